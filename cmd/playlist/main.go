@@ -0,0 +1,166 @@
+// Command playlist exports playlists to m3u8, xspf or json files and imports such files,
+// it is run from the root of the repository so the server config is found.
+//
+//	go run ./cmd/playlist export -id <playlist id> -format m3u8 [-market VN] -o chill.m3u8
+//	go run ./cmd/playlist import -user <user id> -file chill.m3u8 [-name <name>] [-visibility private] [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"flotify/internal/database"
+	"flotify/internal/model"
+	"flotify/internal/playlistfile"
+	"flotify/internal/repository"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = export(os.Args[2:])
+	case "import":
+		err = load(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: playlist export -id <playlist id> [-format m3u8|xspf|json] [-market country] [-o file]")
+	fmt.Fprintln(os.Stderr, "       playlist import -user <user id> -file <file> [-format m3u8|xspf|json] [-name name] [-visibility public|unlisted|private] [-dry-run]")
+	os.Exit(2)
+}
+
+func export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	id_string_form := flags.String("id", "", "playlist id")
+	format_string_form := flags.String("format", "", "m3u8, xspf or json, guessed from the output file when omitted")
+	output := flags.String("o", "", "output file, standard output when omitted")
+	market := flags.String("market", "", "country the tracks are relinked for, every market when omitted")
+	flags.Parse(args)
+
+	id, err := uuid.FromString(*id_string_form)
+	if err != nil {
+		return fmt.Errorf("invalid playlist id: %w", err)
+	}
+
+	format, err := fileFormat(*format_string_form, *output)
+	if err != nil {
+		return err
+	}
+	if *market != "" {
+		if *market, err = repository.NormalizeMarket(*market); err != nil {
+			return err
+		}
+	}
+
+	dbpool := database.GetDatabasePool()
+	defer dbpool.Close()
+
+	playlist_repo := repository.NewPostgresPlaylistRepository(dbpool)
+	// unreleased tracks are left out as for anonymous listeners
+	file, err := playlist_repo.ExportPlaylist(context.Background(), id, uuid.Nil, *market)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		output_file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer output_file.Close()
+		w = output_file
+	}
+
+	return playlistfile.Encode(w, format, *file)
+}
+
+func load(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	user_id_string_form := flags.String("user", "", "id of the user owning the imported playlist")
+	input := flags.String("file", "", "playlist file")
+	format_string_form := flags.String("format", "", "m3u8, xspf or json, guessed from the file when omitted")
+	name := flags.String("name", "", "name of the playlist, taken from the file when omitted")
+	visibility := flags.String("visibility", "", "public, unlisted or private")
+	dry_run := flags.Bool("dry-run", false, "only report which entries match catalog tracks")
+	flags.Parse(args)
+
+	user_id, err := uuid.FromString(*user_id_string_form)
+	if err != nil {
+		return fmt.Errorf("invalid user id: %w", err)
+	}
+
+	format, err := fileFormat(*format_string_form, *input)
+	if err != nil {
+		return err
+	}
+
+	input_file, err := os.Open(*input)
+	if err != nil {
+		return err
+	}
+	defer input_file.Close()
+
+	file, err := playlistfile.Decode(input_file, format)
+	if err != nil {
+		return err
+	}
+
+	playlist := model.Playlist{
+		Name:       *name,
+		UserID:     user_id,
+		Visibility: model.PlaylistVisibility(*visibility),
+	}
+	if playlist.Name == "" {
+		playlist.Name = file.Name
+	}
+	if playlist.Name == "" {
+		playlist.Name = strings.TrimSuffix(filepath.Base(*input), filepath.Ext(*input))
+	}
+
+	dbpool := database.GetDatabasePool()
+	defer dbpool.Close()
+
+	playlist_repo := repository.NewPostgresPlaylistRepository(dbpool)
+	report, err := playlist_repo.ImportPlaylist(context.Background(), playlist, file.Entries, *dry_run)
+	if err != nil {
+		return err
+	}
+
+	if report.Playlist != nil {
+		fmt.Printf("created playlist %s %q\n", report.Playlist.ID, report.Playlist.Name)
+	}
+	fmt.Printf("matched %d of %d entries\n", report.Matched, len(file.Entries))
+	for _, entry := range report.Unmatched {
+		fmt.Printf("unmatched line %d: %s - %s (%ds) %s\n", entry.Line, entry.Artist, entry.Title, entry.Length, entry.Location)
+	}
+	return nil
+}
+
+func fileFormat(format_string_form string, filename string) (playlistfile.Format, error) {
+	if format_string_form != "" {
+		return playlistfile.ParseFormat(format_string_form)
+	}
+	if filename == "" {
+		return playlistfile.JSON, nil
+	}
+	return playlistfile.FormatOfFile(filename)
+}
@@ -0,0 +1,84 @@
+// Command waveform draws the waveform of audio that has none, uploaded before waveforms were drawn
+// or before its codec was analyzed. It is run from the root of the repository so the server config is found.
+//
+//	go run ./cmd/waveform [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"flotify/internal/audio"
+	"flotify/internal/config"
+	"flotify/internal/database"
+	"flotify/internal/repository"
+	"flotify/internal/storage"
+	"fmt"
+	"os"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+func main() {
+	dry_run := flag.Bool("dry-run", false, "only report which tracks have no waveform")
+	flag.Parse()
+
+	dbpool := database.GetDatabasePool()
+	defer dbpool.Close()
+
+	track_repo := repository.NewPostgresTrackRepository(dbpool)
+	file_storage := storage.NewLocalStorage(config.LoadStorageConfig().Dir)
+
+	id_list, err := track_repo.GetTracksWithoutWaveform(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	drawn, failed := 0, 0
+	for _, id := range id_list {
+		if *dry_run {
+			fmt.Println(id)
+			continue
+		}
+		// audio that can't be analyzed is reported and left without a waveform, the next run tries it again
+		if err := draw(track_repo, file_storage, id); err != nil {
+			fmt.Fprintf(os.Stderr, "track %s: %v\n", id, err)
+			failed++
+			continue
+		}
+		drawn++
+	}
+
+	fmt.Printf("%d tracks without waveform, drew %d, failed %d\n", len(id_list), drawn, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// draw analyzes the stored audio of the track and records its waveform
+func draw(track_repo repository.TrackRepository, file_storage storage.Storage, id uuid.UUID) error {
+	track_audio, err := track_repo.GetAudioOfTrack(context.Background(), id)
+	if err != nil {
+		return err
+	}
+
+	file, err := file_storage.Open(context.Background(), track_audio.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := audio.Probe(file, track_audio.Size)
+	if err != nil {
+		return err
+	}
+	analysis, err := audio.Analyze(file, *info, track_audio.Size)
+	if err != nil {
+		return err
+	}
+	if len(analysis.Waveform) == 0 {
+		return fmt.Errorf("the audio holds no frames")
+	}
+
+	return track_repo.SetWaveformOfTrack(context.Background(), id, track_audio.Checksum, analysis.Waveform)
+}
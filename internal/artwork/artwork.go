@@ -0,0 +1,229 @@
+// Package artwork validates uploaded cover and artist images, resizes them and generates the covers of playlists without one
+package artwork
+
+import (
+	"bufio"
+	"bytes"
+	"flotify/internal/custom_error"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+const (
+	// CoverSize is the width and height of stored covers
+	CoverSize = 640
+	// MaxUploadSize is the largest image file accepted
+	MaxUploadSize = 10 << 20
+	// maxDimension bounds width and height of an upload so decoding can't exhaust memory
+	maxDimension = 6000
+	jpegQuality  = 90
+	// BannerAspect is the ratio of the width to the height banners are cropped to
+	BannerAspect = 3
+)
+
+// ImageSizes are the widths artist images are stored at, the largest first
+var ImageSizes = []int{CoverSize, 300, 64}
+
+// Decode reads a JPEG or PNG image, anything else is rejected with custom_error.InvalidImageError
+func Decode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxUploadSize {
+		return nil, custom_error.InvalidImageError{Reason: fmt.Sprintf("file is larger than %d bytes", MaxUploadSize)}
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, custom_error.InvalidImageError{Reason: "only jpeg and png images are accepted"}
+	}
+	if format != "jpeg" && format != "png" {
+		return nil, custom_error.InvalidImageError{Reason: "only jpeg and png images are accepted"}
+	}
+	if config.Width == 0 || config.Height == 0 || config.Width > maxDimension || config.Height > maxDimension {
+		return nil, custom_error.InvalidImageError{Reason: fmt.Sprintf("width and height must be between 1 and %d pixels", maxDimension)}
+	}
+
+	var img image.Image
+	if format == "jpeg" {
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	} else {
+		img, err = png.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, custom_error.InvalidImageError{Reason: err.Error()}
+	}
+	return img, nil
+}
+
+// Encode writes the image as a JPEG, the format every stored cover uses
+func Encode(w io.Writer, img image.Image) error {
+	bw := bufio.NewWriter(w)
+	if err := jpeg.Encode(bw, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Square crops the center square of the image and scales it to size x size
+func Square(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+	return Resize(img, crop, size, size)
+}
+
+// Banner crops the widest center part of the image with the BannerAspect ratio and scales it to width
+func Banner(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	crop_width, crop_height := bounds.Dx(), bounds.Dx()/BannerAspect
+	if crop_height > bounds.Dy() || crop_height == 0 {
+		crop_width, crop_height = min(bounds.Dy()*BannerAspect, bounds.Dx()), bounds.Dy()
+	}
+	crop := image.Rect(0, 0, crop_width, crop_height).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-crop_width)/2,
+		bounds.Min.Y+(bounds.Dy()-crop_height)/2,
+	))
+	return Resize(img, crop, width, max(width/BannerAspect, 1))
+}
+
+// Resize scales the src part of the image to width x height. Every destination pixel is the average of the
+// source pixels it covers, which keeps downscaled covers smooth, upscaling repeats source pixels
+func Resize(img image.Image, src image.Rectangle, width, height int) *image.RGBA {
+	source := image.NewRGBA(image.Rect(0, 0, src.Dx(), src.Dy()))
+	draw.Draw(source, source.Bounds(), img, src.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	sw, sh := src.Dx(), src.Dy()
+	for y := 0; y < height; y++ {
+		y0 := y * sh / height
+		y1 := max((y+1)*sh/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := x * sw / width
+			x1 := max((x+1)*sw/width, x0+1)
+
+			var r, g, b, a, count uint32
+			for sy := y0; sy < y1; sy++ {
+				offset := source.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(source.Pix[offset])
+					g += uint32(source.Pix[offset+1])
+					b += uint32(source.Pix[offset+2])
+					a += uint32(source.Pix[offset+3])
+					count++
+					offset += 4
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / count)
+			dst.Pix[offset+1] = uint8(g / count)
+			dst.Pix[offset+2] = uint8(b / count)
+			dst.Pix[offset+3] = uint8(a / count)
+		}
+	}
+	return dst
+}
+
+// Mosaic lays out the first four tiles in a 2x2 grid of size x size,
+// with less than four tiles the first one fills the whole cover
+func Mosaic(tiles []image.Image, size int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	if len(tiles) == 0 {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.RGBA{R: 40, G: 40, B: 40, A: 255}), image.Point{}, draw.Src)
+		return dst
+	}
+	if len(tiles) < 4 {
+		draw.Draw(dst, dst.Bounds(), Square(tiles[0], size), image.Point{}, draw.Src)
+		return dst
+	}
+
+	half := size / 2
+	for i, tile := range tiles[:4] {
+		cell := image.Rect(0, 0, half, half).Add(image.Pt((i%2)*half, (i/2)*half))
+		if i%2 == 1 {
+			cell.Max.X = size
+		}
+		if i/2 == 1 {
+			cell.Max.Y = size
+		}
+		draw.Draw(dst, cell, Square(tile, cell.Dx()), image.Point{}, draw.Src)
+	}
+	return dst
+}
+
+// Placeholder is a two color gradient derived from seed, standing in for missing artwork
+// so that every artist or album still gets a recognizable tile
+func Placeholder(seed []byte, size int) image.Image {
+	var hash uint32 = 2166136261
+	for _, b := range seed {
+		hash ^= uint32(b)
+		hash *= 16777619
+	}
+	from := hueColor(float64(hash%360), 0.55, 0.45)
+	to := hueColor(float64((hash/360)%360), 0.55, 0.25)
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			t := float64(x+y) / float64(2*size)
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = mix(from.R, to.R, t)
+			dst.Pix[offset+1] = mix(from.G, to.G, t)
+			dst.Pix[offset+2] = mix(from.B, to.B, t)
+			dst.Pix[offset+3] = 255
+		}
+	}
+	return dst
+}
+
+func mix(a, b uint8, t float64) uint8 {
+	return uint8(float64(a)*(1-t) + float64(b)*t)
+}
+
+// hueColor converts a color given as hue (degrees), saturation and lightness to rgb
+func hueColor(hue, saturation, lightness float64) color.RGBA {
+	chroma := (1 - abs(2*lightness-1)) * saturation
+	segment := hue / 60
+	x := chroma * (1 - abs(segment-2*float64(int(segment/2))-1))
+
+	var r, g, b float64
+	switch int(segment) {
+	case 0:
+		r, g = chroma, x
+	case 1:
+		r, g = x, chroma
+	case 2:
+		g, b = chroma, x
+	case 3:
+		g, b = x, chroma
+	case 4:
+		r, b = x, chroma
+	default:
+		r, b = chroma, x
+	}
+
+	m := lightness - chroma/2
+	return color.RGBA{
+		R: uint8((r + m) * 255),
+		G: uint8((g + m) * 255),
+		B: uint8((b + m) * 255),
+		A: 255,
+	}
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
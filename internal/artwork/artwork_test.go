@@ -0,0 +1,150 @@
+package artwork
+
+import (
+	"bytes"
+	"errors"
+	"flotify/internal/custom_error"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+var (
+	red   = color.RGBA{R: 255, A: 255}
+	green = color.RGBA{G: 255, A: 255}
+	blue  = color.RGBA{B: 255, A: 255}
+)
+
+// stripes returns a width x height image split in three equal stripes, vertical ones side by side
+// or horizontal ones stacked, colored red, green and blue
+func stripes(width, height int, vertical bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i, stripe_color := range []color.RGBA{red, green, blue} {
+		stripe := image.Rect(i*width/3, 0, (i+1)*width/3, height)
+		if !vertical {
+			stripe = image.Rect(0, i*height/3, width, (i+1)*height/3)
+		}
+		draw.Draw(img, stripe, image.NewUniform(stripe_color), image.Point{}, draw.Src)
+	}
+	return img
+}
+
+// uniform checks every pixel of img has the color
+func uniform(t *testing.T, img image.Image, want color.RGBA) {
+	t.Helper()
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if got := color.RGBAModel.Convert(img.At(x, y)); got != want {
+				t.Fatalf("pixel %d,%d = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestSquare(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+		size int
+	}{
+		{name: "wide image keeps its center", img: stripes(300, 100, true), size: 50},
+		{name: "tall image keeps its center", img: stripes(100, 300, false), size: 50},
+		{name: "square image is only scaled", img: stripes(99, 99, true).SubImage(image.Rect(33, 0, 66, 33)), size: 8},
+		{name: "upscaled", img: stripes(30, 10, true), size: 64},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Square(test.img, test.size)
+			if size := got.Bounds().Size(); size != image.Pt(test.size, test.size) {
+				t.Fatalf("size = %v, want %dx%d", size, test.size, test.size)
+			}
+			uniform(t, got, green)
+		})
+	}
+}
+
+func TestBanner(t *testing.T) {
+	tests := []struct {
+		name  string
+		img   image.Image
+		width int
+	}{
+		// a 300 x 300 image is cropped to its middle 300 x 100 stripe
+		{name: "tall image keeps its center", img: stripes(300, 300, false), width: 90},
+		// a 900 x 100 image is cropped to its middle 300 x 100
+		{name: "wide image keeps its center", img: stripes(900, 100, true), width: 90},
+		{name: "offset bounds", img: stripes(900, 300, false).SubImage(image.Rect(300, 0, 600, 300)), width: 30},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Banner(test.img, test.width)
+			if size := got.Bounds().Size(); size != image.Pt(test.width, test.width/BannerAspect) {
+				t.Fatalf("size = %v, want %dx%d", size, test.width, test.width/BannerAspect)
+			}
+			uniform(t, got, green)
+		})
+	}
+
+	// images too thin to be cropped still give a banner at least a pixel high
+	if size := Banner(stripes(3, 1, true), 2).Bounds().Size(); size != image.Pt(2, 1) {
+		t.Errorf("size = %v, want 2x1", size)
+	}
+}
+
+func TestResizeAverages(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.RGBA{R: 200, A: 255})
+	img.Set(1, 0, color.RGBA{R: 100, A: 255})
+	img.Set(0, 1, color.RGBA{G: 40, A: 255})
+	img.Set(1, 1, color.RGBA{G: 20, A: 255})
+
+	uniform(t, Resize(img, img.Bounds(), 1, 1), color.RGBA{R: 75, G: 15, A: 255})
+}
+
+func TestDecode(t *testing.T) {
+	encode := func(width, height int, as_gif bool) []byte {
+		var buffer bytes.Buffer
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		if as_gif {
+			gif.Encode(&buffer, img, nil)
+		} else {
+			png.Encode(&buffer, img)
+		}
+		return buffer.Bytes()
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		invalid bool
+	}{
+		{name: "png", data: encode(20, 10, false)},
+		{name: "gif", data: encode(20, 10, true), invalid: true},
+		{name: "not an image", data: []byte("hello"), invalid: true},
+		{name: "too wide", data: encode(maxDimension+1, 1, false), invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := Decode(bytes.NewReader(test.data))
+			if test.invalid {
+				if !errors.As(err, &custom_error.InvalidImageError{}) {
+					t.Errorf("Decode() error = %v, want InvalidImageError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if size := img.Bounds().Size(); size != image.Pt(20, 10) {
+				t.Errorf("size = %v, want 20x10", size)
+			}
+		})
+	}
+}
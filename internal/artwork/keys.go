@@ -0,0 +1,46 @@
+package artwork
+
+import (
+	"context"
+	"flotify/internal/storage"
+	"image"
+	"strconv"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// PlaylistCoverKey is the storage key of the cover uploaded for a playlist
+func PlaylistCoverKey(playlist_id uuid.UUID) string {
+	return "playlists/" + playlist_id.String() + "/cover.jpg"
+}
+
+// AlbumCoverKey is the storage key of the cover uploaded for an album
+func AlbumCoverKey(album_id uuid.UUID) string {
+	return "albums/" + album_id.String() + "/cover.jpg"
+}
+
+// TrackArtworkKey is the storage key of the artwork embedded in the audio of a track, keyed like the audio by its checksum
+func TrackArtworkKey(track_id uuid.UUID, checksum string) string {
+	return "tracks/" + track_id.String() + "/artwork-" + checksum + ".jpg"
+}
+
+// ArtistImageKey is the storage key of the avatar or the banner of an artist resized to width
+func ArtistImageKey(artist_id uuid.UUID, kind string, width int) string {
+	return "artists/" + artist_id.String() + "/" + kind + "_" + strconv.Itoa(width) + ".jpg"
+}
+
+// LoadTile reads the artwork stored under key, falling back to a placeholder derived from id
+// when there is none or it can't be decoded
+func LoadTile(ctx context.Context, store storage.Storage, key string, id uuid.UUID) image.Image {
+	file, err := store.Open(ctx, key)
+	if err != nil {
+		return Placeholder(id.Bytes(), CoverSize/2)
+	}
+	defer file.Close()
+
+	img, err := Decode(file)
+	if err != nil {
+		return Placeholder(id.Bytes(), CoverSize/2)
+	}
+	return img
+}
@@ -0,0 +1,120 @@
+// Package audio recognizes uploaded audio files, reads the technical information of their stream and decodes WAV, FLAC and ogg flac to measure them
+package audio
+
+import (
+	"bytes"
+	"flotify/internal/custom_error"
+	"io"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+type Format string
+
+const (
+	MP3  Format = "mp3"
+	FLAC Format = "flac"
+	OGG  Format = "ogg"
+	WAV  Format = "wav"
+)
+
+// SniffLength is the number of leading bytes Sniff needs
+const SniffLength = 16
+
+// Info describes the audio stream of a file, fields the container doesn't tell are left zero
+type Info struct {
+	Format     Format
+	Codec      string
+	Bitrate    int
+	SampleRate int
+	Channels   int
+	Duration   time.Duration
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case MP3:
+		return "audio/mpeg"
+	case FLAC:
+		return "audio/flac"
+	case OGG:
+		return "audio/ogg"
+	case WAV:
+		return "audio/wav"
+	}
+	return "application/octet-stream"
+}
+
+// Sniff recognizes the container from the first bytes of a file, the content type sent by clients is not trusted
+func Sniff(header []byte) (Format, error) {
+	switch {
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return FLAC, nil
+	case bytes.HasPrefix(header, []byte("OggS")):
+		return OGG, nil
+	case len(header) >= 12 && bytes.HasPrefix(header, []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WAVE")):
+		return WAV, nil
+	case bytes.HasPrefix(header, []byte("ID3")):
+		return MP3, nil
+	case len(header) >= 4 && isMP3FrameHeader(header):
+		return MP3, nil
+	}
+	return "", custom_error.UnsupportedAudioFormatError{}
+}
+
+// Probe reads the stream information of a file of the given size
+func Probe(r io.ReadSeeker, size int64) (*Info, error) {
+	header := make([]byte, SniffLength)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, custom_error.InvalidAudioError{Reason: "file is too short"}
+	}
+
+	format, err := Sniff(header[:n])
+	if err != nil {
+		return nil, err
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var info *Info
+	switch format {
+	case MP3:
+		info, err = probeMP3(r, size)
+	case FLAC:
+		info, err = probeFLAC(r, size)
+	case OGG:
+		info, err = probeOGG(r, size)
+	case WAV:
+		info, err = probeWAV(r, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info.Format = format
+	if info.Bitrate == 0 && info.Duration > 0 {
+		info.Bitrate = int(float64(size*8) / info.Duration.Seconds())
+	}
+	return info, nil
+}
+
+// samplesToDuration converts a number of samples at the sample rate to a duration
+func samplesToDuration(samples uint64, sample_rate int) time.Duration {
+	if sample_rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(samples) / float64(sample_rate) * float64(time.Second))
+}
+
+func invalid(reason string) error {
+	return custom_error.InvalidAudioError{Reason: reason}
+}
+
+// TrackAudioKey is the storage key of the audio file uploaded for a track, each upload gets its own key from its checksum
+// so the stored file is only replaced once the track points to the new one
+func TrackAudioKey(track_id uuid.UUID, checksum string, format Format) string {
+	return "tracks/" + track_id.String() + "/audio-" + checksum + "." + string(format)
+}
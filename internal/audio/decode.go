@@ -0,0 +1,70 @@
+package audio
+
+import (
+	"flotify/internal/custom_error"
+	"io"
+)
+
+// SampleFunc receives a block of decoded samples, one slice per channel with values in [-1, 1].
+// The slices are reused once it returns
+type SampleFunc func(samples [][]float64) error
+
+// Analysis is what decoding a stream tells about it
+type Analysis struct {
+	// Loudness is nil when the stream is too quiet to be measured
+	Loudness *Loudness
+	// Waveform holds the lowest and the highest sample of each point, see WaveformPoints
+	Waveform [][2]float64
+}
+
+// Analyze decodes the WAV, FLAC or ogg flac file described by info once to measure its loudness and draw its waveform.
+// MP3, vorbis and opus files aren't decoded, their loudness is left nil and their waveform is estimated
+// from their frames, see EstimatedWaveform
+func Analyze(r io.ReadSeeker, info Info, size int64) (*Analysis, error) {
+	if EstimatedWaveform(info.Codec) {
+		waveform, err := estimateWaveform(r, info)
+		if err != nil {
+			return nil, err
+		}
+		return &Analysis{Waveform: waveform}, nil
+	}
+	if info.SampleRate <= 0 || info.Channels <= 0 {
+		return nil, invalid("unknown sample rate or channels")
+	}
+
+	meter := newLoudnessMeter(info.SampleRate, info.Channels)
+	waveform := waveformBuilder{}
+	err := Decode(r, info.Format, size, func(samples [][]float64) error {
+		if err := meter.write(samples); err != nil {
+			return err
+		}
+		return waveform.write(samples)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	analysis := Analysis{Waveform: waveform.result()}
+	if loudness := meter.result(); !loudness.Silent() {
+		analysis.Loudness = loudness
+	}
+	return &analysis, nil
+}
+
+// Decode decodes the PCM stream of a WAV, FLAC or ogg flac file of the given size and hands it to fn block after block,
+// the lossy codecs aren't decoded and return custom_error.UnsupportedAudioFormatError
+func Decode(r io.ReadSeeker, format Format, size int64, fn SampleFunc) error {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	switch format {
+	case WAV:
+		return decodeWAV(r, size, fn)
+	case FLAC:
+		return decodeFLAC(r, fn)
+	case OGG:
+		return decodeOGG(r, fn)
+	}
+	return custom_error.UnsupportedAudioFormatError{}
+}
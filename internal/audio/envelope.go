@@ -0,0 +1,78 @@
+package audio
+
+import (
+	"flotify/internal/custom_error"
+	"io"
+	"math"
+)
+
+// envelope collects the levels of consecutive slices of a stream which isn't decoded, MP3 granules or ogg packets.
+// Levels are relative to each other, the loudest slice is drawn at full scale
+type envelope struct {
+	levels []float64
+}
+
+func (e *envelope) add(level float64) {
+	e.levels = append(e.levels, level)
+}
+
+// result merges the levels into at most WaveformPoints symmetric points scaled to the loudest slice,
+// the values are rounded to the thousandth
+func (e *envelope) result() [][2]float64 {
+	loudest := 0.0
+	for _, level := range e.levels {
+		loudest = max(loudest, level)
+	}
+
+	points := min(len(e.levels), WaveformPoints)
+	peaks := make([][2]float64, points)
+	if loudest == 0 {
+		return peaks
+	}
+	for point := range peaks {
+		start, end := point*len(e.levels)/points, (point+1)*len(e.levels)/points
+		level := 0.0
+		for _, slice_level := range e.levels[start:end] {
+			level = max(level, slice_level)
+		}
+		// silent points stay at zero rather than a negative zero
+		if value := math.Round(level/loudest*1000) / 1000; value > 0 {
+			peaks[point] = [2]float64{-value, value}
+		}
+	}
+	return peaks
+}
+
+// EstimatedWaveform reports whether the waveform of audio of the codec is estimated from its frames,
+// the lossy codecs aren't decoded
+func EstimatedWaveform(codec string) bool {
+	switch codec {
+	case "mp3", "vorbis", "opus":
+		return true
+	}
+	return false
+}
+
+// estimateWaveform draws the envelope of a lossy stream without decoding it. MP3 levels follow the global gain
+// of each granule, which tracks the loudness of the music but not its exact peaks, and vorbis and opus levels
+// follow the bitrate of each packet, which is only meaningful for variable bitrate streams: constant bitrate
+// ones draw a flat line. Layer I and II MP3 return custom_error.UnsupportedAudioFormatError
+func estimateWaveform(r io.ReadSeeker, info Info) ([][2]float64, error) {
+	levels := envelope{}
+	switch info.Codec {
+	case "mp3":
+		if err := mp3Envelope(r, &levels); err != nil {
+			return nil, err
+		}
+	case "vorbis", "opus":
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err := oggEnvelope(r, &levels); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, custom_error.UnsupportedAudioFormatError{}
+	}
+	return levels.result(), nil
+}
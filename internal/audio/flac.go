@@ -0,0 +1,549 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math/bits"
+)
+
+const flacStreamInfo = 0
+
+func probeFLAC(r io.ReadSeeker, size int64) (*Info, error) {
+	// "fLaC" followed by the metadata block header, STREAMINFO is always the first block
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, invalid("file is too short")
+	}
+	if header[4]&0x7F != flacStreamInfo {
+		return nil, invalid("missing flac STREAMINFO block")
+	}
+
+	stream_info := make([]byte, 34)
+	if _, err := io.ReadFull(r, stream_info); err != nil {
+		return nil, invalid("truncated flac STREAMINFO block")
+	}
+	return parseFLACStreamInfo(stream_info)
+}
+
+// parseFLACStreamInfo reads sample rate (20 bits), channels (3 bits) and total samples (36 bits) packed after the block sizes
+func parseFLACStreamInfo(stream_info []byte) (*Info, error) {
+	if len(stream_info) < 18 {
+		return nil, invalid("truncated flac STREAMINFO block")
+	}
+	packed := binary.BigEndian.Uint64(stream_info[10:18])
+	sample_rate := int(packed >> 44)
+	channels := int((packed>>41)&0x7) + 1
+	samples := packed & 0xFFFFFFFFF
+	if sample_rate == 0 {
+		return nil, invalid("flac sample rate is zero")
+	}
+
+	return &Info{
+		Codec:      "flac",
+		SampleRate: sample_rate,
+		Channels:   channels,
+		Duration:   samplesToDuration(samples, sample_rate),
+	}, nil
+}
+
+// flacBitsPerSample reads the sample size (5 bits) packed between the channels and the total samples of STREAMINFO
+func flacBitsPerSample(stream_info []byte) int {
+	packed := binary.BigEndian.Uint64(stream_info[10:18])
+	return int((packed>>36)&0x1F) + 1
+}
+
+// flacBlockSizes are the block sizes of the frame header codes, 0 is reserved and 6 and 7 are read after the header
+var flacBlockSizes = [16]int{0, 192, 576, 1152, 2304, 4608, 0, 0, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768}
+
+// flacSampleSizes are the sample sizes of the frame header codes, 0 is the one of STREAMINFO and 3 is reserved
+var flacSampleSizes = [8]int{0, 8, 12, 0, 16, 20, 24, 32}
+
+const (
+	flacIndependent = 7
+	flacLeftSide    = 8
+	flacSideRight   = 9
+	flacMidSide     = 10
+)
+
+// decodeFLAC skips the metadata blocks and decodes the frames up to the end of the file,
+// the CRCs aren't checked
+func decodeFLAC(r io.Reader, fn SampleFunc) error {
+	buffered := bufio.NewReaderSize(r, 64<<10)
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(buffered, header); err != nil {
+		return invalid("file is too short")
+	}
+
+	bits_per_sample := 0
+	for last := false; !last; {
+		if _, err := io.ReadFull(buffered, header); err != nil {
+			return invalid("truncated flac metadata block")
+		}
+		last = header[0]&0x80 != 0
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		if header[0]&0x7F == flacStreamInfo {
+			if length < 34 {
+				return invalid("truncated flac STREAMINFO block")
+			}
+			stream_info := make([]byte, length)
+			if _, err := io.ReadFull(buffered, stream_info); err != nil {
+				return invalid("truncated flac STREAMINFO block")
+			}
+			bits_per_sample = flacBitsPerSample(stream_info)
+			continue
+		}
+		if _, err := buffered.Discard(length); err != nil {
+			return invalid("truncated flac metadata block")
+		}
+	}
+	if bits_per_sample == 0 {
+		return invalid("missing flac STREAMINFO block")
+	}
+
+	decoder := flacDecoder{bits: &bitReader{r: buffered}, bitsPerSample: bits_per_sample}
+	for {
+		if _, err := buffered.Peek(1); err == io.EOF {
+			return nil
+		}
+		samples, err := decoder.frame()
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return invalid("truncated flac frame")
+			}
+			return err
+		}
+		if err := fn(samples); err != nil {
+			return err
+		}
+	}
+}
+
+// flacDecoder decodes frames one after another, reusing its buffers
+type flacDecoder struct {
+	bits          *bitReader
+	bitsPerSample int
+	channels      [][]int64
+	samples       [][]float64
+}
+
+// frame decodes the next frame, bits is at its start
+func (d *flacDecoder) frame() ([][]float64, error) {
+	b := d.bits
+	sync, err := b.read(14)
+	if err != nil {
+		return nil, err
+	}
+	if sync != 0x3FFE {
+		return nil, invalid("lost flac frame sync")
+	}
+	// reserved bit and blocking strategy
+	if _, err = b.read(2); err != nil {
+		return nil, err
+	}
+	block_size_code, err := b.read(4)
+	if err != nil {
+		return nil, err
+	}
+	sample_rate_code, err := b.read(4)
+	if err != nil {
+		return nil, err
+	}
+	assignment, err := b.read(4)
+	if err != nil {
+		return nil, err
+	}
+	sample_size_code, err := b.read(3)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = b.read(1); err != nil {
+		return nil, err
+	}
+
+	// frame or sample number, UTF-8 coded: the leading ones of the first byte count the bytes
+	first, err := b.read(8)
+	if err != nil {
+		return nil, err
+	}
+	for mask := uint64(0x80); first&mask != 0 && mask > 0x01; mask >>= 1 {
+		if mask != 0x80 {
+			if _, err = b.read(8); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	block_size := flacBlockSizes[block_size_code]
+	switch block_size_code {
+	case 0:
+		return nil, invalid("reserved flac block size")
+	case 6, 7:
+		extra, err := b.read(uint(8 * (block_size_code - 5)))
+		if err != nil {
+			return nil, err
+		}
+		block_size = int(extra) + 1
+	}
+	switch sample_rate_code {
+	case 12:
+		_, err = b.read(8)
+	case 13, 14:
+		_, err = b.read(16)
+	case 15:
+		return nil, invalid("invalid flac sample rate")
+	}
+	if err != nil {
+		return nil, err
+	}
+	// CRC-8 of the header
+	if _, err = b.read(8); err != nil {
+		return nil, err
+	}
+
+	bits_per_sample := flacSampleSizes[sample_size_code]
+	if sample_size_code == 0 {
+		bits_per_sample = d.bitsPerSample
+	}
+	if bits_per_sample == 0 {
+		return nil, invalid("reserved flac sample size")
+	}
+
+	channel_count := int(assignment) + 1
+	if assignment > flacIndependent {
+		if assignment > flacMidSide {
+			return nil, invalid("reserved flac channel assignment")
+		}
+		channel_count = 2
+	}
+	d.resize(channel_count, block_size)
+
+	for channel := 0; channel < channel_count; channel++ {
+		// the side channel takes one more bit
+		subframe_bits := bits_per_sample
+		if (assignment == flacLeftSide || assignment == flacMidSide) && channel == 1 || assignment == flacSideRight && channel == 0 {
+			subframe_bits++
+		}
+		if err := d.subframe(d.channels[channel][:block_size], subframe_bits); err != nil {
+			return nil, err
+		}
+	}
+
+	// CRC-16 of the frame, after the padding to the byte
+	b.align()
+	if _, err = b.read(16); err != nil {
+		return nil, err
+	}
+
+	if assignment > flacIndependent {
+		left, right := d.channels[0][:block_size], d.channels[1][:block_size]
+		for i := range left {
+			switch assignment {
+			case flacLeftSide:
+				right[i] = left[i] - right[i]
+			case flacSideRight:
+				left[i] += right[i]
+			case flacMidSide:
+				mid := left[i]<<1 | right[i]&1
+				side := right[i]
+				left[i] = (mid + side) >> 1
+				right[i] = (mid - side) >> 1
+			}
+		}
+	}
+
+	scale := float64(int64(1) << (bits_per_sample - 1))
+	for channel := range d.samples {
+		d.samples[channel] = d.samples[channel][:block_size]
+		for i, sample := range d.channels[channel][:block_size] {
+			d.samples[channel][i] = float64(sample) / scale
+		}
+	}
+	return d.samples, nil
+}
+
+// resize makes room for a frame of block_size samples per channel
+func (d *flacDecoder) resize(channel_count int, block_size int) {
+	if len(d.channels) != channel_count {
+		d.channels = make([][]int64, channel_count)
+		d.samples = make([][]float64, channel_count)
+	}
+	for channel := range d.channels {
+		if cap(d.channels[channel]) < block_size {
+			d.channels[channel] = make([]int64, block_size)
+			d.samples[channel] = make([]float64, block_size)
+		}
+		d.channels[channel] = d.channels[channel][:block_size]
+	}
+}
+
+// subframe decodes the samples of a channel coded with bits_per_sample bits
+func (d *flacDecoder) subframe(samples []int64, bits_per_sample int) error {
+	b := d.bits
+	header, err := b.read(8)
+	if err != nil {
+		return err
+	}
+	if header&0x80 != 0 {
+		return invalid("invalid flac subframe padding")
+	}
+	subframe_type := header >> 1 & 0x3F
+
+	// wasted bits are zero low bits shared by every sample, unary coded
+	wasted := 0
+	if header&1 != 0 {
+		count, err := b.readUnary()
+		if err != nil {
+			return err
+		}
+		wasted = int(count) + 1
+		bits_per_sample -= wasted
+		if bits_per_sample <= 0 {
+			return invalid("invalid flac wasted bits")
+		}
+	}
+
+	switch {
+	case subframe_type == 0:
+		value, err := b.readSigned(uint(bits_per_sample))
+		if err != nil {
+			return err
+		}
+		for i := range samples {
+			samples[i] = value
+		}
+	case subframe_type == 1:
+		for i := range samples {
+			if samples[i], err = b.readSigned(uint(bits_per_sample)); err != nil {
+				return err
+			}
+		}
+	case subframe_type >= 8 && subframe_type <= 12:
+		if err := d.fixed(samples, int(subframe_type-8), bits_per_sample); err != nil {
+			return err
+		}
+	case subframe_type >= 32:
+		if err := d.lpc(samples, int(subframe_type-31), bits_per_sample); err != nil {
+			return err
+		}
+	default:
+		return invalid("reserved flac subframe type")
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= wasted
+		}
+	}
+	return nil
+}
+
+// fixed decodes a subframe predicted by the fixed polynomial of the order
+func (d *flacDecoder) fixed(samples []int64, order int, bits_per_sample int) error {
+	if order > len(samples) {
+		return invalid("flac predictor order exceeds the block size")
+	}
+	for i := 0; i < order; i++ {
+		sample, err := d.bits.readSigned(uint(bits_per_sample))
+		if err != nil {
+			return err
+		}
+		samples[i] = sample
+	}
+	if err := d.residual(samples, order); err != nil {
+		return err
+	}
+
+	for i := order; i < len(samples); i++ {
+		switch order {
+		case 1:
+			samples[i] += samples[i-1]
+		case 2:
+			samples[i] += 2*samples[i-1] - samples[i-2]
+		case 3:
+			samples[i] += 3*samples[i-1] - 3*samples[i-2] + samples[i-3]
+		case 4:
+			samples[i] += 4*samples[i-1] - 6*samples[i-2] + 4*samples[i-3] - samples[i-4]
+		}
+	}
+	return nil
+}
+
+// lpc decodes a subframe predicted by the quantized linear predictive coefficients it carries
+func (d *flacDecoder) lpc(samples []int64, order int, bits_per_sample int) error {
+	b := d.bits
+	if order > len(samples) {
+		return invalid("flac predictor order exceeds the block size")
+	}
+	for i := 0; i < order; i++ {
+		sample, err := b.readSigned(uint(bits_per_sample))
+		if err != nil {
+			return err
+		}
+		samples[i] = sample
+	}
+
+	precision, err := b.read(4)
+	if err != nil {
+		return err
+	}
+	if precision == 0xF {
+		return invalid("invalid flac coefficient precision")
+	}
+	shift, err := b.readSigned(5)
+	if err != nil {
+		return err
+	}
+	if shift < 0 {
+		return invalid("negative flac coefficient shift")
+	}
+	coefficients := make([]int64, order)
+	for i := range coefficients {
+		if coefficients[i], err = b.readSigned(uint(precision + 1)); err != nil {
+			return err
+		}
+	}
+	if err := d.residual(samples, order); err != nil {
+		return err
+	}
+
+	for i := order; i < len(samples); i++ {
+		var prediction int64
+		for j, coefficient := range coefficients {
+			prediction += coefficient * samples[i-1-j]
+		}
+		samples[i] += prediction >> shift
+	}
+	return nil
+}
+
+// residual reads the Rice coded residual into samples after the warm up samples of the predictor
+func (d *flacDecoder) residual(samples []int64, order int) error {
+	b := d.bits
+	method, err := b.read(2)
+	if err != nil {
+		return err
+	}
+	if method > 1 {
+		return invalid("reserved flac residual coding method")
+	}
+	parameter_bits := uint(4 + method)
+	escape := uint64(1)<<parameter_bits - 1
+
+	partition_order, err := b.read(4)
+	if err != nil {
+		return err
+	}
+	partitions := 1 << partition_order
+	if len(samples)%partitions != 0 || len(samples)>>partition_order < order {
+		return invalid("invalid flac residual partition order")
+	}
+
+	i := order
+	for partition := 0; partition < partitions; partition++ {
+		end := (partition + 1) * (len(samples) >> partition_order)
+		parameter, err := b.read(parameter_bits)
+		if err != nil {
+			return err
+		}
+
+		if parameter == escape {
+			raw_bits, err := b.read(5)
+			if err != nil {
+				return err
+			}
+			for ; i < end; i++ {
+				if samples[i], err = b.readSigned(uint(raw_bits)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		for ; i < end; i++ {
+			quotient, err := b.readUnary()
+			if err != nil {
+				return err
+			}
+			remainder, err := b.read(uint(parameter))
+			if err != nil {
+				return err
+			}
+			value := quotient<<parameter | remainder
+			// zigzag: even values are positive, odd ones negative
+			samples[i] = int64(value>>1) ^ -int64(value&1)
+		}
+	}
+	return nil
+}
+
+// bitReader reads big endian bit fields
+type bitReader struct {
+	r     *bufio.Reader
+	cache uint64
+	// n is the number of unread bits, the low bits of cache
+	n uint
+}
+
+func (b *bitReader) fill() error {
+	c, err := b.r.ReadByte()
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	b.cache = b.cache<<8 | uint64(c)
+	b.n += 8
+	return nil
+}
+
+// read returns the next n bits, n is at most 56
+func (b *bitReader) read(n uint) (uint64, error) {
+	for b.n < n {
+		if err := b.fill(); err != nil {
+			return 0, err
+		}
+	}
+	b.n -= n
+	return b.cache >> b.n & (1<<n - 1), nil
+}
+
+// readSigned returns the next n bits as a two's complement number
+func (b *bitReader) readSigned(n uint) (int64, error) {
+	value, err := b.read(n)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	if value&(1<<(n-1)) != 0 {
+		return int64(value) - int64(1)<<n, nil
+	}
+	return int64(value), nil
+}
+
+// readUnary counts the zero bits before the next one bit
+func (b *bitReader) readUnary() (uint64, error) {
+	count := uint64(0)
+	for {
+		if b.n == 0 {
+			if err := b.fill(); err != nil {
+				return 0, err
+			}
+		}
+		unread := b.cache & (1<<b.n - 1)
+		if unread == 0 {
+			count += uint64(b.n)
+			b.n = 0
+			continue
+		}
+		zeros := uint(bits.LeadingZeros64(unread)) - (64 - b.n)
+		count += uint64(zeros)
+		b.n -= zeros + 1
+		return count, nil
+	}
+}
+
+// align drops the bits left in the current byte
+func (b *bitReader) align() {
+	b.n -= b.n % 8
+}
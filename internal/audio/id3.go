@@ -0,0 +1,294 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// id3v1Genres are the genres numbered by ID3v1, ID3v2 genre frames may still refer to them as "(17)" or "17"
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop", "Jazz", "Metal",
+	"New Age", "Oldies", "Other", "Pop", "R&B", "Rap", "Reggae", "Rock", "Techno", "Industrial",
+	"Alternative", "Ska", "Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal", "Jazz+Funk",
+	"Fusion", "Trance", "Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic",
+	"Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream", "Southern Rock", "Comedy", "Cult", "Gangsta",
+	"Top 40", "Christian Rap", "Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave", "Psychadelic", "Rave", "Showtunes",
+	"Trailer", "Lo-Fi", "Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock",
+}
+
+// readID3v2 reads the tag at the start of the file, an empty Tags when there is none.
+// Versions 2.2, 2.3 and 2.4 are understood
+func readID3v2(r io.Reader) (*Tags, error) {
+	tags := &Tags{}
+
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return tags, nil
+	}
+	if !bytes.HasPrefix(header, []byte("ID3")) {
+		return tags, nil
+	}
+	version := header[3]
+	flags := header[5]
+	size := syncsafe(header[6:10])
+	if size > maxTagSize || version < 2 || version > 4 {
+		return tags, nil
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return tags, nil
+	}
+	// before 2.4 unsynchronisation applies to the whole tag
+	if flags&0x80 != 0 && version < 4 {
+		data = bytes.ReplaceAll(data, []byte{0xFF, 0x00}, []byte{0xFF})
+	}
+
+	offset := 0
+	if flags&0x40 != 0 && version > 2 && len(data) >= 4 {
+		if version == 3 {
+			offset = 4 + int(binary.BigEndian.Uint32(data))
+		} else {
+			offset = syncsafe(data[:4])
+		}
+	}
+
+	header_size := 10
+	if version == 2 {
+		header_size = 6
+	}
+	for offset+header_size <= len(data) && data[offset] != 0 {
+		var id string
+		var frame_size int
+		var frame_flags uint16
+		switch version {
+		case 2:
+			id = string(data[offset : offset+3])
+			frame_size = int(data[offset+3])<<16 | int(data[offset+4])<<8 | int(data[offset+5])
+		case 3:
+			id = string(data[offset : offset+4])
+			frame_size = int(binary.BigEndian.Uint32(data[offset+4:]))
+			frame_flags = binary.BigEndian.Uint16(data[offset+8:])
+		default:
+			id = string(data[offset : offset+4])
+			frame_size = syncsafe(data[offset+4 : offset+8])
+			frame_flags = binary.BigEndian.Uint16(data[offset+8:])
+		}
+		offset += header_size
+		if frame_size < 0 || offset+frame_size > len(data) {
+			break
+		}
+		frame := data[offset : offset+frame_size]
+		offset += frame_size
+
+		if skip, body := id3FrameBody(version, frame_flags, frame); !skip {
+			tags.setID3Frame(id, body)
+		}
+	}
+	return tags, nil
+}
+
+// id3FrameBody undoes the per frame encodings of 2.4, compressed and encrypted frames are skipped
+func id3FrameBody(version byte, flags uint16, frame []byte) (bool, []byte) {
+	switch version {
+	case 3:
+		if flags&0x00C0 != 0 {
+			return true, nil
+		}
+	case 4:
+		if flags&0x000C != 0 {
+			return true, nil
+		}
+		if flags&0x0001 != 0 {
+			// data length indicator
+			if len(frame) < 4 {
+				return true, nil
+			}
+			frame = frame[4:]
+		}
+		if flags&0x0002 != 0 {
+			frame = bytes.ReplaceAll(frame, []byte{0xFF, 0x00}, []byte{0xFF})
+		}
+	}
+	return false, frame
+}
+
+func (t *Tags) setID3Frame(id string, body []byte) {
+	switch id {
+	case "TIT2", "TT2":
+		t.Title = firstValue(decodeID3Text(body))
+	case "TPE1", "TP1":
+		t.Artists = decodeID3Text(body)
+	case "TALB", "TAL":
+		t.Album = firstValue(decodeID3Text(body))
+	case "TRCK", "TRK":
+		t.TrackNumber = leadingNumber(firstValue(decodeID3Text(body)))
+	case "TDRC", "TYER", "TYE":
+		t.Year = leadingNumber(firstValue(decodeID3Text(body)))
+	case "TDOR", "TORY", "TOR":
+		if t.Year == 0 {
+			t.Year = leadingNumber(firstValue(decodeID3Text(body)))
+		}
+	case "TCON", "TCO":
+		t.Genre = id3Genre(firstValue(decodeID3Text(body)))
+	case "APIC":
+		// encoding, mime type, picture type, description, data
+		if len(body) < 2 {
+			return
+		}
+		mime_end := bytes.IndexByte(body[1:], 0)
+		if mime_end < 0 || len(body) < mime_end+3 {
+			return
+		}
+		picture_type := int(body[mime_end+2])
+		t.setPicture(picture_type, skipID3String(body[0], body[mime_end+3:]))
+	case "PIC":
+		// encoding, 3 character image format, picture type, description, data
+		if len(body) < 6 {
+			return
+		}
+		t.setPicture(int(body[4]), skipID3String(body[0], body[5:]))
+	}
+}
+
+// decodeID3Text decodes a text frame, 2.4 separates multiple values with a terminator
+func decodeID3Text(body []byte) []string {
+	if len(body) < 2 {
+		return nil
+	}
+
+	var text string
+	encoding, data := body[0], body[1:]
+	switch encoding {
+	case 0:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	case 1, 2:
+		text = decodeUTF16(data, encoding == 2)
+	default:
+		text = string(data)
+	}
+
+	values := []string{}
+	for _, value := range strings.Split(text, "\x00") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// decodeUTF16 decodes text starting with a byte order mark, or big endian text without one
+func decodeUTF16(data []byte, big_endian bool) string {
+	var order binary.ByteOrder = binary.BigEndian
+	if !big_endian && len(data) >= 2 {
+		if data[0] == 0xFF && data[1] == 0xFE {
+			order = binary.LittleEndian
+		}
+		data = data[2:]
+	}
+
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		unit := order.Uint16(data[i:])
+		// a byte order mark repeated before every value of a 2.4 frame
+		if unit == 0xFEFF {
+			continue
+		}
+		units = append(units, unit)
+	}
+	return string(utf16.Decode(units))
+}
+
+// skipID3String skips a terminated string in the given encoding and returns what follows it
+func skipID3String(encoding byte, data []byte) []byte {
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i] == 0 && data[i+1] == 0 {
+				return data[i+2:]
+			}
+		}
+		return nil
+	}
+	end := bytes.IndexByte(data, 0)
+	if end < 0 {
+		return nil
+	}
+	return data[end+1:]
+}
+
+// id3Genre resolves references to ID3v1 genres like "(17)", "(17)Rock" or "17"
+func id3Genre(genre string) string {
+	reference := genre
+	if strings.HasPrefix(genre, "(") {
+		end := strings.IndexByte(genre, ')')
+		if end < 0 {
+			return genre
+		}
+		if rest := strings.TrimSpace(genre[end+1:]); rest != "" {
+			return rest
+		}
+		reference = genre[1:end]
+	}
+
+	index, err := strconv.Atoi(reference)
+	if err != nil {
+		return genre
+	}
+	if index >= 0 && index < len(id3v1Genres) {
+		return id3v1Genres[index]
+	}
+	return ""
+}
+
+// readID3v1 reads the fixed 128 byte tag some mp3 files end with
+func readID3v1(r io.ReadSeeker, size int64) (*Tags, error) {
+	tags := &Tags{}
+	if size < 128 {
+		return tags, nil
+	}
+	if _, err := r.Seek(size-128, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data := make([]byte, 128)
+	if _, err := io.ReadFull(r, data); err != nil || !bytes.HasPrefix(data, []byte("TAG")) {
+		return tags, nil
+	}
+
+	field := func(from, to int) string {
+		return strings.TrimSpace(strings.TrimRight(string(data[from:to]), "\x00"))
+	}
+	tags.Title = field(3, 33)
+	if artist := field(33, 63); artist != "" {
+		tags.Artists = []string{artist}
+	}
+	tags.Album = field(63, 93)
+	tags.Year = leadingNumber(field(93, 97))
+	// ID3v1.1 keeps the track number in the last byte of the comment
+	if data[125] == 0 {
+		tags.TrackNumber = int(data[126])
+	}
+	if int(data[127]) < len(id3v1Genres) {
+		tags.Genre = id3v1Genres[data[127]]
+	}
+	return tags, nil
+}
+
+func syncsafe(data []byte) int {
+	return int(data[0]&0x7F)<<21 | int(data[1]&0x7F)<<14 | int(data[2]&0x7F)<<7 | int(data[3]&0x7F)
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
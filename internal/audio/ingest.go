@@ -0,0 +1,81 @@
+package audio
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flotify/internal/custom_error"
+	"io"
+	"os"
+)
+
+// MaxUploadSize is the largest audio file accepted
+const MaxUploadSize = 500 << 20
+
+// Upload is an audio file spooled to a temporary file, ready to be handed to the storage
+type Upload struct {
+	File     *os.File
+	Size     int64
+	Checksum string
+	Info     Info
+	Tags     Tags
+	// Loudness is only measured for WAV, FLAC and ogg flac files and is nil for silent ones too,
+	// the Waveform of the lossy codecs is estimated and layer I and II MP3 files have none
+	Loudness *Loudness
+	Waveform [][2]float64
+}
+
+// Ingest copies r to a temporary file while hashing it, probes the result, reads its tags and analyzes its audio.
+// The caller must Close the upload
+func Ingest(r io.Reader, max_size int64) (*Upload, error) {
+	file, err := os.CreateTemp("", "flotify-audio-*")
+	if err != nil {
+		return nil, err
+	}
+	upload := &Upload{File: file}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(r, max_size+1))
+	if err != nil {
+		upload.Close()
+		return nil, err
+	}
+	if size > max_size {
+		upload.Close()
+		return nil, custom_error.AudioTooLargeError{Limit: max_size}
+	}
+	upload.Size = size
+	upload.Checksum = hex.EncodeToString(hash.Sum(nil))
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		upload.Close()
+		return nil, err
+	}
+	info, err := Probe(file, size)
+	if err != nil {
+		upload.Close()
+		return nil, err
+	}
+	upload.Info = *info
+
+	// broken tags don't make the audio unusable
+	if tags, err := ReadTags(file, info.Format, size); err == nil {
+		upload.Tags = *tags
+	}
+
+	// audio that can't be decoded is still playable, it just isn't normalized nor drawn
+	if analysis, err := Analyze(file, *info, size); err == nil {
+		upload.Loudness, upload.Waveform = analysis.Loudness, analysis.Waveform
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		upload.Close()
+		return nil, err
+	}
+	return upload, nil
+}
+
+// Close removes the temporary file
+func (u *Upload) Close() error {
+	u.File.Close()
+	return os.Remove(u.File.Name())
+}
@@ -0,0 +1,312 @@
+package audio
+
+import (
+	"math"
+)
+
+const (
+	// ReplayGainReference is the loudness ReplayGain 2.0 brings tracks to, in LUFS
+	ReplayGainReference = -18.0
+	// HistogramStep is the width in LU of the bins of Loudness.Histogram, which starts at the absolute gate
+	HistogramStep = 0.1
+
+	absoluteGate = -70.0
+	relativeGate = -10.0
+	// histogramBins covers the blocks from the absolute gate to +5 LUFS, louder blocks fall in the last bin
+	histogramBins = 750
+)
+
+// Loudness is the loudness of a stream measured following EBU R128 (ITU-R BS.1770-4)
+type Loudness struct {
+	// Integrated is the gated loudness of the whole stream in LUFS, math.Inf(-1) when no block is above the absolute gate
+	Integrated float64
+	// TruePeak is the peak of the stream oversampled 4 times below 96 kHz and twice below 192 kHz, in dBTP
+	TruePeak float64
+	// Histogram counts the 400 ms blocks above the absolute gate by loudness,
+	// the histograms of several tracks gate them together with IntegratedLoudness
+	Histogram []int
+}
+
+// Silent reports whether the stream is too quiet to be measured
+func (l *Loudness) Silent() bool {
+	return math.IsInf(l.Integrated, -1)
+}
+
+// ReplayGain returns the gain in dB bringing the integrated loudness to ReplayGainReference
+func ReplayGain(integrated float64) float64 {
+	return ReplayGainReference - integrated
+}
+
+// IntegratedLoudness gates the blocks of the histograms together, which measures tracks played one after another
+func IntegratedLoudness(histograms ...[]int) float64 {
+	counts := make([]int, histogramBins)
+	for _, histogram := range histograms {
+		for bin, count := range histogram {
+			if bin < histogramBins {
+				counts[bin] += count
+			}
+		}
+	}
+
+	energies := make([]float64, histogramBins)
+	for bin := range energies {
+		energies[bin] = loudnessToEnergy(absoluteGate + (float64(bin)+0.5)*HistogramStep)
+	}
+	return gatedLoudness(energies, counts)
+}
+
+// gatedLoudness applies the absolute then the relative gate to the blocks of the energies, counts weights them
+func gatedLoudness(energies []float64, counts []int) float64 {
+	mean := func(gate float64) float64 {
+		threshold := loudnessToEnergy(gate)
+		sum, total := 0.0, 0
+		for i, energy := range energies {
+			if energy > threshold {
+				sum += energy * float64(counts[i])
+				total += counts[i]
+			}
+		}
+		if total == 0 {
+			return 0
+		}
+		return sum / float64(total)
+	}
+
+	absolute := mean(absoluteGate)
+	if absolute == 0 {
+		return math.Inf(-1)
+	}
+	return energyToLoudness(mean(energyToLoudness(absolute) + relativeGate))
+}
+
+func energyToLoudness(energy float64) float64 {
+	return -0.691 + 10*math.Log10(energy)
+}
+
+func loudnessToEnergy(loudness float64) float64 {
+	return math.Pow(10, (loudness+0.691)/10)
+}
+
+// biquad is a second order IIR filter in transposed direct form II
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns the high shelf and the high pass filters of the K-weighting for the sample rate,
+// their analog prototypes are bilinear transformed so every sample rate gets the response specified at 48 kHz
+func kWeighting(sample_rate int) (biquad, biquad) {
+	k := math.Tan(math.Pi * 1681.974450955533 / float64(sample_rate))
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	k = math.Tan(math.Pi * 38.13547087602444 / float64(sample_rate))
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	highpass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return shelf, highpass
+}
+
+// channelWeights weights the channels in the WAV and FLAC order: front left, front right, center, LFE then surrounds.
+// The LFE is left out and the surround channels count 1.41 times
+func channelWeights(channels int) []float64 {
+	weights := make([]float64, channels)
+	for channel := range weights {
+		switch {
+		case channels <= 3 || channel < 2:
+			weights[channel] = 1
+		case channels == 4:
+			weights[channel] = 1.41
+		case channels == 5 && channel == 2:
+			weights[channel] = 1
+		case channels == 5:
+			weights[channel] = 1.41
+		case channel == 2:
+			weights[channel] = 1
+		case channel == 3:
+			weights[channel] = 0
+		default:
+			weights[channel] = 1.41
+		}
+	}
+	return weights
+}
+
+// loudnessMeter measures the blocks of 400 ms overlapping by 75 %, from the energy of 100 ms sub blocks
+type loudnessMeter struct {
+	weights  []float64
+	shelf    []biquad
+	highpass []biquad
+
+	subBlockLength int
+	subBlockFill   int
+	subBlockSum    float64
+	// subBlocks are the sums of the last 4 sub blocks, a block is measured after each of them
+	subBlocks     [4]float64
+	subBlockCount int
+	energies      []float64
+
+	peak *truePeakMeter
+}
+
+func newLoudnessMeter(sample_rate int, channels int) *loudnessMeter {
+	meter := &loudnessMeter{
+		weights:        channelWeights(channels),
+		shelf:          make([]biquad, channels),
+		highpass:       make([]biquad, channels),
+		subBlockLength: sample_rate / 10,
+		peak:           newTruePeakMeter(sample_rate, channels),
+	}
+	for channel := 0; channel < channels; channel++ {
+		meter.shelf[channel], meter.highpass[channel] = kWeighting(sample_rate)
+	}
+	return meter
+}
+
+// write is the SampleFunc feeding the meter
+func (m *loudnessMeter) write(samples [][]float64) error {
+	if len(samples) != len(m.weights) {
+		return invalid("the number of channels changes within the stream")
+	}
+	m.peak.write(samples)
+
+	for i := range samples[0] {
+		for channel, weight := range m.weights {
+			y := m.highpass[channel].process(m.shelf[channel].process(samples[channel][i]))
+			m.subBlockSum += weight * y * y
+		}
+		m.subBlockFill++
+		if m.subBlockFill == m.subBlockLength {
+			m.subBlocks[m.subBlockCount%4] = m.subBlockSum
+			m.subBlockCount++
+			m.subBlockFill, m.subBlockSum = 0, 0
+			if m.subBlockCount >= 4 {
+				sum := m.subBlocks[0] + m.subBlocks[1] + m.subBlocks[2] + m.subBlocks[3]
+				m.energies = append(m.energies, sum/float64(4*m.subBlockLength))
+			}
+		}
+	}
+	return nil
+}
+
+func (m *loudnessMeter) result() *Loudness {
+	counts := make([]int, len(m.energies))
+	histogram := make([]int, histogramBins)
+	for i, energy := range m.energies {
+		counts[i] = 1
+		loudness := energyToLoudness(energy)
+		if loudness <= absoluteGate {
+			continue
+		}
+		bin := int((loudness - absoluteGate) / HistogramStep)
+		if bin >= histogramBins {
+			bin = histogramBins - 1
+		}
+		histogram[bin]++
+	}
+
+	return &Loudness{
+		Integrated: gatedLoudness(m.energies, counts),
+		TruePeak:   20 * math.Log10(m.peak.max),
+		Histogram:  histogram,
+	}
+}
+
+// truePeakTaps is the number of taps of each phase of the interpolation filter
+const truePeakTaps = 12
+
+// truePeakMeter oversamples the channels with a windowed sinc polyphase filter and keeps the largest absolute value
+type truePeakMeter struct {
+	factor int
+	// phases holds the taps of each phase of the filter, the newest sample first
+	phases [][]float64
+	// history holds the last samples of each channel twice, so the newest truePeakTaps of them are contiguous from position
+	history  [][]float64
+	position int
+	max      float64
+}
+
+func newTruePeakMeter(sample_rate int, channels int) *truePeakMeter {
+	factor := 4
+	switch {
+	case sample_rate >= 192000:
+		factor = 1
+	case sample_rate >= 96000:
+		factor = 2
+	}
+
+	length := truePeakTaps * factor
+	center := float64(length-1) / 2
+	phases := make([][]float64, factor)
+	for phase := range phases {
+		phases[phase] = make([]float64, truePeakTaps)
+		for tap := range phases[phase] {
+			j := phase + tap*factor
+			x := (float64(j) - center) / float64(factor)
+			sinc := 1.0
+			if x != 0 {
+				sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+			}
+			window := 0.5 * (1 - math.Cos(2*math.Pi*(float64(j)+0.5)/float64(length)))
+			phases[phase][tap] = sinc * window
+		}
+	}
+
+	history := make([][]float64, channels)
+	for channel := range history {
+		history[channel] = make([]float64, 2*truePeakTaps)
+	}
+	return &truePeakMeter{factor: factor, phases: phases, history: history}
+}
+
+func (p *truePeakMeter) write(samples [][]float64) {
+	position := p.position
+	for channel, channel_samples := range samples {
+		history := p.history[channel]
+		position = p.position
+		for _, sample := range channel_samples {
+			if math.Abs(sample) > p.max {
+				p.max = math.Abs(sample)
+			}
+			if p.factor == 1 {
+				continue
+			}
+
+			position = (position + truePeakTaps - 1) % truePeakTaps
+			history[position], history[position+truePeakTaps] = sample, sample
+			newest := history[position : position+truePeakTaps]
+			for _, taps := range p.phases {
+				value := 0.0
+				for tap, coefficient := range taps {
+					value += coefficient * newest[tap]
+				}
+				if math.Abs(value) > p.max {
+					p.max = math.Abs(value)
+				}
+			}
+		}
+	}
+	p.position = position
+}
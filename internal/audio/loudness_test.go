@@ -0,0 +1,204 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// testWAV encodes the channels as a 16 bits PCM WAV file
+func testWAV(sample_rate int, channels [][]float64) []byte {
+	frames := len(channels[0])
+	block_align := 2 * len(channels)
+	data := make([]byte, 0, frames*block_align)
+	for frame := 0; frame < frames; frame++ {
+		for _, channel := range channels {
+			sample := int16(math.Round(max(min(channel[frame], 1), -1) * math.MaxInt16))
+			data = binary.LittleEndian.AppendUint16(data, uint16(sample))
+		}
+	}
+
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(36+len(data)))
+	file.WriteString("WAVEfmt ")
+	for _, field := range []any{
+		uint32(16), uint16(wavFormatPCM), uint16(len(channels)), uint32(sample_rate),
+		uint32(sample_rate * block_align), uint16(block_align), uint16(16),
+	} {
+		binary.Write(&file, binary.LittleEndian, field)
+	}
+	file.WriteString("data")
+	binary.Write(&file, binary.LittleEndian, uint32(len(data)))
+	file.Write(data)
+	return file.Bytes()
+}
+
+// sine returns seconds of a sine of the frequency and the amplitude
+func sine(sample_rate int, seconds float64, frequency float64, amplitude float64) []float64 {
+	samples := make([]float64, int(seconds*float64(sample_rate)))
+	for i := range samples {
+		samples[i] = amplitude * math.Sin(2*math.Pi*frequency*float64(i)/float64(sample_rate))
+	}
+	return samples
+}
+
+func analyzeWAV(t *testing.T, file []byte) *Analysis {
+	t.Helper()
+	info, err := Probe(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	analysis, err := Analyze(bytes.NewReader(file), *info, int64(len(file)))
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+	return analysis
+}
+
+func TestAnalyzeLoudness(t *testing.T) {
+	decibels := func(db float64) float64 {
+		return math.Pow(10, db/20)
+	}
+
+	// the stereo sines of EBU Tech 3341 measure their level in LUFS, a 997 Hz sine peaks at its amplitude
+	tests := []struct {
+		name       string
+		sampleRate int
+		channels   [][]float64
+		integrated float64
+		truePeak   float64
+	}{
+		{
+			name:       "stereo sine at -23 dBFS",
+			sampleRate: 48000,
+			channels:   [][]float64{sine(48000, 20, 997, decibels(-23)), sine(48000, 20, 997, decibels(-23))},
+			integrated: -23,
+			truePeak:   -23,
+		},
+		{
+			name:       "stereo sine at -33 dBFS",
+			sampleRate: 48000,
+			channels:   [][]float64{sine(48000, 20, 997, decibels(-33)), sine(48000, 20, 997, decibels(-33))},
+			integrated: -33,
+			truePeak:   -33,
+		},
+		{
+			name:       "mono sine at 44.1 kHz",
+			sampleRate: 44100,
+			channels:   [][]float64{sine(44100, 10, 997, decibels(-6))},
+			integrated: -9.01,
+			truePeak:   -6,
+		},
+		{
+			// the quiet half is more than 10 LU below the loud one and is left out by the relative gate
+			name:       "relative gate",
+			sampleRate: 48000,
+			channels: [][]float64{
+				append(sine(48000, 10, 997, decibels(-20)), sine(48000, 10, 997, decibels(-50))...),
+				append(sine(48000, 10, 997, decibels(-20)), sine(48000, 10, 997, decibels(-50))...),
+			},
+			integrated: -20,
+			truePeak:   -20,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			analysis := analyzeWAV(t, testWAV(test.sampleRate, test.channels))
+			loudness := analysis.Loudness
+			if loudness == nil {
+				t.Fatal("Analyze() loudness = nil")
+			}
+			if math.Abs(loudness.Integrated-test.integrated) > 0.1 {
+				t.Errorf("Integrated = %.2f LUFS, want %.2f", loudness.Integrated, test.integrated)
+			}
+			if math.Abs(loudness.TruePeak-test.truePeak) > 0.1 {
+				t.Errorf("TruePeak = %.2f dBTP, want %.2f", loudness.TruePeak, test.truePeak)
+			}
+			// the histogram keeps the gating within a bin of the measure
+			if histogram := IntegratedLoudness(loudness.Histogram); math.Abs(histogram-loudness.Integrated) > HistogramStep {
+				t.Errorf("IntegratedLoudness(Histogram) = %.2f LUFS, want %.2f", histogram, loudness.Integrated)
+			}
+		})
+	}
+}
+
+func TestAnalyzeSilence(t *testing.T) {
+	analysis := analyzeWAV(t, testWAV(48000, [][]float64{make([]float64, 48000*2)}))
+	if analysis.Loudness != nil {
+		t.Errorf("Analyze() loudness = %+v, want nil", analysis.Loudness)
+	}
+}
+
+func TestIntegratedLoudness(t *testing.T) {
+	bin := func(loudness float64) int {
+		return int((loudness - absoluteGate) / HistogramStep)
+	}
+	histogram := func(counts map[int]int) []int {
+		bins := make([]int, histogramBins)
+		for bin, count := range counts {
+			bins[bin] = count
+		}
+		return bins
+	}
+
+	tests := []struct {
+		name       string
+		histograms [][]int
+		want       float64
+	}{
+		{name: "empty", histograms: [][]int{histogram(nil)}, want: math.Inf(-1)},
+		{name: "single bin", histograms: [][]int{histogram(map[int]int{bin(-14): 10})}, want: -13.95},
+		{
+			// tracks played one after another, the quiet one is gated out by the loud one
+			name: "gated together",
+			histograms: [][]int{
+				histogram(map[int]int{bin(-14): 10}),
+				histogram(map[int]int{bin(-40): 10}),
+			},
+			want: -13.95,
+		},
+		{
+			name: "averaged energies",
+			histograms: [][]int{
+				histogram(map[int]int{bin(-14): 10}),
+				histogram(map[int]int{bin(-17): 10}),
+			},
+			want: -15.20,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := IntegratedLoudness(test.histograms...)
+			if math.IsInf(test.want, -1) {
+				if !math.IsInf(got, -1) {
+					t.Errorf("IntegratedLoudness() = %.2f, want -Inf", got)
+				}
+				return
+			}
+			if math.Abs(got-test.want) > 0.01 {
+				t.Errorf("IntegratedLoudness() = %.2f, want %.2f", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReplayGain(t *testing.T) {
+	tests := []struct {
+		integrated float64
+		want       float64
+	}{
+		{integrated: -18, want: 0},
+		{integrated: -9.5, want: -8.5},
+		{integrated: -23, want: 5},
+	}
+
+	for _, test := range tests {
+		if got := ReplayGain(test.integrated); got != test.want {
+			t.Errorf("ReplayGain(%v) = %v, want %v", test.integrated, got, test.want)
+		}
+	}
+}
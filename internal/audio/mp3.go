@@ -0,0 +1,308 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"flotify/internal/custom_error"
+	"io"
+	"math"
+)
+
+// bitrates of mpeg audio in kbit/s indexed by [mpeg 1 or not][layer-1][bitrate index]
+var mp3Bitrates = [2][3][16]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+}
+
+// sample rates indexed by [version bits][sample rate index], version 1 is reserved
+var mp3SampleRates = [4][3]int{
+	{11025, 12000, 8000},
+	{0, 0, 0},
+	{22050, 24000, 16000},
+	{44100, 48000, 32000},
+}
+
+// mp3Frame is a decoded mpeg audio frame header
+type mp3Frame struct {
+	mpeg1      bool
+	layer      int
+	bitrate    int
+	sampleRate int
+	padding    int
+	mono       bool
+}
+
+func parseMP3Frame(header []byte) (mp3Frame, bool) {
+	if !isMP3FrameHeader(header) {
+		return mp3Frame{}, false
+	}
+
+	version := (header[1] >> 3) & 3
+	layer := 4 - int((header[1]>>1)&3)
+	frame := mp3Frame{
+		mpeg1:      version == 3,
+		layer:      layer,
+		sampleRate: mp3SampleRates[version][(header[2]>>2)&3],
+		padding:    int((header[2] >> 1) & 1),
+		mono:       header[3]>>6 == 3,
+	}
+	table := 1
+	if frame.mpeg1 {
+		table = 0
+	}
+	frame.bitrate = mp3Bitrates[table][layer-1][header[2]>>4] * 1000
+	return frame, true
+}
+
+// isMP3FrameHeader checks the frame sync and rejects reserved or free format values
+func isMP3FrameHeader(header []byte) bool {
+	if len(header) < 4 || header[0] != 0xFF || header[1]&0xE0 != 0xE0 {
+		return false
+	}
+	version := (header[1] >> 3) & 3
+	layer := (header[1] >> 1) & 3
+	bitrate_index := header[2] >> 4
+	sample_rate_index := (header[2] >> 2) & 3
+	return version != 1 && layer != 0 && bitrate_index != 0 && bitrate_index != 15 && sample_rate_index != 3
+}
+
+func (f mp3Frame) samples() int {
+	switch {
+	case f.layer == 1:
+		return 384
+	case f.layer == 3 && !f.mpeg1:
+		return 576
+	}
+	return 1152
+}
+
+func (f mp3Frame) length() int {
+	if f.layer == 1 {
+		return (12*f.bitrate/f.sampleRate + f.padding) * 4
+	}
+	return f.samples()/8*f.bitrate/f.sampleRate + f.padding
+}
+
+// id3v2Size returns the size of the ID3v2 tag at the start of the file, 0 when there is none
+func id3v2Size(header []byte) int64 {
+	if len(header) < 10 || !bytes.HasPrefix(header, []byte("ID3")) {
+		return 0
+	}
+	size := int64(syncsafe(header[6:10])) + 10
+	if header[5]&0x10 != 0 {
+		// footer present
+		size += 10
+	}
+	return size
+}
+
+// mp3SearchLength bounds how far past the tags the first frame is looked for
+const mp3SearchLength = 64 << 10
+
+func probeMP3(r io.ReadSeeker, size int64) (*Info, error) {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, invalid("file is too short")
+	}
+	start := id3v2Size(header)
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	buffer := make([]byte, mp3SearchLength)
+	n, err := io.ReadFull(r, buffer)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, invalid("no mpeg audio frame found")
+	}
+	buffer = buffer[:n]
+
+	offset, frame := findMP3Frame(buffer)
+	if offset < 0 {
+		return nil, invalid("no mpeg audio frame found")
+	}
+
+	info := Info{
+		Codec:      "mp3",
+		Bitrate:    frame.bitrate,
+		SampleRate: frame.sampleRate,
+		Channels:   2,
+	}
+	if frame.mono {
+		info.Channels = 1
+	}
+	if frame.layer != 3 {
+		info.Codec = "mp" + string(rune('0'+frame.layer))
+	}
+
+	audio_size := size - start - int64(offset)
+	if frames, ok := xingFrames(buffer[offset:], frame); ok && frames > 0 {
+		// variable bitrate, the first frame only carries the header with the frame count
+		info.Duration = samplesToDuration(uint64(frames)*uint64(frame.samples()), frame.sampleRate)
+		info.Bitrate = int(float64(audio_size*8) / info.Duration.Seconds())
+	} else if frame.bitrate > 0 {
+		info.Duration = samplesToDuration(uint64(audio_size)*8*uint64(frame.sampleRate)/uint64(frame.bitrate), frame.sampleRate)
+	}
+	return &info, nil
+}
+
+// findMP3Frame returns the offset and the header of the first frame of the buffer, -1 when there is none.
+// A frame only counts when the next one follows right after it, sync bits also show up inside other data
+func findMP3Frame(buffer []byte) (int, mp3Frame) {
+	for i := 0; i+4 <= len(buffer); i++ {
+		candidate, ok := parseMP3Frame(buffer[i:])
+		if !ok {
+			continue
+		}
+		next := i + candidate.length()
+		if next+4 <= len(buffer) {
+			if _, ok := parseMP3Frame(buffer[next:]); !ok {
+				continue
+			}
+		}
+		return i, candidate
+	}
+	return -1, mp3Frame{}
+}
+
+// xingFrames reads the frame count of the Xing or Info header LAME writes in the first frame of vbr files
+func xingFrames(data []byte, frame mp3Frame) (uint32, bool) {
+	side_info := 32
+	switch {
+	case frame.mpeg1 && frame.mono:
+		side_info = 17
+	case !frame.mpeg1 && !frame.mono:
+		side_info = 17
+	case !frame.mpeg1 && frame.mono:
+		side_info = 9
+	}
+
+	offset := 4 + side_info
+	if len(data) < offset+12 {
+		return 0, false
+	}
+	tag := data[offset : offset+4]
+	if !bytes.Equal(tag, []byte("Xing")) && !bytes.Equal(tag, []byte("Info")) {
+		return 0, false
+	}
+	flags := binary.BigEndian.Uint32(data[offset+4:])
+	if flags&1 == 0 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(data[offset+8:]), true
+}
+
+// mp3Envelope walks the layer III frames of the stream and takes the level of each granule from its global gain,
+// the step of the quantizer the encoder picked for it. Granules without coded bits are silent.
+// Layer I and II frames carry no global gain and return custom_error.UnsupportedAudioFormatError
+func mp3Envelope(r io.ReadSeeker, levels *envelope) error {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return invalid("file is too short")
+	}
+	start := id3v2Size(header)
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, mp3SearchLength)
+	n, err := io.ReadFull(r, buffer)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return invalid("no mpeg audio frame found")
+	}
+	offset, _ := findMP3Frame(buffer[:n])
+	if offset < 0 {
+		return invalid("no mpeg audio frame found")
+	}
+	if _, err := r.Seek(start+int64(offset), io.SeekStart); err != nil {
+		return err
+	}
+
+	buffered := bufio.NewReaderSize(r, 64<<10)
+	data := make([]byte, 0, 2048)
+	for {
+		// the stream ends at the first thing that isn't a frame, usually an ID3v1 or APE tag
+		header, err := buffered.Peek(4)
+		if err != nil {
+			return nil
+		}
+		frame, ok := parseMP3Frame(header)
+		if !ok {
+			return nil
+		}
+		if frame.layer != 3 {
+			return custom_error.UnsupportedAudioFormatError{}
+		}
+		data = data[:frame.length()]
+		if _, err := io.ReadFull(buffered, data); err != nil {
+			return nil
+		}
+		mp3GranuleLevels(data, frame, levels)
+	}
+}
+
+// mp3GranuleLevels reads the side information of a layer III frame and adds the level of each of its granules,
+// the loudest channel of a granule gives its level
+func mp3GranuleLevels(data []byte, frame mp3Frame, levels *envelope) {
+	channels := 2
+	if frame.mono {
+		channels = 1
+	}
+	offset := 4
+	// a cleared protection bit means a CRC follows the header
+	if data[1]&1 == 0 {
+		offset += 2
+	}
+
+	position := offset * 8
+	read := func(n int) int {
+		value := 0
+		for ; n > 0; n-- {
+			if position/8 >= len(data) {
+				return 0
+			}
+			value = value<<1 | int(data[position/8]>>(7-position%8)&1)
+			position++
+		}
+		return value
+	}
+
+	// main_data_begin, private bits and scfsi, then per granule and channel part2_3_length, big_values
+	// and global_gain followed by fields the level doesn't need
+	granules, rest := 1, 34
+	if frame.mpeg1 {
+		granules, rest = 2, 30
+		private_bits := 3
+		if frame.mono {
+			private_bits = 5
+		}
+		read(9 + private_bits + 4*channels)
+	} else {
+		read(8 + channels)
+	}
+	for granule := 0; granule < granules; granule++ {
+		level := 0.0
+		for channel := 0; channel < channels; channel++ {
+			coded_bits := read(12)
+			read(9)
+			global_gain := read(8)
+			read(rest)
+			if coded_bits > 0 {
+				// a step of global gain is 1.5 dB
+				level = max(level, math.Pow(2, float64(global_gain)/4))
+			}
+		}
+		levels.add(level)
+	}
+}
@@ -0,0 +1,241 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"flotify/internal/custom_error"
+	"io"
+)
+
+// oggTailLength is how much of the end of the file is searched for the last page
+const oggTailLength = 64 << 10
+
+// opusSampleRate is the rate opus granule positions count in, whatever the input rate was
+const opusSampleRate = 48000
+
+func probeOGG(r io.ReadSeeker, size int64) (*Info, error) {
+	// page header: capture pattern, version, type, granule (8), serial (4), sequence (4), crc (4), segment count
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, invalid("file is too short")
+	}
+	serial := binary.LittleEndian.Uint32(header[14:18])
+
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(r, segments); err != nil {
+		return nil, invalid("truncated ogg page")
+	}
+	packet_length := 0
+	for _, segment := range segments {
+		packet_length += int(segment)
+		if segment < 255 {
+			break
+		}
+	}
+	packet := make([]byte, packet_length)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return nil, invalid("truncated ogg page")
+	}
+
+	info := Info{}
+	pre_skip := uint64(0)
+	granule_rate := 0
+	switch {
+	case len(packet) >= 30 && bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		info.Codec = "vorbis"
+		info.Channels = int(packet[11])
+		info.SampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+		info.Bitrate = int(int32(binary.LittleEndian.Uint32(packet[20:24])))
+		granule_rate = info.SampleRate
+	case len(packet) >= 19 && bytes.HasPrefix(packet, []byte("OpusHead")):
+		info.Codec = "opus"
+		info.Channels = int(packet[9])
+		pre_skip = uint64(binary.LittleEndian.Uint16(packet[10:12]))
+		info.SampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+		granule_rate = opusSampleRate
+	case len(packet) >= 17+34 && bytes.HasPrefix(packet, []byte("\x7fFLAC")):
+		// ogg flac wraps the native STREAMINFO block after its own 13 byte mapping header
+		flac_info, err := parseFLACStreamInfo(packet[17:])
+		if err != nil {
+			return nil, err
+		}
+		info = *flac_info
+		granule_rate = info.SampleRate
+	default:
+		return nil, custom_error.UnsupportedAudioFormatError{}
+	}
+	if info.Bitrate < 0 {
+		info.Bitrate = 0
+	}
+
+	granule, err := lastGranule(r, size, serial)
+	if err != nil {
+		return nil, err
+	}
+	if granule > pre_skip {
+		info.Duration = samplesToDuration(granule-pre_skip, granule_rate)
+	}
+	return &info, nil
+}
+
+// lastGranule finds the granule position of the last page of the logical stream, the number of samples it holds
+func lastGranule(r io.ReadSeeker, size int64, serial uint32) (uint64, error) {
+	start := max(size-oggTailLength, 0)
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	tail, err := io.ReadAll(io.LimitReader(r, oggTailLength))
+	if err != nil {
+		return 0, err
+	}
+
+	for i := bytes.LastIndex(tail, []byte("OggS")); i >= 0; i = bytes.LastIndex(tail[:i], []byte("OggS")) {
+		if i+27 > len(tail) {
+			continue
+		}
+		if binary.LittleEndian.Uint32(tail[i+14:i+18]) != serial {
+			continue
+		}
+		granule := binary.LittleEndian.Uint64(tail[i+6 : i+14])
+		// pages where no packet ends carry -1
+		if granule == ^uint64(0) {
+			continue
+		}
+		return granule, nil
+	}
+	return 0, invalid("no ogg page with a granule position found")
+}
+
+// oggPage is a page of the logical stream followed by an oggReader
+type oggPage struct {
+	// granule is the granule position of the last packet ending on the page, -1 when none does
+	granule uint64
+	lacing  []byte
+	body    []byte
+}
+
+// oggReader reads the pages of the first logical stream of a file in order, pages of other streams are skipped
+type oggReader struct {
+	r       *bufio.Reader
+	serial  uint32
+	started bool
+}
+
+func newOggReader(r io.Reader) *oggReader {
+	return &oggReader{r: bufio.NewReaderSize(r, 64<<10)}
+}
+
+// page returns the next page, io.EOF after the last one
+func (o *oggReader) page() (*oggPage, error) {
+	header := make([]byte, 27)
+	for {
+		if _, err := io.ReadFull(o.r, header); err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, invalid("truncated ogg page")
+		}
+		if !bytes.HasPrefix(header, []byte("OggS")) {
+			return nil, invalid("lost ogg page sync")
+		}
+		lacing := make([]byte, header[26])
+		if _, err := io.ReadFull(o.r, lacing); err != nil {
+			return nil, invalid("truncated ogg page")
+		}
+		length := 0
+		for _, segment := range lacing {
+			length += int(segment)
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(o.r, body); err != nil {
+			return nil, invalid("truncated ogg page")
+		}
+
+		serial := binary.LittleEndian.Uint32(header[14:18])
+		if !o.started {
+			o.serial, o.started = serial, true
+		}
+		if serial != o.serial {
+			continue
+		}
+		return &oggPage{granule: binary.LittleEndian.Uint64(header[6:14]), lacing: lacing, body: body}, nil
+	}
+}
+
+// oggPayload reads the bodies of the pages back to back, which are the packets of the stream without their boundaries
+type oggPayload struct {
+	pages   *oggReader
+	pending []byte
+}
+
+func (p *oggPayload) Read(b []byte) (int, error) {
+	for len(p.pending) == 0 {
+		page, err := p.pages.page()
+		if err != nil {
+			return 0, err
+		}
+		p.pending = page.body
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+// decodeOGG decodes ogg flac, whose packets are a native flac stream once the 9 byte mapping header is dropped.
+// Vorbis and opus return custom_error.UnsupportedAudioFormatError
+func decodeOGG(r io.Reader, fn SampleFunc) error {
+	payload := &oggPayload{pages: newOggReader(r)}
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(payload, header); err != nil {
+		return invalid("file is too short")
+	}
+	if !bytes.HasPrefix(header, []byte("\x7fFLAC")) {
+		return custom_error.UnsupportedAudioFormatError{}
+	}
+	return decodeFLAC(payload, fn)
+}
+
+// oggEnvelope takes the level of each packet of a vorbis or opus stream from its size over the samples it covers.
+// The samples of a page are shared evenly by the packets ending on it, header pages have a granule position of 0
+func oggEnvelope(r io.Reader, levels *envelope) error {
+	pages := newOggReader(r)
+	previous := uint64(0)
+	size := 0
+	for {
+		page, err := pages.page()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		sizes := []int{}
+		for _, segment := range page.lacing {
+			size += int(segment)
+			// a lacing value below 255 ends the packet
+			if segment < 255 {
+				sizes = append(sizes, size)
+				size = 0
+			}
+		}
+		if page.granule == 0 || page.granule == ^uint64(0) || len(sizes) == 0 {
+			continue
+		}
+		if page.granule <= previous {
+			return invalid("ogg granule positions go backwards")
+		}
+
+		span := page.granule - previous
+		count := uint64(len(sizes))
+		for i, packet_size := range sizes {
+			samples := span*uint64(i+1)/count - span*uint64(i)/count
+			if samples == 0 {
+				continue
+			}
+			levels.add(float64(packet_size) / float64(samples))
+		}
+		previous = page.granule
+	}
+}
@@ -0,0 +1,278 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Tags are the descriptive fields embedded in an audio file, fields the file doesn't have are left zero
+type Tags struct {
+	Title       string
+	Artists     []string
+	Album       string
+	TrackNumber int
+	Year        int
+	Genre       string
+	// Picture is the embedded front cover as stored in the file, usually JPEG or PNG
+	Picture []byte
+}
+
+// maxTagSize bounds the size of a tag block read into memory, embedded artwork makes them large
+const maxTagSize = 16 << 20
+
+// ReadTags reads the ID3v2 (or ID3v1) tags of mp3 files and the Vorbis comments of flac and ogg files
+func ReadTags(r io.ReadSeeker, format Format, size int64) (*Tags, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case MP3:
+		tags, err := readID3v2(r)
+		if err != nil {
+			return nil, err
+		}
+		if !tags.empty() {
+			return tags, nil
+		}
+		// the descriptive fields come from the ID3v1 tag, a picture is only found in the ID3v2 one
+		v1_tags, err := readID3v1(r, size)
+		if err != nil {
+			return nil, err
+		}
+		v1_tags.Picture = tags.Picture
+		return v1_tags, nil
+	case FLAC:
+		return readFLACTags(r)
+	case OGG:
+		return readOGGTags(r)
+	}
+	return &Tags{}, nil
+}
+
+func (t *Tags) empty() bool {
+	return t.Title == "" && len(t.Artists) == 0 && t.Album == ""
+}
+
+// readFLACTags walks the metadata blocks for the VORBIS_COMMENT and PICTURE blocks
+func readFLACTags(r io.ReadSeeker) (*Tags, error) {
+	const (
+		vorbisComment = 4
+		picture       = 6
+	)
+
+	if _, err := r.Seek(4, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	tags := &Tags{}
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return tags, nil
+		}
+		last := header[0]&0x80 != 0
+		block_type := header[0] & 0x7F
+		block_size := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+
+		switch block_type {
+		case vorbisComment, picture:
+			block := make([]byte, block_size)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return tags, nil
+			}
+			if block_type == vorbisComment {
+				parseVorbisComment(block, tags)
+			} else {
+				tags.setPicture(parseFLACPicture(block))
+			}
+		default:
+			if _, err := r.Seek(block_size, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+
+		if last {
+			return tags, nil
+		}
+	}
+}
+
+// readOGGTags reads the comment header, the second packet of the stream
+func readOGGTags(r io.ReadSeeker) (*Tags, error) {
+	packets, err := oggPackets(r, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := &Tags{}
+	if len(packets) < 2 {
+		return tags, nil
+	}
+	packet := packets[1]
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+		parseVorbisComment(packet[7:], tags)
+	case bytes.HasPrefix(packet, []byte("OpusTags")):
+		parseVorbisComment(packet[8:], tags)
+	case len(packet) > 4 && packet[0]&0x7F == 4:
+		// ogg flac carries native metadata blocks as packets
+		parseVorbisComment(packet[4:], tags)
+	}
+	return tags, nil
+}
+
+// oggPackets reassembles the first count packets of the stream from its pages
+func oggPackets(r io.ReadSeeker, count int) ([][]byte, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	packets := [][]byte{}
+	packet := []byte{}
+	header := make([]byte, 27)
+	total := 0
+	for len(packets) < count {
+		if _, err := io.ReadFull(r, header); err != nil || !bytes.HasPrefix(header, []byte("OggS")) {
+			return packets, nil
+		}
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(r, segments); err != nil {
+			return packets, nil
+		}
+
+		for _, segment := range segments {
+			total += int(segment)
+			if total > maxTagSize {
+				return packets, nil
+			}
+			data := make([]byte, segment)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return packets, nil
+			}
+			packet = append(packet, data...)
+			// a lacing value below 255 ends the packet
+			if segment < 255 {
+				packets = append(packets, packet)
+				packet = []byte{}
+			}
+		}
+	}
+	return packets[:count], nil
+}
+
+// parseVorbisComment reads a vendor string followed by KEY=value comments, all lengths little endian
+func parseVorbisComment(data []byte, tags *Tags) {
+	read := func() ([]byte, bool) {
+		if len(data) < 4 {
+			return nil, false
+		}
+		length := binary.LittleEndian.Uint32(data)
+		if uint64(length) > uint64(len(data)-4) {
+			return nil, false
+		}
+		value := data[4 : 4+length]
+		data = data[4+length:]
+		return value, true
+	}
+
+	if _, ok := read(); !ok {
+		return
+	}
+	if len(data) < 4 {
+		return
+	}
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+
+	for i := uint32(0); i < count; i++ {
+		comment, ok := read()
+		if !ok {
+			return
+		}
+		key, value, ok := strings.Cut(string(comment), "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		switch strings.ToUpper(key) {
+		case "TITLE":
+			tags.Title = value
+		case "ARTIST":
+			tags.Artists = append(tags.Artists, value)
+		case "ALBUM":
+			tags.Album = value
+		case "TRACKNUMBER":
+			tags.TrackNumber = leadingNumber(value)
+		case "DATE", "YEAR":
+			if tags.Year == 0 {
+				tags.Year = leadingNumber(value)
+			}
+		case "GENRE":
+			tags.Genre = value
+		case "METADATA_BLOCK_PICTURE":
+			block, err := base64.StdEncoding.DecodeString(value)
+			if err == nil {
+				tags.setPicture(parseFLACPicture(block))
+			}
+		}
+	}
+}
+
+// parseFLACPicture returns the picture type and the image data of a FLAC PICTURE block
+func parseFLACPicture(block []byte) (int, []byte) {
+	if len(block) < 8 {
+		return 0, nil
+	}
+	picture_type := int(binary.BigEndian.Uint32(block))
+	offset := 4
+	// mime type and description
+	for i := 0; i < 2; i++ {
+		if len(block) < offset+4 {
+			return 0, nil
+		}
+		offset += 4 + int(binary.BigEndian.Uint32(block[offset:]))
+	}
+	// width, height, color depth, number of colors, data length
+	offset += 16
+	if offset < 0 || len(block) < offset+4 {
+		return 0, nil
+	}
+	length := int(binary.BigEndian.Uint32(block[offset:]))
+	offset += 4
+	if length < 0 || len(block) < offset+length {
+		return 0, nil
+	}
+	return picture_type, block[offset : offset+length]
+}
+
+// pictureFrontCover is the picture type ID3 and FLAC use for the front cover
+const pictureFrontCover = 3
+
+// setPicture keeps the front cover, or the first picture when there is none
+func (t *Tags) setPicture(picture_type int, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	if t.Picture == nil || picture_type == pictureFrontCover {
+		t.Picture = data
+	}
+}
+
+// leadingNumber parses values like "3/12" or "2019-05-01", returning 0 when there is no number
+func leadingNumber(value string) int {
+	end := 0
+	for end < len(value) && value[end] >= '0' && value[end] <= '9' {
+		end++
+	}
+	number, _ := strconv.Atoi(value[:end])
+	return number
+}
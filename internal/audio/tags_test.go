@@ -0,0 +1,448 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// syncsafeSize encodes n in four bytes of seven bits
+func syncsafeSize(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+}
+
+// id3Frame returns a frame of the version, its size is sync-safe in 2.4 and takes three bytes in 2.2
+func id3Frame(version byte, id string, flags uint16, body []byte) []byte {
+	frame := []byte(id)
+	switch version {
+	case 2:
+		frame = append(frame, byte(len(body)>>16), byte(len(body)>>8), byte(len(body)))
+	case 3:
+		frame = binary.BigEndian.AppendUint32(frame, uint32(len(body)))
+		frame = binary.BigEndian.AppendUint16(frame, flags)
+	default:
+		frame = append(frame, syncsafeSize(len(body))...)
+		frame = binary.BigEndian.AppendUint16(frame, flags)
+	}
+	return append(frame, body...)
+}
+
+// id3Tag returns an ID3v2 tag of the version holding the frames
+func id3Tag(version byte, flags byte, frames ...[]byte) []byte {
+	data := bytes.Join(frames, nil)
+	tag := append([]byte{'I', 'D', '3', version, 0, flags}, syncsafeSize(len(data))...)
+	return append(tag, data...)
+}
+
+// latin1Text is the body of a text frame in ISO-8859-1
+func latin1Text(value string) []byte {
+	return append([]byte{0}, value...)
+}
+
+// utf16Text is the body of a text frame in UTF-16 with a little endian byte order mark before every value
+func utf16Text(values ...string) []byte {
+	body := []byte{1}
+	for i, value := range values {
+		if i > 0 {
+			body = append(body, 0, 0)
+		}
+		body = append(body, 0xFF, 0xFE)
+		for _, unit := range utf16.Encode([]rune(value)) {
+			body = binary.LittleEndian.AppendUint16(body, unit)
+		}
+	}
+	return body
+}
+
+// apicBody is the body of an APIC frame with a latin1 description
+func apicBody(picture_type byte, data string) []byte {
+	body := append([]byte{0}, "image/jpeg\x00"...)
+	body = append(body, picture_type)
+	body = append(body, "cover\x00"...)
+	return append(body, data...)
+}
+
+// id3v1Tag returns the 128 bytes ID3v1.1 tag ending some mp3 files
+func id3v1Tag(title string, artist string, track byte, genre byte) []byte {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	copy(tag[3:33], title)
+	copy(tag[33:63], artist)
+	copy(tag[93:97], "2004")
+	tag[126] = track
+	tag[127] = genre
+	return tag
+}
+
+func TestReadID3v2Tags(t *testing.T) {
+	// 2.4 frames of 128 bytes and more spread their size over several sync-safe bytes
+	long_title := strings.TrimSpace(strings.Repeat("la ", 100))
+
+	tests := []struct {
+		name string
+		file []byte
+		want Tags
+	}{
+		{
+			name: "2.3 latin1 frames",
+			file: id3Tag(3, 0,
+				id3Frame(3, "TIT2", 0, latin1Text("Lover Boy")),
+				id3Frame(3, "TPE1", 0, latin1Text("Beyonc\xe9")),
+				id3Frame(3, "TALB", 0, latin1Text("Manchester")),
+				id3Frame(3, "TRCK", 0, latin1Text("3/12")),
+				id3Frame(3, "TYER", 0, latin1Text("2019")),
+				id3Frame(3, "TCON", 0, latin1Text("(17)")),
+			),
+			want: Tags{Title: "Lover Boy", Artists: []string{"Beyoncé"}, Album: "Manchester", TrackNumber: 3, Year: 2019, Genre: "Rock"},
+		},
+		{
+			name: "2.4 utf-16 values",
+			file: id3Tag(4, 0,
+				id3Frame(4, "TIT2", 0, append([]byte{3}, "Blue Town"...)),
+				id3Frame(4, "TPE1", 0, utf16Text("Phum Viphurit", "Higher Brothers")),
+				id3Frame(4, "TDRC", 0, latin1Text("2018-03-09")),
+				id3Frame(4, "TCON", 0, utf16Text("(13)Thai Pop")),
+			),
+			want: Tags{Title: "Blue Town", Artists: []string{"Phum Viphurit", "Higher Brothers"}, Year: 2018, Genre: "Thai Pop"},
+		},
+		{
+			name: "2.4 sync-safe frame size",
+			file: id3Tag(4, 0,
+				id3Frame(4, "TIT2", 0, latin1Text(long_title)),
+				id3Frame(4, "TALB", 0, latin1Text("Manchester")),
+			),
+			want: Tags{Title: long_title, Album: "Manchester"},
+		},
+		{
+			name: "2.3 unsynchronised tag",
+			file: func() []byte {
+				tag := id3Tag(3, 0x80, id3Frame(3, "TIT2", 0, latin1Text("\xff\xe0")))
+				body := bytes.ReplaceAll(tag[10:], []byte{0xFF}, []byte{0xFF, 0x00})
+				return append(append(tag[:6:6], syncsafeSize(len(body))...), body...)
+			}(),
+			want: Tags{Title: "ÿà"},
+		},
+		{
+			name: "2.4 data length indicator and unsynchronised frame",
+			file: id3Tag(4, 0,
+				id3Frame(4, "TIT2", 0x0003, append(syncsafeSize(3), 0, 0xFF, 0x00, 0xE0)),
+			),
+			want: Tags{Title: "ÿà"},
+		},
+		{
+			name: "2.3 extended header and compressed frame",
+			file: func() []byte {
+				extended := append(binary.BigEndian.AppendUint32(nil, 6), make([]byte, 6)...)
+				return id3Tag(3, 0x40,
+					extended,
+					id3Frame(3, "TIT2", 0x0080, latin1Text("compressed")),
+					id3Frame(3, "TALB", 0, latin1Text("Manchester")),
+				)
+			}(),
+			want: Tags{Album: "Manchester"},
+		},
+		{
+			name: "2.2 frames",
+			file: id3Tag(2, 0,
+				id3Frame(2, "TT2", 0, latin1Text("Tip Toe")),
+				id3Frame(2, "TP1", 0, latin1Text("HYBS")),
+				id3Frame(2, "TCO", 0, latin1Text("13")),
+				id3Frame(2, "PIC", 0, append([]byte("\x00JPG\x03cover\x00"), "front"...)),
+			),
+			want: Tags{Title: "Tip Toe", Artists: []string{"HYBS"}, Genre: "Pop", Picture: []byte("front")},
+		},
+		{
+			name: "front cover wins over the other pictures",
+			file: id3Tag(3, 0,
+				id3Frame(3, "TIT2", 0, latin1Text("Blue Town")),
+				id3Frame(3, "APIC", 0, apicBody(4, "back")),
+				id3Frame(3, "APIC", 0, apicBody(3, "front")),
+				id3Frame(3, "APIC", 0, apicBody(0, "other")),
+			),
+			want: Tags{Title: "Blue Town", Picture: []byte("front")},
+		},
+		{
+			name: "picture with a utf-16 description",
+			file: id3Tag(4, 0,
+				id3Frame(4, "TIT2", 0, latin1Text("Blue Town")),
+				id3Frame(4, "APIC", 0, append([]byte("\x01image/png\x00\x03\xff\xfec\x00\x00\x00"), "png"...)),
+			),
+			want: Tags{Title: "Blue Town", Picture: []byte("png")},
+		},
+		{
+			name: "picture without mime type terminator",
+			file: id3Tag(3, 0,
+				id3Frame(3, "TIT2", 0, latin1Text("Blue Town")),
+				id3Frame(3, "APIC", 0, []byte("\x00image/jpeg")),
+			),
+			want: Tags{Title: "Blue Town"},
+		},
+		{
+			name: "frame past the end of the tag keeps the previous ones",
+			file: func() []byte {
+				tag := id3Tag(3, 0,
+					id3Frame(3, "TIT2", 0, latin1Text("Lover Boy")),
+					id3Frame(3, "TPE1", 0, latin1Text("Phum Viphurit")),
+				)
+				// the artist frame claims more bytes than the tag holds
+				binary.BigEndian.PutUint32(tag[10+10+10+4:], 200)
+				return tag
+			}(),
+			want: Tags{Title: "Lover Boy"},
+		},
+		{
+			name: "padding ends the frames",
+			file: id3Tag(4, 0,
+				id3Frame(4, "TIT2", 0, latin1Text("Lover Boy")),
+				make([]byte, 32),
+				id3Frame(4, "TALB", 0, latin1Text("Manchester")),
+			),
+			want: Tags{Title: "Lover Boy"},
+		},
+		{
+			name: "truncated tag",
+			file: id3Tag(3, 0, id3Frame(3, "TIT2", 0, latin1Text("Lover Boy")))[:16],
+			want: Tags{},
+		},
+		{
+			name: "unknown version falls back to ID3v1",
+			file: append(
+				id3Tag(5, 0, id3Frame(4, "TIT2", 0, latin1Text("Lover Boy"))),
+				id3v1Tag("Tip Toe", "HYBS", 7, 13)...,
+			),
+			want: Tags{Title: "Tip Toe", Artists: []string{"HYBS"}, TrackNumber: 7, Year: 2004, Genre: "Pop"},
+		},
+		{
+			name: "ID3v1 fields keep the ID3v2 picture",
+			file: append(
+				id3Tag(3, 0, id3Frame(3, "APIC", 0, apicBody(3, "front"))),
+				id3v1Tag("Tip Toe", "HYBS", 0, 255)...,
+			),
+			want: Tags{Title: "Tip Toe", Artists: []string{"HYBS"}, Year: 2004, Picture: []byte("front")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ReadTags(bytes.NewReader(test.file), MP3, int64(len(test.file)))
+			if err != nil {
+				t.Fatalf("ReadTags() error = %v", err)
+			}
+			if !reflect.DeepEqual(*got, test.want) {
+				t.Errorf("ReadTags() = %+v, want %+v", *got, test.want)
+			}
+		})
+	}
+}
+
+// testVorbisComment returns a comment block of a vendor string and the comments
+func testVorbisComment(comments ...string) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, 7)
+	data = append(data, "flotify"...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(comments)))
+	for _, comment := range comments {
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(comment)))
+		data = append(data, comment...)
+	}
+	return data
+}
+
+// testFLACPicture returns a PICTURE block of the type holding the data
+func testFLACPicture(picture_type uint32, data string) []byte {
+	block := binary.BigEndian.AppendUint32(nil, picture_type)
+	for _, field := range []string{"image/jpeg", "cover"} {
+		block = binary.BigEndian.AppendUint32(block, uint32(len(field)))
+		block = append(block, field...)
+	}
+	block = append(block, make([]byte, 16)...)
+	block = binary.BigEndian.AppendUint32(block, uint32(len(data)))
+	return append(block, data...)
+}
+
+type flacBlock struct {
+	blockType byte
+	data      []byte
+}
+
+// testFLACMetadata returns the marker and metadata blocks of a flac file, a STREAMINFO block comes first
+func testFLACMetadata(blocks ...flacBlock) []byte {
+	blocks = append([]flacBlock{{blockType: 0, data: make([]byte, 34)}}, blocks...)
+	file := []byte("fLaC")
+	for i, block := range blocks {
+		header := block.blockType
+		if i == len(blocks)-1 {
+			header |= 0x80
+		}
+		file = append(file, header, byte(len(block.data)>>16), byte(len(block.data)>>8), byte(len(block.data)))
+		file = append(file, block.data...)
+	}
+	return file
+}
+
+func TestReadFLACTags(t *testing.T) {
+	const (
+		padding       = 1
+		seekTable     = 3
+		vorbisComment = 4
+		picture       = 6
+	)
+
+	tests := []struct {
+		name string
+		file []byte
+		want Tags
+	}{
+		{
+			name: "comments and pictures",
+			file: testFLACMetadata(
+				flacBlock{blockType: seekTable, data: make([]byte, 18)},
+				flacBlock{blockType: vorbisComment, data: testVorbisComment(
+					"title=Blue Town", "ARTIST=Phum Viphurit", "ARTIST=Higher Brothers", "ALBUM=Manchester",
+					"TRACKNUMBER=3/12", "DATE=2018-03-09", "YEAR=2017", "GENRE=Thai Pop", "COMMENT", "LABEL=",
+				)},
+				flacBlock{blockType: picture, data: testFLACPicture(4, "back")},
+				flacBlock{blockType: picture, data: testFLACPicture(3, "front")},
+				flacBlock{blockType: picture, data: testFLACPicture(0, "other")},
+				flacBlock{blockType: padding, data: make([]byte, 64)},
+			),
+			want: Tags{
+				Title: "Blue Town", Artists: []string{"Phum Viphurit", "Higher Brothers"}, Album: "Manchester",
+				TrackNumber: 3, Year: 2018, Genre: "Thai Pop", Picture: []byte("front"),
+			},
+		},
+		{
+			name: "comment count past the block keeps the read comments",
+			file: func() []byte {
+				block := testVorbisComment("TITLE=Tip Toe")
+				binary.LittleEndian.PutUint32(block[4+7:], 3)
+				return testFLACMetadata(flacBlock{blockType: vorbisComment, data: block})
+			}(),
+			want: Tags{Title: "Tip Toe"},
+		},
+		{
+			name: "comment length past the block",
+			file: func() []byte {
+				block := testVorbisComment("TITLE=Tip Toe", "ARTIST=HYBS")
+				binary.LittleEndian.PutUint32(block[4+7+4+4+13:], 1000)
+				return testFLACMetadata(flacBlock{blockType: vorbisComment, data: block})
+			}(),
+			want: Tags{Title: "Tip Toe"},
+		},
+		{
+			name: "picture data length past the block",
+			file: func() []byte {
+				block := testFLACPicture(3, "front")
+				binary.BigEndian.PutUint32(block[len(block)-len("front")-4:], 1<<31)
+				return testFLACMetadata(flacBlock{blockType: picture, data: block})
+			}(),
+			want: Tags{},
+		},
+		{
+			name: "truncated block",
+			file: testFLACMetadata(flacBlock{blockType: vorbisComment, data: testVorbisComment("TITLE=Tip Toe")})[:4+4+34+4+10],
+			want: Tags{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ReadTags(bytes.NewReader(test.file), FLAC, int64(len(test.file)))
+			if err != nil {
+				t.Fatalf("ReadTags() error = %v", err)
+			}
+			if !reflect.DeepEqual(*got, test.want) {
+				t.Errorf("ReadTags() = %+v, want %+v", *got, test.want)
+			}
+		})
+	}
+}
+
+// testOggPage returns an ogg page of the stream holding the packets
+func testOggPage(granule uint64, sequence uint32, packets ...[]byte) []byte {
+	lacing, body := []byte{}, []byte{}
+	for _, packet := range packets {
+		length := len(packet)
+		for ; length >= 255; length -= 255 {
+			lacing = append(lacing, 255)
+		}
+		lacing = append(lacing, byte(length))
+		body = append(body, packet...)
+	}
+
+	header := make([]byte, 27)
+	copy(header, "OggS")
+	binary.LittleEndian.PutUint64(header[6:], granule)
+	binary.LittleEndian.PutUint32(header[14:], 1)
+	binary.LittleEndian.PutUint32(header[18:], sequence)
+	header[26] = byte(len(lacing))
+	return append(append(header, lacing...), body...)
+}
+
+func TestReadOGGTags(t *testing.T) {
+	picture := base64.StdEncoding.EncodeToString(testFLACPicture(3, "front"))
+	// a comment packet longer than a segment is laced over several of them
+	long_album := strings.TrimSpace(strings.Repeat("Manchester ", 40))
+
+	tests := []struct {
+		name    string
+		packets [][]byte
+		want    Tags
+	}{
+		{
+			name: "vorbis",
+			packets: [][]byte{
+				[]byte("\x01vorbis"),
+				append([]byte("\x03vorbis"), testVorbisComment("TITLE=Blue Town", "ALBUM="+long_album, "METADATA_BLOCK_PICTURE="+picture)...),
+			},
+			want: Tags{Title: "Blue Town", Album: long_album, Picture: []byte("front")},
+		},
+		{
+			name: "opus",
+			packets: [][]byte{
+				[]byte("OpusHead"),
+				append([]byte("OpusTags"), testVorbisComment("ARTIST=HYBS", "TRACKNUMBER=7", "METADATA_BLOCK_PICTURE=not base64")...),
+			},
+			want: Tags{Artists: []string{"HYBS"}, TrackNumber: 7},
+		},
+		{
+			name: "ogg flac",
+			packets: [][]byte{
+				[]byte("\x7fFLAC"),
+				append([]byte{0x84, 0, 0, 0}, testVorbisComment("TITLE=Tip Toe")...),
+			},
+			want: Tags{Title: "Tip Toe"},
+		},
+		{
+			name:    "missing comment packet",
+			packets: [][]byte{[]byte("\x01vorbis")},
+			want:    Tags{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := []byte{}
+			for i, packet := range test.packets {
+				file = append(file, testOggPage(0, uint32(i), packet)...)
+			}
+			got, err := ReadTags(bytes.NewReader(file), OGG, int64(len(file)))
+			if err != nil {
+				t.Fatalf("ReadTags() error = %v", err)
+			}
+			if !reflect.DeepEqual(*got, test.want) {
+				t.Errorf("ReadTags() = %+v, want %+v", *got, test.want)
+			}
+		})
+	}
+
+	// a page cut short ends the packets read so far
+	file := append(testOggPage(0, 0, []byte("\x01vorbis")), testOggPage(0, 1, append([]byte("\x03vorbis"), testVorbisComment("TITLE=Tip Toe")...))...)
+	got, err := ReadTags(bytes.NewReader(file[:len(file)-5]), OGG, int64(len(file)-5))
+	if err != nil || !reflect.DeepEqual(*got, Tags{}) {
+		t.Errorf("ReadTags() = %+v, %v, want empty tags", *got, err)
+	}
+}
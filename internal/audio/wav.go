@@ -0,0 +1,190 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+// wavFormat is the content of the fmt chunk, the encoding of an extensible file is taken from its sub format
+type wavFormat struct {
+	encoding      int
+	channels      int
+	sampleRate    int
+	byteRate      int
+	blockAlign    int
+	bitsPerSample int
+}
+
+func probeWAV(r io.ReadSeeker, size int64) (*Info, error) {
+	format, data_size, err := readWAVHeader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	info := Info{
+		Channels:   format.channels,
+		SampleRate: format.sampleRate,
+		Bitrate:    format.byteRate * 8,
+	}
+	switch format.encoding {
+	case wavFormatPCM:
+		info.Codec = "pcm"
+	case wavFormatFloat:
+		info.Codec = "pcm_float"
+	default:
+		info.Codec = "wav"
+	}
+	if format.byteRate > 0 {
+		info.Duration = samplesToDuration(uint64(data_size), format.byteRate)
+	}
+	return &info, nil
+}
+
+// readWAVHeader walks the chunks up to the data chunk and returns the format and the size of the data,
+// r is then at the start of the data
+func readWAVHeader(r io.ReadSeeker, size int64) (*wavFormat, int64, error) {
+	if _, err := r.Seek(12, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+
+	var format *wavFormat
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, 0, invalid("missing wav data chunk")
+		}
+		chunk_size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch string(chunk[:4]) {
+		case "fmt ":
+			if chunk_size < 16 {
+				return nil, 0, invalid("truncated wav fmt chunk")
+			}
+			// the extension of WAVE_FORMAT_EXTENSIBLE ends with the GUID of the sub format, led by its format code
+			read_size := int64(16)
+			if chunk_size >= 40 {
+				read_size = 40
+			}
+			data := make([]byte, read_size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, 0, invalid("truncated wav fmt chunk")
+			}
+			format = &wavFormat{
+				encoding:      int(binary.LittleEndian.Uint16(data[0:2])),
+				channels:      int(binary.LittleEndian.Uint16(data[2:4])),
+				sampleRate:    int(binary.LittleEndian.Uint32(data[4:8])),
+				byteRate:      int(binary.LittleEndian.Uint32(data[8:12])),
+				blockAlign:    int(binary.LittleEndian.Uint16(data[12:14])),
+				bitsPerSample: int(binary.LittleEndian.Uint16(data[14:16])),
+			}
+			if format.encoding == wavFormatExtensible {
+				format.encoding = wavFormatPCM
+				if read_size == 40 {
+					format.encoding = int(binary.LittleEndian.Uint16(data[24:26]))
+				}
+			}
+			chunk_size -= read_size
+		case "data":
+			if format == nil {
+				return nil, 0, invalid("wav data chunk before fmt chunk")
+			}
+			// streaming writers leave the size unset, the data then runs to the end of the file
+			position, err := r.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, 0, err
+			}
+			if chunk_size == 0 || chunk_size == 0xFFFFFFFF || position+chunk_size > size {
+				chunk_size = size - position
+			}
+			return format, chunk_size, nil
+		}
+
+		// chunks are padded to an even size
+		if _, err := r.Seek(chunk_size+chunk_size%2, io.SeekCurrent); err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// wavBlockFrames is the number of frames decoded at once
+const wavBlockFrames = 4096
+
+// decodeWAV converts the 8, 16, 24 and 32 bits integer and the 32 and 64 bits float samples of the data chunk
+func decodeWAV(r io.ReadSeeker, size int64, fn SampleFunc) error {
+	format, data_size, err := readWAVHeader(r, size)
+	if err != nil {
+		return err
+	}
+
+	bytes_per_sample := format.bitsPerSample / 8
+	switch {
+	case format.encoding == wavFormatPCM && bytes_per_sample >= 1 && bytes_per_sample <= 4 && format.bitsPerSample%8 == 0:
+	case format.encoding == wavFormatFloat && (bytes_per_sample == 4 || bytes_per_sample == 8):
+	default:
+		return invalid("unsupported wav encoding")
+	}
+	if format.channels == 0 || format.blockAlign < format.channels*bytes_per_sample {
+		return invalid("invalid wav block alignment")
+	}
+
+	samples := make([][]float64, format.channels)
+	for channel := range samples {
+		samples[channel] = make([]float64, wavBlockFrames)
+	}
+	block := make([][]float64, format.channels)
+	buffer := make([]byte, wavBlockFrames*format.blockAlign)
+	data := io.LimitReader(r, data_size)
+	for {
+		n, err := io.ReadFull(data, buffer)
+		frames := n / format.blockAlign
+		if frames > 0 {
+			for frame := 0; frame < frames; frame++ {
+				offset := frame * format.blockAlign
+				for channel := range samples {
+					samples[channel][frame] = wavSample(buffer[offset:], format.encoding, bytes_per_sample)
+					offset += bytes_per_sample
+				}
+			}
+			for channel := range samples {
+				block[channel] = samples[channel][:frames]
+			}
+			if err := fn(block); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// wavSample converts the little endian sample at the start of data to [-1, 1], 8 bits samples are unsigned
+func wavSample(data []byte, encoding int, bytes_per_sample int) float64 {
+	if encoding == wavFormatFloat {
+		if bytes_per_sample == 4 {
+			return float64(math.Float32frombits(binary.LittleEndian.Uint32(data)))
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data))
+	}
+
+	switch bytes_per_sample {
+	case 1:
+		return float64(int(data[0])-128) / (1 << 7)
+	case 2:
+		return float64(int16(binary.LittleEndian.Uint16(data))) / (1 << 15)
+	case 3:
+		return float64(int32(uint32(data[0])<<8|uint32(data[1])<<16|uint32(data[2])<<24)>>8) / (1 << 23)
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(data))) / (1 << 31)
+	}
+}
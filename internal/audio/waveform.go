@@ -0,0 +1,77 @@
+package audio
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+)
+
+const (
+	// WaveformPoints is the number of points of a waveform, shorter streams get one point per waveformBucket frames
+	WaveformPoints = 1000
+	// WaveformHeight is the height of rendered waveforms, their width is their number of points
+	WaveformHeight = 200
+	// waveformBucket is the number of frames reduced to a min and max pair while decoding
+	waveformBucket = 256
+)
+
+// waveformColor draws the peaks on a transparent background
+var waveformColor = color.NRGBA{R: 0x4A, G: 0x4A, B: 0x4A, A: 0xFF}
+
+// waveformBuilder reduces the decoded samples to pairs of the lowest and the highest sample of every waveformBucket frames
+type waveformBuilder struct {
+	buckets [][2]float64
+	fill    int
+}
+
+// write is the SampleFunc feeding the builder
+func (w *waveformBuilder) write(samples [][]float64) error {
+	for i := range samples[0] {
+		if w.fill == 0 {
+			w.buckets = append(w.buckets, [2]float64{math.Inf(1), math.Inf(-1)})
+		}
+		bucket := &w.buckets[len(w.buckets)-1]
+		for _, channel := range samples {
+			bucket[0] = min(bucket[0], channel[i])
+			bucket[1] = max(bucket[1], channel[i])
+		}
+		w.fill = (w.fill + 1) % waveformBucket
+	}
+	return nil
+}
+
+// result merges the buckets into at most WaveformPoints points, the values are rounded to the thousandth
+func (w *waveformBuilder) result() [][2]float64 {
+	points := min(len(w.buckets), WaveformPoints)
+	peaks := make([][2]float64, points)
+	for point := range peaks {
+		start, end := point*len(w.buckets)/points, (point+1)*len(w.buckets)/points
+		peak := [2]float64{math.Inf(1), math.Inf(-1)}
+		for _, bucket := range w.buckets[start:end] {
+			peak[0] = min(peak[0], bucket[0])
+			peak[1] = max(peak[1], bucket[1])
+		}
+		peaks[point] = [2]float64{math.Round(peak[0]*1000) / 1000, math.Round(peak[1]*1000) / 1000}
+	}
+	return peaks
+}
+
+// RenderWaveform draws the peaks as a PNG image WaveformHeight pixels high with a column per point
+func RenderWaveform(w io.Writer, peaks [][2]float64) error {
+	img := image.NewNRGBA(image.Rect(0, 0, max(len(peaks), 1), WaveformHeight))
+	center := float64(WaveformHeight) / 2
+	for x, peak := range peaks {
+		top := int(math.Floor(center - math.Min(peak[1], 1)*center))
+		bottom := int(math.Ceil(center - math.Max(peak[0], -1)*center))
+		// silence still draws a line
+		if bottom <= top {
+			bottom = top + 1
+		}
+		for y := max(top, 0); y < min(bottom, WaveformHeight); y++ {
+			img.SetNRGBA(x, y, waveformColor)
+		}
+	}
+	return png.Encode(w, img)
+}
@@ -0,0 +1,316 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/png"
+	"math"
+	"testing"
+)
+
+func TestAnalyzeWaveform(t *testing.T) {
+	// one second of silence then one second of a sine at half scale on the right channel only
+	silence := make([]float64, 48000)
+	left := append(silence, make([]float64, 48000)...)
+	right := append(silence, sine(48000, 1, 441, 0.5)...)
+
+	analysis := analyzeWAV(t, testWAV(48000, [][]float64{left, right}))
+	peaks := analysis.Waveform
+	// 96000 frames make 375 buckets of 256 frames, fewer than WaveformPoints
+	if len(peaks) != 375 {
+		t.Fatalf("len(Waveform) = %d, want 375", len(peaks))
+	}
+	for point, peak := range peaks {
+		want := [2]float64{-0.5, 0.5}
+		if point < 187 {
+			want = [2]float64{0, 0}
+		}
+		if point == 187 {
+			// the bucket covering the start of the sine
+			continue
+		}
+		if math.Abs(peak[0]-want[0]) > 0.01 || math.Abs(peak[1]-want[1]) > 0.01 {
+			t.Fatalf("Waveform[%d] = %v, want %v", point, peak, want)
+		}
+	}
+}
+
+func TestWaveformBuilderPoints(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames int
+		want   int
+	}{
+		{name: "partial bucket", frames: 100, want: 1},
+		{name: "under the limit", frames: 256 * 600, want: 600},
+		{name: "merged buckets", frames: 256 * 2500, want: WaveformPoints},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			builder := waveformBuilder{}
+			samples := make([]float64, test.frames)
+			for i := range samples {
+				samples[i] = float64(i%3-1) / 4
+			}
+			builder.write([][]float64{samples})
+
+			peaks := builder.result()
+			if len(peaks) != test.want {
+				t.Fatalf("len(result()) = %d, want %d", len(peaks), test.want)
+			}
+			for point, peak := range peaks {
+				if peak != [2]float64{-0.25, 0.25} {
+					t.Fatalf("result()[%d] = %v, want [-0.25 0.25]", point, peak)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderWaveform(t *testing.T) {
+	peaks := [][2]float64{{0, 0}, {-1, 1}, {-0.5, 0}, {-2, 2}}
+
+	var buffer bytes.Buffer
+	if err := RenderWaveform(&buffer, peaks); err != nil {
+		t.Fatalf("RenderWaveform() error = %v", err)
+	}
+	img, err := png.Decode(&buffer)
+	if err != nil {
+		t.Fatalf("png.Decode() error = %v", err)
+	}
+	if size := img.Bounds().Size(); size.X != len(peaks) || size.Y != WaveformHeight {
+		t.Fatalf("size = %v, want %dx%d", size, len(peaks), WaveformHeight)
+	}
+
+	// the drawn rows of each column
+	tests := []struct {
+		column int
+		top    int
+		bottom int
+	}{
+		{column: 0, top: 100, bottom: 101},
+		{column: 1, top: 0, bottom: WaveformHeight},
+		{column: 2, top: 100, bottom: 150},
+		{column: 3, top: 0, bottom: WaveformHeight},
+	}
+	for _, test := range tests {
+		for y := 0; y < WaveformHeight; y++ {
+			_, _, _, alpha := img.At(test.column, y).RGBA()
+			if drawn := alpha > 0; drawn != (y >= test.top && y < test.bottom) {
+				t.Errorf("pixel %d,%d drawn = %v, want rows %d to %d", test.column, y, drawn, test.top, test.bottom)
+				break
+			}
+		}
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	tests := []struct {
+		name   string
+		levels []float64
+		want   [][2]float64
+	}{
+		{name: "empty", levels: nil, want: [][2]float64{}},
+		{name: "silent", levels: []float64{0, 0}, want: [][2]float64{{0, 0}, {0, 0}}},
+		{name: "scaled to the loudest", levels: []float64{1, 4, 2, 0}, want: [][2]float64{{-0.25, 0.25}, {-1, 1}, {-0.5, 0.5}, {0, 0}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			levels := envelope{levels: test.levels}
+			got := levels.result()
+			if len(got) != len(test.want) {
+				t.Fatalf("result() = %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("result() = %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+
+	// longer streams keep the loudest slice of each point
+	levels := envelope{}
+	for i := 0; i < 3*WaveformPoints; i++ {
+		levels.add(float64(i % 3))
+	}
+	for point, peak := range levels.result() {
+		if peak != [2]float64{-1, 1} {
+			t.Fatalf("result()[%d] = %v, want [-1 1]", point, peak)
+		}
+	}
+}
+
+// bitWriter writes big endian bit fields
+type bitWriter struct {
+	data     []byte
+	position int
+}
+
+func (w *bitWriter) write(value uint64, n int) {
+	for bit := n - 1; bit >= 0; bit-- {
+		if w.position%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if value>>bit&1 == 1 {
+			w.data[w.position/8] |= 1 << (7 - w.position%8)
+		}
+		w.position++
+	}
+}
+
+// testMP3 returns MPEG 1 layer III frames at 128 kbit/s whose granules carry the global gains,
+// a negative gain is a granule without coded bits
+func testMP3(gains ...int) []byte {
+	header := []byte{0xFF, 0xFB, 0x90, 0x00}
+	frame, _ := parseMP3Frame(header)
+
+	file := []byte{}
+	for i := 0; i < len(gains); i += 2 {
+		w := &bitWriter{data: append([]byte{}, header...), position: 32}
+		// main_data_begin, private bits and scfsi of both channels
+		w.write(0, 9+3+8)
+		for _, gain := range gains[i : i+2] {
+			for channel := 0; channel < 2; channel++ {
+				coded_bits := 100
+				if gain < 0 {
+					coded_bits, gain = 0, 0
+				}
+				w.write(uint64(coded_bits), 12)
+				w.write(0, 9)
+				w.write(uint64(gain), 8)
+				w.write(0, 30)
+			}
+		}
+		data := make([]byte, frame.length())
+		copy(data, w.data)
+		file = append(file, data...)
+	}
+	return file
+}
+
+// testOpus returns an opus stream of two pages of two 20 ms packets of the sizes
+func testOpus(sizes ...int) []byte {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[9] = 2
+	binary.LittleEndian.PutUint32(head[12:], 48000)
+
+	file := testOggPage(0, 0, head)
+	file = append(file, testOggPage(0, 1, []byte("OpusTags\x00\x00\x00\x00\x00\x00\x00\x00"))...)
+	for i := 0; i < len(sizes); i += 2 {
+		granule := uint64(i+2) * 960
+		file = append(file, testOggPage(granule, uint32(2+i/2), make([]byte, sizes[i]), make([]byte, sizes[i+1]))...)
+	}
+	return file
+}
+
+// testOggFLAC returns an ogg flac stream of a single frame of verbatim 16 bits stereo samples at 44.1 kHz
+func testOggFLAC(left []int16, right []int16) []byte {
+	stream_info := make([]byte, 34)
+	binary.BigEndian.PutUint16(stream_info[0:], 4096)
+	binary.BigEndian.PutUint16(stream_info[2:], 4096)
+	// sample rate, channels - 1, bits per sample - 1 and total samples
+	binary.BigEndian.PutUint64(stream_info[10:], 44100<<44|1<<41|15<<36|uint64(len(left)))
+	mapping := append([]byte("\x7fFLAC\x01\x00\x00\x01fLaC\x80\x00\x00\x22"), stream_info...)
+
+	w := &bitWriter{}
+	// sync, block size read from the header, 44.1 kHz, independent stereo, 16 bits, frame 0, block size - 1, crc
+	w.write(0x3FFE, 14)
+	w.write(0, 2)
+	w.write(6, 4)
+	w.write(9, 4)
+	w.write(1, 4)
+	w.write(4, 3)
+	w.write(0, 1)
+	w.write(0, 8)
+	w.write(uint64(len(left)-1), 8)
+	w.write(0, 8)
+	for _, channel := range [][]int16{left, right} {
+		// verbatim subframe
+		w.write(1<<1, 8)
+		for _, sample := range channel {
+			w.write(uint64(uint16(sample)), 16)
+		}
+	}
+	w.write(0, 16)
+
+	return append(testOggPage(0, 0, mapping), testOggPage(uint64(len(left)), 1, w.data)...)
+}
+
+func TestAnalyzeEstimatedWaveform(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  []byte
+		codec string
+		want  [][2]float64
+	}{
+		{
+			// 8 steps of global gain are 12 dB, a quarter of the level
+			name:  "mp3 global gains",
+			file:  testMP3(-1, -1, 170, 170, 178, 178),
+			codec: "mp3",
+			want:  [][2]float64{{0, 0}, {0, 0}, {-0.25, 0.25}, {-0.25, 0.25}, {-1, 1}, {-1, 1}},
+		},
+		{
+			name:  "opus packet sizes",
+			file:  testOpus(10, 20, 40, 0),
+			codec: "opus",
+			want:  [][2]float64{{-0.25, 0.25}, {-0.5, 0.5}, {-1, 1}, {0, 0}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := Probe(bytes.NewReader(test.file), int64(len(test.file)))
+			if err != nil {
+				t.Fatalf("Probe() error = %v", err)
+			}
+			if info.Codec != test.codec || !EstimatedWaveform(info.Codec) {
+				t.Fatalf("Codec = %q, want an estimated %q", info.Codec, test.codec)
+			}
+			analysis, err := Analyze(bytes.NewReader(test.file), *info, int64(len(test.file)))
+			if err != nil {
+				t.Fatalf("Analyze() error = %v", err)
+			}
+			if analysis.Loudness != nil {
+				t.Errorf("Loudness = %+v, want nil", analysis.Loudness)
+			}
+			if len(analysis.Waveform) != len(test.want) {
+				t.Fatalf("Waveform = %v, want %v", analysis.Waveform, test.want)
+			}
+			for i := range test.want {
+				if analysis.Waveform[i] != test.want[i] {
+					t.Fatalf("Waveform = %v, want %v", analysis.Waveform, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeOggFLAC(t *testing.T) {
+	left, right := make([]int16, 256), make([]int16, 256)
+	for i := range left {
+		left[i], right[i] = int16(i*100), int16(-i*50)
+	}
+	file := testOggFLAC(left, right)
+
+	info, err := Probe(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if info.Codec != "flac" || EstimatedWaveform(info.Codec) {
+		t.Fatalf("Codec = %q, want a decoded flac", info.Codec)
+	}
+	analysis, err := Analyze(bytes.NewReader(file), *info, int64(len(file)))
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+
+	want := [2]float64{math.Round(-255*50.0/32768*1000) / 1000, math.Round(255*100.0/32768*1000) / 1000}
+	if len(analysis.Waveform) != 1 || analysis.Waveform[0] != want {
+		t.Errorf("Waveform = %v, want [%v]", analysis.Waveform, want)
+	}
+}
@@ -53,6 +53,19 @@ func (am *AuthManager) GenerateJWT(ac *AuthCredential, exp_time time.Duration) (
 
 func (am *AuthManager) VerifyJWT(token_string string, id uuid.UUID) error {
 	log.Println(token_string)
+	id_check, err := am.ParseJWT(token_string)
+	if err != nil {
+		return err
+	}
+
+	if id_check != id {
+		return errors.New("wrong id")
+	}
+	return nil
+}
+
+// ParseJWT validates the token and returns the user ID stored in its claims
+func (am *AuthManager) ParseJWT(token_string string) (uuid.UUID, error) {
 	token, err := jwt.Parse(
 		token_string,
 		func(t *jwt.Token) (interface{}, error) {
@@ -66,32 +79,27 @@ func (am *AuthManager) VerifyJWT(token_string string, id uuid.UUID) error {
 	// but I want to handle it manual
 	if err != nil {
 		log.Println("Not parse")
-		return err
+		return uuid.Nil, err
+	}
+	if !token.Valid {
+		return uuid.Nil, custom_error.InvalidTokenError{}
 	}
-	if token.Valid {
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			exp := int64(claims["exp"].(float64))
-			if exp < time.Now().UTC().Unix() {
-				return custom_error.AccessTokenExpiredError{}
-			}
 
-			id_string_form := claims["id"].(string)
-			id_check, err := uuid.FromString(id_string_form)
-			if err != nil {
-				return err
-			}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return uuid.Nil, errors.New("can't retrieve claims from token")
+	}
 
-			if id_check != id {
-				return errors.New("wrong id")
-			}
-			return nil
-		} else {
-			return errors.New("can't retrieve claims from token")
-		}
+	exp := int64(claims["exp"].(float64))
+	if exp < time.Now().UTC().Unix() {
+		return uuid.Nil, custom_error.AccessTokenExpiredError{}
+	}
 
-	} else {
-		return custom_error.InvalidTokenError{}
+	id_string_form, ok := claims["id"].(string)
+	if !ok {
+		return uuid.Nil, custom_error.InvalidTokenError{}
 	}
+	return uuid.FromString(id_string_form)
 }
 
 func (am *AuthManager) StoreRefreshToken(user_id uuid.UUID, refresh_token string) error {
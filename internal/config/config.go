@@ -1,6 +1,8 @@
 package config
 
 import (
+	"strings"
+
 	"github.com/spf13/viper"
 )
 
@@ -21,6 +23,15 @@ type AuthDatabaseConfig struct {
 	DSN string
 }
 
+type StorageConfig struct {
+	Dir string
+}
+
+type MarketConfig struct {
+	// Default is the market of callers without a country and without the market query parameter
+	Default string
+}
+
 func LoadServerConfig() ServerConfig {
 	server_config := ServerConfig{}
 	viper.SetConfigFile("internal/config/config.yml")
@@ -86,3 +97,31 @@ func LoadAuthDatabaseConfig() DatabaseConfig {
 
 	return database_config
 }
+
+func LoadStorageConfig() StorageConfig {
+	storage_config := StorageConfig{}
+	viper.SetConfigFile("internal/config/config.yml")
+	if err := viper.ReadInConfig(); err != nil {
+		panic(err)
+	}
+
+	if dir := viper.GetString("storage.dir"); dir != "" {
+		storage_config.Dir = dir
+	} else {
+		storage_config.Dir = "storage"
+	}
+
+	return storage_config
+}
+
+func LoadMarketConfig() MarketConfig {
+	market_config := MarketConfig{}
+	viper.SetConfigFile("internal/config/config.yml")
+	if err := viper.ReadInConfig(); err != nil {
+		panic(err)
+	}
+
+	market_config.Default = strings.ToUpper(strings.TrimSpace(viper.GetString("market.default")))
+
+	return market_config
+}
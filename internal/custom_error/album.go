@@ -0,0 +1,23 @@
+package custom_error
+
+import "fmt"
+
+type NonExistAlbumError struct{}
+
+func (e NonExistAlbumError) Error() string {
+	return "non exist album record in database"
+}
+
+type InvalidAlbumTypeError struct{}
+
+func (e InvalidAlbumTypeError) Error() string {
+	return "album type must be album, single, ep or compilation"
+}
+
+type InvalidTrackNumberError struct {
+	Reason string
+}
+
+func (e InvalidTrackNumberError) Error() string {
+	return fmt.Sprintf("invalid track numbering: %s", e.Reason)
+}
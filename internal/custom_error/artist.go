@@ -5,3 +5,9 @@ type NonExistArtistError struct{}
 func (e NonExistArtistError) Error() string {
 	return "non exist artist record in database"
 }
+
+type NonExistArtistImageError struct{}
+
+func (e NonExistArtistImageError) Error() string {
+	return "non exist image of the artist"
+}
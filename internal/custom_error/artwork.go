@@ -0,0 +1,11 @@
+package custom_error
+
+import "fmt"
+
+type InvalidImageError struct {
+	Reason string
+}
+
+func (e InvalidImageError) Error() string {
+	return fmt.Sprintf("invalid image: %s", e.Reason)
+}
@@ -0,0 +1,37 @@
+package custom_error
+
+import "fmt"
+
+type UnsupportedAudioFormatError struct{}
+
+func (e UnsupportedAudioFormatError) Error() string {
+	return "unsupported audio format, use mp3, flac, ogg or wav"
+}
+
+type InvalidAudioError struct {
+	Reason string
+}
+
+func (e InvalidAudioError) Error() string {
+	return fmt.Sprintf("invalid audio file: %s", e.Reason)
+}
+
+type AudioTooLargeError struct {
+	Limit int64
+}
+
+func (e AudioTooLargeError) Error() string {
+	return fmt.Sprintf("audio file is larger than %d bytes", e.Limit)
+}
+
+type NonExistWaveformError struct{}
+
+func (e NonExistWaveformError) Error() string {
+	return "the audio of this track has no waveform, it was uploaded before waveforms were drawn or its codec isn't analyzed"
+}
+
+type NonExistTrackAudioError struct{}
+
+func (e NonExistTrackAudioError) Error() string {
+	return "no audio has been uploaded for this track"
+}
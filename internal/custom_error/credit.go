@@ -0,0 +1,11 @@
+package custom_error
+
+import "fmt"
+
+type InvalidCreditError struct {
+	Reason string
+}
+
+func (e InvalidCreditError) Error() string {
+	return fmt.Sprintf("invalid credit: %s", e.Reason)
+}
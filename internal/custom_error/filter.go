@@ -0,0 +1,11 @@
+package custom_error
+
+import "fmt"
+
+type InvalidSortCriteriaError struct {
+	Field string
+}
+
+func (e InvalidSortCriteriaError) Error() string {
+	return fmt.Sprintf("can't sort by %s", e.Field)
+}
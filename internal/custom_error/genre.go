@@ -0,0 +1,30 @@
+package custom_error
+
+import "fmt"
+
+type NonExistGenreError struct {
+	Slug string
+}
+
+func (e NonExistGenreError) Error() string {
+	if e.Slug == "" {
+		return "non exist genre record in database"
+	}
+	return fmt.Sprintf("non exist genre %q in database", e.Slug)
+}
+
+type DuplicateGenreError struct {
+	Slug string
+}
+
+func (e DuplicateGenreError) Error() string {
+	return fmt.Sprintf("genre %q already exists", e.Slug)
+}
+
+type InvalidGenreError struct {
+	Reason string
+}
+
+func (e InvalidGenreError) Error() string {
+	return fmt.Sprintf("invalid genre: %s", e.Reason)
+}
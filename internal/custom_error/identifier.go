@@ -0,0 +1,23 @@
+package custom_error
+
+import "fmt"
+
+// InvalidIdentifierError is returned for a malformed external identifier, Kind is ISRC, UPC or MBID
+type InvalidIdentifierError struct {
+	Kind  string
+	Value string
+}
+
+func (e InvalidIdentifierError) Error() string {
+	return fmt.Sprintf("invalid %s %q", e.Kind, e.Value)
+}
+
+// DuplicateIdentifierError is returned when an external identifier already belongs to another record
+type DuplicateIdentifierError struct {
+	Kind  string
+	Value string
+}
+
+func (e DuplicateIdentifierError) Error() string {
+	return fmt.Sprintf("%s %q already belongs to another record", e.Kind, e.Value)
+}
@@ -0,0 +1,21 @@
+package custom_error
+
+import "fmt"
+
+type NonExistLyricsError struct{}
+
+func (e NonExistLyricsError) Error() string {
+	return "track has no lyrics"
+}
+
+type InvalidLyricsError struct {
+	Line   int
+	Reason string
+}
+
+func (e InvalidLyricsError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("invalid lyrics at line %d: %s", e.Line, e.Reason)
+	}
+	return fmt.Sprintf("invalid lyrics: %s", e.Reason)
+}
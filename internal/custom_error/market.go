@@ -0,0 +1,19 @@
+package custom_error
+
+import "fmt"
+
+type UnavailableInMarketError struct {
+	Market string
+}
+
+func (e UnavailableInMarketError) Error() string {
+	return fmt.Sprintf("not available in your region (%s)", e.Market)
+}
+
+type InvalidMarketError struct {
+	Market string
+}
+
+func (e InvalidMarketError) Error() string {
+	return fmt.Sprintf("invalid market %q, markets are ISO 3166-1 alpha-2 country codes", e.Market)
+}
@@ -0,0 +1,97 @@
+package custom_error
+
+type NonExistPlaylistError struct{}
+
+func (e NonExistPlaylistError) Error() string {
+	return "non exist playlist record in database"
+}
+
+type PlaylistPermissionError struct{}
+
+func (e PlaylistPermissionError) Error() string {
+	return "you don't have permission to modify this playlist"
+}
+
+type SnapshotMismatchError struct{}
+
+func (e SnapshotMismatchError) Error() string {
+	return "playlist has been modified since the given snapshot"
+}
+
+type InvalidPositionError struct{}
+
+func (e InvalidPositionError) Error() string {
+	return "position is out of range of the playlist"
+}
+
+type InvalidPlaylistRoleError struct{}
+
+func (e InvalidPlaylistRoleError) Error() string {
+	return "role of a playlist member must be editor or viewer"
+}
+
+type OwnerMembershipError struct{}
+
+func (e OwnerMembershipError) Error() string {
+	return "owner of the playlist can't be added or removed as a member"
+}
+
+type NonExistPlaylistMemberError struct{}
+
+func (e NonExistPlaylistMemberError) Error() string {
+	return "user is not a member of this playlist"
+}
+
+type NonExistPlaylistVersionError struct{}
+
+func (e NonExistPlaylistVersionError) Error() string {
+	return "non exist playlist version with this snapshot"
+}
+
+type InvalidPlaylistVisibilityError struct{}
+
+func (e InvalidPlaylistVisibilityError) Error() string {
+	return "visibility of a playlist must be public, unlisted or private"
+}
+
+type SmartPlaylistError struct{}
+
+func (e SmartPlaylistError) Error() string {
+	return "tracks of a smart playlist are decided by its rules"
+}
+
+type NotSmartPlaylistError struct{}
+
+func (e NotSmartPlaylistError) Error() string {
+	return "playlist is not a smart playlist"
+}
+
+type InvalidSmartRulesError struct{}
+
+func (e InvalidSmartRulesError) Error() string {
+	return "lengths and days of smart playlist rules can't be negative, limit must be between 1 and 500"
+}
+
+type NonExistFolderError struct{}
+
+func (e NonExistFolderError) Error() string {
+	return "non exist folder record in database"
+}
+
+type InvalidFolderMoveError struct{}
+
+func (e InvalidFolderMoveError) Error() string {
+	return "a folder can't be moved into itself or one of its subfolders"
+}
+
+type InvalidLibraryItemError struct{}
+
+func (e InvalidLibraryItemError) Error() string {
+	return "type of a library item must be folder or playlist"
+}
+
+type InvalidSavedItemError struct{}
+
+func (e InvalidSavedItemError) Error() string {
+	return "type of a saved item must be track or album"
+}
@@ -0,0 +1,23 @@
+package custom_error
+
+import "fmt"
+
+type UnsupportedPlaylistFormatError struct {
+	Format string
+}
+
+func (e UnsupportedPlaylistFormatError) Error() string {
+	return fmt.Sprintf("unsupported playlist format %q, use m3u8, xspf or json", e.Format)
+}
+
+type InvalidPlaylistFileError struct {
+	Line   int
+	Reason string
+}
+
+func (e InvalidPlaylistFileError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("invalid playlist file at line %d: %s", e.Line, e.Reason)
+	}
+	return fmt.Sprintf("invalid playlist file: %s", e.Reason)
+}
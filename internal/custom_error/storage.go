@@ -0,0 +1,7 @@
+package custom_error
+
+type NonExistObjectError struct{}
+
+func (e NonExistObjectError) Error() string {
+	return "non exist object in storage"
+}
@@ -0,0 +1,7 @@
+package custom_error
+
+type NonExistTrackError struct{}
+
+func (e NonExistTrackError) Error() string {
+	return "non exist track record in database"
+}
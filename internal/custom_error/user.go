@@ -5,3 +5,15 @@ type DuplicateUsernameError struct{}
 func (e DuplicateUsernameError) Error() string {
 	return "this username has been used"
 }
+
+type NonExistUserError struct{}
+
+func (e NonExistUserError) Error() string {
+	return "non exist user record in database"
+}
+
+type CatalogPermissionError struct{}
+
+func (e CatalogPermissionError) Error() string {
+	return "only admins and the accounts managing its artists can edit this item"
+}
@@ -0,0 +1,11 @@
+package custom_error
+
+import "fmt"
+
+type InvalidVersionError struct {
+	Reason string
+}
+
+func (e InvalidVersionError) Error() string {
+	return fmt.Sprintf("invalid version: %s", e.Reason)
+}
@@ -0,0 +1,540 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"flotify/internal/artwork"
+	"flotify/internal/custom_error"
+	"flotify/internal/helper"
+	"flotify/internal/model"
+	"flotify/internal/repository"
+	"flotify/internal/storage"
+	"flotify/middleware"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid/v5"
+)
+
+type AlbumHandler struct {
+	repository repository.AlbumRepository
+	storage    storage.Storage
+}
+
+func NewAlbumHandler(repo repository.AlbumRepository, store storage.Storage) AlbumHandler {
+	return AlbumHandler{
+		repository: repo,
+		storage:    store,
+	}
+}
+
+// RequestAlbum is the body of album creation and update, release_date is formatted as 2006-01-02
+// or as 2006-01-02T15:04:05Z07:00 to schedule the release at a given moment
+type RequestAlbum struct {
+	Title       string          `json:"title"`
+	Type        model.AlbumType `json:"type"`
+	ReleaseDate string          `json:"release_date"`
+	Label       string          `json:"label"`
+	UPC         string          `json:"upc"`
+	ArtistID    []uuid.UUID     `json:"artist_id"`
+	// Markets are the countries the album is licensed in, every country when empty
+	Markets []string `json:"markets"`
+}
+
+func (ra RequestAlbum) album() (model.Album, error) {
+	album := model.Album{
+		Title:    ra.Title,
+		Type:     ra.Type,
+		Label:    ra.Label,
+		UPC:      ra.UPC,
+		ArtistID: ra.ArtistID,
+		Markets:  ra.Markets,
+	}
+	if ra.ReleaseDate != "" {
+		release_date, err := time.Parse(time.DateOnly, ra.ReleaseDate)
+		if err != nil {
+			release_date, err = time.Parse(time.RFC3339, ra.ReleaseDate)
+		}
+		if err != nil {
+			return album, err
+		}
+		album.ReleaseDate = &release_date
+	}
+	return album, nil
+}
+
+// CreateAlbum godoc
+//
+//	@Summary		Create an album
+//	@Description	Create an album credited to the artists in artist_id, type is album (default), single, ep or compilation.
+//	@Description	Its upc must not belong to another album. Only admins are allowed
+//	@Tags			albums
+//	@Accept			json
+//	@Produce		json
+//	@Param			album body RequestAlbum true "Album information"
+//	@Success		200	{object}	model.Album
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		409	"UPC belongs to another album"
+//	@Failure		500	"Internal server error"
+//	@Router			/albums [post]
+func (ah *AlbumHandler) CreateAlbum(c *gin.Context) {
+	ah.createAlbum(c, false)
+}
+
+// ImportAlbum godoc
+//
+//	@Summary		Import an album
+//	@Description	Create an album, an album with the same upc is updated instead so imports can be repeated.
+//	@Description	Its artists are replaced by the given ones, its tracks are kept. Only admins are allowed
+//	@Tags			albums
+//	@Accept			json
+//	@Produce		json
+//	@Param			album body RequestAlbum true "Album information"
+//	@Success		200	{object}	model.Album
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/albums/import [post]
+func (ah *AlbumHandler) ImportAlbum(c *gin.Context) {
+	ah.createAlbum(c, true)
+}
+
+// createAlbum creates the album described by the body, upsert updates the album with the same UPC
+func (ah *AlbumHandler) createAlbum(c *gin.Context, upsert bool) {
+	request_album := RequestAlbum{}
+	if err := c.BindJSON(&request_album); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	album, err := request_album.album()
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	create := ah.repository.CreateAlbum
+	if upsert {
+		create = ah.repository.ImportAlbum
+	}
+	created_album, err := create(context.Background(), album)
+	if err != nil {
+		albumErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, created_album)
+}
+
+// GetAlbum godoc
+//
+//	@Summary		Get an album
+//	@Description	Get an album with its tracks ordered by disc and track number,
+//	@Description	an album releasing in the future is only found by admins and the accounts of its artists.
+//	@Description	The market is the market parameter or the country of the user, albums and tracks not licensed there aren't available
+//	@Tags			albums
+//	@Produce		json
+//	@Param			id path string true "Album ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			market query string false "ISO 3166-1 alpha-2 country code, ignored when the user has a country" example("VN")
+//	@Success		200	{object}	model.Album
+//	@Failure		400	"Bad request"
+//	@Failure		404	"Not found"
+//	@Failure		451	"Not available in your region"
+//	@Failure		500	"Internal server error"
+//	@Router			/albums/{id} [get]
+func (ah *AlbumHandler) GetAlbum(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	album, err := ah.repository.GetAlbumByID(context.Background(), id, middleware.GetUserID(c), middleware.GetMarket(c))
+	if err != nil {
+		albumErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, album)
+}
+
+// GetAlbumsWithFilter godoc
+//
+//	@Summary		Get list of albums
+//	@Description	Get albums satisfying the conditions of the filter, without their tracks. Albums releasing in the future are hidden
+//	@Tags			albums
+//	@Produce		json
+//	@Param			title query string false "title of the album" example("Manchild")
+//	@Param			type query string false "comma separated album types" example("album,ep")
+//	@Param			genre query string false "comma separated genre slugs, sub-genres included" example("indie-rock")
+//	@Param			tag query string false "comma separated tags the albums must all have" example("summer")
+//	@Param			upc query string false "UPC or EAN-13 barcode of the release" example("036000291452")
+//	@Param			market query string false "ISO 3166-1 alpha-2 country code the albums must be licensed in, ignored when the user has a country" example("VN")
+//	@Param			sort query string false "criteria for sorting: title, release_date or created_at, prefixed by - for descending order" example("-release_date")
+//	@Param			page query int false "searching page" example(2)
+//	@Param			limit query int false "searching limit" example(10)
+//	@Success		200	{object}	model.Albums
+//	@Failure		400	"Bad request"
+//	@Failure		500	"Internal server error"
+//	@Router			/albums [get]
+func (ah *AlbumHandler) GetAlbumsWithFilter(c *gin.Context) {
+	filter, err := albumFilter(c)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+	filter.Props["title"] = c.Query("title")
+
+	albums, err := ah.repository.GetAlbumsWithFilter(context.Background(), filter)
+	if err != nil {
+		albumErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"albums": albums})
+}
+
+// GetAlbumsOfArtist godoc
+//
+//	@Summary		Get discography of an artist
+//	@Description	Get the albums credited to an artist, newest release first unless sorted otherwise
+//	@Tags			artists
+//	@Produce		json
+//	@Param			id path string true "Artist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			type query string false "comma separated album types" example("album,single")
+//	@Param			market query string false "ISO 3166-1 alpha-2 country code the albums must be licensed in, ignored when the user has a country" example("VN")
+//	@Param			genre query string false "comma separated genre slugs, sub-genres included" example("indie-rock")
+//	@Param			tag query string false "comma separated tags the albums must all have" example("summer")
+//	@Param			sort query string false "criteria for sorting: title, release_date or created_at, prefixed by - for descending order" example("title")
+//	@Param			page query int false "searching page" example(2)
+//	@Param			limit query int false "searching limit" example(10)
+//	@Success		200	{object}	model.Albums
+//	@Failure		400	"Bad request"
+//	@Failure		500	"Internal server error"
+//	@Router			/artists/{id}/albums [get]
+func (ah *AlbumHandler) GetAlbumsOfArtist(c *gin.Context) {
+	artist_id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	filter, err := albumFilter(c)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+	filter.Props["artist_id"] = artist_id
+	if len(filter.SortBy) == 0 {
+		filter.SortBy = []string{"-release_date"}
+	}
+
+	albums, err := ah.repository.GetAlbumsWithFilter(context.Background(), filter)
+	if err != nil {
+		albumErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"albums": albums})
+}
+
+// albumFilter reads the pagination, sort and type query parameters shared by album listings
+func albumFilter(c *gin.Context) (repository.Filter, error) {
+	page, err := helper.GetPage(c)
+	if err != nil {
+		return repository.Filter{}, err
+	}
+
+	limit, err := helper.GetLimit(c)
+	if err != nil {
+		return repository.Filter{}, err
+	}
+
+	var sort_criterias []string
+	if sort_criterias_string_form := c.Query("sort"); sort_criterias_string_form != "" {
+		sort_criterias = strings.Split(sort_criterias_string_form, ",")
+	}
+
+	var types []model.AlbumType
+	for _, album_type := range helper.GetList(c, "type") {
+		types = append(types, model.AlbumType(album_type))
+	}
+
+	return repository.Filter{
+		Props: map[string]any{
+			"type":  types,
+			"genre": helper.GetList(c, "genre"),
+			"tag":   helper.GetList(c, "tag"),
+			"upc":   c.Query("upc"),
+		},
+		Page:     page,
+		Limit:    limit,
+		SortBy:   sort_criterias,
+		ViewerID: middleware.GetUserID(c),
+		Market:   middleware.GetMarket(c),
+	}, nil
+}
+
+// UpdateAlbum godoc
+//
+//	@Summary		Update an album
+//	@Description	Replace the information and the artists of an album, its tracks are kept
+//	@Tags			albums
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Album ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			album body RequestAlbum true "Album information"
+//	@Success		200	{object}	model.Album
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		409	"UPC belongs to another album"
+//	@Failure		500	"Internal server error"
+//	@Router			/albums/{id} [put]
+func (ah *AlbumHandler) UpdateAlbum(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	request_album := RequestAlbum{Type: model.AlbumTypeAlbum}
+	if err := c.BindJSON(&request_album); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	album, err := request_album.album()
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+	album.ID = id
+
+	updated_album, err := ah.repository.UpdateAlbum(context.Background(), album)
+	if err != nil {
+		albumErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, updated_album)
+}
+
+// DeleteAlbum godoc
+//
+//	@Summary		Delete an album
+//	@Description	Delete an album, its tracks are kept
+//	@Tags			albums
+//	@Produce		json
+//	@Param			id path string true "Album ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/albums/{id} [delete]
+func (ah *AlbumHandler) DeleteAlbum(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := ah.repository.DeleteAlbum(context.Background(), id); err != nil {
+		albumErrorResponse(c, err)
+		return
+	}
+	ah.storage.Delete(context.Background(), artwork.AlbumCoverKey(id))
+
+	c.JSON(http.StatusOK, gin.H{"message": "delete album successfully"})
+}
+
+// SetTracksOfAlbum godoc
+//
+//	@Summary		Set tracklist of an album
+//	@Description	Replace the tracks of an album. disc_number defaults to 1 and a missing track_number continues
+//	@Description	the numbering of the disc, two tracks can't share a disc and track number
+//	@Tags			albums
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Album ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Album
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/albums/{id}/tracks [put]
+func (ah *AlbumHandler) SetTracksOfAlbum(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestTrack struct {
+		TrackID     uuid.UUID `json:"track_id"`
+		DiscNumber  int       `json:"disc_number"`
+		TrackNumber int       `json:"track_number"`
+	}
+	type RequestTracklist struct {
+		Tracks []RequestTrack `json:"tracks"`
+	}
+
+	request_tracklist := RequestTracklist{}
+	if err := c.BindJSON(&request_tracklist); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	tracks := make([]model.AlbumTrack, len(request_tracklist.Tracks))
+	for i, request_track := range request_tracklist.Tracks {
+		tracks[i] = model.AlbumTrack{
+			DiscNumber:  request_track.DiscNumber,
+			TrackNumber: request_track.TrackNumber,
+			Track:       model.Track{ID: request_track.TrackID},
+		}
+	}
+
+	album, err := ah.repository.SetTracksOfAlbum(context.Background(), id, tracks)
+	if err != nil {
+		albumErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, album)
+}
+
+// GetCoverOfAlbum godoc
+//
+//	@Summary		Get cover of an album
+//	@Description	Get the uploaded cover of an album, falling back to the artwork embedded in the audio of its tracks
+//	@Description	and then to a generated placeholder
+//	@Tags			albums
+//	@Produce		jpeg
+//	@Param			id path string true "Album ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/albums/{id}/cover [get]
+func (ah *AlbumHandler) GetCoverOfAlbum(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	cover_key, err := ah.repository.GetCoverOfAlbum(context.Background(), id)
+	if err != nil {
+		albumErrorResponse(c, err)
+		return
+	}
+
+	if cover_key != "" {
+		cover, err := ah.storage.Open(context.Background(), cover_key)
+		if err == nil {
+			defer cover.Close()
+			c.Header("Content-Type", "image/jpeg")
+			http.ServeContent(c.Writer, c.Request, "cover.jpg", time.Time{}, cover)
+			return
+		}
+		if _, ok := err.(custom_error.NonExistObjectError); !ok {
+			helper.ErrorResponse(c, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := artwork.Encode(&buffer, artwork.Placeholder(id.Bytes(), artwork.CoverSize)); err != nil {
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.Data(http.StatusOK, "image/jpeg", buffer.Bytes())
+}
+
+// SetCoverOfAlbum godoc
+//
+//	@Summary		Upload cover of an album
+//	@Description	Upload a JPEG or PNG image as the request body or as the "file" form field, it is cropped to a square
+//	@Description	and stored as a 640x640 JPEG
+//	@Tags			albums
+//	@Accept			jpeg,png
+//	@Produce		json
+//	@Param			id path string true "Album ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Album
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/albums/{id}/cover [put]
+func (ah *AlbumHandler) SetCoverOfAlbum(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	body, _, err := uploadedFile(c, artwork.MaxUploadSize)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+
+	img, err := artwork.Decode(body)
+	if err != nil {
+		albumErrorResponse(c, err)
+		return
+	}
+
+	var buffer bytes.Buffer
+	if err := artwork.Encode(&buffer, artwork.Square(img, artwork.CoverSize)); err != nil {
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	cover_key := artwork.AlbumCoverKey(id)
+	if err := ah.storage.Put(context.Background(), cover_key, &buffer); err != nil {
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	album, err := ah.repository.SetCoverOfAlbum(context.Background(), id, cover_key)
+	if err != nil {
+		if _, ok := err.(custom_error.NonExistAlbumError); ok {
+			ah.storage.Delete(context.Background(), cover_key)
+		}
+		albumErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, album)
+}
+
+func albumErrorResponse(c *gin.Context, err error) {
+	switch err := err.(type) {
+	case custom_error.NonExistAlbumError, custom_error.NonExistArtistError, custom_error.NonExistTrackError:
+		helper.ErrorResponse(c, err, http.StatusNotFound)
+	case custom_error.InvalidAlbumTypeError, custom_error.InvalidTrackNumberError, custom_error.InvalidSortCriteriaError, custom_error.InvalidImageError,
+		custom_error.InvalidIdentifierError, custom_error.InvalidMarketError:
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+	case custom_error.DuplicateIdentifierError:
+		helper.ErrorResponse(c, err, http.StatusConflict)
+	case custom_error.UnavailableInMarketError:
+		helper.ErrorResponse(c, err, http.StatusUnavailableForLegalReasons)
+	default:
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+	}
+}
@@ -1,14 +1,22 @@
 package handler
 
 import (
+	"bytes"
 	"context"
+	"flotify/internal/artwork"
+	"flotify/internal/custom_error"
 	"flotify/internal/helper"
 	"flotify/internal/model"
 	"flotify/internal/repository"
 	"flotify/internal/response"
+	"flotify/internal/storage"
+	"flotify/middleware"
 	"fmt"
+	"image"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gofrs/uuid/v5"
@@ -16,46 +24,92 @@ import (
 
 type ArtistHandler struct {
 	repository repository.ArtistRepository
+	storage    storage.Storage
+	// users tells who is an admin, only admins choose the account managing an artist
+	users repository.UserRepository
 }
 
-func NewArtistHandler(repo repository.ArtistRepository) ArtistHandler {
+func NewArtistHandler(repo repository.ArtistRepository, store storage.Storage, user_repo repository.UserRepository) ArtistHandler {
 	return ArtistHandler{
 		repository: repo,
+		storage:    store,
+		users:      user_repo,
 	}
 }
 
 // CreateArtist godoc
 //
 //		@Summary		Create an artist
-//		@Description	Create a new artist
+//		@Description	Create a new artist, its mbid must not belong to another artist
 //		@Tags			artists
 //		@Accept			json
 //		@Produce		json
 //	 	@Param 			artist body model.Artist true "Artist Information"
 //		@Success		200	{object}	model.Artist
 //		@Failure		400
+//		@Failure		403 "Only admins set the managing account"
+//		@Failure		409 "MBID belongs to another artist"
 //		@Failure		500
 //		@Router			/artists [post]
 func (ah *ArtistHandler) CreateArtist(c *gin.Context) {
+	ah.createArtist(c, false)
+}
+
+// ImportArtist godoc
+//
+//	@Summary		Import an artist
+//	@Description	Create a new artist, an artist with the same mbid is updated instead so imports can be repeated.
+//	@Description	Only admins are allowed
+//	@Tags			artists
+//	@Accept			json
+//	@Produce		json
+//	@Param			artist body model.Artist true "Artist Information"
+//	@Success		200	{object}	model.Artist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		500	"Internal server error"
+//	@Router			/artists/import [post]
+func (ah *ArtistHandler) ImportArtist(c *gin.Context) {
+	ah.createArtist(c, true)
+}
+
+// createArtist creates the artist described by the body, upsert updates the artist with the same MBID
+func (ah *ArtistHandler) createArtist(c *gin.Context, upsert bool) {
 	type RequestArtist struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
+		Name        string     `json:"name"`
+		Description string     `json:"description"`
+		MBID        *uuid.UUID `json:"mbid"`
+		// UserID is the account managing the artist
+		UserID *uuid.UUID `json:"user_id"`
 	}
 
 	request_artist := RequestArtist{}
 	err := c.BindJSON(&request_artist)
 	if err != nil {
 		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := ah.authorizeManager(c, request_artist.UserID, nil); err != nil {
+		artistErrorResponse(c, err)
+		return
 	}
 
 	artist := &model.Artist{
 		Name:        request_artist.Name,
 		Description: request_artist.Description,
+		MBID:        request_artist.MBID,
+		UserID:      request_artist.UserID,
 	}
 
-	artist, err = ah.repository.CreateArtist(context.Background(), artist)
+	create := ah.repository.CreateArtist
+	if upsert {
+		create = ah.repository.ImportArtist
+	}
+	artist, err = create(context.Background(), artist)
 	if err != nil {
-		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		artistErrorResponse(c, err)
 		return
 	}
 
@@ -97,6 +151,8 @@ func (ah *ArtistHandler) GetInfoArtistByID(c *gin.Context) {
 //		@Description	Get top tracks of an artist using ID
 //		@Tags			artists
 //		@Param 			id path string true "Artist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//		@Param 			role query string false "comma separated credit roles, primary by default. featured lists the tracks the artist appears on, composer,lyricist the ones they wrote" example("composer,lyricist")
+//		@Param 			market query string false "ISO 3166-1 alpha-2 country code the tracks must be licensed in, ignored when the user has a country" example("VN")
 //		@Produce		json
 //		@Success		200	{object}	model.Tracks
 //		@Failure		400 "Bad Request"
@@ -111,9 +167,14 @@ func (ah *ArtistHandler) GetArtistTracksByID(c *gin.Context) {
 		return
 	}
 
-	tracks, err := ah.repository.GetTrackOfArtist(context.Background(), id)
+	roles := []model.CreditRole{}
+	for _, role := range helper.GetList(c, "role") {
+		roles = append(roles, model.CreditRole(role))
+	}
+
+	tracks, err := ah.repository.GetTrackOfArtist(context.Background(), id, middleware.GetUserID(c), middleware.GetMarket(c), roles)
 	if err != nil {
-		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		artistErrorResponse(c, err)
 		return
 	}
 
@@ -130,6 +191,9 @@ func (ah *ArtistHandler) GetArtistTracksByID(c *gin.Context) {
 //	@Tags			artists
 //	@Produce		json
 //	@Param 			name query string false "name of the artist" example("Blue Town")
+//	@Param 			genre query string false "comma separated genre slugs, sub-genres included" example("indie-rock")
+//	@Param 			tag query string false "comma separated tags the artists must all have" example("summer")
+//	@Param 			mbid query string false "MusicBrainz identifier of the artist" example("20244d07-534f-4eff-b4d4-930878889970")
 //	@Param 			sort query string false "criteria for sorting artist-searching results" example("-name", "name")
 //	@Param 			page query int false "searching page" example(2)
 //	@Param 			limit query int false "searching limit" example(10)
@@ -159,15 +223,27 @@ func (ah *ArtistHandler) GetArtistWithFilter(c *gin.Context) {
 	}
 
 	filter := repository.Filter{
-		Props:  map[string]any{"name": name},
+		Props: map[string]any{
+			"name":  name,
+			"genre": helper.GetList(c, "genre"),
+			"tag":   helper.GetList(c, "tag"),
+		},
 		Page:   page,
 		Limit:  limit,
 		SortBy: sort_criterias,
 	}
+	if mbid_string_form := c.Query("mbid"); mbid_string_form != "" {
+		mbid, err := uuid.FromString(mbid_string_form)
+		if err != nil {
+			helper.ErrorResponse(c, custom_error.InvalidIdentifierError{Kind: "MBID", Value: mbid_string_form}, http.StatusBadRequest)
+			return
+		}
+		filter.Props["mbid"] = mbid
+	}
 
 	tracks, err := ah.repository.GetArtistsWithFilter(context.Background(), filter)
 	if err != nil {
-		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		artistErrorResponse(c, err)
 		return
 	}
 
@@ -183,6 +259,7 @@ func (ah *ArtistHandler) GetArtistWithFilter(c *gin.Context) {
 //	 	@Param 			id path string true "Artist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
 //		@Success		200	{object} response.DeleteArtistResponse
 //		@Failure		400 "Bad Request"
+//		@Failure		404 "Not Found"
 //		@Failure		500 "Internal Server Error"
 //		@Router			/artists/{id} [delete]
 func (ah *ArtistHandler) DeleteArtist(c *gin.Context) {
@@ -194,12 +271,22 @@ func (ah *ArtistHandler) DeleteArtist(c *gin.Context) {
 		return
 	}
 
+	images, err := ah.repository.GetImagesOfArtist(context.Background(), id)
+	if err != nil {
+		artistErrorResponse(c, err)
+		return
+	}
+
 	err = ah.repository.DeleteArtist(context.Background(), id)
 	if err != nil {
 		helper.ErrorResponse(c, err, http.StatusInternalServerError)
 		return
 	}
 
+	for _, image := range images {
+		ah.storage.Delete(context.Background(), artwork.ArtistImageKey(id, string(image.Kind), image.Width))
+	}
+
 	delete_response := fmt.Sprintf("delete artist with id %v successfully", id)
 	c.JSON(http.StatusOK, response.DeleteArtistResponse{Response: delete_response})
 }
@@ -214,6 +301,9 @@ func (ah *ArtistHandler) DeleteArtist(c *gin.Context) {
 //	@Param 			artist body model.Artist true "artist information"
 //	@Success		200	{object}	model.Artist
 //	@Failure		400 "Bad Request"
+//	@Failure		403 "Only admins change the managing account"
+//	@Failure		404 "Not Found"
+//	@Failure		409 "MBID belongs to another artist"
 //	@Failure		500 "Internal Server Error"
 //	@Router			/artists [put]
 func (ah *ArtistHandler) UpdateArtist(c *gin.Context) {
@@ -223,10 +313,261 @@ func (ah *ArtistHandler) UpdateArtist(c *gin.Context) {
 		return
 	}
 
+	current, err := ah.repository.GetArtistByID(context.Background(), artist.ID)
+	if err != nil {
+		artistErrorResponse(c, err)
+		return
+	}
+	if err := ah.authorizeManager(c, artist.UserID, current.UserID); err != nil {
+		artistErrorResponse(c, err)
+		return
+	}
+
 	if err := ah.repository.UpdateArtist(context.Background(), &artist); err != nil {
-		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		artistErrorResponse(c, err)
 		return
 	}
 
 	c.JSON(http.StatusAccepted, artist)
 }
+
+// GetImageOfArtist godoc
+//
+//	@Summary		Get an image of an artist
+//	@Description	Get the avatar or the banner of an artist at one of the widths listed in its Images
+//	@Tags			artists
+//	@Produce		jpeg
+//	@Param			id path string true "Artist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			kind path string true "avatar or banner" example("avatar")
+//	@Param			width path int true "width of the image, 640, 300 or 64" example(300)
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/artists/{id}/images/{kind}/{width} [get]
+func (ah *ArtistHandler) GetImageOfArtist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	kind, err := imageKind(c)
+	if err != nil {
+		artistErrorResponse(c, err)
+		return
+	}
+
+	width, err := strconv.Atoi(c.Params.ByName("width"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	images, err := ah.repository.GetImagesOfArtist(context.Background(), id)
+	if err != nil {
+		artistErrorResponse(c, err)
+		return
+	}
+
+	stored := false
+	for _, image := range images {
+		if image.Kind == kind && image.Width == width {
+			stored = true
+			break
+		}
+	}
+	if !stored {
+		artistErrorResponse(c, custom_error.NonExistArtistImageError{})
+		return
+	}
+
+	file, err := ah.storage.Open(context.Background(), artwork.ArtistImageKey(id, string(kind), width))
+	if err != nil {
+		if _, ok := err.(custom_error.NonExistObjectError); ok {
+			err = custom_error.NonExistArtistImageError{}
+		}
+		artistErrorResponse(c, err)
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Type", "image/jpeg")
+	http.ServeContent(c.Writer, c.Request, string(kind)+".jpg", time.Time{}, file)
+}
+
+// SetImageOfArtist godoc
+//
+//	@Summary		Upload avatar or banner of an artist
+//	@Description	Upload a JPEG or PNG image as the request body or as the "file" form field. It is stored as JPEG
+//	@Description	640, 300 and 64 pixels wide, avatars are cropped to a square and banners to a 3:1 ratio
+//	@Tags			artists
+//	@Accept			jpeg,png
+//	@Produce		json
+//	@Param			id path string true "Artist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			kind path string true "avatar or banner" example("avatar")
+//	@Success		200	{object}	model.Artist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/artists/{id}/images/{kind} [put]
+func (ah *ArtistHandler) SetImageOfArtist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	kind, err := imageKind(c)
+	if err != nil {
+		artistErrorResponse(c, err)
+		return
+	}
+
+	// nothing is stored for an artist that doesn't exist
+	if _, err := ah.repository.GetImagesOfArtist(context.Background(), id); err != nil {
+		artistErrorResponse(c, err)
+		return
+	}
+
+	body, _, err := uploadedFile(c, artwork.MaxUploadSize)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+
+	img, err := artwork.Decode(body)
+	if err != nil {
+		artistErrorResponse(c, err)
+		return
+	}
+
+	images := make([]model.Image, 0, len(artwork.ImageSizes))
+	for _, width := range artwork.ImageSizes {
+		var resized image.Image
+		if kind == model.ImageAvatar {
+			resized = artwork.Square(img, width)
+		} else {
+			resized = artwork.Banner(img, width)
+		}
+
+		var buffer bytes.Buffer
+		err := artwork.Encode(&buffer, resized)
+		if err == nil {
+			err = ah.storage.Put(context.Background(), artwork.ArtistImageKey(id, string(kind), width), &buffer)
+		}
+		if err != nil {
+			ah.removeImage(id, kind)
+			helper.ErrorResponse(c, err, http.StatusInternalServerError)
+			return
+		}
+		images = append(images, model.Image{Kind: kind, Width: width, Height: resized.Bounds().Dy()})
+	}
+
+	artist, err := ah.repository.SetImagesOfArtist(context.Background(), id, kind, images)
+	if err != nil {
+		ah.removeImage(id, kind)
+		artistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, artist)
+}
+
+// DeleteImageOfArtist godoc
+//
+//	@Summary		Remove avatar or banner of an artist
+//	@Description	Remove every size of the avatar or the banner of an artist
+//	@Tags			artists
+//	@Produce		json
+//	@Param			id path string true "Artist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			kind path string true "avatar or banner" example("banner")
+//	@Success		200	{object}	model.Artist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/artists/{id}/images/{kind} [delete]
+func (ah *ArtistHandler) DeleteImageOfArtist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	kind, err := imageKind(c)
+	if err != nil {
+		artistErrorResponse(c, err)
+		return
+	}
+
+	artist, err := ah.repository.SetImagesOfArtist(context.Background(), id, kind, nil)
+	if err != nil {
+		artistErrorResponse(c, err)
+		return
+	}
+
+	for _, width := range artwork.ImageSizes {
+		ah.storage.Delete(context.Background(), artwork.ArtistImageKey(id, string(kind), width))
+	}
+
+	c.JSON(http.StatusOK, artist)
+}
+
+// removeImage cleans up after a failed upload. Sizes of the previous image may already be overwritten,
+// so the image is removed altogether rather than left mixing two uploads
+func (ah *ArtistHandler) removeImage(id uuid.UUID, kind model.ImageKind) {
+	ah.repository.SetImagesOfArtist(context.Background(), id, kind, nil)
+	for _, width := range artwork.ImageSizes {
+		ah.storage.Delete(context.Background(), artwork.ArtistImageKey(id, string(kind), width))
+	}
+}
+
+// authorizeManager makes sure the caller may change the account managing an artist from current to user_id,
+// which decides who edits the artist and its releases, so only admins do it
+func (ah *ArtistHandler) authorizeManager(c *gin.Context, user_id *uuid.UUID, current *uuid.UUID) error {
+	if user_id == nil && current == nil || user_id != nil && current != nil && *user_id == *current {
+		return nil
+	}
+
+	caller_id := middleware.GetUserID(c)
+	if caller_id == uuid.Nil {
+		return custom_error.CatalogPermissionError{}
+	}
+	admin, err := ah.users.CanEditCatalogItem(context.Background(), caller_id, "", uuid.Nil)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return custom_error.CatalogPermissionError{}
+	}
+	return nil
+}
+
+// imageKind reads the kind of artist image from the path
+func imageKind(c *gin.Context) (model.ImageKind, error) {
+	kind := model.ImageKind(c.Params.ByName("kind"))
+	if kind != model.ImageAvatar && kind != model.ImageBanner {
+		return "", custom_error.InvalidImageError{Reason: fmt.Sprintf("unknown image kind %q, expected avatar or banner", kind)}
+	}
+	return kind, nil
+}
+
+func artistErrorResponse(c *gin.Context, err error) {
+	switch err := err.(type) {
+	case custom_error.NonExistArtistError, custom_error.NonExistUserError, custom_error.NonExistArtistImageError:
+		helper.ErrorResponse(c, err, http.StatusNotFound)
+	case custom_error.InvalidSortCriteriaError, custom_error.InvalidIdentifierError, custom_error.InvalidCreditError, custom_error.InvalidImageError:
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+	case custom_error.DuplicateIdentifierError:
+		helper.ErrorResponse(c, err, http.StatusConflict)
+	case custom_error.CatalogPermissionError:
+		helper.ErrorResponse(c, err, http.StatusForbidden)
+	default:
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,385 @@
+package handler
+
+import (
+	"context"
+	"flotify/internal/custom_error"
+	"flotify/internal/helper"
+	"flotify/internal/model"
+	"flotify/internal/repository"
+	"flotify/middleware"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid/v5"
+)
+
+type FolderHandler struct {
+	repository repository.FolderRepository
+}
+
+func NewFolderHandler(repo repository.FolderRepository) FolderHandler {
+	return FolderHandler{
+		repository: repo,
+	}
+}
+
+// GetLibrary godoc
+//
+//	@Summary		Get library of a user
+//	@Description	Get the folders and playlists of a user as a tree, every level in order
+//	@Tags			library
+//	@Param			id path string true "User ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Produce		json
+//	@Success		200	{array}	model.LibraryNode
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		500	"Internal server error"
+//	@Router			/users/{id}/library [get]
+func (fh *FolderHandler) GetLibrary(c *gin.Context) {
+	user_id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	library, err := fh.repository.GetLibrary(context.Background(), user_id)
+	if err != nil {
+		folderErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"library": library})
+}
+
+// CreateFolder godoc
+//
+//	@Summary		Create a folder
+//	@Description	Create a folder in the library of a user, inside parent_id or at the root, before the item at position (appended when omitted)
+//	@Tags			library
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "User ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Folder
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/users/{id}/folders [post]
+func (fh *FolderHandler) CreateFolder(c *gin.Context) {
+	user_id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestFolder struct {
+		Name     string     `json:"name"`
+		ParentID *uuid.UUID `json:"parent_id"`
+		Position *int       `json:"position"`
+	}
+
+	request_folder := RequestFolder{}
+	if err := c.BindJSON(&request_folder); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	position := -1
+	if request_folder.Position != nil {
+		position = *request_folder.Position
+	}
+
+	folder := model.Folder{
+		UserID:   user_id,
+		Name:     request_folder.Name,
+		ParentID: request_folder.ParentID,
+	}
+
+	created_folder, err := fh.repository.CreateFolder(context.Background(), folder, position)
+	if err != nil {
+		folderErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, created_folder)
+}
+
+// RenameFolder godoc
+//
+//	@Summary		Rename a folder
+//	@Description	Change the name of a folder of the library
+//	@Tags			library
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "User ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			folder_id path string true "Folder ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Folder
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/users/{id}/folders/{folder_id} [put]
+func (fh *FolderHandler) RenameFolder(c *gin.Context) {
+	user_id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	folder_id, err := uuid.FromString(c.Params.ByName("folder_id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestFolder struct {
+		Name string `json:"name"`
+	}
+
+	request_folder := RequestFolder{}
+	if err := c.BindJSON(&request_folder); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	folder, err := fh.repository.RenameFolder(context.Background(), user_id, folder_id, request_folder.Name)
+	if err != nil {
+		folderErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, folder)
+}
+
+// DeleteFolder godoc
+//
+//	@Summary		Delete a folder
+//	@Description	Delete a folder of the library, its folders and playlists take its place in the parent folder
+//	@Tags			library
+//	@Produce		json
+//	@Param			id path string true "User ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			folder_id path string true "Folder ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/users/{id}/folders/{folder_id} [delete]
+func (fh *FolderHandler) DeleteFolder(c *gin.Context) {
+	user_id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	folder_id, err := uuid.FromString(c.Params.ByName("folder_id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	if err = fh.repository.DeleteFolder(context.Background(), user_id, folder_id); err != nil {
+		folderErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "delete folder successfully"})
+}
+
+// MoveLibraryItems godoc
+//
+//	@Summary		Move folders and playlists
+//	@Description	Move folders and playlists of the library into the folder parent_id (the root when omitted) before the item at position,
+//	@Description	appended when position is omitted. The moves are applied together or not at all
+//	@Tags			library
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "User ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{array}	model.LibraryNode
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/users/{id}/library/moves [post]
+func (fh *FolderHandler) MoveLibraryItems(c *gin.Context) {
+	user_id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestMove struct {
+		Items    []model.LibraryItem `json:"items"`
+		ParentID *uuid.UUID          `json:"parent_id"`
+		Position *int                `json:"position"`
+	}
+
+	request_move := RequestMove{}
+	if err := c.BindJSON(&request_move); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	position := -1
+	if request_move.Position != nil {
+		position = *request_move.Position
+	}
+
+	library, err := fh.repository.MoveLibraryItems(context.Background(), user_id, request_move.Items, request_move.ParentID, position)
+	if err != nil {
+		folderErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"library": library})
+}
+
+// GetSavedItems godoc
+//
+//	@Summary		Get saved tracks and albums
+//	@Description	Get the tracks and albums saved to the library of a user, the last added first.
+//	@Description	Pre-saved items appear once released, added at their release date. Tracks taken down or not licensed
+//	@Description	in the market are replaced by another version of the same work, with the saved track in linked_from
+//	@Tags			library
+//	@Param			id path string true "User ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			type query string false "comma separated types of items, track or album" example("album")
+//	@Param			market query string false "ISO 3166-1 alpha-2 country code, ignored when the user has a country" example("VN")
+//	@Produce		json
+//	@Success		200	{array}	model.SavedItem
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		500	"Internal server error"
+//	@Router			/users/{id}/library/saved [get]
+func (fh *FolderHandler) GetSavedItems(c *gin.Context) {
+	user_id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	types := []model.LibraryItemType{}
+	for _, item_type := range helper.GetList(c, "type") {
+		types = append(types, model.LibraryItemType(item_type))
+	}
+
+	items, err := fh.repository.GetSavedItems(context.Background(), user_id, middleware.GetMarket(c), types)
+	if err != nil {
+		folderErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// GetPresavedItems godoc
+//
+//	@Summary		Get pre-saved releases
+//	@Description	Get the tracks and albums a user saved before their release, the next release first
+//	@Tags			library
+//	@Param			id path string true "User ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Produce		json
+//	@Success		200	{array}	model.SavedItem
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		500	"Internal server error"
+//	@Router			/users/{id}/library/presaves [get]
+func (fh *FolderHandler) GetPresavedItems(c *gin.Context) {
+	user_id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	items, err := fh.repository.GetPresavedItems(context.Background(), user_id)
+	if err != nil {
+		folderErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// SaveItem godoc
+//
+//	@Summary		Save a track or an album
+//	@Description	Save a track or an album to the library of a user. An item releasing in the future is pre-saved,
+//	@Description	it joins the library at its release
+//	@Tags			library
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "User ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			item body model.LibraryItem true "type (track or album) and id of the item"
+//	@Success		200	{object}	model.SavedItem
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/users/{id}/library/saved [post]
+func (fh *FolderHandler) SaveItem(c *gin.Context) {
+	user_id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	item := model.LibraryItem{}
+	if err := c.BindJSON(&item); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	saved_item, err := fh.repository.SaveItem(context.Background(), user_id, item)
+	if err != nil {
+		folderErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, saved_item)
+}
+
+// UnsaveItem godoc
+//
+//	@Summary		Remove a saved track or album
+//	@Description	Remove a track or an album from the library of a user, or cancel its pre-save
+//	@Tags			library
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "User ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			item body model.LibraryItem true "type (track or album) and id of the item"
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/users/{id}/library/saved [delete]
+func (fh *FolderHandler) UnsaveItem(c *gin.Context) {
+	user_id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	item := model.LibraryItem{}
+	if err := c.BindJSON(&item); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := fh.repository.UnsaveItem(context.Background(), user_id, item); err != nil {
+		folderErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "remove saved item successfully"})
+}
+
+func folderErrorResponse(c *gin.Context, err error) {
+	switch err := err.(type) {
+	case custom_error.NonExistFolderError, custom_error.NonExistPlaylistError, custom_error.NonExistTrackError, custom_error.NonExistAlbumError:
+		helper.ErrorResponse(c, err, http.StatusNotFound)
+	case custom_error.InvalidFolderMoveError, custom_error.InvalidLibraryItemError, custom_error.InvalidPositionError, custom_error.InvalidSavedItemError:
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+	default:
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+	}
+}
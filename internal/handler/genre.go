@@ -0,0 +1,340 @@
+package handler
+
+import (
+	"context"
+	"flotify/internal/custom_error"
+	"flotify/internal/helper"
+	"flotify/internal/model"
+	"flotify/internal/repository"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid/v5"
+)
+
+type GenreHandler struct {
+	repository repository.GenreRepository
+}
+
+func NewGenreHandler(repo repository.GenreRepository) GenreHandler {
+	return GenreHandler{
+		repository: repo,
+	}
+}
+
+// GetGenres godoc
+//
+//	@Summary		Browse genres
+//	@Description	List the top level genres, or the sub-genres of parent. Counts include the items of sub-genres
+//	@Tags			genres
+//	@Produce		json
+//	@Param			parent query string false "slug of the parent genre" example("rock")
+//	@Success		200	{array}	model.GenreCount
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/genres [get]
+func (gh *GenreHandler) GetGenres(c *gin.Context) {
+	genres, err := gh.repository.GetGenres(context.Background(), c.Query("parent"))
+	if err != nil {
+		genreErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"genres": genres})
+}
+
+// GetGenre godoc
+//
+//	@Summary		Get a genre
+//	@Description	Get a genre with the number of its sub-genres, tracks, albums and artists
+//	@Tags			genres
+//	@Produce		json
+//	@Param			slug path string true "Genre slug" example("indie-rock")
+//	@Success		200	{object}	model.GenreCount
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/genres/{slug} [get]
+func (gh *GenreHandler) GetGenre(c *gin.Context) {
+	genre, err := gh.repository.GetGenreBySlug(context.Background(), c.Params.ByName("slug"))
+	if err != nil {
+		genreErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, genre)
+}
+
+// CreateGenre godoc
+//
+//	@Summary		Create a genre
+//	@Description	Create a genre under parent_id, or at the top level. The slug is derived from the name unless given
+//	@Tags			genres
+//	@Accept			json
+//	@Produce		json
+//	@Param			genre body model.Genre true "Genre information"
+//	@Success		200	{object}	model.Genre
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		409	"Conflict"
+//	@Failure		500	"Internal server error"
+//	@Router			/genres [post]
+func (gh *GenreHandler) CreateGenre(c *gin.Context) {
+	type RequestGenre struct {
+		Name     string     `json:"name"`
+		Slug     string     `json:"slug"`
+		ParentID *uuid.UUID `json:"parent_id"`
+	}
+	request_genre := RequestGenre{}
+	if err := c.BindJSON(&request_genre); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	genre, err := gh.repository.CreateGenre(context.Background(), model.Genre{
+		Name:     request_genre.Name,
+		Slug:     request_genre.Slug,
+		ParentID: request_genre.ParentID,
+	})
+	if err != nil {
+		genreErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, genre)
+}
+
+// DeleteGenre godoc
+//
+//	@Summary		Delete a genre
+//	@Description	Delete a genre, its sub-genres are moved under its parent
+//	@Tags			genres
+//	@Produce		json
+//	@Param			id path string true "Genre ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/genres/{id} [delete]
+func (gh *GenreHandler) DeleteGenre(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := gh.repository.DeleteGenre(context.Background(), id); err != nil {
+		genreErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "delete genre successfully"})
+}
+
+// GetTags godoc
+//
+//	@Summary		Browse tags
+//	@Description	List the most used tags, optionally only those starting with prefix
+//	@Tags			genres
+//	@Produce		json
+//	@Param			prefix query string false "start of the tags" example("sum")
+//	@Param			limit query int false "searching limit" example(10)
+//	@Success		200	{array}	model.TagCount
+//	@Failure		400	"Bad request"
+//	@Failure		500	"Internal server error"
+//	@Router			/tags [get]
+func (gh *GenreHandler) GetTags(c *gin.Context) {
+	limit, err := helper.GetLimit(c)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	tags, err := gh.repository.GetTags(context.Background(), c.Query("prefix"), limit)
+	if err != nil {
+		genreErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// SetGenresOfTrack godoc
+//
+//	@Summary		Set genres of a track
+//	@Description	Replace the genres of a track by their slugs
+//	@Tags			tracks
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{array}	model.Genre
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id}/genres [put]
+func (gh *GenreHandler) SetGenresOfTrack(c *gin.Context) {
+	gh.setGenresOf(c, model.TaxonomyTrack)
+}
+
+// SetGenresOfAlbum godoc
+//
+//	@Summary		Set genres of an album
+//	@Description	Replace the genres of an album by their slugs
+//	@Tags			albums
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Album ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{array}	model.Genre
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/albums/{id}/genres [put]
+func (gh *GenreHandler) SetGenresOfAlbum(c *gin.Context) {
+	gh.setGenresOf(c, model.TaxonomyAlbum)
+}
+
+// SetGenresOfArtist godoc
+//
+//	@Summary		Set genres of an artist
+//	@Description	Replace the genres of an artist by their slugs
+//	@Tags			artists
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Artist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{array}	model.Genre
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/artists/{id}/genres [put]
+func (gh *GenreHandler) SetGenresOfArtist(c *gin.Context) {
+	gh.setGenresOf(c, model.TaxonomyArtist)
+}
+
+func (gh *GenreHandler) setGenresOf(c *gin.Context, target model.TaxonomyTarget) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestGenres struct {
+		Genres []string `json:"genres"`
+	}
+	request_genres := RequestGenres{}
+	if err := c.BindJSON(&request_genres); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	genres, err := gh.repository.SetGenresOf(context.Background(), target, id, request_genres.Genres)
+	if err != nil {
+		genreErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"genres": genres})
+}
+
+// SetTagsOfTrack godoc
+//
+//	@Summary		Set tags of a track
+//	@Description	Replace the free-form tags of a track, tags are lowercased
+//	@Tags			tracks
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id}/tags [put]
+func (gh *GenreHandler) SetTagsOfTrack(c *gin.Context) {
+	gh.setTagsOf(c, model.TaxonomyTrack)
+}
+
+// SetTagsOfAlbum godoc
+//
+//	@Summary		Set tags of an album
+//	@Description	Replace the free-form tags of an album, tags are lowercased
+//	@Tags			albums
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Album ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/albums/{id}/tags [put]
+func (gh *GenreHandler) SetTagsOfAlbum(c *gin.Context) {
+	gh.setTagsOf(c, model.TaxonomyAlbum)
+}
+
+// SetTagsOfArtist godoc
+//
+//	@Summary		Set tags of an artist
+//	@Description	Replace the free-form tags of an artist, tags are lowercased
+//	@Tags			artists
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Artist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/artists/{id}/tags [put]
+func (gh *GenreHandler) SetTagsOfArtist(c *gin.Context) {
+	gh.setTagsOf(c, model.TaxonomyArtist)
+}
+
+func (gh *GenreHandler) setTagsOf(c *gin.Context, target model.TaxonomyTarget) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestTags struct {
+		Tags []string `json:"tags"`
+	}
+	request_tags := RequestTags{}
+	if err := c.BindJSON(&request_tags); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	tags, err := gh.repository.SetTagsOf(context.Background(), target, id, request_tags.Tags)
+	if err != nil {
+		genreErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+func genreErrorResponse(c *gin.Context, err error) {
+	switch err := err.(type) {
+	case custom_error.NonExistGenreError, custom_error.NonExistTrackError, custom_error.NonExistAlbumError, custom_error.NonExistArtistError:
+		helper.ErrorResponse(c, err, http.StatusNotFound)
+	case custom_error.DuplicateGenreError:
+		helper.ErrorResponse(c, err, http.StatusConflict)
+	case custom_error.InvalidGenreError:
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+	default:
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+	}
+}
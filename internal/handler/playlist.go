@@ -1 +1,1399 @@
 package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flotify/internal/artwork"
+	"flotify/internal/custom_error"
+	"flotify/internal/helper"
+	"flotify/internal/model"
+	"flotify/internal/playlistfile"
+	"flotify/internal/repository"
+	"flotify/internal/response"
+	"flotify/internal/storage"
+	"flotify/middleware"
+	"fmt"
+	"image"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid/v5"
+)
+
+type PlaylistHandler struct {
+	repository repository.PlaylistRepository
+	storage    storage.Storage
+	// users tells who is an admin, only admins copy playlists into the account of another user
+	users repository.UserRepository
+}
+
+func NewPlaylistHandler(repo repository.PlaylistRepository, store storage.Storage, user_repo repository.UserRepository) PlaylistHandler {
+	return PlaylistHandler{
+		repository: repo,
+		storage:    store,
+		users:      user_repo,
+	}
+}
+
+// CreatePlaylist godoc
+//
+//	@Summary		Create a playlist
+//	@Description	Create a new empty playlist owned by the authenticated user, visibility is public unless specified.
+//	@Description	When rules are given the playlist is a smart playlist holding the tracks matching them
+//	@Tags			playlists
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists [post]
+func (ph *PlaylistHandler) CreatePlaylist(c *gin.Context) {
+	type RequestPlaylist struct {
+		Name       string                   `json:"name"`
+		Visibility model.PlaylistVisibility `json:"visibility"`
+		Rules      *model.SmartRules        `json:"rules"`
+	}
+
+	request_playlist := RequestPlaylist{}
+	if err := c.BindJSON(&request_playlist); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	playlist := model.Playlist{
+		Name:       request_playlist.Name,
+		UserID:     middleware.GetUserID(c),
+		Visibility: request_playlist.Visibility,
+		Rules:      request_playlist.Rules,
+	}
+
+	created_playlist, err := ph.repository.CreatePlaylist(context.Background(), playlist)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, created_playlist)
+}
+
+// GetPlaylist godoc
+//
+//	@Summary		Get information of a playlist
+//	@Description	Get information of a playlist by its ID, private playlists are only visible to their members
+//	@Tags			playlists
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Produce		json
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id} [get]
+func (ph *PlaylistHandler) GetPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := ph.repository.GetPlaylist(context.Background(), id)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// GetPlaylistsOfUser godoc
+//
+//	@Summary		Get library playlists of a user
+//	@Description	Get all playlists owned by or shared with the user, alongside the playlists the user follows.
+//	@Description	The TrackIDList of smart playlists which aren't materialized is null, it is given when the playlist is read
+//	@Tags			playlists
+//	@Param			id path string true "User ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Produce		json
+//	@Success		200	{object}	model.Playlists
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		500	"Internal server error"
+//	@Router			/users/{id}/playlists [get]
+func (ph *PlaylistHandler) GetPlaylistsOfUser(c *gin.Context) {
+	user_id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	playlists, err := ph.repository.GetPlaylistsOfUser(context.Background(), user_id, user_id)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	followed_playlists, err := ph.repository.GetFollowedPlaylists(context.Background(), user_id)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"playlists": playlists, "followed": followed_playlists})
+}
+
+// GetPublicPlaylistsOfUser godoc
+//
+//	@Summary		Get playlists of a user
+//	@Description	Get the playlists of a user visible to the caller, other users only see public playlists.
+//	@Description	The TrackIDList of smart playlists which aren't materialized is null, it is given when the playlist is read
+//	@Tags			playlists
+//	@Param			user_id query string true "User ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Produce		json
+//	@Success		200	{object}	model.Playlists
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists [get]
+func (ph *PlaylistHandler) GetPublicPlaylistsOfUser(c *gin.Context) {
+	user_id, err := uuid.FromString(c.Query("user_id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	playlists, err := ph.repository.GetPlaylistsOfUser(context.Background(), user_id, middleware.GetUserID(c))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"playlists": playlists})
+}
+
+// GetTracksOfPlaylist godoc
+//
+//	@Summary		Get tracks of a playlist
+//	@Description	Get full track objects of a playlist in order, with who added each of them and when.
+//	@Description	Tracks taken down or not licensed in the market of the caller are replaced by another version of the same work,
+//	@Description	with the track held by the playlist in LinkedFrom, and left out when no version plays
+//	@Tags			playlists
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			market query string false "ISO 3166-1 alpha-2 country code, ignored when the user has a country" example("VN")
+//	@Produce		json
+//	@Success		200	{object}	model.PlaylistTracks
+//	@Failure		400	"Bad request"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/tracks [get]
+func (ph *PlaylistHandler) GetTracksOfPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	tracks, err := ph.repository.GetTracksOfPlaylist(context.Background(), id, middleware.GetUserID(c), middleware.GetMarket(c))
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tracks": tracks})
+}
+
+// AddTracksToPlaylist godoc
+//
+//	@Summary		Add tracks to a playlist
+//	@Description	Insert tracks before the given position (append when omitted), only the owner and editors are allowed.
+//	@Description	When snapshot_id is given the edit is rejected if the playlist has changed since that snapshot
+//	@Tags			playlists
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		409	"Stale snapshot"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/tracks [post]
+func (ph *PlaylistHandler) AddTracksToPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestTracks struct {
+		TrackID    []uuid.UUID `json:"track_id"`
+		Position   *int        `json:"position"`
+		SnapshotID uuid.UUID   `json:"snapshot_id"`
+	}
+
+	request_tracks := RequestTracks{}
+	if err := c.BindJSON(&request_tracks); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	position := -1
+	if request_tracks.Position != nil {
+		position = *request_tracks.Position
+	}
+
+	playlist, err := ph.repository.AddTracksToPlaylist(
+		context.Background(),
+		id,
+		middleware.GetUserID(c),
+		request_tracks.TrackID,
+		position,
+		request_tracks.SnapshotID,
+	)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// DeleteTracksFromPlaylist godoc
+//
+//	@Summary		Remove tracks from a playlist
+//	@Description	Remove tracks from a playlist, only the owner and editors are allowed.
+//	@Description	Every occurrence of a track is removed unless its positions are given
+//	@Tags			playlists
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		409	"Stale snapshot"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/tracks [delete]
+func (ph *PlaylistHandler) DeleteTracksFromPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestOccurrence struct {
+		TrackID   uuid.UUID `json:"track_id"`
+		Positions []int     `json:"positions"`
+	}
+	type RequestTracks struct {
+		TrackID    []uuid.UUID         `json:"track_id"`
+		Tracks     []RequestOccurrence `json:"tracks"`
+		SnapshotID uuid.UUID           `json:"snapshot_id"`
+	}
+
+	request_tracks := RequestTracks{}
+	if err := c.BindJSON(&request_tracks); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	occurrences := []repository.TrackOccurrence{}
+	for _, track_id := range request_tracks.TrackID {
+		occurrences = append(occurrences, repository.TrackOccurrence{TrackID: track_id})
+	}
+	for _, track := range request_tracks.Tracks {
+		occurrences = append(occurrences, repository.TrackOccurrence{TrackID: track.TrackID, Positions: track.Positions})
+	}
+
+	playlist, err := ph.repository.DeleteTracksFromPlaylist(
+		context.Background(),
+		id,
+		middleware.GetUserID(c),
+		occurrences,
+		request_tracks.SnapshotID,
+	)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// ReorderTracksOfPlaylist godoc
+//
+//	@Summary		Reorder tracks of a playlist
+//	@Description	Move range_length tracks starting at range_start to the position before insert_before, only the owner and editors are allowed
+//	@Tags			playlists
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		409	"Stale snapshot"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/tracks [put]
+func (ph *PlaylistHandler) ReorderTracksOfPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestReorder struct {
+		RangeStart   int       `json:"range_start"`
+		InsertBefore int       `json:"insert_before"`
+		RangeLength  *int      `json:"range_length"`
+		SnapshotID   uuid.UUID `json:"snapshot_id"`
+	}
+
+	request_reorder := RequestReorder{}
+	if err := c.BindJSON(&request_reorder); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	range_length := 1
+	if request_reorder.RangeLength != nil {
+		range_length = *request_reorder.RangeLength
+	}
+
+	playlist, err := ph.repository.ReorderTracksOfPlaylist(
+		context.Background(),
+		id,
+		middleware.GetUserID(c),
+		request_reorder.RangeStart,
+		request_reorder.InsertBefore,
+		range_length,
+		request_reorder.SnapshotID,
+	)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// DeletePlaylist godoc
+//
+//	@Summary		Delete a playlist
+//	@Description	Delete a playlist using ID, only the owner is allowed
+//	@Tags			playlists
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	response.DeletePlaylistResponse
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id} [delete]
+func (ph *PlaylistHandler) DeletePlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	err = ph.repository.DeletePlaylist(context.Background(), id)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	if err = ph.storage.Delete(context.Background(), artwork.PlaylistCoverKey(id)); err != nil {
+		c.Error(err)
+	}
+
+	delete_response := fmt.Sprintf("delete playlist with id %v successfully", id)
+	c.JSON(http.StatusOK, response.DeletePlaylistResponse{Response: delete_response})
+}
+
+// RenamePlaylist godoc
+//
+//	@Summary		Rename a playlist
+//	@Description	Change the name of a playlist, only the owner and editors are allowed
+//	@Tags			playlists
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		409	"Stale snapshot"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id} [put]
+func (ph *PlaylistHandler) RenamePlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestPlaylist struct {
+		Name       string    `json:"name"`
+		SnapshotID uuid.UUID `json:"snapshot_id"`
+	}
+
+	request_playlist := RequestPlaylist{}
+	if err := c.BindJSON(&request_playlist); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := ph.repository.RenamePlaylist(
+		context.Background(),
+		id,
+		middleware.GetUserID(c),
+		request_playlist.Name,
+		request_playlist.SnapshotID,
+	)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// SetVisibilityOfPlaylist godoc
+//
+//	@Summary		Change visibility of a playlist
+//	@Description	Make a playlist public, unlisted or private, only the owner is allowed
+//	@Tags			playlists
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/visibility [put]
+func (ph *PlaylistHandler) SetVisibilityOfPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestVisibility struct {
+		Visibility model.PlaylistVisibility `json:"visibility"`
+	}
+
+	request_visibility := RequestVisibility{}
+	if err := c.BindJSON(&request_visibility); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := ph.repository.SetVisibilityOfPlaylist(context.Background(), id, request_visibility.Visibility)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// FollowPlaylist godoc
+//
+//	@Summary		Follow a playlist
+//	@Description	Follow a playlist visible to the authenticated user
+//	@Tags			playlists
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/followers [post]
+func (ph *PlaylistHandler) FollowPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	err = ph.repository.FollowPlaylist(context.Background(), id, middleware.GetUserID(c))
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "follow playlist successfully"})
+}
+
+// UnfollowPlaylist godoc
+//
+//	@Summary		Unfollow a playlist
+//	@Description	Stop following a playlist
+//	@Tags			playlists
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/followers [delete]
+func (ph *PlaylistHandler) UnfollowPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	err = ph.repository.UnfollowPlaylist(context.Background(), id, middleware.GetUserID(c))
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "unfollow playlist successfully"})
+}
+
+// GetVersionsOfPlaylist godoc
+//
+//	@Summary		Get version history of a playlist
+//	@Description	Get the versions of a playlist produced by its changes, newest first. Only members are allowed
+//	@Tags			playlists
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			page query int false "searching page" example(2)
+//	@Param			limit query int false "searching limit" example(10)
+//	@Success		200	{array}	model.PlaylistVersion
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/versions [get]
+func (ph *PlaylistHandler) GetVersionsOfPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	page, err := helper.GetPage(c)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	limit, err := helper.GetLimit(c)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	filter := repository.Filter{
+		Page:  page,
+		Limit: limit,
+	}
+
+	versions, err := ph.repository.GetVersionsOfPlaylist(context.Background(), id, filter)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// GetPlaylistVersion godoc
+//
+//	@Summary		Get a version of a playlist
+//	@Description	Get the name and tracks a playlist had at the given snapshot. Only members are allowed
+//	@Tags			playlists
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			snapshot_id path string true "Snapshot ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.PlaylistVersion
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/versions/{snapshot_id} [get]
+func (ph *PlaylistHandler) GetPlaylistVersion(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	snapshot_id, err := uuid.FromString(c.Params.ByName("snapshot_id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	version, err := ph.repository.GetPlaylistVersion(context.Background(), id, snapshot_id)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, version)
+}
+
+// RestorePlaylist godoc
+//
+//	@Summary		Restore a playlist
+//	@Description	Restore the name and tracks a playlist had at the given snapshot, only the owner and editors are allowed
+//	@Tags			playlists
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			snapshot_id path string true "Snapshot ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/versions/{snapshot_id}/restore [post]
+func (ph *PlaylistHandler) RestorePlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	snapshot_id, err := uuid.FromString(c.Params.ByName("snapshot_id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := ph.repository.RestorePlaylist(context.Background(), id, middleware.GetUserID(c), snapshot_id)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// GetMembersOfPlaylist godoc
+//
+//	@Summary		Get members of a playlist
+//	@Description	Get the users a playlist is shared with and their roles, only members are allowed
+//	@Tags			playlists
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{array}	model.PlaylistMember
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/members [get]
+func (ph *PlaylistHandler) GetMembersOfPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	members, err := ph.repository.GetMembersOfPlaylist(context.Background(), id)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// AddMemberToPlaylist godoc
+//
+//	@Summary		Share a playlist
+//	@Description	Invite a user to a playlist as editor or viewer, inviting a member again changes its role. Only the owner is allowed
+//	@Tags			playlists
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.PlaylistMember
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/members [post]
+func (ph *PlaylistHandler) AddMemberToPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestMember struct {
+		UserID uuid.UUID          `json:"user_id"`
+		Role   model.PlaylistRole `json:"role"`
+	}
+
+	request_member := RequestMember{}
+	if err := c.BindJSON(&request_member); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	member, err := ph.repository.AddMemberToPlaylist(context.Background(), id, request_member.UserID, request_member.Role)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// DeleteMemberFromPlaylist godoc
+//
+//	@Summary		Revoke access to a playlist
+//	@Description	Remove a member from a playlist. The owner can remove anyone, other members can only leave the playlist themselves
+//	@Tags			playlists
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			user_id path string true "User ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/members/{user_id} [delete]
+func (ph *PlaylistHandler) DeleteMemberFromPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	user_id, err := uuid.FromString(c.Params.ByName("user_id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	if middleware.GetPlaylistRole(c) != model.PlaylistOwner && middleware.GetUserID(c) != user_id {
+		helper.ErrorResponse(c, custom_error.PlaylistPermissionError{}, http.StatusForbidden)
+		return
+	}
+
+	err = ph.repository.DeleteMemberFromPlaylist(context.Background(), id, user_id)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "remove member successfully"})
+}
+
+// SetRulesOfPlaylist godoc
+//
+//	@Summary		Set rules of a smart playlist
+//	@Description	Turn a playlist into a smart playlist or replace its rules, only the owner and editors are allowed.
+//	@Description	Smart playlists are evaluated on every read unless materialized, then their tracks only change on refresh
+//	@Tags			playlists
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			rules body model.SmartRules true "Rules of the playlist"
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/rules [put]
+func (ph *PlaylistHandler) SetRulesOfPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	rules := model.SmartRules{}
+	if err := c.BindJSON(&rules); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := ph.repository.SetRulesOfPlaylist(context.Background(), id, middleware.GetUserID(c), rules)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// DeleteRulesOfPlaylist godoc
+//
+//	@Summary		Turn a smart playlist into a normal one
+//	@Description	Drop the rules of a smart playlist and keep the tracks currently matching them, only the owner and editors are allowed
+//	@Tags			playlists
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/rules [delete]
+func (ph *PlaylistHandler) DeleteRulesOfPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := ph.repository.DeleteRulesOfPlaylist(context.Background(), id, middleware.GetUserID(c))
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// RefreshPlaylist godoc
+//
+//	@Summary		Refresh a smart playlist
+//	@Description	Store the tracks currently matching the rules of a smart playlist, only the owner and editors are allowed
+//	@Tags			playlists
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/refresh [post]
+func (ph *PlaylistHandler) RefreshPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := ph.repository.RefreshPlaylist(context.Background(), id, middleware.GetUserID(c))
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// DuplicatePlaylist godoc
+//
+//	@Summary		Copy a playlist
+//	@Description	Copy the name, rules and tracks of a playlist into a new playlist owned by the caller, or by the user of user_id.
+//	@Description	Only admins copy playlists into the account of another user.
+//	@Description	The name and the visibility of the original are kept unless new ones are given
+//	@Tags			playlists
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/copy [post]
+func (ph *PlaylistHandler) DuplicatePlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestCopy struct {
+		Name       string                   `json:"name"`
+		Visibility model.PlaylistVisibility `json:"visibility"`
+		UserID     uuid.UUID                `json:"user_id"`
+	}
+
+	request_copy := RequestCopy{}
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&request_copy); err != nil {
+			helper.ErrorResponse(c, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	user_id := middleware.GetUserID(c)
+	owner_id := user_id
+	if request_copy.UserID != uuid.Nil && request_copy.UserID != user_id {
+		admin, err := ph.users.CanEditCatalogItem(context.Background(), user_id, "", uuid.Nil)
+		if err != nil {
+			playlistErrorResponse(c, err)
+			return
+		}
+		if !admin {
+			helper.ErrorResponse(c, custom_error.PlaylistPermissionError{}, http.StatusForbidden)
+			return
+		}
+		owner_id = request_copy.UserID
+	}
+	playlist := model.Playlist{
+		Name:       request_copy.Name,
+		UserID:     owner_id,
+		Visibility: request_copy.Visibility,
+	}
+
+	duplicated_playlist, err := ph.repository.DuplicatePlaylist(context.Background(), id, user_id, playlist)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, duplicated_playlist)
+}
+
+// MergePlaylists godoc
+//
+//	@Summary		Merge playlists
+//	@Description	Create a playlist holding the tracks of the given playlists one after another, optionally without duplicates.
+//	@Description	Every playlist must be visible to the caller
+//	@Tags			playlists
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/merge [post]
+func (ph *PlaylistHandler) MergePlaylists(c *gin.Context) {
+	type RequestMerge struct {
+		PlaylistID []uuid.UUID              `json:"playlist_id"`
+		Name       string                   `json:"name"`
+		Visibility model.PlaylistVisibility `json:"visibility"`
+		Dedupe     bool                     `json:"dedupe"`
+	}
+
+	request_merge := RequestMerge{}
+	if err := c.BindJSON(&request_merge); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	if len(request_merge.PlaylistID) == 0 {
+		helper.ErrorResponse(c, errors.New("no playlist to merge"), http.StatusBadRequest)
+		return
+	}
+
+	playlist := model.Playlist{
+		Name:       request_merge.Name,
+		UserID:     middleware.GetUserID(c),
+		Visibility: request_merge.Visibility,
+	}
+	if playlist.Name == "" {
+		playlist.Name = "Merged playlist"
+	}
+
+	merged_playlist, err := ph.repository.MergePlaylists(context.Background(), request_merge.PlaylistID, playlist, request_merge.Dedupe)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, merged_playlist)
+}
+
+// DeduplicatePlaylist godoc
+//
+//	@Summary		Remove duplicate tracks of a playlist
+//	@Description	Remove tracks already appearing earlier in the playlist, the same track or the same recording by the same artists.
+//	@Description	Only the owner and editors are allowed
+//	@Tags			playlists
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		409	"Stale snapshot"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/deduplicate [post]
+func (ph *PlaylistHandler) DeduplicatePlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestSnapshot struct {
+		SnapshotID uuid.UUID `json:"snapshot_id"`
+	}
+
+	request_snapshot := RequestSnapshot{}
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&request_snapshot); err != nil {
+			helper.ErrorResponse(c, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	playlist, err := ph.repository.DeduplicatePlaylist(context.Background(), id, middleware.GetUserID(c), request_snapshot.SnapshotID)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// GetCoverOfPlaylist godoc
+//
+//	@Summary		Get cover of a playlist
+//	@Description	Get the uploaded cover of a playlist, playlists without one get a mosaic of the covers of their first four albums,
+//	@Description	or of the artwork of their first four artists when none of their albums has a cover. Tracks taken down
+//	@Description	and tracks or albums not released yet are left out of the mosaic
+//	@Tags			playlists
+//	@Produce		jpeg
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/cover [get]
+func (ph *PlaylistHandler) GetCoverOfPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	cover_key, err := ph.repository.GetCoverOfPlaylist(context.Background(), id)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	if cover_key != "" {
+		cover, err := ph.storage.Open(context.Background(), cover_key)
+		if err == nil {
+			defer cover.Close()
+			c.Header("Content-Type", "image/jpeg")
+			http.ServeContent(c.Writer, c.Request, "cover.jpg", time.Time{}, cover)
+			return
+		}
+		if _, ok := err.(custom_error.NonExistObjectError); !ok {
+			helper.ErrorResponse(c, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	album_id_list, err := ph.repository.GetAlbumsOfPlaylist(context.Background(), id, 4)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	tiles := make([]image.Image, 0, 4)
+	for _, album_id := range album_id_list {
+		tiles = append(tiles, artwork.LoadTile(context.Background(), ph.storage, artwork.AlbumCoverKey(album_id), album_id))
+	}
+
+	if len(tiles) == 0 {
+		artist_id_list, err := ph.repository.GetArtistsOfPlaylist(context.Background(), id, 4)
+		if err != nil {
+			playlistErrorResponse(c, err)
+			return
+		}
+
+		for _, artist_id := range artist_id_list {
+			tiles = append(tiles, artwork.LoadTile(context.Background(), ph.storage, artwork.ArtistImageKey(artist_id, string(model.ImageAvatar), artwork.CoverSize), artist_id))
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := artwork.Encode(&buffer, artwork.Mosaic(tiles, artwork.CoverSize)); err != nil {
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.Data(http.StatusOK, "image/jpeg", buffer.Bytes())
+}
+
+// SetCoverOfPlaylist godoc
+//
+//	@Summary		Upload cover of a playlist
+//	@Description	Upload a JPEG or PNG image as the request body or as the "file" form field, it is cropped to a square
+//	@Description	and stored as a 640x640 JPEG. Only the owner is allowed
+//	@Tags			playlists
+//	@Accept			jpeg,png
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/cover [put]
+func (ph *PlaylistHandler) SetCoverOfPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	body, _, err := uploadedFile(c, artwork.MaxUploadSize)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+
+	img, err := artwork.Decode(body)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	var buffer bytes.Buffer
+	if err := artwork.Encode(&buffer, artwork.Square(img, artwork.CoverSize)); err != nil {
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	cover_key := artwork.PlaylistCoverKey(id)
+	if err := ph.storage.Put(context.Background(), cover_key, &buffer); err != nil {
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	playlist, err := ph.repository.SetCoverOfPlaylist(context.Background(), id, cover_key)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// DeleteCoverOfPlaylist godoc
+//
+//	@Summary		Remove cover of a playlist
+//	@Description	Remove the uploaded cover so the playlist falls back to the generated mosaic. Only the owner is allowed
+//	@Tags			playlists
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Playlist
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/cover [delete]
+func (ph *PlaylistHandler) DeleteCoverOfPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := ph.repository.SetCoverOfPlaylist(context.Background(), id, "")
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	if err := ph.storage.Delete(context.Background(), artwork.PlaylistCoverKey(id)); err != nil {
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// ExportPlaylist godoc
+//
+//	@Summary		Export a playlist
+//	@Description	Download the tracks of a playlist as a m3u8, xspf or json file. Tracks are referenced by ID so the file can be imported again.
+//	@Description	The file lists the tracks the caller plays: relinked versions replace the tracks taken down or not licensed in their market
+//	@Description	and unreleased tracks are left out
+//	@Tags			playlists
+//	@Produce		json
+//	@Param			id path string true "Playlist ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			format query string false "m3u8, xspf or json (default)" example("m3u8")
+//	@Param			market query string false "ISO 3166-1 alpha-2 country code, ignored when the user has a country" example("VN")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/{id}/export [get]
+func (ph *PlaylistHandler) ExportPlaylist(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	format, err := playlistfile.ParseFormat(c.DefaultQuery("format", string(playlistfile.JSON)))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	file, err := ph.repository.ExportPlaylist(context.Background(), id, middleware.GetUserID(c), middleware.GetMarket(c))
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	var buffer bytes.Buffer
+	if err := playlistfile.Encode(&buffer, format, *file); err != nil {
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("%s.%s", strings.NewReplacer("/", "_", "\\", "_").Replace(file.Name), format)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Data(http.StatusOK, format.ContentType(), buffer.Bytes())
+}
+
+// ImportPlaylist godoc
+//
+//	@Summary		Import a playlist
+//	@Description	Create a playlist from a m3u8, xspf or json file sent as the request body or as the "file" form field.
+//	@Description	Entries are matched to catalog tracks by ID, or by artist, title and length. Unmatched entries are listed in the report.
+//	@Description	With dry_run the report is returned without creating the playlist
+//	@Tags			playlists
+//	@Accept			json
+//	@Produce		json
+//	@Param			format query string false "m3u8, xspf or json, guessed from the file name when omitted" example("m3u8")
+//	@Param			name query string false "Name of the playlist, taken from the file when omitted" example("Chill vibes")
+//	@Param			visibility query string false "public, unlisted or private" example("private")
+//	@Param			dry_run query bool false "Only match the entries" example(true)
+//	@Success		200	{object}	model.PlaylistImportReport
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		500	"Internal server error"
+//	@Router			/playlists/import [post]
+func (ph *PlaylistHandler) ImportPlaylist(c *gin.Context) {
+	body, filename, err := uploadedFile(c, maxPlaylistFileSize)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+
+	var format playlistfile.Format
+	if format_string_form := c.Query("format"); format_string_form != "" || filename == "" {
+		format, err = playlistfile.ParseFormat(format_string_form)
+	} else {
+		format, err = playlistfile.FormatOfFile(filename)
+	}
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	dry_run := false
+	if dry_run_string_form := c.Query("dry_run"); dry_run_string_form != "" {
+		dry_run, err = strconv.ParseBool(dry_run_string_form)
+		if err != nil {
+			helper.ErrorResponse(c, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	file, err := playlistfile.Decode(http.MaxBytesReader(c.Writer, body, maxPlaylistFileSize), format)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	playlist := model.Playlist{
+		Name:       c.DefaultQuery("name", file.Name),
+		UserID:     middleware.GetUserID(c),
+		Visibility: model.PlaylistVisibility(c.Query("visibility")),
+	}
+	if playlist.Name == "" {
+		playlist.Name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	if playlist.Name == "" || playlist.Name == "." {
+		playlist.Name = "Imported playlist"
+	}
+
+	report, err := ph.repository.ImportPlaylist(context.Background(), playlist, file.Entries, dry_run)
+	if err != nil {
+		playlistErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+const maxPlaylistFileSize = 10 << 20
+
+// uploadFormOverhead is what a multipart form may add to the file it carries: boundaries, headers and other fields
+const uploadFormOverhead = 64 << 10
+
+// uploadedFile returns the file sent in the "file" form field and its name, or the raw body when no form is sent.
+// The request body is limited to max_size and the form overhead before anything is read, so a large form
+// is never spooled to disk
+func uploadedFile(c *gin.Context, max_size int64) (io.ReadCloser, string, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max_size+uploadFormOverhead)
+	if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		return c.Request.Body, "", nil
+	}
+
+	file_header, err := c.FormFile("file")
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := file_header.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	return file, file_header.Filename, nil
+}
+
+func playlistErrorResponse(c *gin.Context, err error) {
+	switch err := err.(type) {
+	case custom_error.NonExistPlaylistError:
+		helper.ErrorResponse(c, err, http.StatusNotFound)
+	case custom_error.PlaylistPermissionError:
+		helper.ErrorResponse(c, err, http.StatusForbidden)
+	case custom_error.InvalidPositionError:
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+	case custom_error.SnapshotMismatchError, custom_error.SmartPlaylistError:
+		helper.ErrorResponse(c, err, http.StatusConflict)
+	case custom_error.NotSmartPlaylistError, custom_error.InvalidSmartRulesError, custom_error.InvalidSortCriteriaError:
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+	case custom_error.UnsupportedPlaylistFormatError, custom_error.InvalidPlaylistFileError, custom_error.InvalidImageError:
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+	case custom_error.InvalidPlaylistRoleError, custom_error.OwnerMembershipError, custom_error.InvalidPlaylistVisibilityError:
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+	case custom_error.NonExistPlaylistMemberError, custom_error.NonExistUserError, custom_error.NonExistPlaylistVersionError:
+		helper.ErrorResponse(c, err, http.StatusNotFound)
+	default:
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+	}
+}
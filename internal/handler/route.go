@@ -3,7 +3,9 @@ package handler
 import (
 	"flotify/internal/auth"
 	"flotify/internal/config"
+	"flotify/internal/model"
 	"flotify/internal/repository"
+	"flotify/internal/storage"
 	"flotify/middleware"
 
 	"github.com/gin-gonic/gin"
@@ -18,33 +20,149 @@ func InitRouter(dbpool *pgxpool.Pool, authdbpool *pgxpool.Pool) *gin.Engine {
 	router.Use(gin.Recovery())
 	router.GET("/docs/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	repo := auth.NewAuthRepository(authdbpool, config.LoadAuthConfig().SecretKey)
+	auth_manager := auth.NewAuthManager(config.LoadAuthConfig().SecretKey, *repo)
+
+	file_storage := storage.NewLocalStorage(config.LoadStorageConfig().Dir)
+
+	// catalog edits are reserved to admins and, for an item, to the accounts managing its artists
+	user_repo := repository.NewPostgresUserRepository(dbpool)
+	admin := middleware.AuthAdmin(auth_manager, user_repo)
+
+	genre_repo := repository.NewPostgresGenreRepository(dbpool)
+	genre_handler := NewGenreHandler(genre_repo)
+	genre_subrouter := router.Group("/genres")
+	{
+		genre_subrouter.GET("/", genre_handler.GetGenres)
+		genre_subrouter.GET("/:slug", genre_handler.GetGenre)
+		genre_subrouter.POST("/", admin, genre_handler.CreateGenre)
+		genre_subrouter.DELETE("/:id", admin, genre_handler.DeleteGenre)
+	}
+	router.GET("/tags", genre_handler.GetTags)
+
+	// listings hide explicit tracks from authenticated users who chose so, and releases from users who can't see them yet
+	optional_auth := middleware.OptionalAuthenticate(auth_manager)
+
+	// catalog reads are restricted to the market of the caller, it runs after the authentication middlewares
+	market := middleware.Market(user_repo, config.LoadMarketConfig().Default)
+
 	track_repo := repository.NewPostgresTrackRepository(dbpool)
-	track_handler := NewTrackHandler(track_repo)
+	track_handler := NewTrackHandler(track_repo, file_storage, auth_manager)
 	track_subrouter := router.Group("/tracks")
 	{
-		track_subrouter.POST("/", track_handler.CreateTrack)
-		track_subrouter.GET("/:id", track_handler.GetTrackByID)
-		track_subrouter.PUT("/", track_handler.UpdateTrack)
+		track_editor := middleware.AuthCatalogEditor(auth_manager, user_repo, model.TaxonomyTrack)
+
+		track_subrouter.POST("/", admin, track_handler.CreateTrack)
+		track_subrouter.POST("/import", admin, track_handler.ImportTrack)
+		track_subrouter.GET("/:id", optional_auth, market, track_handler.GetTrackByID)
+		track_subrouter.PUT("/:id", track_editor, track_handler.UpdateTrack)
 		track_subrouter.DELETE("/:id", track_handler.DeleteTrack)
-		track_subrouter.GET("/", track_handler.GetTrackWithFilter)
+		track_subrouter.GET("/", optional_auth, market, track_handler.GetTrackWithFilter)
+		track_subrouter.PUT("/:id/audio", track_editor, track_handler.UploadAudioOfTrack)
+		track_subrouter.GET("/:id/artwork", optional_auth, market, track_handler.GetArtworkOfTrack)
+		track_subrouter.GET("/:id/waveform", optional_auth, market, track_handler.GetWaveformOfTrack)
+		track_subrouter.GET("/:id/stream", middleware.AuthenticateMedia(auth_manager), market, track_handler.StreamTrack)
+		track_subrouter.GET("/:id/stream-url", middleware.Authenticate(auth_manager), market, track_handler.GetStreamURLOfTrack)
+		track_subrouter.PUT("/:id/genres", track_editor, genre_handler.SetGenresOfTrack)
+		track_subrouter.PUT("/:id/tags", track_editor, genre_handler.SetTagsOfTrack)
+		track_subrouter.GET("/:id/lyrics", optional_auth, market, track_handler.GetLyricsOfTrack)
+		track_subrouter.PUT("/:id/lyrics", track_editor, track_handler.SetLyricsOfTrack)
+		track_subrouter.DELETE("/:id/lyrics", track_editor, track_handler.DeleteLyricsOfTrack)
+		track_subrouter.PUT("/:id/credits", track_editor, track_handler.SetCreditsOfTrack)
+		track_subrouter.GET("/:id/versions", optional_auth, market, track_handler.GetVersionsOfTrack)
+		// linking versions moves tracks of other artists between works, so it's left to admins like takedowns
+		track_subrouter.PUT("/:id/versions", admin, track_handler.SetVersionsOfTrack)
+		track_subrouter.POST("/:id/takedown", admin, track_handler.TakeDownTrack)
+		track_subrouter.DELETE("/:id/takedown", admin, track_handler.RestoreTrack)
+	}
+
+	album_repo := repository.NewPostgresAlbumRepository(dbpool)
+	album_handler := NewAlbumHandler(album_repo, file_storage)
+	album_subrouter := router.Group("/albums")
+	{
+		album_editor := middleware.AuthCatalogEditor(auth_manager, user_repo, model.TaxonomyAlbum)
+
+		album_subrouter.POST("/", admin, album_handler.CreateAlbum)
+		album_subrouter.POST("/import", admin, album_handler.ImportAlbum)
+		album_subrouter.GET("/", optional_auth, market, album_handler.GetAlbumsWithFilter)
+		album_subrouter.GET("/:id", optional_auth, market, album_handler.GetAlbum)
+		album_subrouter.PUT("/:id", album_editor, album_handler.UpdateAlbum)
+		album_subrouter.DELETE("/:id", album_editor, album_handler.DeleteAlbum)
+		album_subrouter.PUT("/:id/tracks", album_editor, album_handler.SetTracksOfAlbum)
+		album_subrouter.GET("/:id/cover", album_handler.GetCoverOfAlbum)
+		album_subrouter.PUT("/:id/cover", album_editor, album_handler.SetCoverOfAlbum)
+		album_subrouter.PUT("/:id/genres", album_editor, genre_handler.SetGenresOfAlbum)
+		album_subrouter.PUT("/:id/tags", album_editor, genre_handler.SetTagsOfAlbum)
 	}
 
 	artist_repo := repository.NewPostgresArtistRepository(dbpool)
-	artist_handler := NewArtistHandler(artist_repo)
+	artist_handler := NewArtistHandler(artist_repo, file_storage, user_repo)
 	artist_subrouter := router.Group("/artists")
 	{
-		artist_subrouter.POST("/", artist_handler.CreateArtist)
+		artist_editor := middleware.AuthCatalogEditor(auth_manager, user_repo, model.TaxonomyArtist)
+
+		// only admins set the account managing an artist, see ArtistHandler.authorizeManager
+		artist_subrouter.POST("/", optional_auth, artist_handler.CreateArtist)
+		artist_subrouter.POST("/import", admin, artist_handler.ImportArtist)
 		artist_subrouter.GET("/:id", artist_handler.GetInfoArtistByID)
-		artist_subrouter.GET("/:id/tracks", artist_handler.GetArtistTracksByID)
-		artist_subrouter.PUT("/", artist_handler.UpdateArtist)
+		artist_subrouter.GET("/:id/tracks", optional_auth, market, artist_handler.GetArtistTracksByID)
+		artist_subrouter.GET("/:id/albums", optional_auth, market, album_handler.GetAlbumsOfArtist)
+		artist_subrouter.PUT("/", optional_auth, artist_handler.UpdateArtist)
 		artist_subrouter.DELETE("/:id", artist_handler.DeleteArtist)
 		artist_subrouter.GET("/", artist_handler.GetArtistWithFilter)
+		artist_subrouter.PUT("/:id/genres", artist_editor, genre_handler.SetGenresOfArtist)
+		artist_subrouter.PUT("/:id/tags", artist_editor, genre_handler.SetTagsOfArtist)
+		artist_subrouter.GET("/:id/images/:kind/:width", artist_handler.GetImageOfArtist)
+		artist_subrouter.PUT("/:id/images/:kind", artist_editor, artist_handler.SetImageOfArtist)
+		artist_subrouter.DELETE("/:id/images/:kind", artist_editor, artist_handler.DeleteImageOfArtist)
 	}
 
-	repo := auth.NewAuthRepository(authdbpool, config.LoadAuthConfig().SecretKey)
-	auth_manager := auth.NewAuthManager(config.LoadAuthConfig().SecretKey, *repo)
+	playlist_repo := repository.NewPostgresPlaylistRepository(dbpool)
+	playlist_handler := NewPlaylistHandler(playlist_repo, file_storage, user_repo)
+	playlist_subrouter := router.Group("/playlists")
+	{
+		authenticated := middleware.Authenticate(auth_manager)
+		viewable := middleware.AuthPlaylistView(auth_manager, playlist_repo)
+
+		playlist_subrouter.GET("/", optional_auth, playlist_handler.GetPublicPlaylistsOfUser)
+		playlist_subrouter.GET("/:id", viewable, playlist_handler.GetPlaylist)
+		playlist_subrouter.GET("/:id/tracks", viewable, market, playlist_handler.GetTracksOfPlaylist)
+		playlist_subrouter.POST("/", authenticated, playlist_handler.CreatePlaylist)
+		playlist_subrouter.POST("/import", authenticated, playlist_handler.ImportPlaylist)
+		playlist_subrouter.GET("/:id/export", viewable, market, playlist_handler.ExportPlaylist)
+		playlist_subrouter.GET("/:id/cover", viewable, playlist_handler.GetCoverOfPlaylist)
+		playlist_subrouter.POST("/merge", authenticated, playlist_handler.MergePlaylists)
+		playlist_subrouter.POST("/:id/copy", authenticated, viewable, playlist_handler.DuplicatePlaylist)
+		playlist_subrouter.POST("/:id/followers", authenticated, viewable, playlist_handler.FollowPlaylist)
+		playlist_subrouter.DELETE("/:id/followers", authenticated, playlist_handler.UnfollowPlaylist)
+
+		owner := middleware.AuthPlaylistRole(auth_manager, playlist_repo, model.PlaylistOwner)
+		editor := middleware.AuthPlaylistRole(auth_manager, playlist_repo, model.PlaylistOwner, model.PlaylistEditor)
+		member := middleware.AuthPlaylistRole(auth_manager, playlist_repo, model.PlaylistOwner, model.PlaylistEditor, model.PlaylistViewer)
+
+		playlist_subrouter.POST("/:id/tracks", editor, playlist_handler.AddTracksToPlaylist)
+		playlist_subrouter.DELETE("/:id/tracks", editor, playlist_handler.DeleteTracksFromPlaylist)
+		playlist_subrouter.PUT("/:id/tracks", editor, playlist_handler.ReorderTracksOfPlaylist)
+		playlist_subrouter.PUT("/:id", editor, playlist_handler.RenamePlaylist)
+		playlist_subrouter.PUT("/:id/visibility", owner, playlist_handler.SetVisibilityOfPlaylist)
+		playlist_subrouter.PUT("/:id/cover", owner, playlist_handler.SetCoverOfPlaylist)
+		playlist_subrouter.DELETE("/:id/cover", owner, playlist_handler.DeleteCoverOfPlaylist)
+		playlist_subrouter.DELETE("/:id", owner, playlist_handler.DeletePlaylist)
+		playlist_subrouter.GET("/:id/versions", member, playlist_handler.GetVersionsOfPlaylist)
+		playlist_subrouter.GET("/:id/versions/:snapshot_id", member, playlist_handler.GetPlaylistVersion)
+		playlist_subrouter.POST("/:id/versions/:snapshot_id/restore", editor, playlist_handler.RestorePlaylist)
+		playlist_subrouter.PUT("/:id/rules", editor, playlist_handler.SetRulesOfPlaylist)
+		playlist_subrouter.DELETE("/:id/rules", editor, playlist_handler.DeleteRulesOfPlaylist)
+		playlist_subrouter.POST("/:id/refresh", editor, playlist_handler.RefreshPlaylist)
+		playlist_subrouter.POST("/:id/deduplicate", editor, playlist_handler.DeduplicatePlaylist)
+		playlist_subrouter.GET("/:id/members", member, playlist_handler.GetMembersOfPlaylist)
+		playlist_subrouter.POST("/:id/members", owner, playlist_handler.AddMemberToPlaylist)
+		playlist_subrouter.DELETE("/:id/members/:user_id", member, playlist_handler.DeleteMemberFromPlaylist)
+	}
+
+	folder_repo := repository.NewPostgresFolderRepository(dbpool)
+	folder_handler := NewFolderHandler(folder_repo)
 
-	user_repo := repository.NewPostgresUserRepository(dbpool)
 	user_handler := NewUserHandler(user_repo, auth_manager)
 	user_subrouter := router.Group("/users")
 	{
@@ -53,6 +171,17 @@ func InitRouter(dbpool *pgxpool.Pool, authdbpool *pgxpool.Pool) *gin.Engine {
 		user_subrouter.Use(middleware.AuthRequest(auth_manager))
 		user_subrouter.GET("/:id", user_handler.ViewInformation)
 		user_subrouter.PUT("/:id", user_handler.ModifyInformation)
+		user_subrouter.PUT("/:id/preferences", user_handler.ModifyPreferences)
+		user_subrouter.GET("/:id/playlists", playlist_handler.GetPlaylistsOfUser)
+		user_subrouter.GET("/:id/library", folder_handler.GetLibrary)
+		user_subrouter.POST("/:id/library/moves", folder_handler.MoveLibraryItems)
+		user_subrouter.GET("/:id/library/saved", market, folder_handler.GetSavedItems)
+		user_subrouter.POST("/:id/library/saved", folder_handler.SaveItem)
+		user_subrouter.DELETE("/:id/library/saved", folder_handler.UnsaveItem)
+		user_subrouter.GET("/:id/library/presaves", folder_handler.GetPresavedItems)
+		user_subrouter.POST("/:id/folders", folder_handler.CreateFolder)
+		user_subrouter.PUT("/:id/folders/:folder_id", folder_handler.RenameFolder)
+		user_subrouter.DELETE("/:id/folders/:folder_id", folder_handler.DeleteFolder)
 	}
 
 	return router
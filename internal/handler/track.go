@@ -1,44 +1,95 @@
 package handler
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"flotify/internal/artwork"
+	"flotify/internal/audio"
+	"flotify/internal/auth"
+	"flotify/internal/custom_error"
 	"flotify/internal/helper"
+	"flotify/internal/lyrics"
 	"flotify/internal/model"
 	"flotify/internal/repository"
 	"flotify/internal/response"
+	"flotify/internal/storage"
+	"flotify/middleware"
 	"fmt"
+	"math"
+	"mime"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/gofrs/uuid/v5"
 )
 
 type TrackHandler struct {
-	repository repository.TrackRepository
+	repository   repository.TrackRepository
+	storage      storage.Storage
+	auth_manager auth.AuthManager
 }
 
-func NewTrackHandler(repo repository.TrackRepository) TrackHandler {
+func NewTrackHandler(repo repository.TrackRepository, store storage.Storage, auth_manager auth.AuthManager) TrackHandler {
 	return TrackHandler{
-		repository: repo,
+		repository:   repo,
+		storage:      store,
+		auth_manager: auth_manager,
 	}
 }
 
 // CreateTrack godoc
 //
 //	@Summary		Create a track
-//	@Description	Create a new track
+//	@Description	Create a new track, its isrc must not belong to another track. Only admins are allowed
 //	@Tags			tracks
 //	@Accept			json
 //	@Produce		json
 //	@Success		200	{object}	model.Track
 //	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		409	"ISRC belongs to another track"
+//	@Failure		500	"Internal server error"
 //	@Router			/tracks [post]
 func (th *TrackHandler) CreateTrack(c *gin.Context) {
+	th.createTrack(c, false)
+}
+
+// ImportTrack godoc
+//
+//	@Summary		Import a track
+//	@Description	Create a new track, a track with the same isrc is updated instead so imports can be repeated.
+//	@Description	Its primary artists are replaced by the given ones. Only admins are allowed
+//	@Tags			tracks
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	model.Track
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/import [post]
+func (th *TrackHandler) ImportTrack(c *gin.Context) {
+	th.createTrack(c, true)
+}
+
+// createTrack creates the track described by the body, upsert updates the track with the same ISRC
+func (th *TrackHandler) createTrack(c *gin.Context, upsert bool) {
 	type RequestTrack struct {
 		Name      string      `json:"name"`
 		Length    int         `json:"length"`
 		Artist_id []uuid.UUID `json:"artist_id"`
+		ISRC      string      `json:"isrc"`
+		Explicit  bool        `json:"explicit"`
+		// ReleaseDate schedules the release, the track is hidden from regular users until then
+		ReleaseDate *time.Time `json:"release_date"`
+		// Markets are the countries the track is licensed in, every country when empty
+		Markets []string `json:"markets"`
 	}
 
 	request_track := RequestTrack{}
@@ -48,14 +99,22 @@ func (th *TrackHandler) CreateTrack(c *gin.Context) {
 	}
 
 	track := &model.Track{
-		Name:     request_track.Name,
-		Length:   request_track.Length,
-		ArtistID: request_track.Artist_id,
+		Name:        request_track.Name,
+		Length:      request_track.Length,
+		ArtistID:    request_track.Artist_id,
+		ISRC:        request_track.ISRC,
+		Explicit:    request_track.Explicit,
+		ReleaseDate: request_track.ReleaseDate,
+		Markets:     request_track.Markets,
 	}
 
-	track, err := th.repository.CreateTrack(context.Background(), track)
+	create := th.repository.CreateTrack
+	if upsert {
+		create = th.repository.ImportTrack
+	}
+	track, err := create(context.Background(), track)
 	if err != nil {
-		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		trackErrorResponse(c, err)
 		return
 	}
 
@@ -65,12 +124,15 @@ func (th *TrackHandler) CreateTrack(c *gin.Context) {
 // GetTrack godoc
 //
 //	@Summary		Get information of a track
-//	@Description	Get information of a track by its ID
+//	@Description	Get information of a track by its ID, a track releasing in the future is only found by admins and the accounts of its artists
 //	@Tags			tracks
 //	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			market query string false "ISO 3166-1 alpha-2 country code, ignored when the user has a country" example("VN")
 //	@Produce		json
 //	@Success		200	{object}	model.Track
 //	@Failure		400	"Bad request"
+//	@Failure		404	"Not found"
+//	@Failure		451	"Not available in your region"
 //	@Failure		500	"Internal server error"
 //	@Router			/tracks/{id} [get]
 func (th *TrackHandler) GetTrackByID(c *gin.Context) {
@@ -82,9 +144,14 @@ func (th *TrackHandler) GetTrackByID(c *gin.Context) {
 		return
 	}
 
+	if err := th.repository.CheckTrackAvailable(context.Background(), id, middleware.GetUserID(c), middleware.GetMarket(c)); err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
 	track, err := th.repository.GetTrackByID(context.Background(), id)
 	if err != nil {
-		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		trackErrorResponse(c, err)
 		return
 	}
 
@@ -100,10 +167,17 @@ func (th *TrackHandler) GetTrackByID(c *gin.Context) {
 
 // GetTrackWithFilter doc
 // @Summary Get information of many tracks (advanced)
-// @Description Get information of many tracks satisfied conditions in filter
+// @Description Get information of many tracks satisfied conditions in filter, explicit tracks are hidden from users who chose so.
+// @Description Tracks releasing in the future are hidden from everyone but admins and the accounts of their artists,
+// @Description tracks not licensed in the market of the caller are hidden too
 // @Tags tracks
 // @Param name query string false "name of the song" example("Blue Town")
-// @Param sort query string false "criteria for sorting track-searching results" example("-namme", "name")
+// @Param genre query string false "comma separated genre slugs, sub-genres included" example("indie-rock")
+// @Param tag query string false "comma separated tags the tracks must all have" example("summer")
+// @Param isrc query string false "ISRC of the recording, hyphens are ignored" example("USRC17607839")
+// @Param lyrics query string false "words of the lyrics, in any order" example("blue town")
+// @Param market query string false "ISO 3166-1 alpha-2 country code the tracks must be licensed in, ignored when the user has a country" example("VN")
+// @Param sort query string false "criteria for sorting track-searching results: name, length, created_at, release_date or popularity, prefixed by - for descending order" example("-popularity", "name")
 // @Param page query int false "searching page" example(2)
 // @Param limit query int false "searching limit" example(10)
 // @Produce json
@@ -134,15 +208,23 @@ func (th *TrackHandler) GetTrackWithFilter(c *gin.Context) {
 	}
 
 	filter := repository.Filter{
-		Props:  map[string]any{"name": name},
-		Page:   page,
-		Limit:  limit,
-		SortBy: sort_criterias,
+		Props: map[string]any{
+			"name":   name,
+			"genre":  helper.GetList(c, "genre"),
+			"tag":    helper.GetList(c, "tag"),
+			"isrc":   c.Query("isrc"),
+			"lyrics": c.Query("lyrics"),
+		},
+		Page:     page,
+		Limit:    limit,
+		SortBy:   sort_criterias,
+		ViewerID: middleware.GetUserID(c),
+		Market:   middleware.GetMarket(c),
 	}
 
 	tracks, err := th.repository.GetTracksWithFilter(context.Background(), filter)
 	if err != nil {
-		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		trackErrorResponse(c, err)
 		return
 	}
 
@@ -181,24 +263,788 @@ func (th *TrackHandler) DeleteTrack(c *gin.Context) {
 // UpdateTrack godoc
 //
 //	@Summary		Update information of a track
-//	@Description	Update information of a track
+//	@Description	Update the fields of a track the body holds, the others keep their value. A null release_date releases the track
+//	@Description	and null markets license it everywhere.
+//	@Description	Only admins and the accounts of its artists are allowed
 //	@Tags			tracks
 //	@Accept			json
 //	@Produce		json
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
 //	@Success		200	{object}	model.Track
 //	@Failure		400	"Bad request"
-//	@Router			/tracks [put]
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		409	"ISRC belongs to another track"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id} [put]
 func (th *TrackHandler) UpdateTrack(c *gin.Context) {
-	track := model.Track{}
-	if err := c.BindJSON(&track); err != nil {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestTrack struct {
+		Name        *string    `json:"name"`
+		Length      *int       `json:"length"`
+		ISRC        *string    `json:"isrc"`
+		Explicit    *bool      `json:"explicit"`
+		ReleaseDate *time.Time `json:"release_date"`
+		Markets     []string   `json:"markets"`
+	}
+
+	// the body is read twice, the fields it holds tell a null release date or null markets apart from missing ones
+	request_track := RequestTrack{}
+	if err := c.ShouldBindBodyWith(&request_track, binding.JSON); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+	fields := map[string]json.RawMessage{}
+	if err := c.ShouldBindBodyWith(&fields, binding.JSON); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+	_, has_release_date := fields["release_date"]
+	_, has_markets := fields["markets"]
+
+	track, err := th.repository.UpdateTrack(context.Background(), repository.TrackUpdate{
+		ID:             id,
+		Name:           request_track.Name,
+		Length:         request_track.Length,
+		ISRC:           request_track.ISRC,
+		Explicit:       request_track.Explicit,
+		SetReleaseDate: has_release_date,
+		ReleaseDate:    request_track.ReleaseDate,
+		SetMarkets:     has_markets,
+		Markets:        request_track.Markets,
+	})
+	if err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, track)
+}
+
+// UploadAudioOfTrack godoc
+//
+//	@Summary		Upload audio of a track
+//	@Description	Upload an MP3, FLAC, OGG or WAV file as the request body or as the "file" form field. The format is recognized
+//	@Description	from the content of the file, the declared content type is ignored. Replaces the previous audio of the track.
+//	@Description	The length of the track is set to the duration of the audio, an unnamed track takes the title of the embedded tags
+//	@Description	and a track without artists is credited to the artists the tags name.
+//	@Description	FLAC, ogg FLAC and WAV files are decoded to measure their loudness, which gives the ReplayGain values players normalize with,
+//	@Description	and to draw their waveform. The waveform of MP3, Vorbis and Opus files is estimated from their frames
+//	@Tags			tracks
+//	@Accept			mpeg,flac,ogg,wav
+//	@Produce		json
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200	{object}	model.Track
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		413	"File too large"
+//	@Failure		415	"Unsupported audio format"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id}/audio [put]
+func (th *TrackHandler) UploadAudioOfTrack(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	body, _, err := uploadedFile(c, audio.MaxUploadSize)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+
+	upload, err := audio.Ingest(body, audio.MaxUploadSize)
+	if err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+	defer upload.Close()
+
+	previous_audio, err := th.repository.GetAudioOfTrack(context.Background(), id)
+	if err != nil {
+		if _, ok := err.(custom_error.NonExistTrackAudioError); !ok {
+			trackErrorResponse(c, err)
+			return
+		}
+	}
+
+	// the new files get keys of their own, the track keeps playing the previous ones until it points to them.
+	// Identical uploads share their keys, those files are never removed on failure as the track may still use them
+	audio_key := audio.TrackAudioKey(id, upload.Checksum, upload.Info.Format)
+	artwork_key := artwork.TrackArtworkKey(id, upload.Checksum)
+	discard := func() {
+		if previous_audio == nil || previous_audio.StorageKey != audio_key {
+			th.storage.Delete(context.Background(), audio_key)
+		}
+		if previous_audio == nil || previous_audio.ArtworkKey != artwork_key {
+			th.storage.Delete(context.Background(), artwork_key)
+		}
+	}
+	if err := th.storage.Put(context.Background(), audio_key, upload.File); err != nil {
+		discard()
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	tags := upload.Tags
+	track_audio := model.TrackAudio{
+		Format:     string(upload.Info.Format),
+		Codec:      upload.Info.Codec,
+		Size:       upload.Size,
+		Bitrate:    upload.Info.Bitrate,
+		DurationMs: int(upload.Info.Duration.Milliseconds()),
+		Checksum:   upload.Checksum,
+		Tags: &model.AudioTags{
+			Title:       tags.Title,
+			Artists:     tags.Artists,
+			Album:       tags.Album,
+			TrackNumber: tags.TrackNumber,
+			Year:        tags.Year,
+			Genre:       tags.Genre,
+		},
+		StorageKey: audio_key,
+	}
+	if loudness := upload.Loudness; loudness != nil {
+		track_audio.Loudness = &model.Loudness{
+			IntegratedLUFS: hundredths(loudness.Integrated),
+			TruePeakDBTP:   hundredths(loudness.TruePeak),
+			TrackGain:      hundredths(audio.ReplayGain(loudness.Integrated)),
+			TrackPeak:      math.Pow(10, loudness.TruePeak/20),
+		}
+		track_audio.LoudnessHistogram = loudness.Histogram
+	}
+	if len(upload.Waveform) > 0 {
+		track_audio.Waveform = upload.Waveform
+	}
+
+	// embedded artwork that isn't a readable image is dropped rather than failing the upload
+	if len(tags.Picture) > 0 {
+		if img, err := artwork.Decode(bytes.NewReader(tags.Picture)); err == nil {
+			var buffer bytes.Buffer
+			if err := artwork.Encode(&buffer, artwork.Square(img, artwork.CoverSize)); err != nil {
+				discard()
+				helper.ErrorResponse(c, err, http.StatusInternalServerError)
+				return
+			}
+			if err := th.storage.Put(context.Background(), artwork_key, &buffer); err != nil {
+				discard()
+				helper.ErrorResponse(c, err, http.StatusInternalServerError)
+				return
+			}
+			track_audio.ArtworkKey = artwork_key
+		}
+	}
+
+	if _, err = th.repository.SetAudioOfTrack(context.Background(), id, track_audio); err != nil {
+		discard()
+		trackErrorResponse(c, err)
+		return
+	}
+
+	// the track points to the new files, the previous ones aren't used anymore
+	if previous_audio != nil && previous_audio.StorageKey != audio_key {
+		th.storage.Delete(context.Background(), previous_audio.StorageKey)
+	}
+	if previous_audio != nil && previous_audio.ArtworkKey != "" && previous_audio.ArtworkKey != track_audio.ArtworkKey {
+		th.storage.Delete(context.Background(), previous_audio.ArtworkKey)
+	}
+
+	track, err := th.repository.GetTrackByID(context.Background(), id)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	track.ArtistID, err = th.repository.GetArtistOfTrack(context.Background(), id)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, track)
+}
+
+// GetArtworkOfTrack godoc
+//
+//	@Summary		Get artwork of a track
+//	@Description	Get the artwork embedded in the uploaded audio of a track as a 640x640 JPEG
+//	@Tags			tracks
+//	@Produce		jpeg
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			market query string false "ISO 3166-1 alpha-2 country code, ignored when the user has a country" example("VN")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		404	"Not found"
+//	@Failure		451	"Not available in your region"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id}/artwork [get]
+func (th *TrackHandler) GetArtworkOfTrack(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
 		helper.ErrorResponse(c, err, http.StatusBadRequest)
 		return
 	}
 
-	if err := th.repository.UpdateTrack(context.Background(), &track); err != nil {
+	if err := th.repository.CheckTrackAvailable(context.Background(), id, middleware.GetUserID(c), middleware.GetMarket(c)); err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	track_audio, err := th.repository.GetAudioOfTrack(context.Background(), id)
+	if err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+	if track_audio.ArtworkKey == "" {
+		helper.ErrorResponse(c, custom_error.NonExistObjectError{}, http.StatusNotFound)
+		return
+	}
+
+	file, err := th.storage.Open(context.Background(), track_audio.ArtworkKey)
+	if err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Type", "image/jpeg")
+	http.ServeContent(c.Writer, c.Request, "artwork.jpg", track_audio.UploadedAt, file)
+}
+
+// GetWaveformOfTrack godoc
+//
+//	@Summary		Get waveform of a track
+//	@Description	Get the peak waveform of the audio of a track, up to 1000 points each holding the lowest and the highest sample
+//	@Description	of its slice of the audio. With format=png it is rendered as an image 200 pixels high with a column per point.
+//	@Description	The waveform of MP3, Vorbis and Opus audio isn't decoded but estimated from its frames and is marked Estimated:
+//	@Description	its levels are relative to the loudest frame and only follow the loudness of the audio
+//	@Tags			tracks
+//	@Produce		json,png
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			format query string false "json (default) or png" example("png")
+//	@Param			market query string false "ISO 3166-1 alpha-2 country code, ignored when the user has a country" example("VN")
+//	@Success		200	{object}	model.Waveform
+//	@Failure		400	"Bad request"
+//	@Failure		404	"Not found"
+//	@Failure		451	"Not available in your region"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id}/waveform [get]
+func (th *TrackHandler) GetWaveformOfTrack(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "png" {
+		helper.ErrorResponse(c, fmt.Errorf("unsupported waveform format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	if err := th.repository.CheckTrackAvailable(context.Background(), id, middleware.GetUserID(c), middleware.GetMarket(c)); err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	waveform, err := th.repository.GetWaveformOfTrack(context.Background(), id)
+	if err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, waveform)
+		return
+	}
+
+	var buffer bytes.Buffer
+	if err := audio.RenderWaveform(&buffer, waveform.Peaks); err != nil {
 		helper.ErrorResponse(c, err, http.StatusInternalServerError)
 		return
 	}
+	c.Data(http.StatusOK, "image/png", buffer.Bytes())
+}
+
+// StreamTrack godoc
+//
+//	@Summary		Stream audio of a track
+//	@Description	Serve the audio file of a track. Range and If-Range requests are answered with 206 partial content so players can seek.
+//	@Description	Players that can't set headers use the url returned by /tracks/{id}/stream-url, which carries a stream token.
+//	@Description	Requests starting at the beginning of the file are recorded in the listening history of the user
+//	@Tags			tracks
+//	@Produce		mpeg,flac,ogg,wav
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			Range header string false "Byte range" example("bytes=0-1023")
+//	@Param			token query string false "stream token of the track, instead of the access token"
+//	@Param			market query string false "ISO 3166-1 alpha-2 country code, ignored when the user has a country" example("VN")
+//	@Success		200
+//	@Success		206
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		404	"Not found"
+//	@Failure		416	"Range not satisfiable"
+//	@Failure		451	"Not available in your region"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id}/stream [get]
+func (th *TrackHandler) StreamTrack(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := th.repository.CheckTrackAvailable(context.Background(), id, middleware.GetUserID(c), middleware.GetMarket(c)); err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	track_audio, err := th.repository.GetAudioOfTrack(context.Background(), id)
+	if err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	file, err := th.storage.Open(context.Background(), track_audio.StorageKey)
+	if err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+	defer file.Close()
+
+	etag := `"` + track_audio.Checksum + `"`
+	if isStreamStart(c.Request, etag) {
+		// a missing history entry isn't worth failing playback for
+		if err := th.repository.RecordStreamStart(context.Background(), middleware.GetUserID(c), id); err != nil {
+			c.Error(err)
+		}
+	}
+
+	c.Header("Content-Type", audio.Format(track_audio.Format).ContentType())
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, max-age=0, must-revalidate")
+	http.ServeContent(c.Writer, c.Request, "", track_audio.UploadedAt, file)
+}
 
-	c.JSON(http.StatusAccepted, track)
+// GetStreamURLOfTrack godoc
+//
+//	@Summary		Get a stream url of a track
+//	@Description	Get a url streaming the track for an hour without the Authorization header, for audio elements and players
+//	@Description	that can't set headers. The url only opens this track
+//	@Tags			tracks
+//	@Produce		json
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			market query string false "ISO 3166-1 alpha-2 country code, ignored when the user has a country" example("VN")
+//	@Success		200	{object}	response.StreamURLResponse
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		404	"Not found"
+//	@Failure		451	"Not available in your region"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id}/stream-url [get]
+func (th *TrackHandler) GetStreamURLOfTrack(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := th.repository.CheckTrackAvailable(context.Background(), id, middleware.GetUserID(c), middleware.GetMarket(c)); err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	token, expires_at, err := th.auth_manager.GenerateStreamToken(middleware.GetUserID(c), id, auth.StreamTokenDuration)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, response.StreamURLResponse{
+		URL:       "/tracks/" + id.String() + "/stream?token=" + url.QueryEscape(token),
+		ExpiresAt: expires_at,
+	})
+}
+
+// isStreamStart tells whether the request starts playing the file rather than seeking into it or revalidating a cached copy
+func isStreamStart(r *http.Request, etag string) bool {
+	if r.Method != http.MethodGet || r.Header.Get("If-None-Match") == etag {
+		return false
+	}
+	byte_range := r.Header.Get("Range")
+	return byte_range == "" || strings.HasPrefix(byte_range, "bytes=0-")
+}
+
+// GetLyricsOfTrack godoc
+//
+//	@Summary		Get lyrics of a track
+//	@Description	Get the lyrics of a track as lines, synced lyrics give the time in milliseconds every line is sung at.
+//	@Description	With format=lrc the lyrics are downloaded as an .lrc file
+//	@Tags			tracks
+//	@Produce		json
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			format query string false "json (default) or lrc" example("lrc")
+//	@Success		200	{object}	model.Lyrics
+//	@Failure		400	"Bad request"
+//	@Failure		404	"Not found"
+//	@Failure		451	"Not available in your region"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id}/lyrics [get]
+func (th *TrackHandler) GetLyricsOfTrack(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "lrc" {
+		helper.ErrorResponse(c, fmt.Errorf("unsupported lyrics format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	if err := th.repository.CheckTrackAvailable(context.Background(), id, middleware.GetUserID(c), middleware.GetMarket(c)); err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	track_lyrics, err := th.repository.GetLyricsOfTrack(context.Background(), id)
+	if err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, track_lyrics)
+		return
+	}
+
+	track, err := th.repository.GetTrackByID(context.Background(), id)
+	if err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	var buffer bytes.Buffer
+	if err := lyrics.Encode(&buffer, *track_lyrics, track.Name); err != nil {
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	filename := strings.NewReplacer("/", "_", "\\", "_").Replace(track.Name) + ".lrc"
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Data(http.StatusOK, lyrics.ContentType, buffer.Bytes())
+}
+
+const maxLyricsFileSize = 1 << 20
+
+// SetLyricsOfTrack godoc
+//
+//	@Summary		Set lyrics of a track
+//	@Description	Replace the lyrics of a track with an .lrc or plain text file sent as the request body or as the "file" form field,
+//	@Description	or with a json body {"text": "...", "language": "en"} whose text is read the same way.
+//	@Description	Lines starting with [mm:ss.xx] timestamps make the lyrics synced, text without timestamps is stored as plain lyrics
+//	@Tags			tracks
+//	@Accept			json,plain
+//	@Produce		json
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			language query string false "language of the lyrics, overrides the [la:] tag of the file" example("en")
+//	@Success		200	{object}	model.Lyrics
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id}/lyrics [put]
+func (th *TrackHandler) SetLyricsOfTrack(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	var track_lyrics *model.Lyrics
+	language := c.Query("language")
+	if c.ContentType() == "application/json" {
+		type RequestLyrics struct {
+			Text     string `json:"text"`
+			Language string `json:"language"`
+		}
+		request_lyrics := RequestLyrics{}
+		if err := c.BindJSON(&request_lyrics); err != nil {
+			helper.ErrorResponse(c, err, http.StatusBadRequest)
+			return
+		}
+		if language == "" {
+			language = request_lyrics.Language
+		}
+		track_lyrics, err = lyrics.Parse(strings.NewReader(request_lyrics.Text))
+	} else {
+		body, _, upload_err := uploadedFile(c, maxLyricsFileSize)
+		if upload_err != nil {
+			helper.ErrorResponse(c, upload_err, http.StatusBadRequest)
+			return
+		}
+		defer body.Close()
+		track_lyrics, err = lyrics.Parse(http.MaxBytesReader(c.Writer, body, maxLyricsFileSize))
+	}
+	if err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+	if language != "" {
+		track_lyrics.Language = language
+	}
+
+	track_lyrics, err = th.repository.SetLyricsOfTrack(context.Background(), id, *track_lyrics)
+	if err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, track_lyrics)
+}
+
+// DeleteLyricsOfTrack godoc
+//
+//	@Summary		Delete lyrics of a track
+//	@Tags			tracks
+//	@Produce		json
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id}/lyrics [delete]
+func (th *TrackHandler) DeleteLyricsOfTrack(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := th.repository.DeleteLyricsOfTrack(context.Background(), id); err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "delete lyrics successfully"})
+}
+
+// SetCreditsOfTrack godoc
+//
+//	@Summary		Set credits of a track
+//	@Description	Replace the credits of a track. Roles are primary, featured, composer, lyricist, producer and remixer,
+//	@Description	artists sharing a role are ordered as given and a track needs at least one primary artist
+//	@Tags			tracks
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			credits body object true "credits in order, {credits: [{artist_id, role}]}"
+//	@Success		200	{array}	model.Credit
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id}/credits [put]
+func (th *TrackHandler) SetCreditsOfTrack(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestCredit struct {
+		ArtistID uuid.UUID        `json:"artist_id"`
+		Role     model.CreditRole `json:"role"`
+	}
+	type RequestCredits struct {
+		Credits []RequestCredit `json:"credits"`
+	}
+	request_credits := RequestCredits{}
+	if err := c.BindJSON(&request_credits); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	credits := make([]model.Credit, len(request_credits.Credits))
+	for i, credit := range request_credits.Credits {
+		credits[i] = model.Credit{ArtistID: credit.ArtistID, Role: credit.Role}
+	}
+
+	credits, err = th.repository.SetCreditsOfTrack(context.Background(), id, credits)
+	if err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"credits": credits})
+}
+
+// GetVersionsOfTrack godoc
+//
+//	@Summary		Get versions of a track
+//	@Description	Get the versions of the work of a track: the original, remasters, radio edits, live recordings and remixes.
+//	@Description	Versions not playable by the caller are left out
+//	@Tags			tracks
+//	@Produce		json
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			market query string false "ISO 3166-1 alpha-2 country code, ignored when the user has a country" example("VN")
+//	@Success		200	{array}	model.Track
+//	@Failure		400	"Bad request"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id}/versions [get]
+func (th *TrackHandler) GetVersionsOfTrack(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	versions, err := th.repository.GetVersionsOfTrack(context.Background(), id, middleware.GetUserID(c), middleware.GetMarket(c))
+	if err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// SetVersionsOfTrack godoc
+//
+//	@Summary		Set versions of a track
+//	@Description	Link tracks as the versions of the work of a track, the track itself must be listed.
+//	@Description	Versions are original, remaster, live, remix and radio_edit, tracks of the work left out are unlinked
+//	@Tags			tracks
+//	@Accept			json
+//	@Produce		json
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Param			versions body object true "versions of the work, {versions: [{track_id, version}]}"
+//	@Success		200	{array}	model.Track
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id}/versions [put]
+func (th *TrackHandler) SetVersionsOfTrack(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestVersions struct {
+		Versions []model.TrackOfWork `json:"versions"`
+	}
+	request_versions := RequestVersions{}
+	if err := c.BindJSON(&request_versions); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	versions, err := th.repository.SetVersionsOfTrack(context.Background(), id, request_versions.Versions)
+	if err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// TakeDownTrack godoc
+//
+//	@Summary		Take down a track
+//	@Description	Take down a track without deleting it, playlists and libraries holding it play another version of its work instead
+//	@Tags			tracks
+//	@Produce		json
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id}/takedown [post]
+func (th *TrackHandler) TakeDownTrack(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := th.repository.SetTakedownOfTrack(context.Background(), id, true); err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "take down track successfully"})
+}
+
+// RestoreTrack godoc
+//
+//	@Summary		Restore a taken down track
+//	@Tags			tracks
+//	@Produce		json
+//	@Param			id path string true "Track ID" example("3983a1d6-759b-4e5e-b307-7b7e06a05a85")
+//	@Success		200
+//	@Failure		400	"Bad request"
+//	@Failure		401	"Authorization required"
+//	@Failure		403	"Forbidden"
+//	@Failure		404	"Not found"
+//	@Failure		500	"Internal server error"
+//	@Router			/tracks/{id}/takedown [delete]
+func (th *TrackHandler) RestoreTrack(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := th.repository.SetTakedownOfTrack(context.Background(), id, false); err != nil {
+		trackErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "restore track successfully"})
+}
+
+// hundredths rounds loudness values, players don't tell finer differences apart
+func hundredths(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+func trackErrorResponse(c *gin.Context, err error) {
+	switch err := err.(type) {
+	case custom_error.NonExistTrackError, custom_error.NonExistTrackAudioError, custom_error.NonExistObjectError, custom_error.NonExistLyricsError,
+		custom_error.NonExistArtistError, custom_error.NonExistWaveformError:
+		helper.ErrorResponse(c, err, http.StatusNotFound)
+	case custom_error.InvalidAudioError, custom_error.InvalidSortCriteriaError, custom_error.InvalidIdentifierError, custom_error.InvalidLyricsError,
+		custom_error.InvalidCreditError, custom_error.InvalidMarketError, custom_error.InvalidVersionError:
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+	case custom_error.DuplicateIdentifierError:
+		helper.ErrorResponse(c, err, http.StatusConflict)
+	case custom_error.UnavailableInMarketError:
+		helper.ErrorResponse(c, err, http.StatusUnavailableForLegalReasons)
+	case custom_error.UnsupportedAudioFormatError:
+		helper.ErrorResponse(c, err, http.StatusUnsupportedMediaType)
+	case custom_error.AudioTooLargeError:
+		helper.ErrorResponse(c, err, http.StatusRequestEntityTooLarge)
+	default:
+		helper.ErrorResponse(c, err, http.StatusInternalServerError)
+	}
 }
@@ -203,6 +203,59 @@ func (uh *UserHandler) ModifyInformation(c *gin.Context) {
 	c.JSON(http.StatusAccepted, user)
 }
 
+// ModifyPreferences godoc
+// @Summary Modify user preferences
+// @Description Modify the preferences the body holds, the others keep their value. hide_explicit removes explicit tracks
+// @Description from the listings the user gets, country is the ISO 3166-1 alpha-2 code of the market the user gets the catalog of
+// @Description and an empty country removes it
+// @Accept json
+// @Produce json
+// @Param id path string true "user ID"
+// @Success 200 {object} model.User
+// @Failure 400 "Bad request"
+// @Failure 401 "Authorization required"
+// @Failure 404 "Not found"
+// @Failure 500 "Internal server error"
+// @Router /users/{id}/preferences [PUT]
+func (uh *UserHandler) ModifyPreferences(c *gin.Context) {
+	id, err := uuid.FromString(c.Params.ByName("id"))
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	type RequestPreferences struct {
+		HideExplicit *bool   `json:"hide_explicit"`
+		Country      *string `json:"country"`
+	}
+
+	request_preferences := RequestPreferences{}
+	if err := c.BindJSON(&request_preferences); err != nil {
+		helper.ErrorResponse(c, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := uh.repository.UpdatePreferences(context.Background(), id, repository.Preferences{
+		HideExplicit: request_preferences.HideExplicit,
+		Country:      request_preferences.Country,
+	})
+	if err != nil {
+		switch err := err.(type) {
+		case custom_error.InvalidMarketError:
+			helper.ErrorResponse(c, err, http.StatusBadRequest)
+			return
+		case custom_error.NonExistUserError:
+			helper.ErrorResponse(c, err, http.StatusNotFound)
+			return
+		default:
+			helper.ErrorResponse(c, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	c.JSON(http.StatusAccepted, user)
+}
+
 // DeleteUser godoc
 // @Summary Delete user
 // @Description Delete user with user ID
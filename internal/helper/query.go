@@ -0,0 +1,21 @@
+package helper
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetList splits a comma separated query parameter, nil when it is absent
+func GetList(c *gin.Context, key string) []string {
+	list := []string{}
+	for _, value := range strings.Split(c.Query(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	return list
+}
@@ -0,0 +1,176 @@
+// Package lyrics reads and writes lyrics as plain text or synced to the audio in the LRC format
+package lyrics
+
+import (
+	"bufio"
+	"flotify/internal/custom_error"
+	"flotify/internal/model"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxLines is the largest number of lines accepted for the lyrics of a track
+const MaxLines = 2000
+
+// ContentType is the content type of exported LRC files
+const ContentType = "application/x-lrc; charset=utf-8"
+
+// timestampPattern matches [mm:ss], [mm:ss.xx] and [mm:ss.xxx], some editors separate the fraction with a colon
+var timestampPattern = regexp.MustCompile(`^\[(\d{1,3}):([0-5]?\d)(?:[.:](\d{1,3}))?\]`)
+
+// wordTimestampPattern matches the word timings of enhanced LRC, <mm:ss.xx>
+var wordTimestampPattern = regexp.MustCompile(`<\d{1,3}:\d{1,2}(?:[.:]\d{1,3})?>`)
+
+// tagPattern matches ID tags like [ar:Phum Viphurit] or [offset:+200]
+var tagPattern = regexp.MustCompile(`^\[([a-zA-Z#]+):(.*)\]$`)
+
+// Parse reads LRC lyrics. A line with several timestamps is repeated at every one of them,
+// lines are sorted by time and the [offset:] tag is applied. A file without any timestamp is read as plain lyrics
+func Parse(r io.Reader) (*model.Lyrics, error) {
+	timed := []model.LyricLine{}
+	untimed := []string{}
+	language := ""
+	offset := 0
+
+	scanner := bufio.NewScanner(r)
+	number := 0
+	for scanner.Scan() {
+		number++
+		line := scanner.Text()
+		if number == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if !utf8.ValidString(line) {
+			return nil, custom_error.InvalidLyricsError{Line: number, Reason: "text is not utf-8"}
+		}
+		line = strings.TrimSpace(line)
+
+		times := []int{}
+		for {
+			match := timestampPattern.FindStringSubmatch(line)
+			if match == nil {
+				break
+			}
+			times = append(times, timestampMs(match[1], match[2], match[3]))
+			line = line[len(match[0]):]
+		}
+
+		if len(times) == 0 {
+			if tag := tagPattern.FindStringSubmatch(line); tag != nil {
+				value := strings.TrimSpace(tag[2])
+				switch strings.ToLower(tag[1]) {
+				case "offset":
+					offset, _ = strconv.Atoi(value)
+				case "la", "lang", "language":
+					language = value
+				}
+				continue
+			}
+			untimed = append(untimed, line)
+			continue
+		}
+
+		// empty timed lines mark instrumental breaks and are kept
+		text := strings.TrimSpace(wordTimestampPattern.ReplaceAllString(line, ""))
+		for _, time_ms := range times {
+			timed = append(timed, model.LyricLine{TimeMs: time_ms, Text: text})
+		}
+		if len(timed) > MaxLines {
+			return nil, custom_error.InvalidLyricsError{Line: number, Reason: fmt.Sprintf("more than %d lines", MaxLines)}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, custom_error.InvalidLyricsError{Line: number + 1, Reason: err.Error()}
+	}
+
+	if len(timed) == 0 {
+		lyrics, err := plainLyrics(untimed)
+		if err != nil {
+			return nil, err
+		}
+		lyrics.Language = language
+		return lyrics, nil
+	}
+
+	// a positive offset makes the lines appear sooner
+	for i := range timed {
+		timed[i].TimeMs = max(timed[i].TimeMs-offset, 0)
+	}
+	slices.SortStableFunc(timed, func(a, b model.LyricLine) int {
+		return a.TimeMs - b.TimeMs
+	})
+	return &model.Lyrics{Synced: true, Language: language, Lines: timed}, nil
+}
+
+// plainLyrics keeps the blank lines separating verses but drops those around the text
+func plainLyrics(lines []string) (*model.Lyrics, error) {
+	first, last := 0, len(lines)
+	for first < last && strings.TrimSpace(lines[first]) == "" {
+		first++
+	}
+	for last > first && strings.TrimSpace(lines[last-1]) == "" {
+		last--
+	}
+	if first == last {
+		return nil, custom_error.InvalidLyricsError{Reason: "lyrics are empty"}
+	}
+	if last-first > MaxLines {
+		return nil, custom_error.InvalidLyricsError{Reason: fmt.Sprintf("more than %d lines", MaxLines)}
+	}
+
+	lyrics := &model.Lyrics{Lines: make([]model.LyricLine, 0, last-first)}
+	for _, line := range lines[first:last] {
+		lyrics.Lines = append(lyrics.Lines, model.LyricLine{Text: strings.TrimSpace(line)})
+	}
+	return lyrics, nil
+}
+
+// Encode writes the lyrics as an LRC file titled after the track, plain lyrics are written without timestamps
+func Encode(w io.Writer, lyrics model.Lyrics, title string) error {
+	buffer := bufio.NewWriter(w)
+	if title != "" {
+		fmt.Fprintf(buffer, "[ti:%s]\n", title)
+	}
+	if lyrics.Language != "" {
+		fmt.Fprintf(buffer, "[la:%s]\n", lyrics.Language)
+	}
+	for _, line := range lyrics.Lines {
+		if lyrics.Synced {
+			fmt.Fprintf(buffer, "%s%s\n", formatTimestamp(line.TimeMs), line.Text)
+		} else {
+			fmt.Fprintf(buffer, "%s\n", line.Text)
+		}
+	}
+	return buffer.Flush()
+}
+
+// Text joins the lines of the lyrics, it is what lyric search looks into
+func Text(lyrics model.Lyrics) string {
+	lines := make([]string, len(lyrics.Lines))
+	for i, line := range lyrics.Lines {
+		lines[i] = line.Text
+	}
+	return strings.Join(lines, "\n")
+}
+
+func timestampMs(minutes, seconds, fraction string) int {
+	m, _ := strconv.Atoi(minutes)
+	s, _ := strconv.Atoi(seconds)
+	ms := 0
+	if fraction != "" {
+		// .5 is half a second, .05 and .050 are 50 milliseconds
+		ms, _ = strconv.Atoi((fraction + "00")[:3])
+	}
+	return (m*60+s)*1000 + ms
+}
+
+// formatTimestamp writes [mm:ss.xx], the precision most players understand
+func formatTimestamp(time_ms int) string {
+	centiseconds := (time_ms + 5) / 10
+	return fmt.Sprintf("[%02d:%02d.%02d]", centiseconds/6000, centiseconds/100%60, centiseconds%100)
+}
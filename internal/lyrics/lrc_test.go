@@ -0,0 +1,161 @@
+package lyrics
+
+import (
+	"bytes"
+	"errors"
+	"flotify/internal/custom_error"
+	"flotify/internal/model"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  *model.Lyrics
+	}{
+		{
+			name:  "synced lines sorted by time",
+			input: "[00:12.34]second\n[00:01.50]first\n",
+			want: &model.Lyrics{Synced: true, Lines: []model.LyricLine{
+				{TimeMs: 1500, Text: "first"},
+				{TimeMs: 12340, Text: "second"},
+			}},
+		},
+		{
+			name:  "fraction precisions and colon separator",
+			input: "[00:01.5]a\n[00:02.05]b\n[00:03:050]c\n[01:00]d\n",
+			want: &model.Lyrics{Synced: true, Lines: []model.LyricLine{
+				{TimeMs: 1500, Text: "a"},
+				{TimeMs: 2050, Text: "b"},
+				{TimeMs: 3050, Text: "c"},
+				{TimeMs: 60000, Text: "d"},
+			}},
+		},
+		{
+			name:  "line repeated at every timestamp",
+			input: "[00:10.00][00:30.00]chorus\n[00:20.00]verse\n",
+			want: &model.Lyrics{Synced: true, Lines: []model.LyricLine{
+				{TimeMs: 10000, Text: "chorus"},
+				{TimeMs: 20000, Text: "verse"},
+				{TimeMs: 30000, Text: "chorus"},
+			}},
+		},
+		{
+			name:  "offset and language tags",
+			input: "\ufeff[la:en]\n[offset:+500]\n[00:00.20]early\n[00:01.00]late\n",
+			want: &model.Lyrics{Synced: true, Language: "en", Lines: []model.LyricLine{
+				{TimeMs: 0, Text: "early"},
+				{TimeMs: 500, Text: "late"},
+			}},
+		},
+		{
+			name:  "word timings dropped and instrumental breaks kept",
+			input: "[00:01.00]<00:01.00>Blue <00:01.50>town\n[00:05.00]\n",
+			want: &model.Lyrics{Synced: true, Lines: []model.LyricLine{
+				{TimeMs: 1000, Text: "Blue town"},
+				{TimeMs: 5000, Text: ""},
+			}},
+		},
+		{
+			name:  "plain lyrics keep the blank lines between verses",
+			input: "\n[ar:Phum Viphurit]\nfirst verse\n\nsecond verse\n\n",
+			want: &model.Lyrics{Lines: []model.LyricLine{
+				{Text: "first verse"},
+				{Text: ""},
+				{Text: "second verse"},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "empty", input: "\n  \n"},
+		{name: "only tags", input: "[ti:Lover Boy]\n"},
+		{name: "not utf-8", input: "[00:01.00]\xff\xfe\n"},
+		{name: "too many lines", input: strings.Repeat("[00:01.00]la\n", MaxLines+1)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.input))
+			if !errors.As(err, &custom_error.InvalidLyricsError{}) {
+				t.Errorf("Parse() error = %v, want InvalidLyricsError", err)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name   string
+		lyrics model.Lyrics
+		title  string
+		want   string
+	}{
+		{
+			name: "synced",
+			lyrics: model.Lyrics{Synced: true, Language: "en", Lines: []model.LyricLine{
+				{TimeMs: 1504, Text: "first"},
+				{TimeMs: 61995, Text: "second"},
+			}},
+			title: "Lover Boy",
+			want:  "[ti:Lover Boy]\n[la:en]\n[00:01.50]first\n[01:02.00]second\n",
+		},
+		{
+			name:   "plain",
+			lyrics: model.Lyrics{Lines: []model.LyricLine{{Text: "first"}, {Text: ""}, {Text: "second"}}},
+			want:   "first\n\nsecond\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := Encode(&buffer, test.lyrics, test.title); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if got := buffer.String(); got != test.want {
+				t.Errorf("Encode() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEncodeThenParse(t *testing.T) {
+	lyrics := model.Lyrics{Synced: true, Language: "vi", Lines: []model.LyricLine{
+		{TimeMs: 0, Text: "intro"},
+		{TimeMs: 12340, Text: "Blue town, blue town"},
+		{TimeMs: 754560, Text: ""},
+	}}
+
+	var buffer bytes.Buffer
+	if err := Encode(&buffer, lyrics, "Blue Town"); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got, err := Parse(&buffer)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !reflect.DeepEqual(*got, lyrics) {
+		t.Errorf("Parse(Encode()) = %+v, want %+v", *got, lyrics)
+	}
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+type Album struct {
+	ID    uuid.UUID `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	Title string    `example:"Manchild"`
+	Type  AlbumType `example:"album"`
+	// ReleaseDate is when the album goes live, until then only admins and the accounts of its artists see it
+	ReleaseDate *time.Time `example:"2017-05-01T00:00:00Z"`
+	// Markets lists the ISO 3166-1 alpha-2 countries the album is licensed in, every country when empty
+	Markets []string `json:",omitempty" example:"VN,TH"`
+	Label   string   `example:"Rats Records"`
+	// UPC is the barcode of the release, it is unique in the catalog
+	UPC        string      `json:",omitempty" example:"036000291452"`
+	ArtistID   []uuid.UUID `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	TrackCount int         `example:"12"`
+	HasCover   bool        `example:"true"`
+	// Explicit is set when one of the tracks of the album is explicit
+	Explicit bool `example:"false"`
+	// Tracks, Genres and Tags are only loaded with a single album, tracks are ordered by disc and track number
+	Tracks []AlbumTrack `json:",omitempty"`
+	Genres []Genre      `json:",omitempty"`
+	Tags   []string     `json:",omitempty" example:"summer"`
+}
+
+type AlbumType string
+
+const (
+	AlbumTypeAlbum       AlbumType = "album"
+	AlbumTypeSingle      AlbumType = "single"
+	AlbumTypeEP          AlbumType = "ep"
+	AlbumTypeCompilation AlbumType = "compilation"
+)
+
+// AlbumTrack is a track at its place on an album
+type AlbumTrack struct {
+	DiscNumber  int `example:"1"`
+	TrackNumber int `example:"3"`
+	Track
+}
+
+type Albums struct {
+	Albums []Album `swaggertype:"object,string" example:"key:value"`
+}
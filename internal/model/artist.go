@@ -6,6 +6,15 @@ type Artist struct {
 	ID          uuid.UUID `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
 	Name        string    `example:"Taylor Swift"`
 	Description string    `example:"Taylor Swift (born December 13, 1989, West Reading, Pennsylvania, U.S.) is a multitalented singer-songwriter and global superstar who has captivated audiences with her heartfelt lyrics and catchy melodies, solidifying herself as one of the most influential artists in contemporary music."`
+	// MBID is the MusicBrainz identifier of the artist, it is unique in the catalog
+	MBID *uuid.UUID `json:",omitempty" db:"mbid" example:"20244d07-534f-4eff-b4d4-930878889970"`
+	// UserID is the account managing the artist, it sees the releases of the artist before they go live
+	UserID *uuid.UUID `json:",omitempty" db:"user_id" example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	// Genres and Tags are only loaded with a single artist
+	Genres []Genre  `json:",omitempty" db:"-"`
+	Tags   []string `json:",omitempty" db:"-" example:"pop"`
+	// Images lists every stored size of the avatar and the banner, the largest first
+	Images []Image `db:"-"`
 }
 
 type Artists struct {
@@ -0,0 +1,24 @@
+package model
+
+import "github.com/gofrs/uuid/v5"
+
+// CreditRole is what an artist did on a track, primary and featured artists are the artists of the track
+// while the other roles are only listed in its credits
+type CreditRole string
+
+const (
+	CreditPrimary  CreditRole = "primary"
+	CreditFeatured CreditRole = "featured"
+	CreditComposer CreditRole = "composer"
+	CreditLyricist CreditRole = "lyricist"
+	CreditProducer CreditRole = "producer"
+	CreditRemixer  CreditRole = "remixer"
+)
+
+// Credit is an artist credited on a track, Position orders the artists sharing a role
+type Credit struct {
+	ArtistID uuid.UUID  `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	Name     string     `example:"Phum Viphurit"`
+	Role     CreditRole `example:"primary"`
+	Position int        `example:"0"`
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// Folder groups playlists and other folders in the library of a user
+type Folder struct {
+	ID       uuid.UUID  `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	UserID   uuid.UUID  `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	Name     string     `example:"Workout"`
+	ParentID *uuid.UUID `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+}
+
+type LibraryItemType string
+
+const (
+	LibraryFolder   LibraryItemType = "folder"
+	LibraryPlaylist LibraryItemType = "playlist"
+	// tracks and albums are saved to the library, they aren't placed in folders
+	LibraryTrack LibraryItemType = "track"
+	LibraryAlbum LibraryItemType = "album"
+)
+
+// LibraryItem references a folder or a playlist of a library
+type LibraryItem struct {
+	Type LibraryItemType `json:"type" example:"playlist"`
+	ID   uuid.UUID       `json:"id" example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+}
+
+// SavedItem is a track or an album saved to the library of a user. An item saved before its release is pre-saved,
+// it joins the library when it goes live and AddedAt is then its release date
+type SavedItem struct {
+	Type        LibraryItemType `json:"type" example:"album"`
+	ID          uuid.UUID       `json:"id" example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	AddedAt     time.Time       `json:"added_at" example:"2026-10-23T00:00:00Z"`
+	ReleaseDate *time.Time      `json:"release_date,omitempty" example:"2026-10-23T00:00:00Z"`
+	// LinkedFrom is the saved track when ID is another version of it, see Track.LinkedFrom
+	LinkedFrom *uuid.UUID `json:"linked_from,omitempty" example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+}
+
+// LibraryNode is a node of the library tree, folders carry their content in Children
+type LibraryNode struct {
+	Type     LibraryItemType `example:"folder"`
+	Folder   *Folder
+	Playlist *Playlist
+	Children []LibraryNode
+}
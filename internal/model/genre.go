@@ -0,0 +1,35 @@
+package model
+
+import "github.com/gofrs/uuid/v5"
+
+// Genre is a node of the genre taxonomy, like Indie Rock under Rock
+type Genre struct {
+	ID       uuid.UUID  `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	Name     string     `example:"Indie Rock"`
+	Slug     string     `example:"indie-rock"`
+	ParentID *uuid.UUID `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+}
+
+// GenreCount is a genre as listed when browsing, the counts include the items of its descendants
+type GenreCount struct {
+	Genre
+	ChildCount  int `example:"4"`
+	TrackCount  int `example:"1200"`
+	AlbumCount  int `example:"110"`
+	ArtistCount int `example:"35"`
+}
+
+// TagCount is a free-form tag with the number of tracks, albums and artists carrying it
+type TagCount struct {
+	Tag   string `example:"summer"`
+	Count int    `example:"42"`
+}
+
+// TaxonomyTarget names the kind of catalog item genres and tags are attached to, it also tells who may edit the item
+type TaxonomyTarget string
+
+const (
+	TaxonomyTrack  TaxonomyTarget = "track"
+	TaxonomyAlbum  TaxonomyTarget = "album"
+	TaxonomyArtist TaxonomyTarget = "artist"
+)
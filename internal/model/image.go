@@ -0,0 +1,17 @@
+package model
+
+// ImageKind tells apart the images of an artist
+type ImageKind string
+
+const (
+	ImageAvatar ImageKind = "avatar"
+	ImageBanner ImageKind = "banner"
+)
+
+// Image is one of the sizes an image is stored at
+type Image struct {
+	Kind   ImageKind `example:"avatar"`
+	Width  int       `example:"300"`
+	Height int       `example:"300"`
+	URL    string    `example:"/artists/3983a1d6-759b-4e5e-b307-7b7e06a05a85/images/avatar/300"`
+}
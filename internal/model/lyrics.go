@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// Lyrics of a track. Synced lyrics have the time every line is sung at, plain lyrics only the text
+type Lyrics struct {
+	TrackID   uuid.UUID `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	Synced    bool      `example:"true"`
+	Language  string    `json:",omitempty" example:"en"`
+	Lines     []LyricLine
+	UpdatedAt time.Time `example:"2024-05-01T10:00:00Z"`
+}
+
+// LyricLine is a line of lyrics, TimeMs is its offset from the start of the track and is zero in plain lyrics
+type LyricLine struct {
+	TimeMs int    `example:"12340"`
+	Text   string `example:"Blue town, blue town"`
+}
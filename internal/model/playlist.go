@@ -1,10 +1,118 @@
 package model
 
-import "github.com/gofrs/uuid/v5"
+import (
+	"time"
 
+	"github.com/gofrs/uuid/v5"
+)
+
+// Playlist is a list of tracks owned by a user. In lists of playlists the TrackIDList of smart playlists which
+// aren't materialized is nil, their rules are only evaluated when the playlist itself is read
 type Playlist struct {
-	ID          uuid.UUID
-	Name        string
-	UserID      uuid.UUID
-	TrackIDList []uuid.UUID
+	ID            uuid.UUID          `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	Name          string             `example:"Chill vibes"`
+	UserID        uuid.UUID          `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	TrackIDList   []uuid.UUID        `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	SnapshotID    uuid.UUID          `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	Visibility    PlaylistVisibility `example:"public"`
+	FollowerCount int                `example:"12"`
+	Rules         *SmartRules
+	RefreshedAt   *time.Time `example:"2024-04-01T09:00:00Z"`
+	// HasCover tells whether a cover was uploaded, otherwise the cover is a mosaic of the artists in the playlist
+	HasCover bool `example:"false"`
+}
+
+// SmartRules turn a playlist into a smart playlist whose tracks are the ones matching the rules.
+// The rules are evaluated every time the playlist is read, materialized playlists keep the tracks
+// of their last refresh instead
+type SmartRules struct {
+	FollowedArtists bool        `json:"followed_artists" example:"true"`
+	ArtistID        []uuid.UUID `json:"artist_id" example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	Name            string      `json:"name" example:"remix"`
+	MinLength       int         `json:"min_length" example:"60"`
+	MaxLength       int         `json:"max_length" example:"240"`
+	AddedWithinDays int         `json:"added_within_days" example:"30"`
+	SortBy          []string    `json:"sort_by" example:"-popularity"`
+	Limit           int         `json:"limit" example:"50"`
+	Materialized    bool        `json:"materialized" example:"false"`
+}
+
+type Playlists struct {
+	Playlists []Playlist `swaggertype:"object,string" example:"key:value"`
+}
+
+// PlaylistVisibility decides who can see a playlist: public ones are listed on the owner's profile,
+// unlisted ones are reachable by anyone knowing their ID, private ones only by the owner and members
+type PlaylistVisibility string
+
+const (
+	PlaylistPublic   PlaylistVisibility = "public"
+	PlaylistUnlisted PlaylistVisibility = "unlisted"
+	PlaylistPrivate  PlaylistVisibility = "private"
+)
+
+type PlaylistRole string
+
+const (
+	PlaylistOwner  PlaylistRole = "owner"
+	PlaylistEditor PlaylistRole = "editor"
+	PlaylistViewer PlaylistRole = "viewer"
+)
+
+type PlaylistMember struct {
+	UserID  uuid.UUID    `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	Role    PlaylistRole `example:"editor"`
+	AddedAt time.Time    `example:"2024-04-01T09:00:00Z"`
+}
+
+// PlaylistTrack is a track at a position of a playlist together with who added it and when
+type PlaylistTrack struct {
+	Position int        `example:"0"`
+	AddedBy  *uuid.UUID `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	AddedAt  time.Time  `example:"2024-04-01T09:00:00Z"`
+	Track    Track
+}
+
+type PlaylistTracks struct {
+	Tracks []PlaylistTrack `swaggertype:"object,string" example:"key:value"`
+}
+
+type PlaylistAction string
+
+const (
+	PlaylistCreated         PlaylistAction = "create"
+	PlaylistTracksAdded     PlaylistAction = "add"
+	PlaylistTracksRemoved   PlaylistAction = "remove"
+	PlaylistTracksReordered PlaylistAction = "reorder"
+	PlaylistRenamed         PlaylistAction = "rename"
+	PlaylistRestored        PlaylistAction = "restore"
+	PlaylistRulesChanged    PlaylistAction = "rules"
+	PlaylistRefreshed       PlaylistAction = "refresh"
+	PlaylistDeduplicated    PlaylistAction = "dedupe"
+)
+
+// PlaylistVersion is the state of a playlist right after a change, identified by the snapshot the change produced
+type PlaylistVersion struct {
+	SnapshotID  uuid.UUID      `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	Action      PlaylistAction `example:"remove"`
+	UserID      *uuid.UUID     `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	Name        string         `example:"Chill vibes"`
+	TrackIDList []uuid.UUID    `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	CreatedAt   time.Time      `example:"2024-04-01T09:00:00Z"`
+}
+
+// PlaylistImportReport is the result of importing a playlist file, entries which couldn't be matched
+// to a catalog track are left out of the playlist and listed in Unmatched
+type PlaylistImportReport struct {
+	Playlist  *Playlist
+	Matched   int `example:"42"`
+	Unmatched []UnmatchedEntry
+}
+
+type UnmatchedEntry struct {
+	Line     int    `example:"7"`
+	Location string `example:"Music/Taylor Swift - Blue Town.mp3"`
+	Title    string `example:"Blue Town"`
+	Artist   string `example:"Taylor Swift"`
+	Length   int    `example:"88"`
 }
@@ -1,14 +1,92 @@
 package model
 
-import "github.com/gofrs/uuid/v5"
+import (
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
 
 type Track struct {
-	ID       uuid.UUID   `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
-	Name     string      `example:"Blue Town"`
-	Length   int         `example:"88"`
+	ID     uuid.UUID `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	Name   string    `example:"Blue Town"`
+	Length int       `example:"88"`
+	// ArtistID lists the primary then the featured artists of the track
 	ArtistID []uuid.UUID `example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	// ISRC identifies the recording across labels and stores, it is unique in the catalog
+	ISRC     string `json:",omitempty" example:"USRC17607839"`
+	Explicit bool   `example:"false"`
+	// ReleaseDate is when the track goes live, a track without one is available from its creation
+	ReleaseDate *time.Time `json:",omitempty" example:"2026-10-23T00:00:00Z"`
+	// Markets lists the ISO 3166-1 alpha-2 countries the track is licensed in, every country when empty
+	Markets []string `json:",omitempty" example:"VN,TH"`
+	// WorkID groups the versions of a recording, Version tells them apart
+	WorkID  *uuid.UUID   `json:",omitempty" example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	Version TrackVersion `example:"original"`
+	// LinkedFrom is the track held by a playlist or a library when it was relinked to this version,
+	// because that one is taken down or not licensed in the market of the caller
+	LinkedFrom *uuid.UUID `json:",omitempty" example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	// Credits, ArtistLine, Audio, Genres and Tags are only loaded with a single track, Audio is nil until a file is uploaded.
+	// ArtistLine names the primary and featured artists the way players display them
+	Credits    []Credit    `json:",omitempty"`
+	ArtistLine string      `json:",omitempty" example:"Phum Viphurit feat. Higher Brothers"`
+	Audio      *TrackAudio `json:",omitempty"`
+	Genres     []Genre     `json:",omitempty"`
+	Tags       []string    `json:",omitempty" example:"summer"`
 }
 
 type Tracks struct {
 	Tracks []Track `swaggertype:"object,string" example:"key:value"`
 }
+
+// TrackAudio describes the audio file uploaded for a track
+type TrackAudio struct {
+	Format  string `example:"flac"`
+	Codec   string `example:"flac"`
+	Size    int64  `example:"31457280"`
+	Bitrate int    `example:"1411200"`
+	// DurationMs is the duration of the decoded stream in milliseconds, the Length of the track is derived from it
+	DurationMs int        `example:"215430"`
+	Checksum   string     `example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	UploadedAt time.Time  `example:"2024-05-01T10:00:00Z"`
+	Tags       *AudioTags `json:",omitempty"`
+	HasArtwork bool       `example:"true"`
+	StorageKey string     `json:"-"`
+	ArtworkKey string     `json:"-"`
+	Loudness   *Loudness  `json:",omitempty"`
+	// LoudnessHistogram counts the blocks of the audio by loudness, albums are measured from the histograms of their tracks
+	LoudnessHistogram []int `json:"-"`
+	// Waveform is only stored, it is read with the waveform of the track
+	Waveform [][2]float64 `json:"-" db:"-"`
+}
+
+// Waveform is the peak waveform of the audio of a track, each point holds the lowest and the highest sample
+// of its slice of the audio over all channels, in [-1, 1]
+type Waveform struct {
+	Points     int          `example:"1000"`
+	DurationMs int          `example:"215430"`
+	Peaks      [][2]float64 `swaggertype:"array,number" example:"-0.412,0.398"`
+	// Estimated waveforms of lossy audio are symmetric envelopes scaled to the loudest frame rather than sample peaks
+	Estimated bool `example:"false"`
+}
+
+// Loudness of the audio of a track measured following EBU R128, only WAV and FLAC files are measured.
+// The gains and peaks follow ReplayGain 2.0 which brings tracks to -18 LUFS, peaks are linear true peaks.
+// The album values cover the analyzed tracks of the first album released with the track
+type Loudness struct {
+	IntegratedLUFS float64  `example:"-9.21"`
+	TruePeakDBTP   float64  `example:"-0.42"`
+	TrackGain      float64  `example:"-8.79"`
+	TrackPeak      float64  `example:"0.953"`
+	AlbumGain      *float64 `json:",omitempty" example:"-8.13"`
+	AlbumPeak      *float64 `json:",omitempty" example:"0.989"`
+}
+
+// AudioTags are the tags embedded in the uploaded audio file
+type AudioTags struct {
+	Title       string   `json:"title,omitempty" example:"Blue Town"`
+	Artists     []string `json:"artists,omitempty" example:"Phum Viphurit"`
+	Album       string   `json:"album,omitempty" example:"Manchild"`
+	TrackNumber int      `json:"track_number,omitempty" example:"3"`
+	Year        int      `json:"year,omitempty" example:"2017"`
+	Genre       string   `json:"genre,omitempty" example:"Indie Pop"`
+}
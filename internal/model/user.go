@@ -7,4 +7,10 @@ type User struct {
 	Username string    `json:"username"`
 	Email    string    `json:"email"`
 	Password string    `json:"-"`
+	// HideExplicit removes explicit tracks from the listings the user gets
+	HideExplicit bool `json:"hide_explicit"`
+	// Country is the ISO 3166-1 alpha-2 code of the market the user gets the catalog of
+	Country string `json:"country"`
+	// IsAdmin is granted in the database, admins see releases before they go live
+	IsAdmin bool `json:"is_admin"`
 }
@@ -0,0 +1,20 @@
+package model
+
+import "github.com/gofrs/uuid/v5"
+
+// TrackVersion tells apart the tracks of a work
+type TrackVersion string
+
+const (
+	VersionOriginal  TrackVersion = "original"
+	VersionRemaster  TrackVersion = "remaster"
+	VersionLive      TrackVersion = "live"
+	VersionRemix     TrackVersion = "remix"
+	VersionRadioEdit TrackVersion = "radio_edit"
+)
+
+// TrackOfWork is a track linked as a version of a work
+type TrackOfWork struct {
+	TrackID uuid.UUID    `json:"track_id" example:"3983a1d6-759b-4e5e-b307-7b7e06a05a85"`
+	Version TrackVersion `json:"version" example:"live"`
+}
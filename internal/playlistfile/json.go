@@ -0,0 +1,76 @@
+package playlistfile
+
+import (
+	"encoding/json"
+	"flotify/internal/custom_error"
+	"io"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+type jsonPlaylist struct {
+	Name   string      `json:"name"`
+	Tracks []jsonTrack `json:"tracks"`
+}
+
+type jsonTrack struct {
+	TrackID  *uuid.UUID `json:"track_id,omitempty"`
+	Title    string     `json:"title,omitempty"`
+	Artist   string     `json:"artist,omitempty"`
+	Length   int        `json:"length,omitempty"`
+	Location string     `json:"location,omitempty"`
+}
+
+func encodeJSON(w io.Writer, playlist Playlist) error {
+	document := jsonPlaylist{
+		Name:   playlist.Name,
+		Tracks: make([]jsonTrack, 0, len(playlist.Entries)),
+	}
+	for _, entry := range playlist.Entries {
+		track := jsonTrack{
+			Title:    entry.Title,
+			Artist:   entry.Artist,
+			Length:   entry.Length,
+			Location: entry.Location,
+		}
+		if !entry.TrackID.IsNil() {
+			track_id := entry.TrackID
+			track.TrackID = &track_id
+		}
+		document.Tracks = append(document.Tracks, track)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(document)
+}
+
+func decodeJSON(r io.Reader) (*Playlist, error) {
+	document := jsonPlaylist{}
+	if err := json.NewDecoder(r).Decode(&document); err != nil {
+		return nil, custom_error.InvalidPlaylistFileError{Reason: err.Error()}
+	}
+
+	playlist := Playlist{
+		Name:    strings.TrimSpace(document.Name),
+		Entries: make([]Entry, 0, len(document.Tracks)),
+	}
+	for i, track := range document.Tracks {
+		entry := Entry{
+			Title:    strings.TrimSpace(track.Title),
+			Artist:   strings.TrimSpace(track.Artist),
+			Length:   track.Length,
+			Location: strings.TrimSpace(track.Location),
+			Line:     i + 1,
+		}
+		if track.TrackID != nil {
+			entry.TrackID = *track.TrackID
+		} else if entry.Location != "" {
+			entry.TrackID = trackIDOfLocation(entry.Location)
+		}
+		playlist.Entries = append(playlist.Entries, entry)
+	}
+
+	return &playlist, nil
+}
@@ -0,0 +1,111 @@
+package playlistfile
+
+import (
+	"bufio"
+	"flotify/internal/custom_error"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func encodeM3U8(w io.Writer, playlist Playlist) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#EXTM3U")
+	if playlist.Name != "" {
+		fmt.Fprintf(bw, "#PLAYLIST:%s\n", oneLine(playlist.Name))
+	}
+
+	for _, entry := range playlist.Entries {
+		length := entry.Length
+		if length == 0 {
+			length = -1
+		}
+		display := oneLine(entry.Title)
+		if entry.Artist != "" {
+			display = oneLine(entry.Artist) + " - " + display
+		}
+		fmt.Fprintf(bw, "#EXTINF:%d,%s\n", length, display)
+
+		location := entry.Location
+		if location == "" {
+			location = TrackURI(entry.TrackID)
+		}
+		fmt.Fprintln(bw, oneLine(location))
+	}
+
+	return bw.Flush()
+}
+
+func decodeM3U8(r io.Reader) (*Playlist, error) {
+	playlist := Playlist{Entries: []Entry{}}
+
+	scanner := bufio.NewScanner(r)
+	// the info line only applies to the location line following it
+	var info *Entry
+	line_number := 0
+	for scanner.Scan() {
+		line_number++
+		line := strings.TrimSpace(scanner.Text())
+		if line_number == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXTINF:"):
+			entry, err := parseExtinf(strings.TrimPrefix(line, "#EXTINF:"))
+			if err != nil {
+				return nil, custom_error.InvalidPlaylistFileError{Line: line_number, Reason: err.Error()}
+			}
+			entry.Line = line_number
+			info = entry
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			playlist.Name = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#"):
+			// other directives and comments are not needed to find the tracks
+			continue
+		default:
+			entry := Entry{Line: line_number}
+			if info != nil {
+				entry = *info
+			}
+			entry.Location = line
+			entry.TrackID = trackIDOfLocation(line)
+			if entry.Title == "" {
+				entry.Artist, entry.Title = describeLocation(line)
+			}
+			playlist.Entries = append(playlist.Entries, entry)
+			info = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, custom_error.InvalidPlaylistFileError{Line: line_number, Reason: err.Error()}
+	}
+
+	return &playlist, nil
+}
+
+// parseExtinf reads the "<length> [attributes],<artist> - <title>" part of an info line
+func parseExtinf(info string) (*Entry, error) {
+	head, display, _ := strings.Cut(info, ",")
+	length_string_form, _, _ := strings.Cut(strings.TrimSpace(head), " ")
+
+	length, err := strconv.ParseFloat(length_string_form, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid track length %q", length_string_form)
+	}
+
+	entry := Entry{}
+	if length > 0 {
+		entry.Length = int(length + 0.5)
+	}
+	entry.Artist, entry.Title = splitDisplay(display)
+	return &entry, nil
+}
+
+// oneLine keeps values from breaking the line based format
+func oneLine(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
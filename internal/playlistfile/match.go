@@ -0,0 +1,140 @@
+package playlistfile
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// Candidate is a catalog track an entry might refer to
+type Candidate struct {
+	TrackID uuid.UUID
+	Title   string
+	Artists []string
+	Length  int
+}
+
+const (
+	minTitleSimilarity  = 0.8
+	minArtistSimilarity = 0.6
+	// maxLengthDifference is the number of seconds two recordings of the same track may differ by
+	maxLengthDifference = 10
+)
+
+// BestMatch picks the candidate most likely to be the track described by the entry,
+// comparing title, artist and length. Unknown artist or length of the entry are not held against a candidate
+func BestMatch(entry Entry, candidates []Candidate) (uuid.UUID, bool) {
+	best_id := uuid.Nil
+	best_score := 0.0
+	for _, candidate := range candidates {
+		score, ok := matchScore(entry, candidate)
+		if ok && score > best_score {
+			best_id = candidate.TrackID
+			best_score = score
+		}
+	}
+	return best_id, !best_id.IsNil()
+}
+
+func matchScore(entry Entry, candidate Candidate) (float64, bool) {
+	title_score := titleSimilarity(entry.Title, candidate.Title)
+	if title_score < minTitleSimilarity {
+		return 0, false
+	}
+
+	artist_score := 0.5
+	if entry.Artist != "" && len(candidate.Artists) > 0 {
+		artist_score = similarity(normalize(entry.Artist), normalize(strings.Join(candidate.Artists, " ")))
+		for _, artist := range candidate.Artists {
+			artist_score = max(artist_score, similarity(normalize(entry.Artist), normalize(artist)))
+		}
+		if artist_score < minArtistSimilarity {
+			return 0, false
+		}
+	}
+
+	length_score := 0.5
+	if entry.Length > 0 && candidate.Length > 0 {
+		difference := entry.Length - candidate.Length
+		if difference < 0 {
+			difference = -difference
+		}
+		if difference > maxLengthDifference {
+			return 0, false
+		}
+		length_score = 1 - float64(difference)/maxLengthDifference
+	}
+
+	return 0.6*title_score + 0.3*artist_score + 0.1*length_score, true
+}
+
+// SearchTitle is the part of the title worth searching the catalog for
+func (e Entry) SearchTitle() string {
+	return normalize(stripBrackets(e.Title))
+}
+
+// titleSimilarity also compares the titles without their bracketed parts,
+// so "Blue Town (Remastered)" still matches "Blue Town"
+func titleSimilarity(a, b string) float64 {
+	score := similarity(normalize(a), normalize(b))
+	return max(score, similarity(normalize(stripBrackets(a)), normalize(stripBrackets(b))))
+}
+
+// normalize lowercases the value and keeps only words made of letters and digits
+func normalize(value string) string {
+	words := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+func stripBrackets(value string) string {
+	var builder strings.Builder
+	depth := 0
+	for _, r := range value {
+		switch r {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			if depth > 0 {
+				depth--
+			}
+		default:
+			if depth == 0 {
+				builder.WriteRune(r)
+			}
+		}
+	}
+	return builder.String()
+}
+
+// similarity is 1 minus the edit distance of the values relative to the longer one
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	return 1 - float64(editDistance(ra, rb))/float64(max(len(ra), len(rb)))
+}
+
+func editDistance(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,138 @@
+// Package playlistfile reads and writes playlists in the interchange formats understood by other players
+package playlistfile
+
+import (
+	"flotify/internal/custom_error"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+type Format string
+
+const (
+	M3U8 Format = "m3u8"
+	XSPF Format = "xspf"
+	JSON Format = "json"
+)
+
+// Playlist is the content of a playlist file
+type Playlist struct {
+	Name    string
+	Entries []Entry
+}
+
+// Entry is one track of a playlist file. TrackID is set when the entry references a catalog track,
+// the other fields describe the track for files coming from other players
+type Entry struct {
+	TrackID  uuid.UUID
+	Title    string
+	Artist   string
+	Length   int
+	Location string
+	// Line is the line of the entry in a m3u8 file, or its index in the other formats
+	Line int
+}
+
+// trackURIPrefix is used as location of exported tracks so they are found by id when imported again
+const trackURIPrefix = "flotify:track:"
+
+func ParseFormat(name string) (Format, error) {
+	format := Format(strings.ToLower(strings.TrimPrefix(name, ".")))
+	switch format {
+	case M3U8, XSPF, JSON:
+		return format, nil
+	case "m3u":
+		return M3U8, nil
+	}
+	return "", custom_error.UnsupportedPlaylistFormatError{Format: name}
+}
+
+// FormatOfFile guesses the format from the extension of the file name
+func FormatOfFile(filename string) (Format, error) {
+	return ParseFormat(filepath.Ext(filename))
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case M3U8:
+		return "audio/x-mpegurl; charset=utf-8"
+	case XSPF:
+		return "application/xspf+xml; charset=utf-8"
+	}
+	return "application/json; charset=utf-8"
+}
+
+func Encode(w io.Writer, format Format, playlist Playlist) error {
+	switch format {
+	case M3U8:
+		return encodeM3U8(w, playlist)
+	case XSPF:
+		return encodeXSPF(w, playlist)
+	case JSON:
+		return encodeJSON(w, playlist)
+	}
+	return custom_error.UnsupportedPlaylistFormatError{Format: string(format)}
+}
+
+func Decode(r io.Reader, format Format) (*Playlist, error) {
+	switch format {
+	case M3U8:
+		return decodeM3U8(r)
+	case XSPF:
+		return decodeXSPF(r)
+	case JSON:
+		return decodeJSON(r)
+	}
+	return nil, custom_error.UnsupportedPlaylistFormatError{Format: string(format)}
+}
+
+func TrackURI(track_id uuid.UUID) string {
+	return trackURIPrefix + track_id.String()
+}
+
+// trackIDOfLocation finds the catalog track a location points at, either a track uri
+// or an url whose last path segment is the track id
+func trackIDOfLocation(location string) uuid.UUID {
+	location = strings.TrimSpace(location)
+	if strings.HasPrefix(location, trackURIPrefix) {
+		id, _ := uuid.FromString(strings.TrimPrefix(location, trackURIPrefix))
+		return id
+	}
+
+	location = strings.TrimRight(location, "/")
+	if i := strings.LastIndexAny(location, "/:"); i >= 0 {
+		location = location[i+1:]
+	}
+	id, err := uuid.FromString(location)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
+// describeLocation derives artist and title from a file name like "Artist - Title.mp3",
+// used for entries that carry nothing but their location. The names of urls are unescaped
+func describeLocation(location string) (artist, title string) {
+	location = strings.ReplaceAll(location, "\\", "/")
+	name := filepath.Base(location)
+	if strings.Contains(location, "://") {
+		if unescaped, err := url.PathUnescape(name); err == nil {
+			name = unescaped
+		}
+	}
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	return splitDisplay(name)
+}
+
+// splitDisplay splits the "Artist - Title" form used by m3u8 players
+func splitDisplay(display string) (artist, title string) {
+	display = strings.TrimSpace(display)
+	if artist, title, ok := strings.Cut(display, " - "); ok {
+		return strings.TrimSpace(artist), strings.TrimSpace(title)
+	}
+	return "", display
+}
@@ -0,0 +1,205 @@
+package playlistfile
+
+import (
+	"bytes"
+	"errors"
+	"flotify/internal/custom_error"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+var testTrackID = uuid.Must(uuid.FromString("3983a1d6-759b-4e5e-b307-7b7e06a05a85"))
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+		want   *Playlist
+	}{
+		{
+			name:   "m3u8",
+			format: M3U8,
+			input: "\ufeff#EXTM3U\n#PLAYLIST:Chill vibes\n" +
+				"#EXTINF:215.4 tvg-id=\"x\",Phum Viphurit - Lover Boy\nmusic/lover boy.mp3\n" +
+				"\n# a comment\n" +
+				"#EXTINF:-1,Blue Town\nflotify:track:3983a1d6-759b-4e5e-b307-7b7e06a05a85\n" +
+				"C:\\Music\\HYBS - Tip Toe.flac\n",
+			want: &Playlist{Name: "Chill vibes", Entries: []Entry{
+				{Title: "Lover Boy", Artist: "Phum Viphurit", Length: 215, Location: "music/lover boy.mp3", Line: 3},
+				{TrackID: testTrackID, Title: "Blue Town", Location: "flotify:track:3983a1d6-759b-4e5e-b307-7b7e06a05a85", Line: 7},
+				{Title: "Tip Toe", Artist: "HYBS", Location: "C:\\Music\\HYBS - Tip Toe.flac", Line: 9},
+			}},
+		},
+		{
+			name:   "xspf",
+			format: XSPF,
+			input: `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <title> Chill vibes </title>
+  <trackList>
+    <track>
+      <location>https://example.com/tracks/3983a1d6-759b-4e5e-b307-7b7e06a05a85</location>
+      <title>Blue Town</title>
+      <creator>Phum Viphurit</creator>
+      <duration>215499</duration>
+    </track>
+    <track>
+      <location>file:///music/HYBS%20-%20Tip%20Toe.flac</location>
+      <location>https://example.com/other</location>
+    </track>
+  </trackList>
+</playlist>`,
+			want: &Playlist{Name: "Chill vibes", Entries: []Entry{
+				{
+					TrackID:  testTrackID,
+					Title:    "Blue Town",
+					Artist:   "Phum Viphurit",
+					Length:   215,
+					Location: "https://example.com/tracks/3983a1d6-759b-4e5e-b307-7b7e06a05a85",
+					Line:     1,
+				},
+				{Title: "Tip Toe", Artist: "HYBS", Location: "file:///music/HYBS%20-%20Tip%20Toe.flac", Line: 2},
+			}},
+		},
+		{
+			name:   "json",
+			format: JSON,
+			input: `{"name": "Chill vibes", "tracks": [
+				{"track_id": "3983a1d6-759b-4e5e-b307-7b7e06a05a85", "title": "Blue Town"},
+				{"title": " Tip Toe ", "artist": "HYBS", "length": 181, "location": "flotify:track:3983a1d6-759b-4e5e-b307-7b7e06a05a85"},
+				{"title": "Lover Boy", "location": "music/lover boy.mp3"}
+			]}`,
+			want: &Playlist{Name: "Chill vibes", Entries: []Entry{
+				{TrackID: testTrackID, Title: "Blue Town", Line: 1},
+				{TrackID: testTrackID, Title: "Tip Toe", Artist: "HYBS", Length: 181, Location: "flotify:track:3983a1d6-759b-4e5e-b307-7b7e06a05a85", Line: 2},
+				{Title: "Lover Boy", Location: "music/lover boy.mp3", Line: 3},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Decode(strings.NewReader(test.input), test.format)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Decode() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+	}{
+		{name: "m3u8 length", format: M3U8, input: "#EXTM3U\n#EXTINF:long,Blue Town\nblue.mp3\n"},
+		{name: "xspf", format: XSPF, input: "<playlist><trackList>"},
+		{name: "json", format: JSON, input: `{"tracks": {}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Decode(strings.NewReader(test.input), test.format)
+			if !errors.As(err, &custom_error.InvalidPlaylistFileError{}) {
+				t.Errorf("Decode() error = %v, want InvalidPlaylistFileError", err)
+			}
+		})
+	}
+}
+
+func TestEncodeThenDecode(t *testing.T) {
+	playlist := Playlist{Name: "Chill vibes", Entries: []Entry{
+		{TrackID: testTrackID, Title: "Blue Town", Artist: "Phum Viphurit", Length: 215},
+		{Title: "Tip Toe", Artist: "HYBS", Length: 181, Location: "music/tip toe.mp3"},
+	}}
+
+	for _, format := range []Format{M3U8, XSPF, JSON} {
+		t.Run(string(format), func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := Encode(&buffer, format, playlist); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			got, err := Decode(&buffer, format)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			if got.Name != playlist.Name || len(got.Entries) != len(playlist.Entries) {
+				t.Fatalf("Decode(Encode()) = %+v, want %+v", got, playlist)
+			}
+			for i, entry := range got.Entries {
+				want := playlist.Entries[i]
+				if entry.TrackID != want.TrackID || entry.Title != want.Title || entry.Artist != want.Artist || entry.Length != want.Length {
+					t.Errorf("entry %d = %+v, want %+v", i, entry, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		want        Format
+		unsupported bool
+	}{
+		{name: "m3u8", want: M3U8},
+		{name: ".M3U", want: M3U8},
+		{name: "xspf", want: XSPF},
+		{name: "JSON", want: JSON},
+		{name: "pls", unsupported: true},
+		{name: "", unsupported: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseFormat(test.name)
+		if test.unsupported {
+			if !errors.As(err, &custom_error.UnsupportedPlaylistFormatError{}) {
+				t.Errorf("ParseFormat(%q) error = %v, want UnsupportedPlaylistFormatError", test.name, err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestBestMatch(t *testing.T) {
+	original := Candidate{TrackID: uuid.UUID{1}, Title: "Blue Town", Artists: []string{"Phum Viphurit"}, Length: 215}
+	live := Candidate{TrackID: uuid.UUID{2}, Title: "Blue Town (Live)", Artists: []string{"Phum Viphurit"}, Length: 260}
+	cover := Candidate{TrackID: uuid.UUID{3}, Title: "Blue Town", Artists: []string{"Someone Else"}, Length: 215}
+
+	tests := []struct {
+		name  string
+		entry Entry
+		want  uuid.UUID
+	}{
+		{name: "exact", entry: Entry{Title: "Blue Town", Artist: "Phum Viphurit", Length: 215}, want: original.TrackID},
+		{name: "case and punctuation", entry: Entry{Title: "blue town!", Artist: "phum viphurit", Length: 214}, want: original.TrackID},
+		{name: "bracketed title", entry: Entry{Title: "Blue Town (Remastered)", Artist: "Phum Viphurit", Length: 216}, want: original.TrackID},
+		{name: "length picks the version", entry: Entry{Title: "Blue Town", Artist: "Phum Viphurit", Length: 258}, want: live.TrackID},
+		// the cover scores the same and ties keep the first candidate
+		{name: "unknown artist and length", entry: Entry{Title: "Blue Town"}, want: original.TrackID},
+		{name: "other title", entry: Entry{Title: "Lover Boy", Artist: "Phum Viphurit"}, want: uuid.Nil},
+		{name: "other artist", entry: Entry{Title: "Blue Town", Artist: "HYBS", Length: 215}, want: uuid.Nil},
+		{name: "length too different", entry: Entry{Title: "Blue Town", Artist: "Phum Viphurit", Length: 300}, want: uuid.Nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := BestMatch(test.entry, []Candidate{original, live, cover})
+			if got != test.want || ok != !test.want.IsNil() {
+				t.Errorf("BestMatch() = %v, %v, want %v", got, ok, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package playlistfile
+
+import (
+	"encoding/xml"
+	"flotify/internal/custom_error"
+	"io"
+	"strings"
+)
+
+const xspfNamespace = "http://xspf.org/ns/0/"
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"playlist"`
+	Version string      `xml:"version,attr"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location   []string `xml:"location,omitempty"`
+	Identifier []string `xml:"identifier,omitempty"`
+	Title      string   `xml:"title,omitempty"`
+	Creator    string   `xml:"creator,omitempty"`
+	// Duration is in milliseconds
+	Duration int `xml:"duration,omitempty"`
+}
+
+func encodeXSPF(w io.Writer, playlist Playlist) error {
+	document := xspfPlaylist{
+		Version: "1",
+		Xmlns:   xspfNamespace,
+		Title:   playlist.Name,
+		Tracks:  make([]xspfTrack, 0, len(playlist.Entries)),
+	}
+	for _, entry := range playlist.Entries {
+		track := xspfTrack{
+			Title:    entry.Title,
+			Creator:  entry.Artist,
+			Duration: entry.Length * 1000,
+		}
+		if entry.Location != "" {
+			track.Location = []string{entry.Location}
+		}
+		if !entry.TrackID.IsNil() {
+			track.Identifier = []string{TrackURI(entry.TrackID)}
+		}
+		document.Tracks = append(document.Tracks, track)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func decodeXSPF(r io.Reader) (*Playlist, error) {
+	document := xspfPlaylist{}
+	if err := xml.NewDecoder(r).Decode(&document); err != nil {
+		return nil, custom_error.InvalidPlaylistFileError{Reason: err.Error()}
+	}
+
+	playlist := Playlist{
+		Name:    strings.TrimSpace(document.Title),
+		Entries: make([]Entry, 0, len(document.Tracks)),
+	}
+	for i, track := range document.Tracks {
+		entry := Entry{
+			Title:  strings.TrimSpace(track.Title),
+			Artist: strings.TrimSpace(track.Creator),
+			Length: (track.Duration + 500) / 1000,
+			Line:   i + 1,
+		}
+		if len(track.Location) > 0 {
+			entry.Location = strings.TrimSpace(track.Location[0])
+		}
+
+		for _, reference := range append(track.Identifier, track.Location...) {
+			if id := trackIDOfLocation(reference); !id.IsNil() {
+				entry.TrackID = id
+				break
+			}
+		}
+		if entry.Title == "" && entry.Location != "" {
+			entry.Artist, entry.Title = describeLocation(entry.Location)
+		}
+		playlist.Entries = append(playlist.Entries, entry)
+	}
+
+	return &playlist, nil
+}
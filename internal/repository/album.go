@@ -0,0 +1,537 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"flotify/internal/custom_error"
+	"flotify/internal/model"
+	"fmt"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AlbumRepository interface {
+	GetAlbumByID(ctx context.Context, id uuid.UUID, viewer_id uuid.UUID, market string) (*model.Album, error)
+	GetAlbumsWithFilter(ctx context.Context, filter Filter) ([]model.Album, error)
+	CreateAlbum(ctx context.Context, album model.Album) (*model.Album, error)
+	ImportAlbum(ctx context.Context, album model.Album) (*model.Album, error)
+	UpdateAlbum(ctx context.Context, album model.Album) (*model.Album, error)
+	DeleteAlbum(ctx context.Context, id uuid.UUID) error
+	SetTracksOfAlbum(ctx context.Context, id uuid.UUID, tracks []model.AlbumTrack) (*model.Album, error)
+	GetCoverOfAlbum(ctx context.Context, id uuid.UUID) (string, error)
+	SetCoverOfAlbum(ctx context.Context, id uuid.UUID, cover_key string) (*model.Album, error)
+}
+
+type PostgresAlbumRepository struct {
+	dbpool *pgxpool.Pool
+}
+
+func NewPostgresAlbumRepository(dbpool *pgxpool.Pool) *PostgresAlbumRepository {
+	return &PostgresAlbumRepository{
+		dbpool: dbpool,
+	}
+}
+
+// albumSelect reads albums in the column order expected by scanAlbum,
+// the placeholders take the condition and the sort criteria
+const albumSelect = `
+	SELECT a.id, a.title, a.type, a.release_date, a.markets, a.label, COALESCE(a.upc, ''),
+		COALESCE((SELECT array_agg(aa.artist_id ORDER BY aa.position) FROM artists_albums aa WHERE aa.album_id = a.id), '{}'),
+		(SELECT count(*) FROM albums_tracks at WHERE at.album_id = a.id),
+		a.cover_key IS NOT NULL,
+		EXISTS (SELECT 1 FROM albums_tracks at JOIN tracks t ON t.id = at.track_id WHERE at.album_id = a.id AND t.explicit)
+	FROM albums a
+	WHERE %s
+	ORDER BY %s a.id ASC
+`
+
+func scanAlbum(row pgx.Row) (*model.Album, error) {
+	album := model.Album{}
+	err := row.Scan(&album.ID, &album.Title, &album.Type, &album.ReleaseDate, &album.Markets, &album.Label, &album.UPC, &album.ArtistID, &album.TrackCount, &album.HasCover, &album.Explicit)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistAlbumError{}
+		}
+		return nil, err
+	}
+	return &album, nil
+}
+
+// albumReleasedTo is the condition hiding the albums of alias released in the future from the viewer of its placeholder,
+// unless the viewer is an admin or the account of one of their artists
+func albumReleasedTo(alias string) string {
+	return fmt.Sprintf(`(%[1]s.release_date IS NULL OR %[1]s.release_date <= now() OR EXISTS (
+		SELECT 1 FROM users u WHERE u.id = %%s AND (u.is_admin OR EXISTS (
+			SELECT 1 FROM artists_albums rx JOIN artists ra ON ra.id = rx.artist_id
+			WHERE rx.album_id = %[1]s.id AND ra.user_id = u.id
+		))
+	))`, alias)
+}
+
+// GetAlbumByID returns the album with its tracks licensed in the market, without the explicit ones when the viewer hides them.
+// An album not released to the viewer yet doesn't exist for them, one not licensed in the market gives UnavailableInMarketError
+func (ar *PostgresAlbumRepository) GetAlbumByID(ctx context.Context, id uuid.UUID, viewer_id uuid.UUID, market string) (*model.Album, error) {
+	tx, err := ar.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	checkString := "SELECT " + fmt.Sprintf(albumReleasedTo("a"), "$2") + ", " + fmt.Sprintf(availableIn("a"), "$3") + " FROM albums a WHERE a.id = $1"
+	var released, available bool
+	if err = tx.QueryRow(ctx, checkString, id, viewer_id, market).Scan(&released, &available); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistAlbumError{}
+		}
+		return nil, err
+	}
+	if !released {
+		return nil, custom_error.NonExistAlbumError{}
+	}
+	if !available {
+		return nil, custom_error.UnavailableInMarketError{Market: market}
+	}
+
+	return getAlbum(ctx, tx, id, viewer_id, market)
+}
+
+func getAlbum(ctx context.Context, tx pgx.Tx, id uuid.UUID, viewer_id uuid.UUID, market string) (*model.Album, error) {
+	album, err := scanAlbum(tx.QueryRow(ctx, fmt.Sprintf(albumSelect, "a.id = $1", ""), id))
+	if err != nil {
+		return nil, err
+	}
+
+	fetchString := `
+		SELECT at.disc_number, at.track_number, t.id, t.name, t.length, t.explicit,
+			COALESCE((
+				SELECT array_agg(x.artist_id ORDER BY x.role = 'featured', x.position) FROM artists_tracks x
+				WHERE x.track_id = t.id AND x.role IN ('primary', 'featured')
+			), '{}')
+		FROM albums_tracks at
+		JOIN tracks t ON t.id = at.track_id
+		WHERE at.album_id = $1 AND ` + fmt.Sprintf(explicitAllowed("t"), "$2") + ` AND ` + fmt.Sprintf(availableIn("t"), "$3") + `
+		ORDER BY at.disc_number, at.track_number
+	`
+	rows, err := tx.Query(ctx, fetchString, id, viewer_id, market)
+	if err != nil {
+		return nil, err
+	}
+
+	album.Tracks, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.AlbumTrack, error) {
+		album_track := model.AlbumTrack{}
+		err := row.Scan(&album_track.DiscNumber, &album_track.TrackNumber, &album_track.ID, &album_track.Name, &album_track.Length, &album_track.Explicit, &album_track.ArtistID)
+		return album_track, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	album.Genres, err = genresOf(ctx, tx, model.TaxonomyAlbum, id)
+	if err != nil {
+		return nil, err
+	}
+	album.Tags, err = tagsOf(ctx, tx, model.TaxonomyAlbum, id)
+	if err != nil {
+		return nil, err
+	}
+	return album, nil
+}
+
+// albumSortColumns are the fields albums can be sorted by
+var albumSortColumns = map[string]string{
+	"title":        "a.title",
+	"release_date": "a.release_date",
+	"created_at":   "a.created_at",
+}
+
+// GetAlbumsWithFilter hides the albums not released to the viewer of the filter or not licensed in its market,
+// it understands the following props:
+// title (full text search), type ([]model.AlbumType), artist_id (uuid.UUID), upc (string),
+// genre ([]string of slugs, descendants included) and tag ([]string, all required)
+func (ar *PostgresAlbumRepository) GetAlbumsWithFilter(ctx context.Context, filter Filter) ([]model.Album, error) {
+	sort_criteria, err := filter.GetSortCriteriaOf(albumSortColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	qb := queryBuilder{}
+	if title, ok := filter.Props["title"].(string); ok && title != "" {
+		qb.Where("to_tsvector('simple', a.title) @@ plainto_tsquery('simple', %s)", title)
+	}
+	if types, ok := filter.Props["type"].([]model.AlbumType); ok && len(types) > 0 {
+		type_list := make([]string, len(types))
+		for i, album_type := range types {
+			type_list[i] = string(album_type)
+		}
+		qb.Where("a.type = ANY(%s)", type_list)
+	}
+	if artist_id, ok := filter.Props["artist_id"].(uuid.UUID); ok {
+		qb.Where("EXISTS (SELECT 1 FROM artists_albums aa WHERE aa.album_id = a.id AND aa.artist_id = %s)", artist_id)
+	}
+	if upc, ok := filter.Props["upc"].(string); ok && upc != "" {
+		normalized, err := normalizeUPC(upc)
+		if err != nil {
+			return nil, err
+		}
+		qb.Where("a.upc = %s", normalized)
+	}
+	if genres, ok := filter.Props["genre"].([]string); ok && len(genres) > 0 {
+		whereGenre(&qb, model.TaxonomyAlbum, "a.id", genres)
+	}
+	if tags, ok := filter.Props["tag"].([]string); ok && len(tags) > 0 {
+		whereTag(&qb, model.TaxonomyAlbum, "a.id", tags)
+	}
+	qb.Where(albumReleasedTo("a"), filter.ViewerID)
+	if filter.Market != "" {
+		qb.Where(availableIn("a"), filter.Market)
+	}
+
+	fetchString := fmt.Sprintf(albumSelect, qb.Condition(), sort_criteria) +
+		fmt.Sprintf("LIMIT %s OFFSET %s", qb.Arg(filter.Limit), qb.Arg(filter.GetOffSet()))
+
+	rows, err := ar.dbpool.Query(ctx, fetchString, qb.args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Album, error) {
+		album, err := scanAlbum(row)
+		if err != nil {
+			return model.Album{}, err
+		}
+		return *album, nil
+	})
+}
+
+// CreateAlbum inserts an album, DuplicateIdentifierError when its UPC belongs to another album
+func (ar *PostgresAlbumRepository) CreateAlbum(ctx context.Context, album model.Album) (*model.Album, error) {
+	return ar.createAlbum(ctx, album, false)
+}
+
+// ImportAlbum inserts an album, or updates the album with the same UPC so repeated imports don't duplicate it.
+// The artists of an updated album are replaced, its tracks are kept
+func (ar *PostgresAlbumRepository) ImportAlbum(ctx context.Context, album model.Album) (*model.Album, error) {
+	return ar.createAlbum(ctx, album, true)
+}
+
+func (ar *PostgresAlbumRepository) createAlbum(ctx context.Context, album model.Album, upsert bool) (*model.Album, error) {
+	if album.Type == "" {
+		album.Type = model.AlbumTypeAlbum
+	}
+	if !validAlbumType(album.Type) {
+		return nil, custom_error.InvalidAlbumTypeError{}
+	}
+	upc, err := normalizeUPC(album.UPC)
+	if err != nil {
+		return nil, err
+	}
+	album.Markets, err = normalizeMarkets(album.Markets)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := ar.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	conflictString := "ON CONFLICT (upc) DO NOTHING"
+	if upsert {
+		conflictString = `ON CONFLICT (upc) DO UPDATE SET title = EXCLUDED.title, type = EXCLUDED.type,
+			release_date = EXCLUDED.release_date, label = EXCLUDED.label, markets = EXCLUDED.markets`
+	}
+	insertString := `
+		INSERT INTO albums(title, type, release_date, label, upc, markets) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		` + conflictString + `
+		RETURNING id
+	`
+	var id uuid.UUID
+	err = tx.QueryRow(ctx, insertString, album.Title, album.Type, album.ReleaseDate, album.Label, upc, album.Markets).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.DuplicateIdentifierError{Kind: "UPC", Value: upc}
+		}
+		return nil, err
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM artists_albums WHERE album_id = $1", id); err != nil {
+		return nil, err
+	}
+	if err = setArtistsOfAlbum(ctx, tx, id, album.ArtistID); err != nil {
+		return nil, err
+	}
+
+	created_album, err := getAlbum(ctx, tx, id, uuid.Nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return created_album, nil
+}
+
+// UpdateAlbum replaces the information and the artists of the album, its tracks are kept
+func (ar *PostgresAlbumRepository) UpdateAlbum(ctx context.Context, album model.Album) (*model.Album, error) {
+	if !validAlbumType(album.Type) {
+		return nil, custom_error.InvalidAlbumTypeError{}
+	}
+	upc, err := normalizeUPC(album.UPC)
+	if err != nil {
+		return nil, err
+	}
+	album.Markets, err = normalizeMarkets(album.Markets)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := ar.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if upc != "" {
+		var taken bool
+		err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM albums WHERE upc = $2 AND id <> $1)", album.ID, upc).Scan(&taken)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			return nil, custom_error.DuplicateIdentifierError{Kind: "UPC", Value: upc}
+		}
+	}
+
+	updateString := "UPDATE albums SET title = $2, type = $3, release_date = $4, label = $5, upc = NULLIF($6, ''), markets = $7 WHERE id = $1"
+	tag, err := tx.Exec(ctx, updateString, album.ID, album.Title, album.Type, album.ReleaseDate, album.Label, upc, album.Markets)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, custom_error.NonExistAlbumError{}
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM artists_albums WHERE album_id = $1", album.ID); err != nil {
+		return nil, err
+	}
+	if err = setArtistsOfAlbum(ctx, tx, album.ID, album.ArtistID); err != nil {
+		return nil, err
+	}
+
+	updated_album, err := getAlbum(ctx, tx, album.ID, uuid.Nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return updated_album, nil
+}
+
+// setArtistsOfAlbum credits the artists to the album in the given order
+func setArtistsOfAlbum(ctx context.Context, tx pgx.Tx, album_id uuid.UUID, artist_id_list []uuid.UUID) error {
+	if len(artist_id_list) == 0 {
+		return nil
+	}
+
+	checkString := `
+		SELECT (SELECT count(*) FROM artists WHERE id = ANY($1)) = (SELECT count(DISTINCT x) FROM unnest($1::uuid[]) x)
+	`
+	var all_exist bool
+	if err := tx.QueryRow(ctx, checkString, artist_id_list).Scan(&all_exist); err != nil {
+		return err
+	}
+	if !all_exist {
+		return custom_error.NonExistArtistError{}
+	}
+
+	insertString := `
+		INSERT INTO artists_albums(artist_id, album_id, position)
+		SELECT artist_id, $1, min(position) FROM unnest($2::uuid[]) WITH ORDINALITY AS x(artist_id, position)
+		GROUP BY artist_id
+	`
+	_, err := tx.Exec(ctx, insertString, album_id, artist_id_list)
+	return err
+}
+
+func (ar *PostgresAlbumRepository) DeleteAlbum(ctx context.Context, id uuid.UUID) error {
+	tag, err := ar.dbpool.Exec(ctx, "DELETE FROM albums WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return custom_error.NonExistAlbumError{}
+	}
+	return nil
+}
+
+// SetTracksOfAlbum replaces the tracklist of the album. A missing disc number means disc 1,
+// a missing track number continues the numbering of the disc
+func (ar *PostgresAlbumRepository) SetTracksOfAlbum(ctx context.Context, id uuid.UUID, tracks []model.AlbumTrack) (*model.Album, error) {
+	tracks, err := numberAlbumTracks(tracks)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := ar.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// lock the album so concurrent replacements don't interleave
+	var exist bool
+	err = tx.QueryRow(ctx, "SELECT true FROM albums WHERE id = $1 FOR UPDATE", id).Scan(&exist)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistAlbumError{}
+		}
+		return nil, err
+	}
+
+	track_id_list := make([]uuid.UUID, len(tracks))
+	disc_numbers := make([]int, len(tracks))
+	track_numbers := make([]int, len(tracks))
+	for i, track := range tracks {
+		track_id_list[i] = track.ID
+		disc_numbers[i] = track.DiscNumber
+		track_numbers[i] = track.TrackNumber
+	}
+
+	var count int
+	err = tx.QueryRow(ctx, "SELECT count(*) FROM tracks WHERE id = ANY($1)", track_id_list).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count != len(track_id_list) {
+		return nil, custom_error.NonExistTrackError{}
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM albums_tracks WHERE album_id = $1", id); err != nil {
+		return nil, err
+	}
+
+	insertString := `
+		INSERT INTO albums_tracks(album_id, track_id, disc_number, track_number)
+		SELECT $1, track_id, disc_number, track_number
+		FROM unnest($2::uuid[], $3::int[], $4::int[]) AS x(track_id, disc_number, track_number)
+	`
+	if _, err = tx.Exec(ctx, insertString, id, track_id_list, disc_numbers, track_numbers); err != nil {
+		return nil, err
+	}
+
+	album, err := getAlbum(ctx, tx, id, uuid.Nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return album, nil
+}
+
+// numberAlbumTracks fills in missing disc and track numbers and rejects duplicated tracks or places
+func numberAlbumTracks(tracks []model.AlbumTrack) ([]model.AlbumTrack, error) {
+	type place struct {
+		disc  int
+		track int
+	}
+
+	numbered := make([]model.AlbumTrack, len(tracks))
+	last_number := map[int]int{}
+	taken := map[place]bool{}
+	seen := map[uuid.UUID]bool{}
+	for i, track := range tracks {
+		if seen[track.ID] {
+			return nil, custom_error.InvalidTrackNumberError{Reason: fmt.Sprintf("track %s is listed twice", track.ID)}
+		}
+		seen[track.ID] = true
+
+		if track.DiscNumber == 0 {
+			track.DiscNumber = 1
+		}
+		if track.TrackNumber == 0 {
+			track.TrackNumber = last_number[track.DiscNumber] + 1
+		}
+		if track.DiscNumber < 0 || track.TrackNumber < 0 {
+			return nil, custom_error.InvalidTrackNumberError{Reason: "disc and track numbers must be positive"}
+		}
+
+		key := place{disc: track.DiscNumber, track: track.TrackNumber}
+		if taken[key] {
+			return nil, custom_error.InvalidTrackNumberError{Reason: fmt.Sprintf("disc %d has two tracks numbered %d", key.disc, key.track)}
+		}
+		taken[key] = true
+		last_number[track.DiscNumber] = max(last_number[track.DiscNumber], track.TrackNumber)
+		numbered[i] = track
+	}
+	return numbered, nil
+}
+
+// GetCoverOfAlbum returns the storage key of the uploaded cover, falling back to the artwork embedded
+// in the audio of its first track that has one, or an empty key when there is neither
+func (ar *PostgresAlbumRepository) GetCoverOfAlbum(ctx context.Context, id uuid.UUID) (string, error) {
+	fetchString := `
+		SELECT COALESCE(a.cover_key, (
+			SELECT ta.artwork_key FROM albums_tracks at
+			JOIN tracks_audio ta ON ta.track_id = at.track_id
+			WHERE at.album_id = a.id AND ta.artwork_key IS NOT NULL
+			ORDER BY at.disc_number, at.track_number
+			LIMIT 1
+		), '')
+		FROM albums a WHERE a.id = $1
+	`
+	var cover_key string
+	if err := ar.dbpool.QueryRow(ctx, fetchString, id).Scan(&cover_key); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", custom_error.NonExistAlbumError{}
+		}
+		return "", err
+	}
+	return cover_key, nil
+}
+
+// SetCoverOfAlbum records the storage key of the uploaded cover, an empty key removes the cover
+func (ar *PostgresAlbumRepository) SetCoverOfAlbum(ctx context.Context, id uuid.UUID, cover_key string) (*model.Album, error) {
+	tx, err := ar.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "UPDATE albums SET cover_key = NULLIF($2, '') WHERE id = $1", id, cover_key)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, custom_error.NonExistAlbumError{}
+	}
+
+	album, err := getAlbum(ctx, tx, id, uuid.Nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return album, nil
+}
+
+func validAlbumType(album_type model.AlbumType) bool {
+	switch album_type {
+	case model.AlbumTypeAlbum, model.AlbumTypeSingle, model.AlbumTypeEP, model.AlbumTypeCompilation:
+		return true
+	}
+	return false
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"flotify/internal/custom_error"
 	"flotify/internal/model"
 	"fmt"
 	"time"
@@ -15,12 +17,15 @@ type ArtistRepository interface {
 	GetArtistByID(ctx context.Context, id uuid.UUID) (*model.Artist, error)
 	GetArtistsWithFilter(ctx context.Context, filter Filter) ([]model.Artist, error)
 	CreateArtist(ctx context.Context, artist *model.Artist) (*model.Artist, error)
+	ImportArtist(ctx context.Context, artist *model.Artist) (*model.Artist, error)
 	CreateArtists(ctx context.Context, artists []*model.Artist) ([]*model.Artist, error)
 	UpdateArtist(ctx context.Context, artist *model.Artist) error
 	PartialUpdateArtist(ctx context.Context, artist *model.Artist) error
 	DeleteArtist(ctx context.Context, id uuid.UUID) error
 	DeleteArtists(ctx context.Context, id_list []uuid.UUID) error
-	GetTrackOfArtist(ctx context.Context, id uuid.UUID) ([]*model.Track, error)
+	GetTrackOfArtist(ctx context.Context, id uuid.UUID, viewer_id uuid.UUID, market string, roles []model.CreditRole) ([]*model.Track, error)
+	GetImagesOfArtist(ctx context.Context, id uuid.UUID) ([]model.Image, error)
+	SetImagesOfArtist(ctx context.Context, id uuid.UUID, kind model.ImageKind, images []model.Image) (*model.Artist, error)
 }
 
 type PostgresArtistRepository struct {
@@ -34,13 +39,16 @@ func NewPostgresArtistRepository(dbpool *pgxpool.Pool) *PostgresArtistRepository
 }
 
 func (ar *PostgresArtistRepository) GetArtistByID(ctx context.Context, id uuid.UUID) (*model.Artist, error) {
-	row := ar.dbpool.QueryRow(ctx, "select id, name, description from artists where id=$1", id)
+	row := ar.dbpool.QueryRow(ctx, "select id, name, description, mbid, user_id from artists where id=$1", id)
 
 	artist := model.Artist{}
 
 	uuid_byte := []byte{}
-	err := row.Scan(&uuid_byte, &artist.Name, &artist.Description)
+	err := row.Scan(&uuid_byte, &artist.Name, &artist.Description, &artist.MBID, &artist.UserID)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistArtistError{}
+		}
 		return nil, err
 	}
 
@@ -49,20 +57,59 @@ func (ar *PostgresArtistRepository) GetArtistByID(ctx context.Context, id uuid.U
 		return nil, err
 	}
 	artist.ID = id
+
+	artist.Genres, err = genresOf(ctx, ar.dbpool, model.TaxonomyArtist, id)
+	if err != nil {
+		return nil, err
+	}
+	artist.Tags, err = tagsOf(ctx, ar.dbpool, model.TaxonomyArtist, id)
+	if err != nil {
+		return nil, err
+	}
+	images, err := imagesOf(ctx, ar.dbpool, []uuid.UUID{id})
+	if err != nil {
+		return nil, err
+	}
+	artist.Images = images[id]
 	return &artist, nil
 }
 
+// artistSortColumns are the fields artists can be sorted by
+var artistSortColumns = map[string]string{
+	"name": "a.name",
+}
+
+// GetArtistsWithFilter understands the following props:
+// name (full text search), mbid (uuid.UUID), genre ([]string of slugs, descendants included) and tag ([]string, all required)
 func (ar *PostgresArtistRepository) GetArtistsWithFilter(ctx context.Context, filter Filter) ([]model.Artist, error) {
 
-	sort_criteria := filter.GetSortCriteria()
+	sort_criteria, err := filter.GetSortCriteriaOf(artistSortColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	qb := queryBuilder{}
+	if name, ok := filter.Props["name"].(string); ok && name != "" {
+		qb.Where("to_tsvector('simple', a.name) @@ plainto_tsquery('simple', %s)", name)
+	}
+	if mbid, ok := filter.Props["mbid"].(uuid.UUID); ok {
+		qb.Where("a.mbid = %s", mbid)
+	}
+	if genres, ok := filter.Props["genre"].([]string); ok && len(genres) > 0 {
+		whereGenre(&qb, model.TaxonomyArtist, "a.id", genres)
+	}
+	if tags, ok := filter.Props["tag"].([]string); ok && len(tags) > 0 {
+		whereTag(&qb, model.TaxonomyArtist, "a.id", tags)
+	}
+
 	fetchString := fmt.Sprintf(`
-        select id, name, description from artists
-        where (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
-        order by %s id ASC
-		limit $2 offset $3
-    `, sort_criteria)
+		select a.id, a.name, a.description, a.mbid, a.user_id from artists a
+		where %s
+		order by %s a.id ASC
+		limit %s offset %s
+	`, qb.Condition(), sort_criteria, qb.Arg(filter.Limit), qb.Arg(filter.GetOffSet()))
 
-	rows, err := ar.dbpool.Query(ctx, fetchString, filter.Props["name"], filter.Limit, filter.GetOffSet())
+	rows, err := ar.dbpool.Query(ctx, fetchString, qb.args...)
 	if err != nil {
 		return nil, err
 	}
@@ -72,10 +119,36 @@ func (ar *PostgresArtistRepository) GetArtistsWithFilter(ctx context.Context, fi
 		return nil, err
 	}
 
+	artist_id_list := make([]uuid.UUID, len(artists))
+	for i := range artists {
+		artist_id_list[i] = artists[i].ID
+	}
+	images, err := imagesOf(ctx, ar.dbpool, artist_id_list)
+	if err != nil {
+		return nil, err
+	}
+	for i := range artists {
+		artists[i].Images = images[artists[i].ID]
+	}
+
 	return artists, nil
 }
 
+// CreateArtist inserts an artist, DuplicateIdentifierError when its MBID belongs to another artist
 func (ar *PostgresArtistRepository) CreateArtist(ctx context.Context, artist *model.Artist) (*model.Artist, error) {
+	return ar.createArtist(ctx, artist, false)
+}
+
+// ImportArtist inserts an artist, or updates the artist with the same MBID so repeated imports don't duplicate it
+func (ar *PostgresArtistRepository) ImportArtist(ctx context.Context, artist *model.Artist) (*model.Artist, error) {
+	return ar.createArtist(ctx, artist, true)
+}
+
+func (ar *PostgresArtistRepository) createArtist(ctx context.Context, artist *model.Artist, upsert bool) (*model.Artist, error) {
+	if err := ar.checkUserOfArtist(ctx, artist); err != nil {
+		return nil, err
+	}
+
 	tx, err := ar.dbpool.Begin(ctx)
 	if err != nil {
 		return nil, err
@@ -85,15 +158,29 @@ func (ar *PostgresArtistRepository) CreateArtist(ctx context.Context, artist *mo
 	context, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	insertString := "INSERT INTO artists(name, description) VALUES ($1, $2) RETURNING id"
+	conflictString := "ON CONFLICT (mbid) DO NOTHING"
+	if upsert {
+		conflictString = `ON CONFLICT (mbid) DO UPDATE SET name = EXCLUDED.name, description = EXCLUDED.description,
+			user_id = COALESCE(EXCLUDED.user_id, artists.user_id)`
+	}
+	insertString := `
+		INSERT INTO artists(name, description, mbid, user_id) VALUES ($1, $2, $3, $4)
+		` + conflictString + `
+		RETURNING id
+	`
 	args := []any{
 		artist.Name,
 		artist.Description,
+		artist.MBID,
+		artist.UserID,
 	}
 	row := tx.QueryRow(context, insertString, args...)
 
 	uuid_byte := []byte{}
 	if err = row.Scan(&uuid_byte); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.DuplicateIdentifierError{Kind: "MBID", Value: artist.MBID.String()}
+		}
 		return nil, err
 	}
 
@@ -145,12 +232,28 @@ func (ar *PostgresArtistRepository) CreateArtists(ctx context.Context, artists [
 }
 
 func (ar *PostgresArtistRepository) UpdateArtist(ctx context.Context, artist *model.Artist) error {
+	if err := ar.checkUserOfArtist(ctx, artist); err != nil {
+		return err
+	}
+	if artist.MBID != nil {
+		var taken bool
+		err := ar.dbpool.QueryRow(ctx, "select exists (select 1 from artists where mbid = $2 and id <> $1)", artist.ID, artist.MBID).Scan(&taken)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return custom_error.DuplicateIdentifierError{Kind: "MBID", Value: artist.MBID.String()}
+		}
+	}
+
 	args := []any{
 		artist.ID,
 		artist.Name,
 		artist.Description,
+		artist.MBID,
+		artist.UserID,
 	}
-	_, err := ar.dbpool.Exec(ctx, "update artists set name = $2, description = $3 where id = $1", args...)
+	_, err := ar.dbpool.Exec(ctx, "update artists set name = $2, description = $3, mbid = $4, user_id = $5 where id = $1", args...)
 	if err != nil {
 		return err
 	}
@@ -158,6 +261,22 @@ func (ar *PostgresArtistRepository) UpdateArtist(ctx context.Context, artist *mo
 	return nil
 }
 
+// checkUserOfArtist makes sure the account given to manage the artist exists
+func (ar *PostgresArtistRepository) checkUserOfArtist(ctx context.Context, artist *model.Artist) error {
+	if artist.UserID == nil {
+		return nil
+	}
+
+	var exist bool
+	if err := ar.dbpool.QueryRow(ctx, "select exists (select 1 from users where id = $1)", artist.UserID).Scan(&exist); err != nil {
+		return err
+	}
+	if !exist {
+		return custom_error.NonExistUserError{}
+	}
+	return nil
+}
+
 func (ar *PostgresArtistRepository) PartialUpdateArtist(ctx context.Context, artist *model.Artist) error {
 	return nil
 }
@@ -206,9 +325,26 @@ func (ar *PostgresArtistRepository) DeleteArtists(ctx context.Context, id_list [
 	return nil
 }
 
-func (ar *PostgresArtistRepository) GetTrackOfArtist(ctx context.Context, id uuid.UUID) ([]*model.Track, error) {
-	fetchString := "select track_id from artists_tracks where artist_id = $1"
-	rows, err := ar.dbpool.Query(ctx, fetchString, id)
+// GetTrackOfArtist returns the tracks the artist is credited on with one of the roles, the primary ones when no role is given.
+// Tracks not released to the viewer yet or not licensed in the market are left out, so are explicit tracks when the viewer hides them
+func (ar *PostgresArtistRepository) GetTrackOfArtist(ctx context.Context, id uuid.UUID, viewer_id uuid.UUID, market string, roles []model.CreditRole) ([]*model.Track, error) {
+	role_list := []string{string(model.CreditPrimary)}
+	if len(roles) > 0 {
+		role_list = make([]string, len(roles))
+		for i, role := range roles {
+			if !validCreditRole(role) {
+				return nil, custom_error.InvalidCreditError{Reason: fmt.Sprintf("unknown role %q", role)}
+			}
+			role_list[i] = string(role)
+		}
+	}
+
+	fetchString := `
+		select distinct at.track_id from artists_tracks at
+		join tracks t on t.id = at.track_id
+		where at.artist_id = $1 and at.role = any($3) and t.removed_at is null and ` + fmt.Sprintf(explicitAllowed("t"), "$2") + `
+		and ` + fmt.Sprintf(trackReleasedTo("t"), "$2") + ` and ` + fmt.Sprintf(availableIn("t"), "$4")
+	rows, err := ar.dbpool.Query(ctx, fetchString, id, viewer_id, role_list, market)
 	if err != nil {
 		return nil, err
 	}
@@ -230,16 +366,20 @@ func (ar *PostgresArtistRepository) GetTrackOfArtist(ctx context.Context, id uui
 	tracks := []*model.Track{}
 
 	for _, id := range id_list {
-		row := ar.dbpool.QueryRow(ctx, "select name, length from tracks where id=$1", id)
+		row := ar.dbpool.QueryRow(ctx, "select name, length, explicit, release_date, markets from tracks where id=$1", id)
 
 		track := model.Track{}
 		track.ID = id
-		err := row.Scan(&track.Name, &track.Length)
+		err := row.Scan(&track.Name, &track.Length, &track.Explicit, &track.ReleaseDate, &track.Markets)
 		if err != nil {
 			return nil, err
 		}
 
-		fetchString := "select artist_id from artists_tracks where track_id = $1"
+		fetchString := `
+			select artist_id from artists_tracks
+			where track_id = $1 and role in ('primary', 'featured')
+			order by role = 'featured', position
+		`
 		rows, err := ar.dbpool.Query(ctx, fetchString, id)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"flotify/internal/custom_error"
+	"flotify/internal/model"
+	"fmt"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// creditOrder lists the roles in the order credits are shown
+var creditOrder = []model.CreditRole{
+	model.CreditPrimary,
+	model.CreditFeatured,
+	model.CreditComposer,
+	model.CreditLyricist,
+	model.CreditProducer,
+	model.CreditRemixer,
+}
+
+// validCreditRole reports whether role is one of the known credit roles
+func validCreditRole(role model.CreditRole) bool {
+	for _, known := range creditOrder {
+		if role == known {
+			return true
+		}
+	}
+	return false
+}
+
+// SetCreditsOfTrack replaces the credits of the track. Artists sharing a role are ordered as given,
+// a track needs at least one primary artist
+func (tr *PostgresTrackRepository) SetCreditsOfTrack(ctx context.Context, track_id uuid.UUID, credits []model.Credit) ([]model.Credit, error) {
+	positions := map[model.CreditRole]int{}
+	seen := map[model.Credit]bool{}
+	artist_id_list := make([]uuid.UUID, len(credits))
+	roles := make([]string, len(credits))
+	position_list := make([]int, len(credits))
+	for i, credit := range credits {
+		if !validCreditRole(credit.Role) {
+			return nil, custom_error.InvalidCreditError{Reason: fmt.Sprintf("unknown role %q", credit.Role)}
+		}
+		key := model.Credit{ArtistID: credit.ArtistID, Role: credit.Role}
+		if seen[key] {
+			return nil, custom_error.InvalidCreditError{Reason: fmt.Sprintf("artist %s is credited twice as %s", credit.ArtistID, credit.Role)}
+		}
+		seen[key] = true
+
+		artist_id_list[i] = credit.ArtistID
+		roles[i] = string(credit.Role)
+		position_list[i] = positions[credit.Role]
+		positions[credit.Role]++
+	}
+	if positions[model.CreditPrimary] == 0 {
+		return nil, custom_error.InvalidCreditError{Reason: "a track needs a primary artist"}
+	}
+
+	tx, err := tr.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// lock the track so concurrent replacements don't interleave
+	var exist bool
+	err = tx.QueryRow(ctx, "SELECT true FROM tracks WHERE id = $1 FOR UPDATE", track_id).Scan(&exist)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistTrackError{}
+		}
+		return nil, err
+	}
+
+	var missing bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM unnest($1::uuid[]) AS x(artist_id)
+			WHERE NOT EXISTS (SELECT 1 FROM artists a WHERE a.id = x.artist_id)
+		)
+	`, artist_id_list).Scan(&missing)
+	if err != nil {
+		return nil, err
+	}
+	if missing {
+		return nil, custom_error.NonExistArtistError{}
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM artists_tracks WHERE track_id = $1", track_id); err != nil {
+		return nil, err
+	}
+	insertString := `
+		INSERT INTO artists_tracks(track_id, artist_id, role, position)
+		SELECT $1, artist_id, role, position
+		FROM unnest($2::uuid[], $3::text[], $4::int[]) AS x(artist_id, role, position)
+	`
+	if _, err = tx.Exec(ctx, insertString, track_id, artist_id_list, roles, position_list); err != nil {
+		return nil, err
+	}
+
+	result, err := creditsOf(ctx, tx, track_id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// creditsOf returns the credits of the track grouped by role in creditOrder
+func creditsOf(ctx context.Context, q querier, track_id uuid.UUID) ([]model.Credit, error) {
+	fetchString := `
+		SELECT at.artist_id, a.name, at.role, at.position FROM artists_tracks at
+		JOIN artists a ON a.id = at.artist_id
+		WHERE at.track_id = $1
+		ORDER BY array_position($2::text[], at.role), at.position
+	`
+	order := make([]string, len(creditOrder))
+	for i, role := range creditOrder {
+		order[i] = string(role)
+	}
+	rows, err := q.Query(ctx, fetchString, track_id, order)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[model.Credit])
+}
+
+// artistLine renders the performers of a track like "A, B feat. C"
+func artistLine(credits []model.Credit) string {
+	primary := []string{}
+	featured := []string{}
+	for _, credit := range credits {
+		switch credit.Role {
+		case model.CreditPrimary:
+			primary = append(primary, credit.Name)
+		case model.CreditFeatured:
+			featured = append(featured, credit.Name)
+		}
+	}
+
+	line := strings.Join(primary, ", ")
+	if len(featured) > 0 {
+		line += " feat. " + strings.Join(featured, ", ")
+	}
+	return line
+}
@@ -1,8 +1,11 @@
 package repository
 
 import (
+	"flotify/internal/custom_error"
 	"fmt"
 	"strings"
+
+	"github.com/gofrs/uuid/v5"
 )
 
 type Filter struct {
@@ -10,6 +13,10 @@ type Filter struct {
 	Page   int
 	Limit  int
 	SortBy []string
+	// ViewerID is the user the listing is for, uuid.Nil for anonymous callers
+	ViewerID uuid.UUID
+	// Market keeps the items licensed in this country, every item is listed when empty
+	Market string
 }
 
 func (f Filter) GetOffSet() int {
@@ -28,3 +35,50 @@ func (f Filter) GetSortCriteria() string {
 	}
 	return sort_criteria
 }
+
+// GetSortCriteriaOf works like GetSortCriteria but only accepts the given fields,
+// each field is replaced by the sql expression it maps to
+func (f Filter) GetSortCriteriaOf(columns map[string]string) (string, error) {
+	sort_criteria := ""
+	for _, criteria := range f.SortBy {
+		field := strings.TrimPrefix(criteria, "-")
+		column, ok := columns[field]
+		if !ok {
+			return "", custom_error.InvalidSortCriteriaError{Field: field}
+		}
+		dir := "ASC"
+		if strings.HasPrefix(criteria, "-") {
+			dir = "DESC"
+		}
+		sort_criteria = fmt.Sprintf("%s %s %s,", sort_criteria, column, dir)
+	}
+	return sort_criteria, nil
+}
+
+// queryBuilder collects the conditions of a where clause together with their positional arguments
+type queryBuilder struct {
+	conditions []string
+	args       []any
+}
+
+// Arg registers a value and returns its placeholder
+func (qb *queryBuilder) Arg(value any) string {
+	qb.args = append(qb.args, value)
+	return fmt.Sprintf("$%d", len(qb.args))
+}
+
+// Where adds a condition, every %s in format is replaced by the placeholder of the matching value
+func (qb *queryBuilder) Where(format string, values ...any) {
+	placeholders := make([]any, 0, len(values))
+	for _, value := range values {
+		placeholders = append(placeholders, qb.Arg(value))
+	}
+	qb.conditions = append(qb.conditions, fmt.Sprintf(format, placeholders...))
+}
+
+func (qb *queryBuilder) Condition() string {
+	if len(qb.conditions) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(qb.conditions, " AND ")
+}
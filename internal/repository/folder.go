@@ -0,0 +1,409 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flotify/internal/custom_error"
+	"flotify/internal/model"
+	"slices"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type FolderRepository interface {
+	GetLibrary(ctx context.Context, user_id uuid.UUID) ([]model.LibraryNode, error)
+	CreateFolder(ctx context.Context, folder model.Folder, position int) (*model.Folder, error)
+	RenameFolder(ctx context.Context, user_id uuid.UUID, folder_id uuid.UUID, name string) (*model.Folder, error)
+	DeleteFolder(ctx context.Context, user_id uuid.UUID, folder_id uuid.UUID) error
+	MoveLibraryItems(ctx context.Context, user_id uuid.UUID, items []model.LibraryItem, parent_id *uuid.UUID, position int) ([]model.LibraryNode, error)
+	GetSavedItems(ctx context.Context, user_id uuid.UUID, market string, types []model.LibraryItemType) ([]model.SavedItem, error)
+	GetPresavedItems(ctx context.Context, user_id uuid.UUID) ([]model.SavedItem, error)
+	SaveItem(ctx context.Context, user_id uuid.UUID, item model.LibraryItem) (*model.SavedItem, error)
+	UnsaveItem(ctx context.Context, user_id uuid.UUID, item model.LibraryItem) error
+}
+
+type PostgresFolderRepository struct {
+	dbpool *pgxpool.Pool
+	// playlist_repository reads the playlists placed in the library
+	playlist_repository *PostgresPlaylistRepository
+}
+
+func NewPostgresFolderRepository(dbpool *pgxpool.Pool) *PostgresFolderRepository {
+	return &PostgresFolderRepository{
+		dbpool:              dbpool,
+		playlist_repository: NewPostgresPlaylistRepository(dbpool),
+	}
+}
+
+// GetLibrary returns the folders and playlists of the user as a tree, every level in order.
+// Playlists the user never placed come last at the root, ordered by name
+func (fr *PostgresFolderRepository) GetLibrary(ctx context.Context, user_id uuid.UUID) ([]model.LibraryNode, error) {
+	rows, err := fr.dbpool.Query(ctx, "SELECT id, user_id, name, parent_id, position FROM folders WHERE user_id = $1", user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type placedNode struct {
+		node     model.LibraryNode
+		parent   uuid.UUID
+		position int
+		unplaced bool
+		name     string
+		id       uuid.UUID
+	}
+
+	nodes := []placedNode{}
+	for rows.Next() {
+		folder := model.Folder{}
+		var position int
+		if err = rows.Scan(&folder.ID, &folder.UserID, &folder.Name, &folder.ParentID, &position); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, placedNode{
+			node:     model.LibraryNode{Type: model.LibraryFolder, Folder: &folder},
+			parent:   parentKey(folder.ParentID),
+			position: position,
+			name:     folder.Name,
+			id:       folder.ID,
+		})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	type placement struct {
+		folder_id *uuid.UUID
+		position  int
+	}
+	placements := map[uuid.UUID]placement{}
+	rows, err = fr.dbpool.Query(ctx, "SELECT playlist_id, folder_id, position FROM library_playlists WHERE user_id = $1", user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var playlist_id uuid.UUID
+		p := placement{}
+		if err = rows.Scan(&playlist_id, &p.folder_id, &p.position); err != nil {
+			return nil, err
+		}
+		placements[playlist_id] = p
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	playlists, err := fr.playlist_repository.queryPlaylists(ctx, inLibraryOf("$1"), user_id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range playlists {
+		playlist := &playlists[i]
+		p, placed := placements[playlist.ID]
+		nodes = append(nodes, placedNode{
+			node:     model.LibraryNode{Type: model.LibraryPlaylist, Playlist: playlist},
+			parent:   parentKey(p.folder_id),
+			position: p.position,
+			unplaced: !placed,
+			name:     playlist.Name,
+			id:       playlist.ID,
+		})
+	}
+
+	slices.SortStableFunc(nodes, func(a, b placedNode) int {
+		if a.unplaced != b.unplaced {
+			if a.unplaced {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Or(cmp.Compare(a.position, b.position), cmp.Compare(a.name, b.name), cmp.Compare(a.id.String(), b.id.String()))
+	})
+
+	children := map[uuid.UUID][]model.LibraryNode{}
+	for _, n := range nodes {
+		children[n.parent] = append(children[n.parent], n.node)
+	}
+
+	var build func(parent uuid.UUID) []model.LibraryNode
+	build = func(parent uuid.UUID) []model.LibraryNode {
+		level := children[parent]
+		if level == nil {
+			return []model.LibraryNode{}
+		}
+		for i := range level {
+			if level[i].Type == model.LibraryFolder {
+				level[i].Children = build(level[i].Folder.ID)
+			}
+		}
+		return level
+	}
+	return build(uuid.Nil), nil
+}
+
+// CreateFolder creates a folder inside folder.ParentID, or at the root of the library when it's nil,
+// before the item at position. A negative position appends the folder
+func (fr *PostgresFolderRepository) CreateFolder(ctx context.Context, folder model.Folder, position int) (*model.Folder, error) {
+	tx, err := fr.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = lockLibrary(ctx, tx, folder.UserID); err != nil {
+		return nil, err
+	}
+
+	insertString := "INSERT INTO folders(user_id, name) VALUES ($1, $2) RETURNING id"
+	if err = tx.QueryRow(ctx, insertString, folder.UserID, folder.Name).Scan(&folder.ID); err != nil {
+		return nil, err
+	}
+
+	item := model.LibraryItem{Type: model.LibraryFolder, ID: folder.ID}
+	if err = moveItems(ctx, tx, folder.UserID, []model.LibraryItem{item}, folder.ParentID, position); err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &folder, nil
+}
+
+func (fr *PostgresFolderRepository) RenameFolder(ctx context.Context, user_id uuid.UUID, folder_id uuid.UUID, name string) (*model.Folder, error) {
+	updateString := "UPDATE folders SET name = $3 WHERE id = $1 AND user_id = $2 RETURNING id, user_id, name, parent_id"
+
+	folder := model.Folder{}
+	err := fr.dbpool.QueryRow(ctx, updateString, folder_id, user_id, name).Scan(&folder.ID, &folder.UserID, &folder.Name, &folder.ParentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistFolderError{}
+		}
+		return nil, err
+	}
+
+	return &folder, nil
+}
+
+// DeleteFolder removes the folder, its folders and playlists take its place in the parent folder
+func (fr *PostgresFolderRepository) DeleteFolder(ctx context.Context, user_id uuid.UUID, folder_id uuid.UUID) error {
+	tx, err := fr.dbpool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = lockLibrary(ctx, tx, user_id); err != nil {
+		return err
+	}
+
+	parents, err := loadFolderParents(ctx, tx, user_id)
+	if err != nil {
+		return err
+	}
+	parent_id, ok := parents[folder_id]
+	if !ok {
+		return custom_error.NonExistFolderError{}
+	}
+
+	children, err := loadChildren(ctx, tx, user_id, &folder_id)
+	if err != nil {
+		return err
+	}
+	siblings, err := loadChildren(ctx, tx, user_id, parent_id)
+	if err != nil {
+		return err
+	}
+	position := slices.Index(siblings, model.LibraryItem{Type: model.LibraryFolder, ID: folder_id})
+
+	if err = moveItems(ctx, tx, user_id, children, parent_id, position); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM folders WHERE id = $1", folder_id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// MoveLibraryItems moves the items into the folder parent_id (the root when nil) before the item at position,
+// keeping their relative order. A negative position appends them. Either every item is moved or none is
+func (fr *PostgresFolderRepository) MoveLibraryItems(ctx context.Context, user_id uuid.UUID, items []model.LibraryItem, parent_id *uuid.UUID, position int) ([]model.LibraryNode, error) {
+	tx, err := fr.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = lockLibrary(ctx, tx, user_id); err != nil {
+		return nil, err
+	}
+
+	if err = moveItems(ctx, tx, user_id, items, parent_id, position); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return fr.GetLibrary(ctx, user_id)
+}
+
+// lockLibrary serializes changes to the library of a user until the transaction ends
+func lockLibrary(ctx context.Context, tx pgx.Tx, user_id uuid.UUID) error {
+	_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtextextended($1::text, 0))", user_id)
+	return err
+}
+
+// loadFolderParents maps every folder of the user to its parent
+func loadFolderParents(ctx context.Context, tx pgx.Tx, user_id uuid.UUID) (map[uuid.UUID]*uuid.UUID, error) {
+	rows, err := tx.Query(ctx, "SELECT id, parent_id FROM folders WHERE user_id = $1", user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parents := map[uuid.UUID]*uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		var parent_id *uuid.UUID
+		if err = rows.Scan(&id, &parent_id); err != nil {
+			return nil, err
+		}
+		parents[id] = parent_id
+	}
+	return parents, rows.Err()
+}
+
+// loadChildren returns the content of a folder in order, at the root this includes the playlists never placed
+func loadChildren(ctx context.Context, tx pgx.Tx, user_id uuid.UUID, parent_id *uuid.UUID) ([]model.LibraryItem, error) {
+	queryString := `
+		SELECT kind, id FROM (
+			SELECT 'folder' AS kind, f.id, f.position, 0 AS unplaced, f.name
+			FROM folders f
+			WHERE f.user_id = $1 AND f.parent_id IS NOT DISTINCT FROM $2
+			UNION ALL
+			SELECT 'playlist', p.id, lp.position, 0, p.name
+			FROM library_playlists lp
+			JOIN playlists p ON p.id = lp.playlist_id
+			WHERE lp.user_id = $1 AND lp.folder_id IS NOT DISTINCT FROM $2 AND ` + inLibraryOf("$1") + `
+			UNION ALL
+			SELECT 'playlist', p.id, 0, 1, p.name
+			FROM playlists p
+			WHERE $2::uuid IS NULL AND ` + inLibraryOf("$1") + `
+				AND NOT EXISTS (SELECT 1 FROM library_playlists lp WHERE lp.user_id = $1 AND lp.playlist_id = p.id)
+		) AS children
+		ORDER BY unplaced, position, name, id
+	`
+	rows, err := tx.Query(ctx, queryString, user_id, parent_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[model.LibraryItem])
+}
+
+func moveItems(ctx context.Context, tx pgx.Tx, user_id uuid.UUID, items []model.LibraryItem, parent_id *uuid.UUID, position int) error {
+	parents, err := loadFolderParents(ctx, tx, user_id)
+	if err != nil {
+		return err
+	}
+	if parent_id != nil {
+		if _, ok := parents[*parent_id]; !ok {
+			return custom_error.NonExistFolderError{}
+		}
+	}
+
+	moving := map[model.LibraryItem]bool{}
+	moved := []model.LibraryItem{}
+	for _, item := range items {
+		switch item.Type {
+		case model.LibraryFolder:
+			if _, ok := parents[item.ID]; !ok {
+				return custom_error.NonExistFolderError{}
+			}
+			for ancestor := parent_id; ancestor != nil; ancestor = parents[*ancestor] {
+				if *ancestor == item.ID {
+					return custom_error.InvalidFolderMoveError{}
+				}
+			}
+		case model.LibraryPlaylist:
+			var exist bool
+			queryString := "SELECT EXISTS(SELECT 1 FROM playlists p WHERE p.id = $2 AND " + inLibraryOf("$1") + ")"
+			if err = tx.QueryRow(ctx, queryString, user_id, item.ID).Scan(&exist); err != nil {
+				return err
+			}
+			if !exist {
+				return custom_error.NonExistPlaylistError{}
+			}
+		default:
+			return custom_error.InvalidLibraryItemError{}
+		}
+
+		if !moving[item] {
+			moving[item] = true
+			moved = append(moved, item)
+		}
+	}
+
+	children, err := loadChildren(ctx, tx, user_id, parent_id)
+	if err != nil {
+		return err
+	}
+
+	rest := make([]model.LibraryItem, 0, len(children))
+	for _, child := range children {
+		if !moving[child] {
+			rest = append(rest, child)
+		}
+	}
+
+	if position < 0 {
+		position = len(rest)
+	}
+	if position > len(rest) {
+		return custom_error.InvalidPositionError{}
+	}
+
+	result := make([]model.LibraryItem, 0, len(rest)+len(moved))
+	result = append(result, rest[:position]...)
+	result = append(result, moved...)
+	result = append(result, rest[position:]...)
+
+	return storeChildren(ctx, tx, user_id, parent_id, result)
+}
+
+// storeChildren rewrites the positions of the content of a folder
+func storeChildren(ctx context.Context, tx pgx.Tx, user_id uuid.UUID, parent_id *uuid.UUID, children []model.LibraryItem) error {
+	batch := &pgx.Batch{}
+	for position, child := range children {
+		switch child.Type {
+		case model.LibraryFolder:
+			batch.Queue("UPDATE folders SET parent_id = $3, position = $4 WHERE id = $2 AND user_id = $1", user_id, child.ID, parent_id, position)
+		case model.LibraryPlaylist:
+			insertString := `
+				INSERT INTO library_playlists(user_id, playlist_id, folder_id, position) VALUES ($1, $2, $3, $4)
+				ON CONFLICT (user_id, playlist_id) DO UPDATE SET folder_id = EXCLUDED.folder_id, position = EXCLUDED.position
+			`
+			batch.Queue(insertString, user_id, child.ID, parent_id, position)
+		}
+	}
+
+	return tx.SendBatch(ctx, batch).Close()
+}
+
+// parentKey identifies the root of the library by uuid.Nil
+func parentKey(parent_id *uuid.UUID) uuid.UUID {
+	if parent_id == nil {
+		return uuid.Nil
+	}
+	return *parent_id
+}
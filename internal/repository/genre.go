@@ -0,0 +1,417 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"flotify/internal/custom_error"
+	"flotify/internal/model"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type GenreRepository interface {
+	GetGenres(ctx context.Context, parent_slug string) ([]model.GenreCount, error)
+	GetGenreBySlug(ctx context.Context, slug string) (*model.GenreCount, error)
+	CreateGenre(ctx context.Context, genre model.Genre) (*model.Genre, error)
+	DeleteGenre(ctx context.Context, id uuid.UUID) error
+	SetGenresOf(ctx context.Context, target model.TaxonomyTarget, id uuid.UUID, slugs []string) ([]model.Genre, error)
+	SetTagsOf(ctx context.Context, target model.TaxonomyTarget, id uuid.UUID, tags []string) ([]string, error)
+	GetTags(ctx context.Context, prefix string, limit int) ([]model.TagCount, error)
+}
+
+type PostgresGenreRepository struct {
+	dbpool *pgxpool.Pool
+}
+
+func NewPostgresGenreRepository(dbpool *pgxpool.Pool) *PostgresGenreRepository {
+	return &PostgresGenreRepository{
+		dbpool: dbpool,
+	}
+}
+
+// taxonomyTable names the tables attaching genres and tags to one kind of catalog item
+type taxonomyTable struct {
+	items  string
+	genres string
+	tags   string
+	column string
+	// missing is returned when the item doesn't exist
+	missing error
+}
+
+var taxonomyTables = map[model.TaxonomyTarget]taxonomyTable{
+	model.TaxonomyTrack:  {items: "tracks", genres: "tracks_genres", tags: "tracks_tags", column: "track_id", missing: custom_error.NonExistTrackError{}},
+	model.TaxonomyAlbum:  {items: "albums", genres: "albums_genres", tags: "albums_tags", column: "album_id", missing: custom_error.NonExistAlbumError{}},
+	model.TaxonomyArtist: {items: "artists", genres: "artists_genres", tags: "artists_tags", column: "artist_id", missing: custom_error.NonExistArtistError{}},
+}
+
+// querier is satisfied by both the pool and transactions
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// genreCountSelect reads genres with the number of items attached to them or to their descendants,
+// both placeholders take the same condition selecting the genres
+const genreCountSelect = `
+	WITH RECURSIVE tree AS (
+		SELECT g.id AS root_id, g.id FROM genres g WHERE %[1]s
+		UNION ALL
+		SELECT tree.root_id, c.id FROM genres c JOIN tree ON c.parent_id = tree.id
+	)
+	SELECT g.id, g.name, g.slug, g.parent_id,
+		(SELECT count(*) FROM genres c WHERE c.parent_id = g.id),
+		(SELECT count(DISTINCT x.track_id) FROM tracks_genres x JOIN tree ON tree.id = x.genre_id WHERE tree.root_id = g.id),
+		(SELECT count(DISTINCT x.album_id) FROM albums_genres x JOIN tree ON tree.id = x.genre_id WHERE tree.root_id = g.id),
+		(SELECT count(DISTINCT x.artist_id) FROM artists_genres x JOIN tree ON tree.id = x.genre_id WHERE tree.root_id = g.id)
+	FROM genres g
+	WHERE %[1]s
+	ORDER BY g.name ASC, g.id ASC
+`
+
+func collectGenreCounts(rows pgx.Rows) ([]model.GenreCount, error) {
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.GenreCount, error) {
+		genre := model.GenreCount{}
+		err := row.Scan(&genre.ID, &genre.Name, &genre.Slug, &genre.ParentID, &genre.ChildCount, &genre.TrackCount, &genre.AlbumCount, &genre.ArtistCount)
+		return genre, err
+	})
+}
+
+// GetGenres lists the children of the genre, the top level genres when parent_slug is empty
+func (gr *PostgresGenreRepository) GetGenres(ctx context.Context, parent_slug string) ([]model.GenreCount, error) {
+	if parent_slug == "" {
+		rows, err := gr.dbpool.Query(ctx, fmt.Sprintf(genreCountSelect, "g.parent_id IS NULL"))
+		if err != nil {
+			return nil, err
+		}
+		return collectGenreCounts(rows)
+	}
+
+	var parent_id uuid.UUID
+	err := gr.dbpool.QueryRow(ctx, "SELECT id FROM genres WHERE slug = $1", parent_slug).Scan(&parent_id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistGenreError{Slug: parent_slug}
+		}
+		return nil, err
+	}
+
+	rows, err := gr.dbpool.Query(ctx, fmt.Sprintf(genreCountSelect, "g.parent_id = $1"), parent_id)
+	if err != nil {
+		return nil, err
+	}
+	return collectGenreCounts(rows)
+}
+
+func (gr *PostgresGenreRepository) GetGenreBySlug(ctx context.Context, slug string) (*model.GenreCount, error) {
+	rows, err := gr.dbpool.Query(ctx, fmt.Sprintf(genreCountSelect, "g.slug = $1"), slug)
+	if err != nil {
+		return nil, err
+	}
+
+	genres, err := collectGenreCounts(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(genres) == 0 {
+		return nil, custom_error.NonExistGenreError{Slug: slug}
+	}
+	return &genres[0], nil
+}
+
+// CreateGenre adds a genre under ParentID, or at the top level. The slug is derived from the name unless given
+func (gr *PostgresGenreRepository) CreateGenre(ctx context.Context, genre model.Genre) (*model.Genre, error) {
+	genre.Name = strings.TrimSpace(genre.Name)
+	if genre.Name == "" {
+		return nil, custom_error.InvalidGenreError{Reason: "name is empty"}
+	}
+	if genre.Slug == "" {
+		genre.Slug = genre.Name
+	}
+	genre.Slug = slugify(genre.Slug)
+	if genre.Slug == "" {
+		return nil, custom_error.InvalidGenreError{Reason: "slug has no letters or digits"}
+	}
+
+	tx, err := gr.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if genre.ParentID != nil {
+		var exist bool
+		err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM genres WHERE id = $1)", genre.ParentID).Scan(&exist)
+		if err != nil {
+			return nil, err
+		}
+		if !exist {
+			return nil, custom_error.NonExistGenreError{}
+		}
+	}
+
+	insertString := `
+		INSERT INTO genres(name, slug, parent_id) VALUES ($1, $2, $3)
+		ON CONFLICT (slug) DO NOTHING
+		RETURNING id
+	`
+	err = tx.QueryRow(ctx, insertString, genre.Name, genre.Slug, genre.ParentID).Scan(&genre.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.DuplicateGenreError{Slug: genre.Slug}
+		}
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &genre, nil
+}
+
+// DeleteGenre removes a genre, its children take its place under its parent
+func (gr *PostgresGenreRepository) DeleteGenre(ctx context.Context, id uuid.UUID) error {
+	tx, err := gr.dbpool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var parent_id *uuid.UUID
+	err = tx.QueryRow(ctx, "SELECT parent_id FROM genres WHERE id = $1 FOR UPDATE", id).Scan(&parent_id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return custom_error.NonExistGenreError{}
+		}
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE genres SET parent_id = $2 WHERE parent_id = $1", id, parent_id); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, "DELETE FROM genres WHERE id = $1", id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// SetGenresOf replaces the genres of a track, album or artist
+func (gr *PostgresGenreRepository) SetGenresOf(ctx context.Context, target model.TaxonomyTarget, id uuid.UUID, slugs []string) ([]model.Genre, error) {
+	table, ok := taxonomyTables[target]
+	if !ok {
+		return nil, fmt.Errorf("unknown taxonomy target %q", target)
+	}
+
+	tx, err := gr.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = lockTaxonomyItem(ctx, tx, table, id); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, "SELECT slug FROM genres WHERE slug = ANY($1)", slugs)
+	if err != nil {
+		return nil, err
+	}
+	exist_slugs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	for _, slug := range slugs {
+		if !slices.Contains(exist_slugs, slug) {
+			return nil, custom_error.NonExistGenreError{Slug: slug}
+		}
+	}
+
+	if _, err = tx.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s = $1", table.genres, table.column), id); err != nil {
+		return nil, err
+	}
+	insertString := fmt.Sprintf("INSERT INTO %s(%s, genre_id) SELECT $1, id FROM genres WHERE slug = ANY($2)", table.genres, table.column)
+	if _, err = tx.Exec(ctx, insertString, id, slugs); err != nil {
+		return nil, err
+	}
+
+	genres, err := genresOf(ctx, tx, target, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return genres, nil
+}
+
+// SetTagsOf replaces the tags of a track, album or artist. Tags are trimmed and lower cased
+func (gr *PostgresGenreRepository) SetTagsOf(ctx context.Context, target model.TaxonomyTarget, id uuid.UUID, tags []string) ([]string, error) {
+	table, ok := taxonomyTables[target]
+	if !ok {
+		return nil, fmt.Errorf("unknown taxonomy target %q", target)
+	}
+
+	normalized_tags := normalizeTags(tags)
+
+	tx, err := gr.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = lockTaxonomyItem(ctx, tx, table, id); err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s = $1", table.tags, table.column), id); err != nil {
+		return nil, err
+	}
+	insertString := fmt.Sprintf("INSERT INTO %s(%s, tag) SELECT $1, unnest($2::text[])", table.tags, table.column)
+	if _, err = tx.Exec(ctx, insertString, id, normalized_tags); err != nil {
+		return nil, err
+	}
+
+	stored_tags, err := tagsOf(ctx, tx, target, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return stored_tags, nil
+}
+
+// GetTags lists the most used tags starting with prefix
+func (gr *PostgresGenreRepository) GetTags(ctx context.Context, prefix string, limit int) ([]model.TagCount, error) {
+	fetchString := `
+		SELECT tag, count(*) FROM (
+			SELECT tag FROM tracks_tags
+			UNION ALL SELECT tag FROM albums_tags
+			UNION ALL SELECT tag FROM artists_tags
+		) t
+		WHERE starts_with(tag, $1)
+		GROUP BY tag
+		ORDER BY count(*) DESC, tag ASC
+		LIMIT $2
+	`
+	rows, err := gr.dbpool.Query(ctx, fetchString, strings.ToLower(strings.TrimSpace(prefix)), limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[model.TagCount])
+}
+
+// lockTaxonomyItem locks the item so concurrent replacements of its genres or tags don't interleave
+func lockTaxonomyItem(ctx context.Context, tx pgx.Tx, table taxonomyTable, id uuid.UUID) error {
+	var exist bool
+	err := tx.QueryRow(ctx, fmt.Sprintf("SELECT true FROM %s WHERE id = $1 FOR UPDATE", table.items), id).Scan(&exist)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return table.missing
+		}
+		return err
+	}
+	return nil
+}
+
+// genresOf returns the genres attached to the item, ordered by name
+func genresOf(ctx context.Context, q querier, target model.TaxonomyTarget, id uuid.UUID) ([]model.Genre, error) {
+	table := taxonomyTables[target]
+	fetchString := fmt.Sprintf(`
+		SELECT g.id, g.name, g.slug, g.parent_id FROM %s x
+		JOIN genres g ON g.id = x.genre_id
+		WHERE x.%s = $1
+		ORDER BY g.name ASC
+	`, table.genres, table.column)
+	rows, err := q.Query(ctx, fetchString, id)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[model.Genre])
+}
+
+// tagsOf returns the tags of the item in alphabetical order
+func tagsOf(ctx context.Context, q querier, target model.TaxonomyTarget, id uuid.UUID) ([]string, error) {
+	table := taxonomyTables[target]
+	fetchString := fmt.Sprintf("SELECT tag FROM %s WHERE %s = $1 ORDER BY tag ASC", table.tags, table.column)
+	rows, err := q.Query(ctx, fetchString, id)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// whereGenre adds the condition that the item, whose id is the column item_id of the query,
+// has one of the genres or one of their descendants
+func whereGenre(qb *queryBuilder, target model.TaxonomyTarget, item_id string, slugs []string) {
+	table := taxonomyTables[target]
+	qb.Where(fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM %s x WHERE x.%s = %s AND x.genre_id IN (
+			WITH RECURSIVE tree AS (
+				SELECT id FROM genres WHERE slug = ANY(%%s)
+				UNION
+				SELECT c.id FROM genres c JOIN tree ON c.parent_id = tree.id
+			)
+			SELECT id FROM tree
+		)
+	)`, table.genres, table.column, item_id), slugs)
+}
+
+// whereTag adds the condition that the item, whose id is the column item_id of the query, has all the tags
+func whereTag(qb *queryBuilder, target model.TaxonomyTarget, item_id string, tags []string) {
+	table := taxonomyTables[target]
+	normalized_tags := normalizeTags(tags)
+	qb.Where(fmt.Sprintf(
+		"(SELECT count(*) FROM %s x WHERE x.%s = %s AND x.tag = ANY(%%s)) = %d",
+		table.tags, table.column, item_id, len(normalized_tags),
+	), normalized_tags)
+}
+
+// normalizeTags trims and lower cases tags, dropping empty and repeated ones
+func normalizeTags(tags []string) []string {
+	normalized_tags := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag != "" && !slices.Contains(normalized_tags, tag) {
+			normalized_tags = append(normalized_tags, tag)
+		}
+	}
+	return normalized_tags
+}
+
+// slugify keeps lower cased letters and digits, every other run of characters becomes a single dash
+func slugify(name string) string {
+	var builder strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && builder.Len() > 0 {
+				builder.WriteByte('-')
+			}
+			builder.WriteRune(r)
+			dash = false
+			continue
+		}
+		if r == '&' {
+			// keeps "R&B" and "Drum & Bass" readable
+			if builder.Len() > 0 {
+				builder.WriteString("-and")
+			}
+			dash = true
+			continue
+		}
+		dash = true
+	}
+	return builder.String()
+}
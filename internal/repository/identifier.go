@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"flotify/internal/custom_error"
+	"strings"
+)
+
+// normalizeISRC uppercases an ISRC and drops the hyphens of its display form (US-RC1-76-07839).
+// An ISRC is a country code, a 3 character registrant code, 2 digits of year and a 5 digit designation
+func normalizeISRC(isrc string) (string, error) {
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(isrc), "-", ""))
+	if normalized == "" {
+		return "", nil
+	}
+
+	invalid := custom_error.InvalidIdentifierError{Kind: "ISRC", Value: isrc}
+	if len(normalized) != 12 {
+		return "", invalid
+	}
+	for i, r := range normalized {
+		switch {
+		case i < 2 && (r < 'A' || r > 'Z'):
+			return "", invalid
+		case i >= 2 && i < 5 && !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'):
+			return "", invalid
+		case i >= 5 && (r < '0' || r > '9'):
+			return "", invalid
+		}
+	}
+	return normalized, nil
+}
+
+// normalizeUPC checks the check digit of a 12 digit UPC-A or 13 digit EAN-13.
+// An EAN-13 starting with 0 is the same code as the UPC-A without it and is stored as such
+func normalizeUPC(upc string) (string, error) {
+	normalized := strings.ReplaceAll(strings.ReplaceAll(strings.TrimSpace(upc), "-", ""), " ", "")
+	if normalized == "" {
+		return "", nil
+	}
+
+	invalid := custom_error.InvalidIdentifierError{Kind: "UPC", Value: upc}
+	if len(normalized) != 12 && len(normalized) != 13 {
+		return "", invalid
+	}
+
+	// weights alternate 3 and 1 starting from the digit left of the check digit
+	sum := 0
+	for i := len(normalized) - 2; i >= 0; i-- {
+		digit := int(normalized[i] - '0')
+		if digit > 9 {
+			return "", invalid
+		}
+		if (len(normalized)-2-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	if int(normalized[len(normalized)-1]-'0') != (10-sum%10)%10 {
+		return "", invalid
+	}
+
+	if len(normalized) == 13 && normalized[0] == '0' {
+		normalized = normalized[1:]
+	}
+	return normalized, nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"errors"
+	"flotify/internal/custom_error"
+	"testing"
+)
+
+func TestNormalizeISRC(t *testing.T) {
+	tests := []struct {
+		isrc    string
+		want    string
+		invalid bool
+	}{
+		{isrc: "USRC17607839", want: "USRC17607839"},
+		{isrc: "us-rc1-76-07839", want: "USRC17607839"},
+		{isrc: "  GBAYE0601498 ", want: "GBAYE0601498"},
+		{isrc: "", want: ""},
+		{isrc: "USRC1760783", invalid: true},
+		{isrc: "USRC176078390", invalid: true},
+		{isrc: "U1RC17607839", invalid: true},
+		{isrc: "USR_17607839", invalid: true},
+		{isrc: "USRC1760783X", invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.isrc, func(t *testing.T) {
+			got, err := normalizeISRC(test.isrc)
+			if test.invalid {
+				if !errors.As(err, &custom_error.InvalidIdentifierError{}) {
+					t.Errorf("normalizeISRC(%q) error = %v, want InvalidIdentifierError", test.isrc, err)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("normalizeISRC(%q) = %q, %v, want %q", test.isrc, got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeUPC(t *testing.T) {
+	tests := []struct {
+		upc     string
+		want    string
+		invalid bool
+	}{
+		{upc: "036000291452", want: "036000291452"},
+		{upc: "0-36000-29145-2", want: "036000291452"},
+		{upc: "4006381333931", want: "4006381333931"},
+		{upc: "0036000291452", want: "036000291452"},
+		{upc: "400 638 133 393 1", want: "4006381333931"},
+		{upc: "", want: ""},
+		{upc: "036000291453", invalid: true},
+		{upc: "4006381333932", invalid: true},
+		{upc: "03600029145", invalid: true},
+		{upc: "03600A291452", invalid: true},
+		{upc: "03600029145X", invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.upc, func(t *testing.T) {
+			got, err := normalizeUPC(test.upc)
+			if test.invalid {
+				if !errors.As(err, &custom_error.InvalidIdentifierError{}) {
+					t.Errorf("normalizeUPC(%q) error = %v, want InvalidIdentifierError", test.upc, err)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("normalizeUPC(%q) = %q, %v, want %q", test.upc, got, err, test.want)
+			}
+		})
+	}
+}
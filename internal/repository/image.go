@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"flotify/internal/custom_error"
+	"flotify/internal/model"
+	"fmt"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// artistImageURL is the path serving the image of the artist resized to width
+func artistImageURL(artist_id uuid.UUID, kind model.ImageKind, width int) string {
+	return fmt.Sprintf("/artists/%s/images/%s/%d", artist_id, kind, width)
+}
+
+// GetImagesOfArtist returns the stored sizes of the avatar and the banner of the artist
+func (ar *PostgresArtistRepository) GetImagesOfArtist(ctx context.Context, id uuid.UUID) ([]model.Image, error) {
+	var exist bool
+	if err := ar.dbpool.QueryRow(ctx, "SELECT exists (SELECT 1 FROM artists WHERE id = $1)", id).Scan(&exist); err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, custom_error.NonExistArtistError{}
+	}
+
+	images, err := imagesOf(ctx, ar.dbpool, []uuid.UUID{id})
+	if err != nil {
+		return nil, err
+	}
+	return images[id], nil
+}
+
+// SetImagesOfArtist replaces the sizes stored for the avatar or the banner of the artist, no image removes it
+func (ar *PostgresArtistRepository) SetImagesOfArtist(ctx context.Context, id uuid.UUID, kind model.ImageKind, images []model.Image) (*model.Artist, error) {
+	width_list := make([]int, len(images))
+	height_list := make([]int, len(images))
+	for i, image := range images {
+		width_list[i] = image.Width
+		height_list[i] = image.Height
+	}
+
+	tx, err := ar.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// lock the artist so concurrent uploads don't interleave
+	var artist_id uuid.UUID
+	err = tx.QueryRow(ctx, "SELECT id FROM artists WHERE id = $1 FOR UPDATE", id).Scan(&artist_id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistArtistError{}
+		}
+		return nil, err
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM artists_images WHERE artist_id = $1 AND kind = $2", id, kind); err != nil {
+		return nil, err
+	}
+	insertString := `
+		INSERT INTO artists_images(artist_id, kind, width, height)
+		SELECT $1, $2, x.width, x.height FROM unnest($3::integer[], $4::integer[]) AS x(width, height)
+	`
+	if _, err = tx.Exec(ctx, insertString, id, kind, width_list, height_list); err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ar.GetArtistByID(ctx, id)
+}
+
+// imagesOf returns the images of the artists by artist, avatars first and the largest sizes first.
+// Artists without images get an empty list
+func imagesOf(ctx context.Context, q querier, artist_id_list []uuid.UUID) (map[uuid.UUID][]model.Image, error) {
+	fetchString := `
+		SELECT artist_id, kind, width, height FROM artists_images
+		WHERE artist_id = ANY($1)
+		ORDER BY artist_id, kind = 'banner', width DESC
+	`
+	rows, err := q.Query(ctx, fetchString, artist_id_list)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := make(map[uuid.UUID][]model.Image, len(artist_id_list))
+	for _, artist_id := range artist_id_list {
+		images[artist_id] = []model.Image{}
+	}
+	for rows.Next() {
+		var artist_id uuid.UUID
+		image := model.Image{}
+		if err := rows.Scan(&artist_id, &image.Kind, &image.Width, &image.Height); err != nil {
+			return nil, err
+		}
+		image.URL = artistImageURL(artist_id, image.Kind, image.Width)
+		images[artist_id] = append(images[artist_id], image)
+	}
+	return images, rows.Err()
+}
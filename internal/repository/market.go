@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"flotify/internal/custom_error"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// UnknownMarket is the market of callers whose country isn't known, ZZ is the ISO 3166 code left for unknown regions.
+// Only the items licensed everywhere are available in it
+const UnknownMarket = "ZZ"
+
+// NormalizeMarket upper cases a market, which is an ISO 3166-1 alpha-2 country code
+func NormalizeMarket(market string) (string, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(market))
+	if len(normalized) != 2 || normalized[0] < 'A' || normalized[0] > 'Z' || normalized[1] < 'A' || normalized[1] > 'Z' {
+		return "", custom_error.InvalidMarketError{Market: market}
+	}
+	return normalized, nil
+}
+
+// normalizeMarkets sorts and deduplicates the markets an item is licensed in,
+// no market means every market and is stored as NULL
+func normalizeMarkets(markets []string) ([]string, error) {
+	if len(markets) == 0 {
+		return nil, nil
+	}
+
+	normalized := make([]string, 0, len(markets))
+	for _, market := range markets {
+		market, err := NormalizeMarket(market)
+		if err != nil {
+			return nil, err
+		}
+		if market == UnknownMarket {
+			return nil, custom_error.InvalidMarketError{Market: market}
+		}
+		normalized = append(normalized, market)
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized), nil
+}
+
+// availableIn is the condition keeping the items of alias licensed in the market of its placeholder.
+// An empty market doesn't restrict anything, it is only given by internal lookups, callers always have a market
+func availableIn(alias string) string {
+	return fmt.Sprintf("(%[1]s.markets IS NULL OR %%[1]s = '' OR %%[1]s = ANY(%[1]s.markets))", alias)
+}
@@ -2,7 +2,12 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"flotify/internal/custom_error"
 	"flotify/internal/model"
+	"flotify/internal/playlistfile"
+	"fmt"
+	"slices"
 	"time"
 
 	"github.com/gofrs/uuid/v5"
@@ -13,39 +18,136 @@ import (
 type PlaylistRepository interface {
 	CreatePlaylist(ctx context.Context, playlist model.Playlist) (*model.Playlist, error)
 	GetPlaylist(ctx context.Context, playlist_id uuid.UUID) (*model.Playlist, error)
-	AddTracksToPlaylist(ctx context.Context, playlist_id uuid.UUID, track_id_list []uuid.UUID) (*model.Playlist, error)
-	DeleteTracksFromPlaylist(ctx context.Context, playlist_id uuid.UUID, track_id_list []uuid.UUID) (*model.Playlist, error)
-	GetTracksOfPlaylist(ctx context.Context, playlist_id uuid.UUID) ([]model.Track, error)
-	DeletePlaylist(ctx context.Context) error
+	GetPlaylistsOfUser(ctx context.Context, user_id uuid.UUID, viewer_id uuid.UUID) ([]model.Playlist, error)
+	GetFollowedPlaylists(ctx context.Context, user_id uuid.UUID) ([]model.Playlist, error)
+	GetVisibilityOfPlaylist(ctx context.Context, playlist_id uuid.UUID) (model.PlaylistVisibility, error)
+	SetVisibilityOfPlaylist(ctx context.Context, playlist_id uuid.UUID, visibility model.PlaylistVisibility) (*model.Playlist, error)
+	FollowPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID) error
+	UnfollowPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID) error
+	GetRoleOfUser(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID) (model.PlaylistRole, error)
+	AddTracksToPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, track_id_list []uuid.UUID, position int, snapshot_id uuid.UUID) (*model.Playlist, error)
+	DeleteTracksFromPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, occurrences []TrackOccurrence, snapshot_id uuid.UUID) (*model.Playlist, error)
+	ReorderTracksOfPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, range_start, insert_before, range_length int, snapshot_id uuid.UUID) (*model.Playlist, error)
+	RenamePlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, name string, snapshot_id uuid.UUID) (*model.Playlist, error)
+	GetTracksOfPlaylist(ctx context.Context, playlist_id uuid.UUID, viewer_id uuid.UUID, market string) ([]model.PlaylistTrack, error)
+	DeletePlaylist(ctx context.Context, playlist_id uuid.UUID) error
+	GetMembersOfPlaylist(ctx context.Context, playlist_id uuid.UUID) ([]model.PlaylistMember, error)
+	AddMemberToPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, role model.PlaylistRole) (*model.PlaylistMember, error)
+	DeleteMemberFromPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID) error
+	GetVersionsOfPlaylist(ctx context.Context, playlist_id uuid.UUID, filter Filter) ([]model.PlaylistVersion, error)
+	GetPlaylistVersion(ctx context.Context, playlist_id uuid.UUID, snapshot_id uuid.UUID) (*model.PlaylistVersion, error)
+	RestorePlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, snapshot_id uuid.UUID) (*model.Playlist, error)
+	SetRulesOfPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, rules model.SmartRules) (*model.Playlist, error)
+	DeleteRulesOfPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID) (*model.Playlist, error)
+	RefreshPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID) (*model.Playlist, error)
+	ExportPlaylist(ctx context.Context, playlist_id uuid.UUID, viewer_id uuid.UUID, market string) (*playlistfile.Playlist, error)
+	ImportPlaylist(ctx context.Context, playlist model.Playlist, entries []playlistfile.Entry, dry_run bool) (*model.PlaylistImportReport, error)
+	DuplicatePlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, playlist model.Playlist) (*model.Playlist, error)
+	MergePlaylists(ctx context.Context, playlist_id_list []uuid.UUID, playlist model.Playlist, dedupe bool) (*model.Playlist, error)
+	DeduplicatePlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, snapshot_id uuid.UUID) (*model.Playlist, error)
+	GetCoverOfPlaylist(ctx context.Context, playlist_id uuid.UUID) (string, error)
+	SetCoverOfPlaylist(ctx context.Context, playlist_id uuid.UUID, cover_key string) (*model.Playlist, error)
+	GetArtistsOfPlaylist(ctx context.Context, playlist_id uuid.UUID, limit int) ([]uuid.UUID, error)
+	GetAlbumsOfPlaylist(ctx context.Context, playlist_id uuid.UUID, limit int) ([]uuid.UUID, error)
 }
 
+// TrackOccurrence selects a track to be removed from a playlist,
+// when Positions is empty every occurrence of the track is removed
+type TrackOccurrence struct {
+	TrackID   uuid.UUID
+	Positions []int
+}
+
+const (
+	smartPlaylistDefaultLimit = 100
+	smartPlaylistMaxLimit     = 500
+)
+
 type PostgresPlaylistRepository struct {
 	dbpool *pgxpool.Pool
+	// track_repository evaluates the rules of smart playlists
+	track_repository *PostgresTrackRepository
 }
 
 func NewPostgresPlaylistRepository(dbpool *pgxpool.Pool) *PostgresPlaylistRepository {
 	return &PostgresPlaylistRepository{
-		dbpool: dbpool,
+		dbpool:           dbpool,
+		track_repository: NewPostgresTrackRepository(dbpool),
 	}
 }
 
 func (pr *PostgresPlaylistRepository) CreatePlaylist(ctx context.Context, playlist model.Playlist) (*model.Playlist, error) {
-	// let playlistname in db = playlist.name + user_id
-	insertString := "INSERT INTO playlists(name, user_id) VALUES($1, $2) RETURNING id"
+	if playlist.Rules != nil {
+		if err := validSmartRules(*playlist.Rules); err != nil {
+			return nil, err
+		}
+	}
 
-	var uuid_byte []byte
-	err := pr.dbpool.QueryRow(ctx, insertString, playlist.UserID, playlist.Name).Scan(&uuid_byte)
+	tx, err := pr.dbpool.Begin(ctx)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback(ctx)
 
-	id, err := uuid.FromBytes(uuid_byte)
+	id, err := insertPlaylist(ctx, tx, playlist)
 	if err != nil {
 		return nil, err
 	}
-	playlist.ID = id
 
-	return &playlist, nil
+	entries := []playlistEntry{}
+	if playlist.Rules != nil && playlist.Rules.Materialized {
+		entries, err = pr.materializeRules(ctx, tx, id, *playlist.Rules, entries)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	created_playlist, err := pr.storeCreatedPlaylist(ctx, tx, id, playlist.UserID, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return created_playlist, nil
+}
+
+// insertPlaylist inserts the playlist row, visibility is public unless specified
+func insertPlaylist(ctx context.Context, tx pgx.Tx, playlist model.Playlist) (uuid.UUID, error) {
+	if playlist.Visibility == "" {
+		playlist.Visibility = model.PlaylistPublic
+	}
+	if !validVisibility(playlist.Visibility) {
+		return uuid.Nil, custom_error.InvalidPlaylistVisibilityError{}
+	}
+
+	insertString := "INSERT INTO playlists(name, user_id, visibility, rules) VALUES($1, $2, $3, $4) RETURNING id"
+
+	var uuid_byte []byte
+	err := tx.QueryRow(ctx, insertString, playlist.Name, playlist.UserID, playlist.Visibility, playlist.Rules).Scan(&uuid_byte)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return uuid.FromBytes(uuid_byte)
+}
+
+// storeCreatedPlaylist stores the first tracks of a newly inserted playlist and records its first version
+func (pr *PostgresPlaylistRepository) storeCreatedPlaylist(ctx context.Context, tx pgx.Tx, playlist_id uuid.UUID, user_id uuid.UUID, entries []playlistEntry) (*model.Playlist, error) {
+	if len(entries) > 0 {
+		if err := storeEntries(ctx, tx, playlist_id, entries); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := commitPlaylistChange(ctx, tx, playlist_id, user_id, model.PlaylistCreated, entries); err != nil {
+		return nil, err
+	}
+
+	return pr.getPlaylist(ctx, tx, playlist_id)
 }
 
 func (pr *PostgresPlaylistRepository) GetPlaylist(ctx context.Context, playlist_id uuid.UUID) (*model.Playlist, error) {
@@ -55,29 +157,173 @@ func (pr *PostgresPlaylistRepository) GetPlaylist(ctx context.Context, playlist_
 	}
 	defer tx.Rollback(ctx)
 
-	playlist := model.Playlist{
-		ID: playlist_id,
+	playlist, err := pr.getPlaylist(ctx, tx, playlist_id)
+	if err != nil {
+		return nil, err
 	}
 
-	queryString := "SELECT name, user_id FROM playlists WHERE playlist_id=$1"
-	err = tx.QueryRow(ctx, queryString, playlist_id).Scan(&playlist.Name, &playlist.UserID)
+	err = tx.Commit(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	queryString = "SELECT track_id FROM playlist_tracks WHERE playlist_id=$1"
-	rows, err := tx.Query(ctx, queryString, playlist_id)
+	return playlist, nil
+}
+
+// playlistSelect reads playlists in the column order expected by scanPlaylist,
+// the caller fills in the where clause
+const playlistSelect = `
+	SELECT p.id, p.name, p.user_id, p.snapshot_id, p.visibility, p.rules, p.refreshed_at, p.cover_key IS NOT NULL,
+		(SELECT count(*) FROM playlists_followers f WHERE f.playlist_id = p.id) AS follower_count,
+		COALESCE(
+			(SELECT array_agg(pt.track_id ORDER BY pt.position) FROM playlists_tracks pt WHERE pt.playlist_id = p.id),
+			'{}'
+		) AS track_id_list
+	FROM playlists p
+	WHERE %s
+	ORDER BY p.name ASC, p.id ASC
+`
+
+func scanPlaylist(row pgx.Row) (*model.Playlist, error) {
+	playlist := model.Playlist{}
+	err := row.Scan(
+		&playlist.ID,
+		&playlist.Name,
+		&playlist.UserID,
+		&playlist.SnapshotID,
+		&playlist.Visibility,
+		&playlist.Rules,
+		&playlist.RefreshedAt,
+		&playlist.HasCover,
+		&playlist.FollowerCount,
+		&playlist.TrackIDList,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &playlist, nil
+}
+
+// getPlaylist reads a playlist and its track id list using the given transaction,
+// so that callers modifying the playlist can return its state before committing
+func (pr *PostgresPlaylistRepository) getPlaylist(ctx context.Context, tx pgx.Tx, playlist_id uuid.UUID) (*model.Playlist, error) {
+	playlist, err := scanPlaylist(tx.QueryRow(ctx, fmt.Sprintf(playlistSelect, "p.id = $1"), playlist_id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistPlaylistError{}
+		}
+		return nil, err
+	}
+
+	if err = pr.evaluateLivePlaylist(ctx, playlist); err != nil {
+		return nil, err
+	}
+
+	return playlist, nil
+}
+
+// queryPlaylists lists the playlists matching the condition. The rules of live smart playlists aren't evaluated,
+// which would take a query per playlist, their track id list is left nil until the playlist itself is read
+func (pr *PostgresPlaylistRepository) queryPlaylists(ctx context.Context, condition string, args ...any) ([]model.Playlist, error) {
+	rows, err := pr.dbpool.Query(ctx, fmt.Sprintf(playlistSelect, condition), args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
+	playlists := []model.Playlist{}
 	for rows.Next() {
-		var track_id uuid.UUID
-		err = rows.Scan(&track_id)
+		playlist, err := scanPlaylist(rows)
 		if err != nil {
 			return nil, err
 		}
-		playlist.TrackIDList = append(playlist.TrackIDList, track_id)
+		if playlist.Rules != nil && !playlist.Rules.Materialized {
+			playlist.TrackIDList = nil
+		}
+		playlists = append(playlists, *playlist)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return playlists, nil
+}
+
+// GetPlaylistsOfUser returns the playlists owned by or shared with the user.
+// Other viewers only get the public playlists the user owns
+func (pr *PostgresPlaylistRepository) GetPlaylistsOfUser(ctx context.Context, user_id uuid.UUID, viewer_id uuid.UUID) ([]model.Playlist, error) {
+	if viewer_id != user_id {
+		return pr.queryPlaylists(ctx, "p.user_id = $1 AND p.visibility = 'public'", user_id)
+	}
+
+	condition := `
+		p.user_id = $1
+		OR EXISTS (SELECT 1 FROM playlists_members m WHERE m.playlist_id = p.id AND m.user_id = $1)
+	`
+	return pr.queryPlaylists(ctx, condition, user_id)
+}
+
+// GetFollowedPlaylists returns the playlists followed by the user which are still visible to the user
+func (pr *PostgresPlaylistRepository) GetFollowedPlaylists(ctx context.Context, user_id uuid.UUID) ([]model.Playlist, error) {
+	condition := `
+		EXISTS (SELECT 1 FROM playlists_followers f WHERE f.playlist_id = p.id AND f.user_id = $1)
+		AND ` + visibleTo("$1")
+	return pr.queryPlaylists(ctx, condition, user_id)
+}
+
+// inLibraryOf is the condition for playlist p to be in the library of the user whose id is bound to placeholder:
+// owned by, shared with or followed by the user
+func inLibraryOf(placeholder string) string {
+	return fmt.Sprintf(`(
+		p.user_id = %[1]s
+		OR EXISTS (SELECT 1 FROM playlists_members m WHERE m.playlist_id = p.id AND m.user_id = %[1]s)
+		OR (EXISTS (SELECT 1 FROM playlists_followers f WHERE f.playlist_id = p.id AND f.user_id = %[1]s) AND %[2]s)
+	)`, placeholder, visibleTo(placeholder))
+}
+
+// visibleTo is the condition for playlist p to be visible to the user whose id is bound to placeholder
+func visibleTo(placeholder string) string {
+	return fmt.Sprintf(`(
+		p.visibility <> 'private'
+		OR p.user_id = %[1]s
+		OR EXISTS (SELECT 1 FROM playlists_members m WHERE m.playlist_id = p.id AND m.user_id = %[1]s)
+	)`, placeholder)
+}
+
+func (pr *PostgresPlaylistRepository) GetVisibilityOfPlaylist(ctx context.Context, playlist_id uuid.UUID) (model.PlaylistVisibility, error) {
+	var visibility model.PlaylistVisibility
+	err := pr.dbpool.QueryRow(ctx, "SELECT visibility FROM playlists WHERE id = $1", playlist_id).Scan(&visibility)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", custom_error.NonExistPlaylistError{}
+		}
+		return "", err
+	}
+	return visibility, nil
+}
+
+func (pr *PostgresPlaylistRepository) SetVisibilityOfPlaylist(ctx context.Context, playlist_id uuid.UUID, visibility model.PlaylistVisibility) (*model.Playlist, error) {
+	if !validVisibility(visibility) {
+		return nil, custom_error.InvalidPlaylistVisibilityError{}
+	}
+
+	tx, err := pr.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "UPDATE playlists SET visibility = $2 WHERE id = $1", playlist_id, visibility)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, custom_error.NonExistPlaylistError{}
+	}
+
+	playlist, err := pr.getPlaylist(ctx, tx, playlist_id)
+	if err != nil {
+		return nil, err
 	}
 
 	err = tx.Commit(ctx)
@@ -85,53 +331,199 @@ func (pr *PostgresPlaylistRepository) GetPlaylist(ctx context.Context, playlist_
 		return nil, err
 	}
 
-	return &playlist, nil
+	return playlist, nil
+}
+
+// GetCoverOfPlaylist returns the storage key of the uploaded cover, or an empty key when there is none
+func (pr *PostgresPlaylistRepository) GetCoverOfPlaylist(ctx context.Context, playlist_id uuid.UUID) (string, error) {
+	var cover_key *string
+	err := pr.dbpool.QueryRow(ctx, "SELECT cover_key FROM playlists WHERE id = $1", playlist_id).Scan(&cover_key)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", custom_error.NonExistPlaylistError{}
+		}
+		return "", err
+	}
+
+	if cover_key == nil {
+		return "", nil
+	}
+	return *cover_key, nil
 }
 
-func (pr *PostgresPlaylistRepository) AddTracksToPlaylist(ctx context.Context, playlist_id uuid.UUID, track_id_list []uuid.UUID) (*model.Playlist, error) {
+// SetCoverOfPlaylist records the storage key of the uploaded cover, an empty key removes the cover
+func (pr *PostgresPlaylistRepository) SetCoverOfPlaylist(ctx context.Context, playlist_id uuid.UUID, cover_key string) (*model.Playlist, error) {
 	tx, err := pr.dbpool.Begin(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback(ctx)
 
-	context, cancel := context.WithTimeout(ctx, time.Second*5)
-	defer cancel()
+	tag, err := tx.Exec(ctx, "UPDATE playlists SET cover_key = NULLIF($2, '') WHERE id = $1", playlist_id, cover_key)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, custom_error.NonExistPlaylistError{}
+	}
 
-	type track_playlist struct {
-		playlist_id uuid.UUID
-		track_id    uuid.UUID
+	playlist, err := pr.getPlaylist(ctx, tx, playlist_id)
+	if err != nil {
+		return nil, err
 	}
-	rows := [][]any{}
-	for _, track_id := range track_id_list {
-		rows[0] = append(rows[0], track_playlist{playlist_id: playlist_id, track_id: track_id})
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err = tx.CopyFrom(
-		context,
-		pgx.Identifier{"playlists_tracks"},
-		[]string{"playlist_id", "track_id"},
-		pgx.CopyFromRows(rows),
-	)
+	return playlist, nil
+}
+
+// GetArtistsOfPlaylist returns the first distinct artists in the order their tracks appear in the playlist.
+// Like GetAlbumsOfPlaylist it skips the tracks taken down or not released to everyone yet, the mosaic cover is the same for every viewer
+func (pr *PostgresPlaylistRepository) GetArtistsOfPlaylist(ctx context.Context, playlist_id uuid.UUID, limit int) ([]uuid.UUID, error) {
+	playlist, err := pr.GetPlaylist(ctx, playlist_id)
+	if err != nil {
+		return nil, err
+	}
+
+	fetchString := `
+		SELECT at.artist_id
+		FROM unnest($1::uuid[]) WITH ORDINALITY AS pt(track_id, position)
+		JOIN tracks t ON t.id = pt.track_id AND t.removed_at IS NULL AND ` + fmt.Sprintf(trackReleasedTo("t"), "$3") + `
+		JOIN artists_tracks at ON at.track_id = t.id AND at.role = 'primary'
+		GROUP BY at.artist_id
+		ORDER BY min(pt.position), at.artist_id
+		LIMIT $2
+	`
+	rows, err := pr.dbpool.Query(ctx, fetchString, playlist.TrackIDList, limit, uuid.Nil)
 	if err != nil {
 		return nil, err
 	}
 
+	return pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+}
+
+// GetAlbumsOfPlaylist returns the first distinct albums with an uploaded cover in the order their tracks appear in the playlist
+func (pr *PostgresPlaylistRepository) GetAlbumsOfPlaylist(ctx context.Context, playlist_id uuid.UUID, limit int) ([]uuid.UUID, error) {
 	playlist, err := pr.GetPlaylist(ctx, playlist_id)
 	if err != nil {
 		return nil, err
 	}
 
-	playlist.TrackIDList = append(playlist.TrackIDList, track_id_list...)
-	err = tx.Commit(ctx)
+	fetchString := `
+		SELECT a.id
+		FROM unnest($1::uuid[]) WITH ORDINALITY AS pt(track_id, position)
+		JOIN tracks t ON t.id = pt.track_id AND t.removed_at IS NULL AND ` + fmt.Sprintf(trackReleasedTo("t"), "$3") + `
+		JOIN albums_tracks at ON at.track_id = t.id
+		JOIN albums a ON a.id = at.album_id AND a.cover_key IS NOT NULL AND ` + fmt.Sprintf(albumReleasedTo("a"), "$3") + `
+		GROUP BY a.id
+		ORDER BY min(pt.position), a.id
+		LIMIT $2
+	`
+	rows, err := pr.dbpool.Query(ctx, fetchString, playlist.TrackIDList, limit, uuid.Nil)
 	if err != nil {
 		return nil, err
 	}
 
-	return playlist, nil
+	return pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+}
+
+func (pr *PostgresPlaylistRepository) FollowPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID) error {
+	insertString := `
+		INSERT INTO playlists_followers(playlist_id, user_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	_, err := pr.dbpool.Exec(ctx, insertString, playlist_id, user_id)
+	return err
+}
+
+func (pr *PostgresPlaylistRepository) UnfollowPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID) error {
+	_, err := pr.dbpool.Exec(ctx, "DELETE FROM playlists_followers WHERE playlist_id = $1 AND user_id = $2", playlist_id, user_id)
+	return err
+}
+
+// GetRoleOfUser returns the role of the user in the playlist, or an empty role when the user has no access
+func (pr *PostgresPlaylistRepository) GetRoleOfUser(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID) (model.PlaylistRole, error) {
+	queryString := `
+		SELECT CASE WHEN p.user_id = $2 THEN 'owner' ELSE m.role END
+		FROM playlists p
+		LEFT JOIN playlists_members m ON m.playlist_id = p.id AND m.user_id = $2
+		WHERE p.id = $1
+	`
+
+	var role *string
+	err := pr.dbpool.QueryRow(ctx, queryString, playlist_id, user_id).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", custom_error.NonExistPlaylistError{}
+		}
+		return "", err
+	}
+
+	if role == nil {
+		return "", nil
+	}
+	return model.PlaylistRole(*role), nil
+}
+
+// AddTracksToPlaylist inserts the tracks before the given position, a negative position appends them.
+// When snapshot_id is not nil the playlist must still be at that snapshot
+func (pr *PostgresPlaylistRepository) AddTracksToPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, track_id_list []uuid.UUID, position int, snapshot_id uuid.UUID) (*model.Playlist, error) {
+	return pr.modifyPlaylist(ctx, playlist_id, user_id, model.PlaylistTracksAdded, snapshot_id, func(ctx context.Context, tx pgx.Tx, entries []playlistEntry) ([]playlistEntry, error) {
+		if err := rejectSmartPlaylist(ctx, tx, playlist_id); err != nil {
+			return nil, err
+		}
+		added_at := time.Now().UTC()
+		new_entries := make([]playlistEntry, 0, len(track_id_list))
+		for _, track_id := range track_id_list {
+			new_entries = append(new_entries, playlistEntry{TrackID: track_id, AddedBy: &user_id, AddedAt: added_at})
+		}
+		if position < 0 {
+			position = len(entries)
+		}
+		return insertEntries(entries, position, new_entries)
+	})
+}
+
+func (pr *PostgresPlaylistRepository) DeleteTracksFromPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, occurrences []TrackOccurrence, snapshot_id uuid.UUID) (*model.Playlist, error) {
+	return pr.modifyPlaylist(ctx, playlist_id, user_id, model.PlaylistTracksRemoved, snapshot_id, func(ctx context.Context, tx pgx.Tx, entries []playlistEntry) ([]playlistEntry, error) {
+		if err := rejectSmartPlaylist(ctx, tx, playlist_id); err != nil {
+			return nil, err
+		}
+		return removeEntries(entries, occurrences)
+	})
+}
+
+// ReorderTracksOfPlaylist moves range_length tracks starting at range_start so that they are placed
+// before the track currently at insert_before
+func (pr *PostgresPlaylistRepository) ReorderTracksOfPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, range_start, insert_before, range_length int, snapshot_id uuid.UUID) (*model.Playlist, error) {
+	return pr.modifyPlaylist(ctx, playlist_id, user_id, model.PlaylistTracksReordered, snapshot_id, func(ctx context.Context, tx pgx.Tx, entries []playlistEntry) ([]playlistEntry, error) {
+		if err := rejectSmartPlaylist(ctx, tx, playlist_id); err != nil {
+			return nil, err
+		}
+		return moveEntries(entries, range_start, insert_before, range_length)
+	})
+}
+
+func (pr *PostgresPlaylistRepository) RenamePlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, name string, snapshot_id uuid.UUID) (*model.Playlist, error) {
+	return pr.modifyPlaylist(ctx, playlist_id, user_id, model.PlaylistRenamed, snapshot_id, func(ctx context.Context, tx pgx.Tx, entries []playlistEntry) ([]playlistEntry, error) {
+		_, err := tx.Exec(ctx, "UPDATE playlists SET name = $2 WHERE id = $1", playlist_id, name)
+		return entries, err
+	})
 }
 
-func (pr *PostgresPlaylistRepository) DeleteTracksFromPlaylist(ctx context.Context, playlist_id uuid.UUID, track_id_list []uuid.UUID) (*model.Playlist, error) {
+// modifyPlaylist locks the playlist, applies modify to its ordered entries, rewrites the positions
+// and moves the playlist to a new snapshot recorded in its history, all inside one transaction
+func (pr *PostgresPlaylistRepository) modifyPlaylist(
+	ctx context.Context,
+	playlist_id uuid.UUID,
+	user_id uuid.UUID,
+	action model.PlaylistAction,
+	snapshot_id uuid.UUID,
+	modify func(context.Context, pgx.Tx, []playlistEntry) ([]playlistEntry, error),
+) (*model.Playlist, error) {
 	tx, err := pr.dbpool.Begin(ctx)
 	if err != nil {
 		return nil, err
@@ -141,51 +533,1008 @@ func (pr *PostgresPlaylistRepository) DeleteTracksFromPlaylist(ctx context.Conte
 	context, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 
-	type track_playlist struct {
-		playlist_id uuid.UUID
-		track_id    uuid.UUID
+	if err = lockPlaylist(context, tx, playlist_id, snapshot_id); err != nil {
+		return nil, err
+	}
+
+	entries, err := loadEntries(context, tx, playlist_id)
+	if err != nil {
+		return nil, err
 	}
 
-	batch := &pgx.Batch{}
+	entries, err = modify(context, tx, entries)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, track_id := range track_id_list {
-		batch.Queue("delete tracks where track_id = $1", track_id)
+	if err = storeEntries(context, tx, playlist_id, entries); err != nil {
+		return nil, err
 	}
 
-	br := tx.SendBatch(context, batch)
+	if err = commitPlaylistChange(context, tx, playlist_id, user_id, action, entries); err != nil {
+		return nil, err
+	}
 
-	br.Close()
+	playlist, err := pr.getPlaylist(context, tx, playlist_id)
+	if err != nil {
+		return nil, err
+	}
 
-	playlist, err := pr.GetPlaylist(ctx, playlist_id)
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return playlist, nil
+}
+
+// GetTracksOfPlaylist returns the stored tracks of the playlist, for a smart playlist which
+// is not materialized the tracks currently matching its rules are returned instead.
+// Tracks taken down or not licensed in the market are relinked to another version of their work and left out when none plays,
+// tracks not released to the viewer yet are left out too, so are explicit tracks when the viewer hides them
+func (pr *PostgresPlaylistRepository) GetTracksOfPlaylist(ctx context.Context, playlist_id uuid.UUID, viewer_id uuid.UUID, market string) ([]model.PlaylistTrack, error) {
+	var owner_id uuid.UUID
+	var rules *model.SmartRules
+	err := pr.dbpool.QueryRow(ctx, "SELECT user_id, rules FROM playlists WHERE id = $1", playlist_id).Scan(&owner_id, &rules)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistPlaylistError{}
+		}
 		return nil, err
 	}
 
-	delete_track_id := make(map[uuid.UUID]bool, len(track_id_list))
-	for _, track_id := range track_id_list {
-		delete_track_id[track_id] = true
+	if rules != nil && !rules.Materialized {
+		matched_tracks, err := pr.evaluateRules(ctx, *rules, owner_id, viewer_id, market)
+		if err != nil {
+			return nil, err
+		}
+		evaluated_at := time.Now().UTC()
+		tracks := make([]model.PlaylistTrack, 0, len(matched_tracks))
+		for position, track := range matched_tracks {
+			tracks = append(tracks, model.PlaylistTrack{Position: position, AddedAt: evaluated_at, Track: track})
+		}
+		return tracks, nil
+	}
+
+	fetchString := `
+		SELECT pt.position, pt.added_by, pt.added_at, t.id, t.name, t.length, t.explicit, t.work_id, t.version, nullif(o.id, t.id),
+			COALESCE(array_agg(at.artist_id ORDER BY at.role = 'featured', at.position) FILTER (WHERE at.artist_id IS NOT NULL), '{}') AS artist_id
+		FROM playlists_tracks pt
+		JOIN tracks o ON o.id = pt.track_id
+		JOIN ` + relinkedTrack("o", "$2", "$3") + ` t ON true
+		LEFT JOIN artists_tracks at ON at.track_id = t.id AND at.role IN ('primary', 'featured')
+		WHERE pt.playlist_id = $1 AND ` + fmt.Sprintf(explicitAllowed("t"), "$2") + ` AND ` + fmt.Sprintf(trackReleasedTo("t"), "$2") + `
+		GROUP BY pt.position, pt.added_by, pt.added_at, o.id, t.id, t.name, t.length, t.explicit, t.work_id, t.version
+		ORDER BY pt.position
+	`
+	rows, err := pr.dbpool.Query(ctx, fetchString, playlist_id, viewer_id, market)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	var new_track_id_list []uuid.UUID
-	for _, track_id := range playlist.TrackIDList {
-		if !delete_track_id[track_id] {
-			new_track_id_list = append(new_track_id_list, track_id)
+	tracks := []model.PlaylistTrack{}
+	for rows.Next() {
+		track := model.PlaylistTrack{}
+		err = rows.Scan(
+			&track.Position,
+			&track.AddedBy,
+			&track.AddedAt,
+			&track.Track.ID,
+			&track.Track.Name,
+			&track.Track.Length,
+			&track.Track.Explicit,
+			&track.Track.WorkID,
+			&track.Track.Version,
+			&track.Track.LinkedFrom,
+			&track.Track.ArtistID,
+		)
+		if err != nil {
+			return nil, err
 		}
+		tracks = append(tracks, track)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
-	playlist.TrackIDList = new_track_id_list
 
-	err = tx.Commit(ctx)
+	return tracks, nil
+}
+
+func (pr *PostgresPlaylistRepository) DeletePlaylist(ctx context.Context, playlist_id uuid.UUID) error {
+	deleteString := `
+		with res as (DELETE FROM playlists where id = $1 returning 1)
+		select count(*) from res
+	`
+
+	var success int
+	if err := pr.dbpool.QueryRow(ctx, deleteString, playlist_id).Scan(&success); err != nil {
+		return err
+	}
+
+	if success == 0 {
+		return custom_error.NonExistPlaylistError{}
+	}
+
+	return nil
+}
+
+func (pr *PostgresPlaylistRepository) GetMembersOfPlaylist(ctx context.Context, playlist_id uuid.UUID) ([]model.PlaylistMember, error) {
+	fetchString := "SELECT user_id, role, added_at FROM playlists_members WHERE playlist_id = $1 ORDER BY added_at"
+	rows, err := pr.dbpool.Query(ctx, fetchString, playlist_id)
 	if err != nil {
 		return nil, err
 	}
 
-	return playlist, nil
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[model.PlaylistMember])
 }
 
-func (pr *PostgresPlaylistRepository) GetTracksOfPlaylist(ctx context.Context, playlist_id uuid.UUID) ([]model.Track, error) {
-	return []model.Track{}, nil
+// AddMemberToPlaylist invites the user to the playlist, inviting an existing member changes its role
+func (pr *PostgresPlaylistRepository) AddMemberToPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, role model.PlaylistRole) (*model.PlaylistMember, error) {
+	if role != model.PlaylistEditor && role != model.PlaylistViewer {
+		return nil, custom_error.InvalidPlaylistRoleError{}
+	}
+
+	tx, err := pr.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var owner_id uuid.UUID
+	err = tx.QueryRow(ctx, "SELECT user_id FROM playlists WHERE id = $1", playlist_id).Scan(&owner_id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistPlaylistError{}
+		}
+		return nil, err
+	}
+	if owner_id == user_id {
+		return nil, custom_error.OwnerMembershipError{}
+	}
+
+	var exist bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", user_id).Scan(&exist)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, custom_error.NonExistUserError{}
+	}
+
+	insertString := `
+		INSERT INTO playlists_members(playlist_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (playlist_id, user_id) DO UPDATE SET role = EXCLUDED.role
+		RETURNING added_at
+	`
+	member := model.PlaylistMember{
+		UserID: user_id,
+		Role:   role,
+	}
+	err = tx.QueryRow(ctx, insertString, playlist_id, user_id, role).Scan(&member.AddedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
 }
 
-func (pr *PostgresPlaylistRepository) DeletePlaylist(ctx context.Context) error {
+func (pr *PostgresPlaylistRepository) DeleteMemberFromPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID) error {
+	deleteString := `
+		with res as (DELETE FROM playlists_members where playlist_id = $1 AND user_id = $2 returning 1)
+		select count(*) from res
+	`
+
+	var success int
+	if err := pr.dbpool.QueryRow(ctx, deleteString, playlist_id, user_id).Scan(&success); err != nil {
+		return err
+	}
+
+	if success == 0 {
+		return custom_error.NonExistPlaylistMemberError{}
+	}
+
 	return nil
 }
+
+func (pr *PostgresPlaylistRepository) GetVersionsOfPlaylist(ctx context.Context, playlist_id uuid.UUID, filter Filter) ([]model.PlaylistVersion, error) {
+	fetchString := `
+		SELECT snapshot_id, action, user_id, name, tracks, created_at
+		FROM playlists_versions
+		WHERE playlist_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := pr.dbpool.Query(ctx, fetchString, playlist_id, filter.Limit, filter.GetOffSet())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []model.PlaylistVersion{}
+	for rows.Next() {
+		version, err := scanPlaylistVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *version)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func (pr *PostgresPlaylistRepository) GetPlaylistVersion(ctx context.Context, playlist_id uuid.UUID, snapshot_id uuid.UUID) (*model.PlaylistVersion, error) {
+	fetchString := `
+		SELECT snapshot_id, action, user_id, name, tracks, created_at
+		FROM playlists_versions
+		WHERE playlist_id = $1 AND snapshot_id = $2
+	`
+	version, err := scanPlaylistVersion(pr.dbpool.QueryRow(ctx, fetchString, playlist_id, snapshot_id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistPlaylistVersionError{}
+		}
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// RestorePlaylist brings back the name and tracks the playlist had at the given snapshot.
+// The restore itself becomes a new version, so it can be undone as well
+func (pr *PostgresPlaylistRepository) RestorePlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, snapshot_id uuid.UUID) (*model.Playlist, error) {
+	return pr.modifyPlaylist(ctx, playlist_id, user_id, model.PlaylistRestored, uuid.Nil, func(ctx context.Context, tx pgx.Tx, _ []playlistEntry) ([]playlistEntry, error) {
+		if err := rejectSmartPlaylist(ctx, tx, playlist_id); err != nil {
+			return nil, err
+		}
+
+		var name string
+		var entries []playlistEntry
+		fetchString := "SELECT name, tracks FROM playlists_versions WHERE playlist_id = $1 AND snapshot_id = $2"
+		err := tx.QueryRow(ctx, fetchString, playlist_id, snapshot_id).Scan(&name, &entries)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, custom_error.NonExistPlaylistVersionError{}
+			}
+			return nil, err
+		}
+
+		if _, err = tx.Exec(ctx, "UPDATE playlists SET name = $2 WHERE id = $1", playlist_id, name); err != nil {
+			return nil, err
+		}
+
+		// tracks deleted from the catalog since that snapshot can't be restored
+		track_id_list := make([]uuid.UUID, 0, len(entries))
+		for _, entry := range entries {
+			track_id_list = append(track_id_list, entry.TrackID)
+		}
+		rows, err := tx.Query(ctx, "SELECT id FROM tracks WHERE id = ANY($1)", track_id_list)
+		if err != nil {
+			return nil, err
+		}
+		exist_track_id_list, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+		if err != nil {
+			return nil, err
+		}
+		exist := make(map[uuid.UUID]bool, len(exist_track_id_list))
+		for _, track_id := range exist_track_id_list {
+			exist[track_id] = true
+		}
+
+		restored_entries := make([]playlistEntry, 0, len(entries))
+		for _, entry := range entries {
+			if exist[entry.TrackID] {
+				restored_entries = append(restored_entries, entry)
+			}
+		}
+		return restored_entries, nil
+	})
+}
+
+// SetRulesOfPlaylist turns the playlist into a smart playlist or replaces its rules.
+// The stored tracks are replaced by the matching ones when the playlist is materialized, and dropped otherwise
+func (pr *PostgresPlaylistRepository) SetRulesOfPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, rules model.SmartRules) (*model.Playlist, error) {
+	if err := validSmartRules(rules); err != nil {
+		return nil, err
+	}
+
+	return pr.modifyPlaylist(ctx, playlist_id, user_id, model.PlaylistRulesChanged, uuid.Nil, func(ctx context.Context, tx pgx.Tx, entries []playlistEntry) ([]playlistEntry, error) {
+		_, err := tx.Exec(ctx, "UPDATE playlists SET rules = $2, refreshed_at = NULL WHERE id = $1", playlist_id, rules)
+		if err != nil {
+			return nil, err
+		}
+
+		if !rules.Materialized {
+			return []playlistEntry{}, nil
+		}
+		return pr.materializeRules(ctx, tx, playlist_id, rules, entries)
+	})
+}
+
+// DeleteRulesOfPlaylist turns a smart playlist back into a normal one holding the tracks currently matching its rules
+func (pr *PostgresPlaylistRepository) DeleteRulesOfPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID) (*model.Playlist, error) {
+	return pr.modifyPlaylist(ctx, playlist_id, user_id, model.PlaylistRulesChanged, uuid.Nil, func(ctx context.Context, tx pgx.Tx, entries []playlistEntry) ([]playlistEntry, error) {
+		rules, err := rulesOfPlaylist(ctx, tx, playlist_id)
+		if err != nil {
+			return nil, err
+		}
+		if rules == nil {
+			return nil, custom_error.NotSmartPlaylistError{}
+		}
+
+		if !rules.Materialized {
+			entries, err = pr.materializeRules(ctx, tx, playlist_id, *rules, entries)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE playlists SET rules = NULL, refreshed_at = NULL WHERE id = $1", playlist_id)
+		return entries, err
+	})
+}
+
+// RefreshPlaylist stores the tracks currently matching the rules of a smart playlist
+func (pr *PostgresPlaylistRepository) RefreshPlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID) (*model.Playlist, error) {
+	return pr.modifyPlaylist(ctx, playlist_id, user_id, model.PlaylistRefreshed, uuid.Nil, func(ctx context.Context, tx pgx.Tx, entries []playlistEntry) ([]playlistEntry, error) {
+		rules, err := rulesOfPlaylist(ctx, tx, playlist_id)
+		if err != nil {
+			return nil, err
+		}
+		if rules == nil {
+			return nil, custom_error.NotSmartPlaylistError{}
+		}
+
+		return pr.materializeRules(ctx, tx, playlist_id, *rules, entries)
+	})
+}
+
+// ExportPlaylist describes the tracks of the playlist for writing them to a playlist file, they are the tracks
+// GetTracksOfPlaylist returns to the viewer in the market so the file lists what plays and nothing unreleased
+func (pr *PostgresPlaylistRepository) ExportPlaylist(ctx context.Context, playlist_id uuid.UUID, viewer_id uuid.UUID, market string) (*playlistfile.Playlist, error) {
+	playlist, err := pr.GetPlaylist(ctx, playlist_id)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks, err := pr.GetTracksOfPlaylist(ctx, playlist_id, viewer_id, market)
+	if err != nil {
+		return nil, err
+	}
+
+	track_id_list := make([]uuid.UUID, 0, len(tracks))
+	for _, track := range tracks {
+		track_id_list = append(track_id_list, track.Track.ID)
+	}
+	fetchString := `
+		SELECT at.track_id, string_agg(a.name, ', ' ORDER BY at.role = 'featured', at.position) AS artist
+		FROM artists_tracks at
+		JOIN artists a ON a.id = at.artist_id
+		WHERE at.track_id = ANY($1) AND at.role IN ('primary', 'featured')
+		GROUP BY at.track_id
+	`
+	rows, err := pr.dbpool.Query(ctx, fetchString, track_id_list)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	artists := make(map[uuid.UUID]string, len(tracks))
+	for rows.Next() {
+		var track_id uuid.UUID
+		var artist string
+		if err = rows.Scan(&track_id, &artist); err != nil {
+			return nil, err
+		}
+		artists[track_id] = artist
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	file := playlistfile.Playlist{
+		Name:    playlist.Name,
+		Entries: make([]playlistfile.Entry, 0, len(tracks)),
+	}
+	for i, track := range tracks {
+		file.Entries = append(file.Entries, playlistfile.Entry{
+			TrackID: track.Track.ID,
+			Title:   track.Track.Name,
+			Artist:  artists[track.Track.ID],
+			Length:  track.Track.Length,
+			Line:    i + 1,
+		})
+	}
+
+	return &file, nil
+}
+
+// ImportPlaylist creates a playlist holding the catalog tracks matched by the entries of a playlist file.
+// With dry_run only the report is computed and nothing is created
+func (pr *PostgresPlaylistRepository) ImportPlaylist(ctx context.Context, playlist model.Playlist, entries []playlistfile.Entry, dry_run bool) (*model.PlaylistImportReport, error) {
+	matched_id_list, err := pr.track_repository.MatchTracks(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	added_at := time.Now().UTC()
+	report := model.PlaylistImportReport{Unmatched: []model.UnmatchedEntry{}}
+	playlist_entries := make([]playlistEntry, 0, len(entries))
+	for i, entry := range entries {
+		if matched_id_list[i].IsNil() {
+			report.Unmatched = append(report.Unmatched, model.UnmatchedEntry{
+				Line:     entry.Line,
+				Location: entry.Location,
+				Title:    entry.Title,
+				Artist:   entry.Artist,
+				Length:   entry.Length,
+			})
+			continue
+		}
+		playlist_entries = append(playlist_entries, playlistEntry{TrackID: matched_id_list[i], AddedBy: &playlist.UserID, AddedAt: added_at})
+	}
+	report.Matched = len(playlist_entries)
+
+	if dry_run {
+		return &report, nil
+	}
+
+	tx, err := pr.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	playlist.Rules = nil
+	id, err := insertPlaylist(ctx, tx, playlist)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Playlist, err = pr.storeCreatedPlaylist(ctx, tx, id, playlist.UserID, playlist_entries)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// DuplicatePlaylist copies the name, rules and tracks of the playlist visible to user_id into a new playlist owned by playlist.UserID.
+// An empty playlist.Name or playlist.Visibility keeps the one of the original
+func (pr *PostgresPlaylistRepository) DuplicatePlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, playlist model.Playlist) (*model.Playlist, error) {
+	tx, err := pr.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var exist bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", playlist.UserID).Scan(&exist)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, custom_error.NonExistUserError{}
+	}
+
+	var name string
+	var visibility model.PlaylistVisibility
+	fetchString := "SELECT p.name, p.visibility, p.rules FROM playlists p WHERE p.id = $1 AND " + visibleTo("$2")
+	err = tx.QueryRow(ctx, fetchString, playlist_id, user_id).Scan(&name, &visibility, &playlist.Rules)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistPlaylistError{}
+		}
+		return nil, err
+	}
+	if playlist.Name == "" {
+		playlist.Name = name
+	}
+	// a copy of a private or unlisted playlist must not publish its tracks
+	if playlist.Visibility == "" {
+		playlist.Visibility = visibility
+	}
+
+	entries, err := loadEntries(ctx, tx, playlist_id)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := insertPlaylist(ctx, tx, playlist)
+	if err != nil {
+		return nil, err
+	}
+
+	duplicated_playlist, err := pr.storeCreatedPlaylist(ctx, tx, id, user_id, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return duplicated_playlist, nil
+}
+
+// MergePlaylists creates a playlist owned by playlist.UserID holding the tracks of the given playlists one after another.
+// Every playlist must be visible to the owner, smart playlists contribute the tracks currently matching their rules
+func (pr *PostgresPlaylistRepository) MergePlaylists(ctx context.Context, playlist_id_list []uuid.UUID, playlist model.Playlist, dedupe bool) (*model.Playlist, error) {
+	tx, err := pr.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	entries := []playlistEntry{}
+	for _, playlist_id := range playlist_id_list {
+		source_entries, err := pr.entriesOfVisiblePlaylist(ctx, tx, playlist_id, playlist.UserID)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, source_entries...)
+	}
+
+	if dedupe {
+		entries, err = deduplicateEntries(ctx, tx, entries)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	playlist.Rules = nil
+	id, err := insertPlaylist(ctx, tx, playlist)
+	if err != nil {
+		return nil, err
+	}
+
+	merged_playlist, err := pr.storeCreatedPlaylist(ctx, tx, id, playlist.UserID, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return merged_playlist, nil
+}
+
+// DeduplicatePlaylist removes tracks appearing earlier in the playlist, keeping the first occurrence of each
+func (pr *PostgresPlaylistRepository) DeduplicatePlaylist(ctx context.Context, playlist_id uuid.UUID, user_id uuid.UUID, snapshot_id uuid.UUID) (*model.Playlist, error) {
+	return pr.modifyPlaylist(ctx, playlist_id, user_id, model.PlaylistDeduplicated, snapshot_id, func(ctx context.Context, tx pgx.Tx, entries []playlistEntry) ([]playlistEntry, error) {
+		if err := rejectSmartPlaylist(ctx, tx, playlist_id); err != nil {
+			return nil, err
+		}
+		return deduplicateEntries(ctx, tx, entries)
+	})
+}
+
+// entriesOfVisiblePlaylist returns the entries of a playlist visible to the user,
+// invisible playlists are reported as missing
+func (pr *PostgresPlaylistRepository) entriesOfVisiblePlaylist(ctx context.Context, tx pgx.Tx, playlist_id uuid.UUID, user_id uuid.UUID) ([]playlistEntry, error) {
+	var owner_id uuid.UUID
+	var rules *model.SmartRules
+	fetchString := "SELECT p.user_id, p.rules FROM playlists p WHERE p.id = $1 AND " + visibleTo("$2")
+	err := tx.QueryRow(ctx, fetchString, playlist_id, user_id).Scan(&owner_id, &rules)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistPlaylistError{}
+		}
+		return nil, err
+	}
+
+	if rules == nil || rules.Materialized {
+		return loadEntries(ctx, tx, playlist_id)
+	}
+
+	tracks, err := pr.evaluateRules(ctx, *rules, owner_id, uuid.Nil, "")
+	if err != nil {
+		return nil, err
+	}
+	added_at := time.Now().UTC()
+	entries := make([]playlistEntry, 0, len(tracks))
+	for _, track := range tracks {
+		entries = append(entries, playlistEntry{TrackID: track.ID, AddedAt: added_at})
+	}
+	return entries, nil
+}
+
+// evaluateRules returns the tracks matching the rules of a playlist owned by owner_id,
+// viewer_id and market are the user and the market they are listed for, uuid.Nil and "" when they are stored
+func (pr *PostgresPlaylistRepository) evaluateRules(ctx context.Context, rules model.SmartRules, owner_id uuid.UUID, viewer_id uuid.UUID, market string) ([]model.Track, error) {
+	filter := smartRulesFilter(rules, owner_id)
+	filter.ViewerID = viewer_id
+	filter.Market = market
+	return pr.track_repository.GetTracksWithFilter(ctx, filter)
+}
+
+// evaluateLivePlaylist replaces the stored track id list of a smart playlist which is not materialized
+func (pr *PostgresPlaylistRepository) evaluateLivePlaylist(ctx context.Context, playlist *model.Playlist) error {
+	if playlist.Rules == nil || playlist.Rules.Materialized {
+		return nil
+	}
+
+	tracks, err := pr.evaluateRules(ctx, *playlist.Rules, playlist.UserID, uuid.Nil, "")
+	if err != nil {
+		return err
+	}
+
+	playlist.TrackIDList = make([]uuid.UUID, 0, len(tracks))
+	for _, track := range tracks {
+		playlist.TrackIDList = append(playlist.TrackIDList, track.ID)
+	}
+	return nil
+}
+
+// materializeRules marks the playlist as refreshed and returns the entries of the tracks matching the rules,
+// tracks which were already in the playlist keep the time they were first added
+func (pr *PostgresPlaylistRepository) materializeRules(ctx context.Context, tx pgx.Tx, playlist_id uuid.UUID, rules model.SmartRules, entries []playlistEntry) ([]playlistEntry, error) {
+	var owner_id uuid.UUID
+	var refreshed_at time.Time
+	updateString := "UPDATE playlists SET refreshed_at = now() WHERE id = $1 RETURNING user_id, refreshed_at"
+	if err := tx.QueryRow(ctx, updateString, playlist_id).Scan(&owner_id, &refreshed_at); err != nil {
+		return nil, err
+	}
+
+	tracks, err := pr.evaluateRules(ctx, rules, owner_id, uuid.Nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	added_at := make(map[uuid.UUID]time.Time, len(entries))
+	for _, entry := range entries {
+		if _, ok := added_at[entry.TrackID]; !ok {
+			added_at[entry.TrackID] = entry.AddedAt
+		}
+	}
+
+	materialized_entries := make([]playlistEntry, 0, len(tracks))
+	for _, track := range tracks {
+		entry := playlistEntry{TrackID: track.ID, AddedAt: refreshed_at}
+		if first_added_at, ok := added_at[track.ID]; ok {
+			entry.AddedAt = first_added_at
+		}
+		materialized_entries = append(materialized_entries, entry)
+	}
+	return materialized_entries, nil
+}
+
+// smartRulesFilter translates the rules of a playlist owned by owner_id into a track filter
+func smartRulesFilter(rules model.SmartRules, owner_id uuid.UUID) Filter {
+	props := map[string]any{
+		"name":       rules.Name,
+		"artist_id":  rules.ArtistID,
+		"min_length": rules.MinLength,
+		"max_length": rules.MaxLength,
+	}
+	if rules.FollowedArtists {
+		props["followed_by"] = owner_id
+	}
+	if rules.AddedWithinDays > 0 {
+		props["added_after"] = time.Now().AddDate(0, 0, -rules.AddedWithinDays)
+	}
+
+	limit := rules.Limit
+	if limit == 0 {
+		limit = smartPlaylistDefaultLimit
+	}
+
+	return Filter{
+		Props:  props,
+		Page:   1,
+		Limit:  limit,
+		SortBy: rules.SortBy,
+	}
+}
+
+func validSmartRules(rules model.SmartRules) error {
+	if rules.MinLength < 0 || rules.MaxLength < 0 || rules.AddedWithinDays < 0 {
+		return custom_error.InvalidSmartRulesError{}
+	}
+	if rules.Limit < 0 || rules.Limit > smartPlaylistMaxLimit {
+		return custom_error.InvalidSmartRulesError{}
+	}
+
+	_, err := smartRulesFilter(rules, uuid.Nil).GetSortCriteriaOf(trackSortColumns)
+	return err
+}
+
+func rulesOfPlaylist(ctx context.Context, tx pgx.Tx, playlist_id uuid.UUID) (*model.SmartRules, error) {
+	var rules *model.SmartRules
+	if err := tx.QueryRow(ctx, "SELECT rules FROM playlists WHERE id = $1", playlist_id).Scan(&rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// rejectSmartPlaylist prevents editing the tracks of a smart playlist by hand
+func rejectSmartPlaylist(ctx context.Context, tx pgx.Tx, playlist_id uuid.UUID) error {
+	rules, err := rulesOfPlaylist(ctx, tx, playlist_id)
+	if err != nil {
+		return err
+	}
+	if rules != nil {
+		return custom_error.SmartPlaylistError{}
+	}
+	return nil
+}
+
+func scanPlaylistVersion(row pgx.Row) (*model.PlaylistVersion, error) {
+	version := model.PlaylistVersion{}
+	var entries []playlistEntry
+	err := row.Scan(&version.SnapshotID, &version.Action, &version.UserID, &version.Name, &entries, &version.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	version.TrackIDList = make([]uuid.UUID, 0, len(entries))
+	for _, entry := range entries {
+		version.TrackIDList = append(version.TrackIDList, entry.TrackID)
+	}
+	return &version, nil
+}
+
+func validVisibility(visibility model.PlaylistVisibility) bool {
+	switch visibility {
+	case model.PlaylistPublic, model.PlaylistUnlisted, model.PlaylistPrivate:
+		return true
+	}
+	return false
+}
+
+// playlistEntry is one row of playlists_tracks, its position is the index inside the entry list.
+// Entries are also kept as json in playlists_versions so a version can be restored exactly
+type playlistEntry struct {
+	TrackID uuid.UUID  `json:"track_id"`
+	AddedBy *uuid.UUID `json:"added_by"`
+	AddedAt time.Time  `json:"added_at"`
+}
+
+// lockPlaylist takes a row lock on the playlist so concurrent edits are serialized,
+// and rejects the edit when the caller's snapshot is stale
+func lockPlaylist(ctx context.Context, tx pgx.Tx, playlist_id uuid.UUID, snapshot_id uuid.UUID) error {
+	var current_snapshot_id uuid.UUID
+	err := tx.QueryRow(ctx, "SELECT snapshot_id FROM playlists WHERE id = $1 FOR UPDATE", playlist_id).Scan(&current_snapshot_id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return custom_error.NonExistPlaylistError{}
+		}
+		return err
+	}
+
+	if snapshot_id != uuid.Nil && snapshot_id != current_snapshot_id {
+		return custom_error.SnapshotMismatchError{}
+	}
+	return nil
+}
+
+// commitPlaylistChange moves the playlist to a new snapshot and records the state after the change
+func commitPlaylistChange(ctx context.Context, tx pgx.Tx, playlist_id uuid.UUID, user_id uuid.UUID, action model.PlaylistAction, entries []playlistEntry) error {
+	updateString := "UPDATE playlists SET snapshot_id = gen_random_uuid() WHERE id = $1 RETURNING snapshot_id, name"
+
+	var snapshot_id uuid.UUID
+	var name string
+	if err := tx.QueryRow(ctx, updateString, playlist_id).Scan(&snapshot_id, &name); err != nil {
+		return err
+	}
+
+	insertString := `
+		INSERT INTO playlists_versions(snapshot_id, playlist_id, action, user_id, name, tracks)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	args := []any{
+		snapshot_id,
+		playlist_id,
+		action,
+		user_id,
+		name,
+		entries,
+	}
+	_, err := tx.Exec(ctx, insertString, args...)
+	return err
+}
+
+func loadEntries(ctx context.Context, tx pgx.Tx, playlist_id uuid.UUID) ([]playlistEntry, error) {
+	queryString := "SELECT track_id, added_by, added_at FROM playlists_tracks WHERE playlist_id = $1 ORDER BY position"
+	rows, err := tx.Query(ctx, queryString, playlist_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[playlistEntry])
+}
+
+func storeEntries(ctx context.Context, tx pgx.Tx, playlist_id uuid.UUID, entries []playlistEntry) error {
+	if _, err := tx.Exec(ctx, "DELETE FROM playlists_tracks WHERE playlist_id = $1", playlist_id); err != nil {
+		return err
+	}
+
+	rows := [][]any{}
+	for position, entry := range entries {
+		rows = append(rows, []any{playlist_id, entry.TrackID, position, entry.AddedBy, entry.AddedAt})
+	}
+
+	_, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"playlists_tracks"},
+		[]string{"playlist_id", "track_id", "position", "added_by", "added_at"},
+		pgx.CopyFromRows(rows),
+	)
+	return err
+}
+
+// duplicateLengthTolerance is the number of seconds two catalog tracks with the same identity may differ by
+const duplicateLengthTolerance = 2
+
+// deduplicateEntries keeps the first occurrence of every track. Besides the same id, two catalog tracks are the same
+// recording when they share their ISRC, or when one of them has no ISRC, they share title and artists and their
+// lengths are within duplicateLengthTolerance
+func deduplicateEntries(ctx context.Context, tx pgx.Tx, entries []playlistEntry) ([]playlistEntry, error) {
+	track_id_list := make([]uuid.UUID, 0, len(entries))
+	for _, entry := range entries {
+		track_id_list = append(track_id_list, entry.TrackID)
+	}
+
+	fetchString := `
+		SELECT t.id, COALESCE(t.isrc, ''),
+			lower(trim(regexp_replace(t.name, '[^[:alnum:]]+', ' ', 'g'))) || '|' ||
+				COALESCE(string_agg(at.artist_id::text, ',' ORDER BY at.artist_id), '') AS identity,
+			t.length
+		FROM tracks t
+		LEFT JOIN artists_tracks at ON at.track_id = t.id AND at.role IN ('primary', 'featured')
+		WHERE t.id = ANY($1)
+		GROUP BY t.id
+	`
+	rows, err := tx.Query(ctx, fetchString, track_id_list)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := make(map[uuid.UUID]trackIdentity, len(entries))
+	for rows.Next() {
+		var track_id uuid.UUID
+		identity := trackIdentity{}
+		if err = rows.Scan(&track_id, &identity.isrc, &identity.identity, &identity.length); err != nil {
+			return nil, err
+		}
+		identities[track_id] = identity
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deduplicate(entries, identities), nil
+}
+
+// trackIdentity is what tells whether two catalog tracks are the same recording,
+// identity is the normalized title followed by the artists
+type trackIdentity struct {
+	isrc     string
+	identity string
+	length   int
+}
+
+// deduplicate keeps the first occurrence of every track of entries, see deduplicateEntries.
+// Tracks missing from identities only match the same id, and tracks with different ISRCs never match
+func deduplicate(entries []playlistEntry, identities map[uuid.UUID]trackIdentity) []playlistEntry {
+	kept_id := make(map[uuid.UUID]bool, len(entries))
+	kept_isrc := make(map[string]bool, len(entries))
+	kept_identities := make(map[string][]trackIdentity, len(entries))
+	result := make([]playlistEntry, 0, len(entries))
+	for _, entry := range entries {
+		if kept_id[entry.TrackID] {
+			continue
+		}
+
+		identity, ok := identities[entry.TrackID]
+		if ok && identity.isrc != "" && kept_isrc[identity.isrc] {
+			continue
+		}
+		if ok && slices.ContainsFunc(kept_identities[identity.identity], func(kept trackIdentity) bool {
+			return (kept.isrc == "" || identity.isrc == "") && abs(kept.length-identity.length) <= duplicateLengthTolerance
+		}) {
+			continue
+		}
+
+		kept_id[entry.TrackID] = true
+		if ok {
+			if identity.isrc != "" {
+				kept_isrc[identity.isrc] = true
+			}
+			kept_identities[identity.identity] = append(kept_identities[identity.identity], identity)
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func insertEntries(entries []playlistEntry, position int, new_entries []playlistEntry) ([]playlistEntry, error) {
+	if position < 0 || position > len(entries) {
+		return nil, custom_error.InvalidPositionError{}
+	}
+
+	result := make([]playlistEntry, 0, len(entries)+len(new_entries))
+	result = append(result, entries[:position]...)
+	result = append(result, new_entries...)
+	result = append(result, entries[position:]...)
+	return result, nil
+}
+
+func removeEntries(entries []playlistEntry, occurrences []TrackOccurrence) ([]playlistEntry, error) {
+	removed := make([]bool, len(entries))
+	for _, occurrence := range occurrences {
+		if len(occurrence.Positions) == 0 {
+			for position, entry := range entries {
+				if entry.TrackID == occurrence.TrackID {
+					removed[position] = true
+				}
+			}
+			continue
+		}
+
+		// a position has to point at the given track, otherwise the client works on an outdated view
+		for _, position := range occurrence.Positions {
+			if position < 0 || position >= len(entries) || entries[position].TrackID != occurrence.TrackID {
+				return nil, custom_error.InvalidPositionError{}
+			}
+			removed[position] = true
+		}
+	}
+
+	result := make([]playlistEntry, 0, len(entries))
+	for position, entry := range entries {
+		if !removed[position] {
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+func moveEntries(entries []playlistEntry, range_start, insert_before, range_length int) ([]playlistEntry, error) {
+	// range_length is compared against what is left so a huge value can't overflow the sum
+	if range_length < 1 || range_start < 0 || range_start > len(entries) || range_length > len(entries)-range_start {
+		return nil, custom_error.InvalidPositionError{}
+	}
+	if insert_before < 0 || insert_before > len(entries) {
+		return nil, custom_error.InvalidPositionError{}
+	}
+
+	moved := make([]playlistEntry, range_length)
+	copy(moved, entries[range_start:range_start+range_length])
+
+	rest := make([]playlistEntry, 0, len(entries)-range_length)
+	rest = append(rest, entries[:range_start]...)
+	rest = append(rest, entries[range_start+range_length:]...)
+
+	// insert_before is an index of the list before moving, shift it when the range was in front of it
+	position := insert_before
+	if insert_before > range_start {
+		position = max(insert_before-range_length, range_start)
+	}
+
+	return insertEntries(rest, position, moved)
+}
@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"errors"
+	"flotify/internal/custom_error"
+	"math"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// testEntries returns an entry per character, the track id of an entry is made of its character
+func testEntries(tracks string) []playlistEntry {
+	entries := make([]playlistEntry, 0, len(tracks))
+	for i := range tracks {
+		entries = append(entries, playlistEntry{TrackID: uuid.UUID{tracks[i]}})
+	}
+	return entries
+}
+
+// entryTracks is the inverse of testEntries
+func entryTracks(entries []playlistEntry) string {
+	tracks := make([]byte, 0, len(entries))
+	for _, entry := range entries {
+		tracks = append(tracks, entry.TrackID[0])
+	}
+	return string(tracks)
+}
+
+func TestInsertEntries(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  string
+		position int
+		inserted string
+		want     string
+		invalid  bool
+	}{
+		{name: "front", entries: "abc", position: 0, inserted: "xy", want: "xyabc"},
+		{name: "middle", entries: "abc", position: 1, inserted: "xy", want: "axybc"},
+		{name: "end", entries: "abc", position: 3, inserted: "x", want: "abcx"},
+		{name: "empty playlist", entries: "", position: 0, inserted: "x", want: "x"},
+		{name: "negative", entries: "abc", position: -1, inserted: "x", invalid: true},
+		{name: "past the end", entries: "abc", position: 4, inserted: "x", invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := insertEntries(testEntries(test.entries), test.position, testEntries(test.inserted))
+			if test.invalid {
+				if !errors.As(err, &custom_error.InvalidPositionError{}) {
+					t.Errorf("insertEntries() error = %v, want InvalidPositionError", err)
+				}
+				return
+			}
+			if err != nil || entryTracks(got) != test.want {
+				t.Errorf("insertEntries() = %q, %v, want %q", entryTracks(got), err, test.want)
+			}
+		})
+	}
+}
+
+func TestRemoveEntries(t *testing.T) {
+	track := func(c byte) uuid.UUID {
+		return uuid.UUID{c}
+	}
+
+	tests := []struct {
+		name        string
+		entries     string
+		occurrences []TrackOccurrence
+		want        string
+		invalid     bool
+	}{
+		{
+			name:        "every occurrence",
+			entries:     "abcab",
+			occurrences: []TrackOccurrence{{TrackID: track('a')}},
+			want:        "bcb",
+		},
+		{
+			name:        "given positions",
+			entries:     "abcab",
+			occurrences: []TrackOccurrence{{TrackID: track('a'), Positions: []int{3}}, {TrackID: track('c'), Positions: []int{2}}},
+			want:        "abb",
+		},
+		{
+			name:        "missing track",
+			entries:     "abc",
+			occurrences: []TrackOccurrence{{TrackID: track('z')}},
+			want:        "abc",
+		},
+		{
+			name:        "position of another track",
+			entries:     "abc",
+			occurrences: []TrackOccurrence{{TrackID: track('a'), Positions: []int{1}}},
+			invalid:     true,
+		},
+		{
+			name:        "position past the end",
+			entries:     "abc",
+			occurrences: []TrackOccurrence{{TrackID: track('a'), Positions: []int{3}}},
+			invalid:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := removeEntries(testEntries(test.entries), test.occurrences)
+			if test.invalid {
+				if !errors.As(err, &custom_error.InvalidPositionError{}) {
+					t.Errorf("removeEntries() error = %v, want InvalidPositionError", err)
+				}
+				return
+			}
+			if err != nil || entryTracks(got) != test.want {
+				t.Errorf("removeEntries() = %q, %v, want %q", entryTracks(got), err, test.want)
+			}
+		})
+	}
+}
+
+func TestMoveEntries(t *testing.T) {
+	tests := []struct {
+		name         string
+		rangeStart   int
+		insertBefore int
+		rangeLength  int
+		want         string
+		invalid      bool
+	}{
+		{name: "forward", rangeStart: 1, insertBefore: 4, rangeLength: 2, want: "adbce"},
+		{name: "backward", rangeStart: 3, insertBefore: 0, rangeLength: 2, want: "deabc"},
+		{name: "to the end", rangeStart: 0, insertBefore: 5, rangeLength: 1, want: "bcdea"},
+		{name: "before itself", rangeStart: 1, insertBefore: 1, rangeLength: 2, want: "abcde"},
+		{name: "inside itself", rangeStart: 1, insertBefore: 2, rangeLength: 2, want: "abcde"},
+		{name: "right after itself", rangeStart: 1, insertBefore: 3, rangeLength: 2, want: "abcde"},
+		{name: "whole list", rangeStart: 0, insertBefore: 0, rangeLength: 5, want: "abcde"},
+		{name: "empty range", rangeStart: 1, insertBefore: 3, rangeLength: 0, invalid: true},
+		{name: "range past the end", rangeStart: 4, insertBefore: 0, rangeLength: 2, invalid: true},
+		{name: "negative start", rangeStart: -1, insertBefore: 0, rangeLength: 1, invalid: true},
+		{name: "insert past the end", rangeStart: 0, insertBefore: 6, rangeLength: 1, invalid: true},
+		{name: "overflowing length", rangeStart: 1, insertBefore: 0, rangeLength: math.MaxInt, invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := moveEntries(testEntries("abcde"), test.rangeStart, test.insertBefore, test.rangeLength)
+			if test.invalid {
+				if !errors.As(err, &custom_error.InvalidPositionError{}) {
+					t.Errorf("moveEntries() error = %v, want InvalidPositionError", err)
+				}
+				return
+			}
+			if err != nil || entryTracks(got) != test.want {
+				t.Errorf("moveEntries() = %q, %v, want %q", entryTracks(got), err, test.want)
+			}
+		})
+	}
+}
+
+func TestDeduplicate(t *testing.T) {
+	identities := map[uuid.UUID]trackIdentity{
+		// a and b are the same recording released twice, c is a live take with its own ISRC
+		{'a'}: {isrc: "USRC17607839", identity: "blue town|1", length: 200},
+		{'b'}: {isrc: "USRC17607839", identity: "blue town|1", length: 230},
+		{'c'}: {isrc: "USRC17607840", identity: "blue town|1", length: 201},
+		// d and e have no ISRC and match a by title, artists and length
+		{'d'}: {identity: "blue town|1", length: 202},
+		{'e'}: {identity: "blue town|1", length: 203},
+		// f is too long to be a, g is by other artists
+		{'f'}: {identity: "blue town|1", length: 260},
+		{'g'}: {identity: "blue town|2", length: 200},
+	}
+
+	tests := []struct {
+		name    string
+		entries string
+		want    string
+	}{
+		{name: "same id", entries: "gxgx", want: "gx"},
+		{name: "same ISRC", entries: "ab", want: "a"},
+		{name: "different ISRC", entries: "ac", want: "ac"},
+		{name: "no ISRC within tolerance", entries: "ad", want: "a"},
+		{name: "no ISRC before an ISRC", entries: "da", want: "d"},
+		{name: "just past the tolerance", entries: "ae", want: "ae"},
+		{name: "length too different", entries: "af", want: "af"},
+		{name: "other artists", entries: "ag", want: "ag"},
+		{name: "tracks without identity", entries: "xyx", want: "xy"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := deduplicate(testEntries(test.entries), identities)
+			if entryTracks(got) != test.want {
+				t.Errorf("deduplicate() = %q, want %q", entryTracks(got), test.want)
+			}
+		})
+	}
+}
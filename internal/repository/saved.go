@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"flotify/internal/custom_error"
+	"flotify/internal/model"
+	"fmt"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// savedTable locates the saves of a type of library item
+type savedTable struct {
+	items  string
+	saves  string
+	column string
+	// missing is returned when the item doesn't exist or isn't saved
+	missing error
+}
+
+var savedTables = map[model.LibraryItemType]savedTable{
+	model.LibraryTrack: {items: "tracks", saves: "saved_tracks", column: "track_id", missing: custom_error.NonExistTrackError{}},
+	model.LibraryAlbum: {items: "albums", saves: "saved_albums", column: "album_id", missing: custom_error.NonExistAlbumError{}},
+}
+
+// savedSelect reads the items saved by the user $1 in the column order of model.SavedItem,
+// a pre-saved item is added to the library at its release. Saved tracks taken down or not licensed in the market $2
+// are relinked to another version of their work when one plays. The placeholders take the condition and the order
+var savedSelect = `
+	SELECT type, id, added_at, release_date, linked_from FROM (
+		SELECT 'track' AS type, COALESCE(r.id, s.track_id) AS id, greatest(s.saved_at, t.release_date) AS added_at, t.release_date,
+			nullif(s.track_id, COALESCE(r.id, s.track_id)) AS linked_from
+		FROM saved_tracks s JOIN tracks t ON t.id = s.track_id
+		LEFT JOIN ` + relinkedTrack("t", "$1", "$2") + ` r ON true
+		WHERE s.user_id = $1
+		UNION ALL
+		SELECT 'album', s.album_id, greatest(s.saved_at, a.release_date), a.release_date, NULL::uuid
+		FROM saved_albums s JOIN albums a ON a.id = s.album_id
+		WHERE s.user_id = $1
+	) saved
+	WHERE %s
+	ORDER BY %s
+`
+
+// GetSavedItems returns the released tracks and albums saved by the user, the last added first.
+// types restricts the items to tracks or albums, tracks are relinked for the market
+func (fr *PostgresFolderRepository) GetSavedItems(ctx context.Context, user_id uuid.UUID, market string, types []model.LibraryItemType) ([]model.SavedItem, error) {
+	type_list := []string{}
+	for _, item_type := range types {
+		if _, ok := savedTables[item_type]; !ok {
+			return nil, custom_error.InvalidSavedItemError{}
+		}
+		type_list = append(type_list, string(item_type))
+	}
+	if len(type_list) == 0 {
+		type_list = []string{string(model.LibraryTrack), string(model.LibraryAlbum)}
+	}
+
+	fetchString := fmt.Sprintf(savedSelect, "(release_date IS NULL OR release_date <= now()) AND type = ANY($3)", "added_at DESC, id")
+	rows, err := fr.dbpool.Query(ctx, fetchString, user_id, market, type_list)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[model.SavedItem])
+}
+
+// GetPresavedItems returns the tracks and albums the user saved before their release, the next release first
+func (fr *PostgresFolderRepository) GetPresavedItems(ctx context.Context, user_id uuid.UUID) ([]model.SavedItem, error) {
+	rows, err := fr.dbpool.Query(ctx, fmt.Sprintf(savedSelect, "release_date > now()", "release_date, id"), user_id, "")
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[model.SavedItem])
+}
+
+// SaveItem saves the track or the album to the library of the user, an item releasing in the future is pre-saved.
+// Saving an item twice keeps the first save
+func (fr *PostgresFolderRepository) SaveItem(ctx context.Context, user_id uuid.UUID, item model.LibraryItem) (*model.SavedItem, error) {
+	table, ok := savedTables[item.Type]
+	if !ok {
+		return nil, custom_error.InvalidSavedItemError{}
+	}
+
+	insertString := fmt.Sprintf(`
+		INSERT INTO %s(user_id, %s) SELECT $1, id FROM %s WHERE id = $2
+		ON CONFLICT DO NOTHING
+	`, table.saves, table.column, table.items)
+	if _, err := fr.dbpool.Exec(ctx, insertString, user_id, item.ID); err != nil {
+		return nil, err
+	}
+
+	fetchString := fmt.Sprintf(savedSelect, "type = $3 AND COALESCE(linked_from, id) = $4", "id")
+	rows, err := fr.dbpool.Query(ctx, fetchString, user_id, "", string(item.Type), item.ID)
+	if err != nil {
+		return nil, err
+	}
+	saved_item, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByPos[model.SavedItem])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, table.missing
+		}
+		return nil, err
+	}
+	return &saved_item, nil
+}
+
+// UnsaveItem removes the track or the album from the library of the user, or cancels its pre-save
+func (fr *PostgresFolderRepository) UnsaveItem(ctx context.Context, user_id uuid.UUID, item model.LibraryItem) error {
+	table, ok := savedTables[item.Type]
+	if !ok {
+		return custom_error.InvalidSavedItemError{}
+	}
+
+	deleteString := fmt.Sprintf("DELETE FROM %s WHERE user_id = $1 AND %s = $2", table.saves, table.column)
+	tag, err := fr.dbpool.Exec(ctx, deleteString, user_id, item.ID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return table.missing
+	}
+	return nil
+}
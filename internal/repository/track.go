@@ -2,8 +2,15 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"flotify/internal/audio"
+	"flotify/internal/custom_error"
+	"flotify/internal/lyrics"
 	"flotify/internal/model"
+	"flotify/internal/playlistfile"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid/v5"
@@ -13,14 +20,30 @@ import (
 
 type TrackRepository interface {
 	GetTrackByID(ctx context.Context, id uuid.UUID) (*model.Track, error)
+	CheckTrackAvailable(ctx context.Context, id uuid.UUID, viewer_id uuid.UUID, market string) error
 	GetTracksWithFilter(ctx context.Context, filter Filter) ([]model.Track, error)
 	CreateTrack(ctx context.Context, track *model.Track) (*model.Track, error)
+	ImportTrack(ctx context.Context, track *model.Track) (*model.Track, error)
 	CreateTracks(ctx context.Context, tracks []*model.Track) ([]*model.Track, error)
-	UpdateTrack(ctx context.Context, track *model.Track) error
+	UpdateTrack(ctx context.Context, update TrackUpdate) (*model.Track, error)
 	ParitalUpdateTrack(ctx context.Context, track *model.Track) error
 	DeleteTrack(ctx context.Context, id uuid.UUID) error
 	DeleteTracks(ctx context.Context, id_list []uuid.UUID) error
 	GetArtistOfTrack(ctx context.Context, id uuid.UUID) ([]uuid.UUID, error)
+	SetCreditsOfTrack(ctx context.Context, track_id uuid.UUID, credits []model.Credit) ([]model.Credit, error)
+	GetVersionsOfTrack(ctx context.Context, track_id uuid.UUID, viewer_id uuid.UUID, market string) ([]model.Track, error)
+	SetVersionsOfTrack(ctx context.Context, track_id uuid.UUID, versions []model.TrackOfWork) ([]model.Track, error)
+	SetTakedownOfTrack(ctx context.Context, track_id uuid.UUID, removed bool) error
+	MatchTracks(ctx context.Context, entries []playlistfile.Entry) ([]uuid.UUID, error)
+	GetAudioOfTrack(ctx context.Context, track_id uuid.UUID) (*model.TrackAudio, error)
+	SetAudioOfTrack(ctx context.Context, track_id uuid.UUID, audio model.TrackAudio) (*model.TrackAudio, error)
+	GetWaveformOfTrack(ctx context.Context, track_id uuid.UUID) (*model.Waveform, error)
+	GetTracksWithoutWaveform(ctx context.Context) ([]uuid.UUID, error)
+	SetWaveformOfTrack(ctx context.Context, track_id uuid.UUID, checksum string, waveform [][2]float64) error
+	RecordStreamStart(ctx context.Context, user_id uuid.UUID, track_id uuid.UUID) error
+	GetLyricsOfTrack(ctx context.Context, track_id uuid.UUID) (*model.Lyrics, error)
+	SetLyricsOfTrack(ctx context.Context, track_id uuid.UUID, lyrics model.Lyrics) (*model.Lyrics, error)
+	DeleteLyricsOfTrack(ctx context.Context, track_id uuid.UUID) error
 }
 
 type PostgresTrackRepository struct {
@@ -34,13 +57,16 @@ func NewPostgresTrackRepository(dbpool *pgxpool.Pool) *PostgresTrackRepository {
 }
 
 func (tr *PostgresTrackRepository) GetTrackByID(ctx context.Context, id uuid.UUID) (*model.Track, error) {
-	row := tr.dbpool.QueryRow(ctx, "select id, name, length from tracks where id=$1", id)
+	row := tr.dbpool.QueryRow(ctx, "select id, name, length, COALESCE(isrc, ''), explicit, release_date, markets, work_id, version from tracks where id=$1", id)
 
 	track := model.Track{}
 
 	uuid_byte := []byte{}
-	err := row.Scan(&uuid_byte, &track.Name, &track.Length)
+	err := row.Scan(&uuid_byte, &track.Name, &track.Length, &track.ISRC, &track.Explicit, &track.ReleaseDate, &track.Markets, &track.WorkID, &track.Version)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistTrackError{}
+		}
 		return nil, err
 	}
 
@@ -49,28 +75,157 @@ func (tr *PostgresTrackRepository) GetTrackByID(ctx context.Context, id uuid.UUI
 		return nil, err
 	}
 	track.ID = id
+
+	track.Credits, err = creditsOf(ctx, tr.dbpool, id)
+	if err != nil {
+		return nil, err
+	}
+	track.ArtistLine = artistLine(track.Credits)
+
+	track.Audio, err = tr.GetAudioOfTrack(ctx, id)
+	if err != nil {
+		if _, ok := err.(custom_error.NonExistTrackAudioError); !ok {
+			return nil, err
+		}
+	}
+
+	track.Genres, err = genresOf(ctx, tr.dbpool, model.TaxonomyTrack, id)
+	if err != nil {
+		return nil, err
+	}
+	track.Tags, err = tagsOf(ctx, tr.dbpool, model.TaxonomyTrack, id)
+	if err != nil {
+		return nil, err
+	}
 	return &track, nil
 }
 
+// trackSortColumns are the fields tracks can be sorted by, popularity is the number of playlists containing the track
+var trackSortColumns = map[string]string{
+	"name":         "t.name",
+	"length":       "t.length",
+	"created_at":   "t.created_at",
+	"release_date": "t.release_date",
+	"popularity":   "(SELECT count(*) FROM playlists_tracks pt WHERE pt.track_id = t.id)",
+}
+
+// explicitAllowed is the condition hiding the explicit tracks of alias from viewers who chose so,
+// its placeholder takes the id of the viewer
+func explicitAllowed(alias string) string {
+	return fmt.Sprintf("NOT (%s.explicit AND EXISTS (SELECT 1 FROM users u WHERE u.id = %%s AND u.hide_explicit))", alias)
+}
+
+// trackReleasedTo is the condition hiding the tracks of alias released in the future from the viewer of its placeholder,
+// unless the viewer is an admin or the account of one of their primary artists
+func trackReleasedTo(alias string) string {
+	return fmt.Sprintf(`(%[1]s.release_date IS NULL OR %[1]s.release_date <= now() OR EXISTS (
+		SELECT 1 FROM users u WHERE u.id = %%s AND (u.is_admin OR EXISTS (
+			SELECT 1 FROM artists_tracks rx JOIN artists ra ON ra.id = rx.artist_id
+			WHERE rx.track_id = %[1]s.id AND rx.role = 'primary' AND ra.user_id = u.id
+		))
+	))`, alias)
+}
+
+// CheckTrackAvailable returns NonExistTrackError when the track doesn't exist, is taken down or isn't released to the viewer yet,
+// and UnavailableInMarketError when it isn't licensed in the market
+func (tr *PostgresTrackRepository) CheckTrackAvailable(ctx context.Context, id uuid.UUID, viewer_id uuid.UUID, market string) error {
+	checkString := "SELECT t.removed_at IS NULL AND " + fmt.Sprintf(trackReleasedTo("t"), "$2") + ", " + fmt.Sprintf(availableIn("t"), "$3") + " FROM tracks t WHERE t.id = $1"
+	var released, available bool
+	if err := tr.dbpool.QueryRow(ctx, checkString, id, viewer_id, market).Scan(&released, &available); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return custom_error.NonExistTrackError{}
+		}
+		return err
+	}
+	if !released {
+		return custom_error.NonExistTrackError{}
+	}
+	if !available {
+		return custom_error.UnavailableInMarketError{Market: market}
+	}
+	return nil
+}
+
+// GetTracksWithFilter hides the tracks taken down, not released to the viewer of the filter or not licensed in its market,
+// and the explicit ones when the viewer chose so. It understands the following props:
+// name (full text search), artist_id ([]uuid.UUID of primary or featured artists), followed_by (uuid.UUID of a user following the artists),
+// min_length and max_length (int, seconds), added_after (time.Time), isrc (string),
+// genre ([]string of slugs, descendants included), tag ([]string, all required) and lyrics (full text search)
 func (tr *PostgresTrackRepository) GetTracksWithFilter(ctx context.Context, filter Filter) ([]model.Track, error) {
 
-	sort_criteria := filter.GetSortCriteria()
+	sort_criteria, err := filter.GetSortCriteriaOf(trackSortColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	qb := queryBuilder{}
+	if name, ok := filter.Props["name"].(string); ok && name != "" {
+		qb.Where("to_tsvector('simple', t.name) @@ plainto_tsquery('simple', %s)", name)
+	}
+	if artist_id_list, ok := filter.Props["artist_id"].([]uuid.UUID); ok && len(artist_id_list) > 0 {
+		qb.Where("EXISTS (SELECT 1 FROM artists_tracks at WHERE at.track_id = t.id AND at.role IN ('primary', 'featured') AND at.artist_id = ANY(%s))", artist_id_list)
+	}
+	if user_id, ok := filter.Props["followed_by"].(uuid.UUID); ok {
+		qb.Where(`EXISTS (
+			SELECT 1 FROM artists_tracks at
+			JOIN artists_users au ON au.artist_id = at.artist_id
+			WHERE at.track_id = t.id AND at.role IN ('primary', 'featured') AND au.user_id = %s
+		)`, user_id)
+	}
+	if min_length, ok := filter.Props["min_length"].(int); ok && min_length > 0 {
+		qb.Where("t.length >= %s", min_length)
+	}
+	if max_length, ok := filter.Props["max_length"].(int); ok && max_length > 0 {
+		qb.Where("t.length <= %s", max_length)
+	}
+	if added_after, ok := filter.Props["added_after"].(time.Time); ok {
+		qb.Where("t.created_at >= %s", added_after)
+	}
+	if isrc, ok := filter.Props["isrc"].(string); ok && isrc != "" {
+		normalized, err := normalizeISRC(isrc)
+		if err != nil {
+			return nil, err
+		}
+		qb.Where("t.isrc = %s", normalized)
+	}
+	if text, ok := filter.Props["lyrics"].(string); ok && text != "" {
+		qb.Where("EXISTS (SELECT 1 FROM tracks_lyrics l WHERE l.track_id = t.id AND to_tsvector('simple', l.text) @@ plainto_tsquery('simple', %s))", text)
+	}
+	if genres, ok := filter.Props["genre"].([]string); ok && len(genres) > 0 {
+		whereGenre(&qb, model.TaxonomyTrack, "t.id", genres)
+	}
+	if filter.ViewerID != uuid.Nil {
+		qb.Where(explicitAllowed("t"), filter.ViewerID)
+	}
+	qb.Where("t.removed_at IS NULL")
+	qb.Where(trackReleasedTo("t"), filter.ViewerID)
+	if filter.Market != "" {
+		qb.Where(availableIn("t"), filter.Market)
+	}
+	if tags, ok := filter.Props["tag"].([]string); ok && len(tags) > 0 {
+		whereTag(&qb, model.TaxonomyTrack, "t.id", tags)
+	}
+
 	fetchString := fmt.Sprintf(`
-		select id, name, length from tracks
-		where (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		order by %s id ASC
-		limit $2 offset $3
-	`, sort_criteria)
+		select t.id, t.name, t.length, COALESCE(t.isrc, '') AS isrc, t.explicit, t.release_date, t.markets from tracks t
+		where %s
+		order by %s t.id ASC
+		limit %s offset %s
+	`, qb.Condition(), sort_criteria, qb.Arg(filter.Limit), qb.Arg(filter.GetOffSet()))
 
-	rows, err := tr.dbpool.Query(ctx, fetchString, filter.Props["name"], filter.Limit, filter.GetOffSet())
+	rows, err := tr.dbpool.Query(ctx, fetchString, qb.args...)
 	if err != nil {
 		return nil, err
 	}
 
 	type OnlyTrackInfo struct {
-		ID     uuid.UUID
-		Name   string
-		Length int
+		ID          uuid.UUID
+		Name        string
+		Length      int
+		ISRC        string
+		Explicit    bool
+		ReleaseDate *time.Time
+		Markets     []string
 	}
 	onlytracks, err := pgx.CollectRows(rows, pgx.RowToStructByName[OnlyTrackInfo])
 	if err != nil {
@@ -84,17 +239,41 @@ func (tr *PostgresTrackRepository) GetTracksWithFilter(ctx context.Context, filt
 			return nil, err
 		}
 		track := model.Track{
-			ID:       ot.ID,
-			Name:     ot.Name,
-			Length:   ot.Length,
-			ArtistID: artists_id,
+			ID:          ot.ID,
+			Name:        ot.Name,
+			Length:      ot.Length,
+			ArtistID:    artists_id,
+			ISRC:        ot.ISRC,
+			Explicit:    ot.Explicit,
+			ReleaseDate: ot.ReleaseDate,
+			Markets:     ot.Markets,
 		}
 		tracks = append(tracks, track)
 	}
 	return tracks, nil
 }
 
+// CreateTrack inserts a track, DuplicateIdentifierError when its ISRC belongs to another track
 func (tr *PostgresTrackRepository) CreateTrack(ctx context.Context, track *model.Track) (*model.Track, error) {
+	return tr.createTrack(ctx, track, false)
+}
+
+// ImportTrack inserts a track, or updates the track with the same ISRC so repeated imports don't duplicate it
+func (tr *PostgresTrackRepository) ImportTrack(ctx context.Context, track *model.Track) (*model.Track, error) {
+	return tr.createTrack(ctx, track, true)
+}
+
+func (tr *PostgresTrackRepository) createTrack(ctx context.Context, track *model.Track, upsert bool) (*model.Track, error) {
+	isrc, err := normalizeISRC(track.ISRC)
+	if err != nil {
+		return nil, err
+	}
+	track.ISRC = isrc
+	track.Markets, err = normalizeMarkets(track.Markets)
+	if err != nil {
+		return nil, err
+	}
+
 	tx, err := tr.dbpool.Begin(ctx)
 	if err != nil {
 		return nil, err
@@ -104,15 +283,33 @@ func (tr *PostgresTrackRepository) CreateTrack(ctx context.Context, track *model
 	context, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	insertString := "INSERT INTO tracks(name, length) VALUES ($1, $2) RETURNING id"
+	// as in UpdateTrack the length of uploaded audio wins over the given one
+	conflictString := "ON CONFLICT (isrc) DO NOTHING"
+	if upsert {
+		conflictString = `ON CONFLICT (isrc) DO UPDATE SET name = EXCLUDED.name, explicit = EXCLUDED.explicit, release_date = EXCLUDED.release_date,
+			markets = EXCLUDED.markets,
+			length = COALESCE((select round(duration_ms / 1000.0)::int from tracks_audio where track_id = tracks.id and duration_ms > 0), EXCLUDED.length)`
+	}
+	insertString := `
+		INSERT INTO tracks(name, length, isrc, explicit, release_date, markets) VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)
+		` + conflictString + `
+		RETURNING id, length
+	`
 	args := []any{
 		track.Name,
 		track.Length,
+		track.ISRC,
+		track.Explicit,
+		track.ReleaseDate,
+		track.Markets,
 	}
 	row := tx.QueryRow(context, insertString, args...)
 
 	uuid_byte := []byte{}
-	if err = row.Scan(&uuid_byte); err != nil {
+	if err = row.Scan(&uuid_byte, &track.Length); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.DuplicateIdentifierError{Kind: "ISRC", Value: track.ISRC}
+		}
 		return nil, err
 	}
 
@@ -121,9 +318,16 @@ func (tr *PostgresTrackRepository) CreateTrack(ctx context.Context, track *model
 		return nil, err
 	}
 
-	insert_xref_string := "INSERT INTO artists_tracks(artist_id, track_id) VALUES ($1, $2)"
-	for _, artist_id := range track.ArtistID {
-		_, err = tx.Exec(ctx, insert_xref_string, artist_id, track.ID)
+	// the given artists become the primary artists of an upserted track, its other credits are kept
+	if _, err = tx.Exec(ctx, "DELETE FROM artists_tracks WHERE track_id = $1 AND role = 'primary'", track.ID); err != nil {
+		return nil, err
+	}
+	insert_xref_string := `
+		INSERT INTO artists_tracks(artist_id, track_id, role, position) VALUES ($1, $2, 'primary', $3)
+		ON CONFLICT DO NOTHING
+	`
+	for position, artist_id := range track.ArtistID {
+		_, err = tx.Exec(ctx, insert_xref_string, artist_id, track.ID, position)
 		if err != nil {
 			return nil, err
 		}
@@ -170,18 +374,78 @@ func (tr *PostgresTrackRepository) CreateTracks(ctx context.Context, tracks []*m
 	return tracks, nil
 }
 
-func (tr *PostgresTrackRepository) UpdateTrack(ctx context.Context, track *model.Track) error {
-	args := []any{
-		track.ID,
-		track.Name,
-		track.Length,
+// TrackUpdate holds the fields UpdateTrack changes, nil fields keep their value.
+// ReleaseDate and Markets are only changed when their Set flag is true as a nil date releases the track
+// and nil markets license it everywhere
+type TrackUpdate struct {
+	ID             uuid.UUID
+	Name           *string
+	Length         *int
+	ISRC           *string
+	Explicit       *bool
+	SetReleaseDate bool
+	ReleaseDate    *time.Time
+	SetMarkets     bool
+	Markets        []string
+}
+
+// UpdateTrack changes the fields of the update and returns the track, NonExistTrackError when it doesn't exist
+// and DuplicateIdentifierError when the ISRC belongs to another track
+func (tr *PostgresTrackRepository) UpdateTrack(ctx context.Context, update TrackUpdate) (*model.Track, error) {
+	qb := queryBuilder{}
+	id := qb.Arg(update.ID)
+	sets := []string{}
+
+	if update.Name != nil {
+		sets = append(sets, "name = "+qb.Arg(*update.Name))
 	}
-	_, err := tr.dbpool.Exec(ctx, "update tracks set name = $2, length = $3 where id = $1", args...)
-	if err != nil {
-		return err
+	if update.Length != nil {
+		// once audio is uploaded the length comes from the decoded stream, not from clients
+		sets = append(sets, fmt.Sprintf("length = COALESCE((select round(duration_ms / 1000.0)::int from tracks_audio where track_id = %s and duration_ms > 0), %s)", id, qb.Arg(*update.Length)))
+	}
+	if update.ISRC != nil {
+		isrc, err := normalizeISRC(*update.ISRC)
+		if err != nil {
+			return nil, err
+		}
+		if isrc != "" {
+			var taken bool
+			err := tr.dbpool.QueryRow(ctx, "select exists (select 1 from tracks where isrc = $2 and id <> $1)", update.ID, isrc).Scan(&taken)
+			if err != nil {
+				return nil, err
+			}
+			if taken {
+				return nil, custom_error.DuplicateIdentifierError{Kind: "ISRC", Value: isrc}
+			}
+		}
+		sets = append(sets, fmt.Sprintf("isrc = NULLIF(%s, '')", qb.Arg(isrc)))
+	}
+	if update.Explicit != nil {
+		sets = append(sets, "explicit = "+qb.Arg(*update.Explicit))
+	}
+	if update.SetReleaseDate {
+		sets = append(sets, "release_date = "+qb.Arg(update.ReleaseDate))
+	}
+	if update.SetMarkets {
+		markets, err := normalizeMarkets(update.Markets)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, "markets = "+qb.Arg(markets))
 	}
 
-	return nil
+	if len(sets) > 0 {
+		updateString := fmt.Sprintf("update tracks set %s where id = %s", strings.Join(sets, ", "), id)
+		tag, err := tr.dbpool.Exec(ctx, updateString, qb.args...)
+		if err != nil {
+			return nil, err
+		}
+		if tag.RowsAffected() == 0 {
+			return nil, custom_error.NonExistTrackError{}
+		}
+	}
+
+	return tr.GetTrackByID(ctx, update.ID)
 }
 
 func (tr *PostgresTrackRepository) ParitalUpdateTrack(ctx context.Context, track *model.Track) error {
@@ -232,8 +496,13 @@ func (tr *PostgresTrackRepository) DeleteTracks(ctx context.Context, id_list []u
 	return nil
 }
 
+// GetArtistOfTrack returns the primary then the featured artists of the track
 func (tr *PostgresTrackRepository) GetArtistOfTrack(ctx context.Context, id uuid.UUID) ([]uuid.UUID, error) {
-	fetchString := "select artist_id from artists_tracks where track_id = $1"
+	fetchString := `
+		select artist_id from artists_tracks
+		where track_id = $1 and role in ('primary', 'featured')
+		order by role = 'featured', position
+	`
 	rows, err := tr.dbpool.Query(ctx, fetchString, id)
 	if err != nil {
 		return nil, err
@@ -254,3 +523,349 @@ func (tr *PostgresTrackRepository) GetArtistOfTrack(ctx context.Context, id uuid
 	}
 	return id_list, nil
 }
+
+// MatchTracks finds the catalog track of every entry of a playlist file, uuid.Nil marks an unmatched entry.
+// Entries referencing an existing track by id are matched directly, the others by artist, title and length
+func (tr *PostgresTrackRepository) MatchTracks(ctx context.Context, entries []playlistfile.Entry) ([]uuid.UUID, error) {
+	id_list := []uuid.UUID{}
+	for _, entry := range entries {
+		if !entry.TrackID.IsNil() {
+			id_list = append(id_list, entry.TrackID)
+		}
+	}
+
+	rows, err := tr.dbpool.Query(ctx, "SELECT id FROM tracks WHERE id = ANY($1)", id_list)
+	if err != nil {
+		return nil, err
+	}
+	exist_id_list, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, err
+	}
+	exist := make(map[uuid.UUID]bool, len(exist_id_list))
+	for _, id := range exist_id_list {
+		exist[id] = true
+	}
+
+	matched_id_list := make([]uuid.UUID, len(entries))
+	for i, entry := range entries {
+		if exist[entry.TrackID] {
+			matched_id_list[i] = entry.TrackID
+			continue
+		}
+		if entry.SearchTitle() == "" {
+			continue
+		}
+
+		candidates, err := tr.getMatchCandidates(ctx, entry)
+		if err != nil {
+			return nil, err
+		}
+		matched_id_list[i], _ = playlistfile.BestMatch(entry, candidates)
+	}
+
+	return matched_id_list, nil
+}
+
+// getMatchCandidates returns tracks sharing words with the title or the artist of the entry
+func (tr *PostgresTrackRepository) getMatchCandidates(ctx context.Context, entry playlistfile.Entry) ([]playlistfile.Candidate, error) {
+	fetchString := `
+		SELECT t.id, t.name, t.length,
+			COALESCE(array_agg(a.name) FILTER (WHERE a.name IS NOT NULL), '{}') AS artists
+		FROM tracks t
+		LEFT JOIN artists_tracks at ON at.track_id = t.id AND at.role IN ('primary', 'featured')
+		LEFT JOIN artists a ON a.id = at.artist_id
+		WHERE t.id IN (
+			SELECT id FROM tracks
+			WHERE to_tsvector('simple', name) @@ plainto_tsquery('simple', $1)
+			UNION
+			SELECT at.track_id FROM artists_tracks at
+			JOIN artists a ON a.id = at.artist_id
+			WHERE $2 <> '' AND at.role IN ('primary', 'featured') AND to_tsvector('simple', a.name) @@ plainto_tsquery('simple', $2)
+		)
+		GROUP BY t.id
+		LIMIT 200
+	`
+	rows, err := tr.dbpool.Query(ctx, fetchString, entry.SearchTitle(), entry.Artist)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[playlistfile.Candidate])
+}
+
+// trackAudioSelect lists the columns of tracks_audio in the order of the fields of model.TrackAudio
+const trackAudioSelect = `format, codec, size, bitrate, duration_ms, checksum, uploaded_at, tags,
+	artwork_key IS NOT NULL, storage_key, COALESCE(artwork_key, ''), loudness, loudness_histogram`
+
+// GetAudioOfTrack returns the audio file uploaded for the track, custom_error.NonExistTrackAudioError when there is none
+func (tr *PostgresTrackRepository) GetAudioOfTrack(ctx context.Context, track_id uuid.UUID) (*model.TrackAudio, error) {
+	rows, err := tr.dbpool.Query(ctx, "SELECT "+trackAudioSelect+" FROM tracks_audio WHERE track_id = $1", track_id)
+	if err != nil {
+		return nil, err
+	}
+
+	track_audio, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByPos[model.TrackAudio])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistTrackAudioError{}
+		}
+		return nil, err
+	}
+
+	if track_audio.Loudness != nil {
+		if err := tr.measureAlbumLoudness(ctx, track_id, track_audio.Loudness); err != nil {
+			return nil, err
+		}
+	}
+	return track_audio, nil
+}
+
+// measureAlbumLoudness sets the album gain and peak of the loudness of the track, from the analyzed tracks
+// of the first album released with it. Tracks on no album are left without them
+func (tr *PostgresTrackRepository) measureAlbumLoudness(ctx context.Context, track_id uuid.UUID, loudness *model.Loudness) error {
+	fetchString := `
+		SELECT ta.loudness_histogram, (ta.loudness->>'TrackPeak')::float8 FROM albums_tracks x
+		JOIN tracks_audio ta ON ta.track_id = x.track_id
+		WHERE ta.loudness_histogram IS NOT NULL AND x.album_id = (
+			SELECT at.album_id FROM albums_tracks at JOIN albums a ON a.id = at.album_id
+			WHERE at.track_id = $1
+			ORDER BY a.release_date NULLS LAST, a.created_at, a.id
+			LIMIT 1
+		)
+	`
+	rows, err := tr.dbpool.Query(ctx, fetchString, track_id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	histograms := [][]int{}
+	peak := 0.0
+	for rows.Next() {
+		var histogram []int
+		var track_peak float64
+		if err := rows.Scan(&histogram, &track_peak); err != nil {
+			return err
+		}
+		histograms = append(histograms, histogram)
+		peak = max(peak, track_peak)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(histograms) == 0 {
+		return nil
+	}
+
+	gain := math.Round(audio.ReplayGain(audio.IntegratedLoudness(histograms...))*100) / 100
+	loudness.AlbumGain = &gain
+	loudness.AlbumPeak = &peak
+	return nil
+}
+
+// SetAudioOfTrack records the audio file uploaded for the track, replacing the previous one.
+// The length of the track becomes the duration of the audio, an unnamed track takes the title of the tags
+// and a track without artists is credited to the catalog artists named by the tags
+func (tr *PostgresTrackRepository) SetAudioOfTrack(ctx context.Context, track_id uuid.UUID, audio model.TrackAudio) (*model.TrackAudio, error) {
+	tx, err := tr.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	upsertString := `
+		INSERT INTO tracks_audio(track_id, storage_key, format, codec, size, bitrate, duration_ms, checksum, tags, artwork_key, loudness, loudness_histogram, waveform)
+		SELECT id, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11, $12, $13 FROM tracks WHERE id = $1
+		ON CONFLICT (track_id) DO UPDATE SET
+			storage_key = EXCLUDED.storage_key,
+			format = EXCLUDED.format,
+			codec = EXCLUDED.codec,
+			size = EXCLUDED.size,
+			bitrate = EXCLUDED.bitrate,
+			duration_ms = EXCLUDED.duration_ms,
+			checksum = EXCLUDED.checksum,
+			tags = EXCLUDED.tags,
+			artwork_key = EXCLUDED.artwork_key,
+			loudness = EXCLUDED.loudness,
+			loudness_histogram = EXCLUDED.loudness_histogram,
+			waveform = EXCLUDED.waveform,
+			uploaded_at = now()
+		RETURNING ` + trackAudioSelect
+	args := []any{
+		track_id,
+		audio.StorageKey,
+		audio.Format,
+		audio.Codec,
+		audio.Size,
+		audio.Bitrate,
+		audio.DurationMs,
+		audio.Checksum,
+		audio.Tags,
+		audio.ArtworkKey,
+		audio.Loudness,
+		audio.LoudnessHistogram,
+		audio.Waveform,
+	}
+	rows, err := tx.Query(ctx, upsertString, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	track_audio, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByPos[model.TrackAudio])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistTrackError{}
+		}
+		return nil, err
+	}
+
+	tags := model.AudioTags{}
+	if audio.Tags != nil {
+		tags = *audio.Tags
+	}
+
+	updateString := `
+		UPDATE tracks SET
+			length = CASE WHEN $2 > 0 THEN round($2 / 1000.0)::int ELSE length END,
+			name = CASE WHEN name = '' AND $3 <> '' THEN $3 ELSE name END
+		WHERE id = $1
+	`
+	if _, err = tx.Exec(ctx, updateString, track_id, audio.DurationMs, tags.Title); err != nil {
+		return nil, err
+	}
+
+	if len(tags.Artists) > 0 {
+		artist_names := make([]string, len(tags.Artists))
+		for i, name := range tags.Artists {
+			artist_names[i] = strings.ToLower(name)
+		}
+		linkString := `
+			INSERT INTO artists_tracks(artist_id, track_id, role, position)
+			SELECT a.id, $1::uuid, 'primary', min(x.position) - 1 FROM artists a
+			JOIN unnest($2::text[]) WITH ORDINALITY AS x(name, position) ON lower(a.name) = x.name
+			WHERE NOT EXISTS (SELECT 1 FROM artists_tracks WHERE track_id = $1 AND role IN ('primary', 'featured'))
+			GROUP BY a.id
+		`
+		if _, err = tx.Exec(ctx, linkString, track_id, artist_names); err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return track_audio, nil
+}
+
+// GetWaveformOfTrack returns the waveform of the audio uploaded for the track, custom_error.NonExistTrackAudioError
+// when there is no audio and custom_error.NonExistWaveformError when it wasn't analyzed
+func (tr *PostgresTrackRepository) GetWaveformOfTrack(ctx context.Context, track_id uuid.UUID) (*model.Waveform, error) {
+	waveform := model.Waveform{}
+	codec := ""
+	err := tr.dbpool.QueryRow(ctx, "SELECT duration_ms, codec, waveform FROM tracks_audio WHERE track_id = $1", track_id).Scan(&waveform.DurationMs, &codec, &waveform.Peaks)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistTrackAudioError{}
+		}
+		return nil, err
+	}
+	if waveform.Peaks == nil {
+		return nil, custom_error.NonExistWaveformError{}
+	}
+	waveform.Points = len(waveform.Peaks)
+	waveform.Estimated = audio.EstimatedWaveform(codec)
+	return &waveform, nil
+}
+
+// GetTracksWithoutWaveform returns the tracks whose audio has no waveform, oldest uploads first
+func (tr *PostgresTrackRepository) GetTracksWithoutWaveform(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := tr.dbpool.Query(ctx, "SELECT track_id FROM tracks_audio WHERE waveform IS NULL ORDER BY uploaded_at")
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+}
+
+// SetWaveformOfTrack stores the waveform drawn from the audio with the given checksum,
+// custom_error.NonExistTrackAudioError when the track has no audio or it was replaced in the meantime
+func (tr *PostgresTrackRepository) SetWaveformOfTrack(ctx context.Context, track_id uuid.UUID, checksum string, waveform [][2]float64) error {
+	result, err := tr.dbpool.Exec(ctx, "UPDATE tracks_audio SET waveform = $3 WHERE track_id = $1 AND checksum = $2", track_id, checksum, waveform)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return custom_error.NonExistTrackAudioError{}
+	}
+	return nil
+}
+
+// RecordStreamStart adds the start of a stream of the track by the user to the listening history
+func (tr *PostgresTrackRepository) RecordStreamStart(ctx context.Context, user_id uuid.UUID, track_id uuid.UUID) error {
+	_, err := tr.dbpool.Exec(ctx, "INSERT INTO listening_history(user_id, track_id) VALUES ($1, $2)", user_id, track_id)
+	return err
+}
+
+const lyricsSelect = "track_id, synced, language, lines, updated_at"
+
+func scanLyrics(row pgx.Row) (*model.Lyrics, error) {
+	track_lyrics := model.Lyrics{}
+	err := row.Scan(&track_lyrics.TrackID, &track_lyrics.Synced, &track_lyrics.Language, &track_lyrics.Lines, &track_lyrics.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &track_lyrics, nil
+}
+
+// GetLyricsOfTrack returns the lyrics of the track, custom_error.NonExistLyricsError when it has none
+func (tr *PostgresTrackRepository) GetLyricsOfTrack(ctx context.Context, track_id uuid.UUID) (*model.Lyrics, error) {
+	track_lyrics, err := scanLyrics(tr.dbpool.QueryRow(ctx, "SELECT "+lyricsSelect+" FROM tracks_lyrics WHERE track_id = $1", track_id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistLyricsError{}
+		}
+		return nil, err
+	}
+	return track_lyrics, nil
+}
+
+// SetLyricsOfTrack replaces the lyrics of the track
+func (tr *PostgresTrackRepository) SetLyricsOfTrack(ctx context.Context, track_id uuid.UUID, track_lyrics model.Lyrics) (*model.Lyrics, error) {
+	upsertString := `
+		INSERT INTO tracks_lyrics(track_id, synced, language, text, lines)
+		SELECT id, $2, $3, $4, $5 FROM tracks WHERE id = $1
+		ON CONFLICT (track_id) DO UPDATE SET
+			synced = EXCLUDED.synced,
+			language = EXCLUDED.language,
+			text = EXCLUDED.text,
+			lines = EXCLUDED.lines,
+			updated_at = now()
+		RETURNING ` + lyricsSelect
+	args := []any{
+		track_id,
+		track_lyrics.Synced,
+		track_lyrics.Language,
+		lyrics.Text(track_lyrics),
+		track_lyrics.Lines,
+	}
+	stored_lyrics, err := scanLyrics(tr.dbpool.QueryRow(ctx, upsertString, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistTrackError{}
+		}
+		return nil, err
+	}
+	return stored_lyrics, nil
+}
+
+func (tr *PostgresTrackRepository) DeleteLyricsOfTrack(ctx context.Context, track_id uuid.UUID) error {
+	tag, err := tr.dbpool.Exec(ctx, "DELETE FROM tracks_lyrics WHERE track_id = $1", track_id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return custom_error.NonExistLyricsError{}
+	}
+	return nil
+}
@@ -2,12 +2,14 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"flotify/internal/custom_error"
 	"flotify/internal/model"
 	"fmt"
 	"time"
 
 	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -16,11 +18,13 @@ type UserRepository interface {
 	GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error)
 	CreateUser(ctx context.Context, user *model.User) (*model.User, error)
 	UpdateUserInfo(ctx context.Context, user *model.User) error
+	UpdatePreferences(ctx context.Context, id uuid.UUID, preferences Preferences) (*model.User, error)
 	UpdatePassword(ctx context.Context, id uuid.UUID, new_password, old_password string) error
 	DeleteUser(ctx context.Context, id uuid.UUID) error
 	GetFollowArtist(ctx context.Context, id uuid.UUID) ([]model.Artist, error)
 	UserLogin(ctx context.Context, email string, password string) (*uuid.UUID, error)
 	FollowArtist(ctx context.Context, user_id uuid.UUID, artist_id uuid.UUID) error
+	CanEditCatalogItem(ctx context.Context, user_id uuid.UUID, target model.TaxonomyTarget, item_id uuid.UUID) (bool, error)
 }
 
 type PostgresUserRepository struct {
@@ -34,11 +38,14 @@ func NewPostgresUserRepository(dbpool *pgxpool.Pool) *PostgresUserRepository {
 }
 
 func (ur *PostgresUserRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
-	row := ur.dbpool.QueryRow(ctx, "select username, email from users where id=$1", id)
+	row := ur.dbpool.QueryRow(ctx, "select username, email, hide_explicit, is_admin, country from users where id=$1", id)
 
 	user := model.User{ID: id}
-	err := row.Scan(&user.Username, &user.Email)
+	err := row.Scan(&user.Username, &user.Email, &user.HideExplicit, &user.IsAdmin, &user.Country)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistUserError{}
+		}
 		return nil, err
 	}
 
@@ -120,6 +127,40 @@ func (tr *PostgresUserRepository) UpdateUserInfo(ctx context.Context, user *mode
 	return nil
 }
 
+// this function need authentication
+// Preferences holds the preferences UpdatePreferences changes, nil fields keep their value
+type Preferences struct {
+	HideExplicit *bool
+	// Country is the market of the user, an empty country means no market
+	Country *string
+}
+
+// UpdatePreferences stores the preferences of the user and returns the user
+func (ur *PostgresUserRepository) UpdatePreferences(ctx context.Context, id uuid.UUID, preferences Preferences) (*model.User, error) {
+	var country *string
+	if preferences.Country != nil {
+		normalized := *preferences.Country
+		if normalized != "" {
+			var err error
+			normalized, err = NormalizeMarket(normalized)
+			if err != nil {
+				return nil, err
+			}
+		}
+		country = &normalized
+	}
+
+	tag, err := ur.dbpool.Exec(ctx, "update users set hide_explicit = COALESCE($2, hide_explicit), country = COALESCE($3, country) where id = $1", id, preferences.HideExplicit, country)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, custom_error.NonExistUserError{}
+	}
+
+	return ur.GetUserByID(ctx, id)
+}
+
 // this function need authentication, and verify using id
 func (ur *PostgresUserRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	deleteString := `
@@ -244,3 +285,36 @@ func (ur *PostgresUserRepository) FollowArtist(ctx context.Context, user_id uuid
 	}
 	return nil
 }
+
+// catalogManagerConditions tell whether the user $1 manages an artist of the item $2,
+// the primary artists of a track and the artists of an album
+var catalogManagerConditions = map[model.TaxonomyTarget]string{
+	model.TaxonomyTrack: `exists (
+		select 1 from artists_tracks rx join artists ra on ra.id = rx.artist_id
+		where rx.track_id = $2 and rx.role = 'primary' and ra.user_id = $1
+	)`,
+	model.TaxonomyAlbum: `exists (
+		select 1 from artists_albums rx join artists ra on ra.id = rx.artist_id
+		where rx.album_id = $2 and ra.user_id = $1
+	)`,
+	model.TaxonomyArtist: "exists (select 1 from artists ra where ra.id = $2 and ra.user_id = $1)",
+}
+
+// CanEditCatalogItem reports whether the user is an admin or manages an artist of the catalog item.
+// An empty target is only editable by admins
+func (ur *PostgresUserRepository) CanEditCatalogItem(ctx context.Context, user_id uuid.UUID, target model.TaxonomyTarget, item_id uuid.UUID) (bool, error) {
+	condition, ok := catalogManagerConditions[target]
+	if !ok {
+		condition = "false"
+	}
+
+	var allowed bool
+	err := ur.dbpool.QueryRow(ctx, "select is_admin or "+condition+" from users where id = $1", user_id, item_id).Scan(&allowed)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, custom_error.NonExistUserError{}
+		}
+		return false, err
+	}
+	return allowed, nil
+}
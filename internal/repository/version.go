@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"flotify/internal/custom_error"
+	"flotify/internal/model"
+	"fmt"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// versionOrder lists the versions in the order the tracks of a work are shown
+var versionOrder = []model.TrackVersion{
+	model.VersionOriginal,
+	model.VersionRemaster,
+	model.VersionRadioEdit,
+	model.VersionLive,
+	model.VersionRemix,
+}
+
+// validVersion reports whether version is one of the known track versions
+func validVersion(version model.TrackVersion) bool {
+	for _, known := range versionOrder {
+		if version == known {
+			return true
+		}
+	}
+	return false
+}
+
+// relinkedTrack is the lateral subquery picking the version played in place of the track of alias: the track itself
+// unless it's taken down or not licensed in the market, otherwise another version of its work released to the viewer,
+// which must not be explicit when the viewer chose so. The same version is preferred, then the original.
+// It yields no row when no version can be played
+func relinkedTrack(alias string, viewer string, market string) string {
+	return fmt.Sprintf(`LATERAL (
+		SELECT v.* FROM tracks v
+		WHERE (v.id = %[1]s.id OR v.work_id = %[1]s.work_id) AND v.removed_at IS NULL AND %[2]s
+			AND (v.id = %[1]s.id OR (%[3]s AND %[4]s))
+		ORDER BY v.id <> %[1]s.id, v.version <> %[1]s.version, v.version <> 'original', v.id
+		LIMIT 1
+	)`, alias, fmt.Sprintf(availableIn("v"), market), fmt.Sprintf(explicitAllowed("v"), viewer), fmt.Sprintf(trackReleasedTo("v"), viewer))
+}
+
+// GetVersionsOfTrack returns the versions of the work of the track playable by the viewer in the market,
+// the track alone when it isn't linked to other versions
+func (tr *PostgresTrackRepository) GetVersionsOfTrack(ctx context.Context, track_id uuid.UUID, viewer_id uuid.UUID, market string) ([]model.Track, error) {
+	var exist bool
+	err := tr.dbpool.QueryRow(ctx, "SELECT true FROM tracks WHERE id = $1 AND removed_at IS NULL", track_id).Scan(&exist)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistTrackError{}
+		}
+		return nil, err
+	}
+
+	condition := "t.removed_at IS NULL AND " + fmt.Sprintf(explicitAllowed("t"), "$3") + " AND " + fmt.Sprintf(trackReleasedTo("t"), "$3") +
+		" AND " + fmt.Sprintf(availableIn("t"), "$4")
+	return versionsOf(ctx, tr.dbpool, condition, track_id, viewer_id, market)
+}
+
+// SetVersionsOfTrack links the tracks as the versions of the work of the track, creating the work when the track has none.
+// The track must be one of them, tracks of the work left out are unlinked and listed tracks leave their former work
+func (tr *PostgresTrackRepository) SetVersionsOfTrack(ctx context.Context, track_id uuid.UUID, versions []model.TrackOfWork) ([]model.Track, error) {
+	seen := map[uuid.UUID]bool{}
+	track_id_list := make([]uuid.UUID, len(versions))
+	version_list := make([]string, len(versions))
+	for i, version := range versions {
+		if !validVersion(version.Version) {
+			return nil, custom_error.InvalidVersionError{Reason: fmt.Sprintf("unknown version %q", version.Version)}
+		}
+		if seen[version.TrackID] {
+			return nil, custom_error.InvalidVersionError{Reason: fmt.Sprintf("track %s is listed twice", version.TrackID)}
+		}
+		seen[version.TrackID] = true
+
+		track_id_list[i] = version.TrackID
+		version_list[i] = string(version.Version)
+	}
+	if !seen[track_id] {
+		return nil, custom_error.InvalidVersionError{Reason: "the track must be one of its versions"}
+	}
+
+	tx, err := tr.dbpool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// lock the track so concurrent replacements don't interleave
+	var work_id *uuid.UUID
+	var name string
+	err = tx.QueryRow(ctx, "SELECT work_id, name FROM tracks WHERE id = $1 FOR UPDATE", track_id).Scan(&work_id, &name)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, custom_error.NonExistTrackError{}
+		}
+		return nil, err
+	}
+
+	var missing bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM unnest($1::uuid[]) AS x(track_id)
+			WHERE NOT EXISTS (SELECT 1 FROM tracks t WHERE t.id = x.track_id)
+		)
+	`, track_id_list).Scan(&missing)
+	if err != nil {
+		return nil, err
+	}
+	if missing {
+		return nil, custom_error.NonExistTrackError{}
+	}
+
+	if work_id == nil {
+		work_id = &uuid.UUID{}
+		if err = tx.QueryRow(ctx, "INSERT INTO works(name) VALUES ($1) RETURNING id", name).Scan(work_id); err != nil {
+			return nil, err
+		}
+	}
+
+	unlinkString := "UPDATE tracks SET work_id = NULL, version = 'original' WHERE work_id = $1 AND NOT id = ANY($2)"
+	if _, err = tx.Exec(ctx, unlinkString, *work_id, track_id_list); err != nil {
+		return nil, err
+	}
+	linkString := `
+		UPDATE tracks t SET work_id = $1, version = x.version
+		FROM unnest($2::uuid[], $3::text[]) AS x(track_id, version)
+		WHERE t.id = x.track_id
+	`
+	if _, err = tx.Exec(ctx, linkString, *work_id, track_id_list, version_list); err != nil {
+		return nil, err
+	}
+	// works whose tracks all moved away are gone
+	if _, err = tx.Exec(ctx, "DELETE FROM works w WHERE NOT EXISTS (SELECT 1 FROM tracks t WHERE t.work_id = w.id)"); err != nil {
+		return nil, err
+	}
+
+	result, err := versionsOf(ctx, tx, "TRUE", track_id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetTakedownOfTrack takes the track down or puts it back. A taken down track isn't found anymore,
+// the playlists and libraries holding it relink it to another version of its work
+func (tr *PostgresTrackRepository) SetTakedownOfTrack(ctx context.Context, track_id uuid.UUID, removed bool) error {
+	updateString := "UPDATE tracks SET removed_at = CASE WHEN $2 THEN COALESCE(removed_at, now()) END WHERE id = $1"
+	tag, err := tr.dbpool.Exec(ctx, updateString, track_id, removed)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return custom_error.NonExistTrackError{}
+	}
+	return nil
+}
+
+// versionsOf returns the tracks of the work of the track $1 satisfying condition in versionOrder,
+// the track alone when it has no work. The placeholders of condition start at $3
+func versionsOf(ctx context.Context, q querier, condition string, track_id uuid.UUID, args ...any) ([]model.Track, error) {
+	fetchString := `
+		SELECT t.id, t.name, t.length, t.explicit, t.release_date, t.work_id, t.version,
+			COALESCE(array_agg(at.artist_id ORDER BY at.role = 'featured', at.position) FILTER (WHERE at.artist_id IS NOT NULL), '{}') AS artist_id
+		FROM tracks o
+		JOIN tracks t ON t.id = o.id OR t.work_id = o.work_id
+		LEFT JOIN artists_tracks at ON at.track_id = t.id AND at.role IN ('primary', 'featured')
+		WHERE o.id = $1 AND ` + condition + `
+		GROUP BY t.id
+		ORDER BY array_position($2::text[], t.version), t.release_date NULLS FIRST, t.id
+	`
+	order := make([]string, len(versionOrder))
+	for i, version := range versionOrder {
+		order[i] = string(version)
+	}
+	rows, err := q.Query(ctx, fetchString, append([]any{track_id, order}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Track, error) {
+		track := model.Track{}
+		err := row.Scan(&track.ID, &track.Name, &track.Length, &track.Explicit, &track.ReleaseDate, &track.WorkID, &track.Version, &track.ArtistID)
+		return track, err
+	})
+}
@@ -0,0 +1,5 @@
+package response
+
+type DeletePlaylistResponse struct {
+	Response string
+}
@@ -1,5 +1,13 @@
 package response
 
+import "time"
+
 type DeleteTrackResponse struct {
 	Response string
 }
+
+// StreamURLResponse is a url streaming a track without the Authorization header until ExpiresAt
+type StreamURLResponse struct {
+	URL       string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"flotify/internal/custom_error"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage keeps objects as files under a directory of the server
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{
+		root: root,
+	}
+}
+
+func (ls *LocalStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	file_path, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(file_path), 0o755); err != nil {
+		return err
+	}
+
+	// write next to the destination first so readers never see a partial object
+	temp_file, err := os.CreateTemp(filepath.Dir(file_path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp_file.Name())
+
+	if _, err = io.Copy(temp_file, contextReader{ctx: ctx, r: r}); err != nil {
+		temp_file.Close()
+		return err
+	}
+	if err = temp_file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp_file.Name(), file_path)
+}
+
+func (ls *LocalStorage) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	file_path, err := ls.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(file_path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, custom_error.NonExistObjectError{}
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+func (ls *LocalStorage) Delete(ctx context.Context, key string) error {
+	file_path, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(file_path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path maps a key to a file under root, keys escaping root are rejected
+func (ls *LocalStorage) path(key string) (string, error) {
+	clean_key := path.Clean("/" + key)[1:]
+	if clean_key == "" || clean_key != strings.TrimPrefix(key, "/") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(ls.root, filepath.FromSlash(clean_key)), nil
+}
+
+// contextReader stops a copy once the request is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
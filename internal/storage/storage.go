@@ -0,0 +1,17 @@
+// Package storage keeps uploaded files such as artwork and audio outside of the database
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// Storage stores objects under slash separated keys like "playlists/<id>/cover.jpg"
+type Storage interface {
+	// Put replaces the object stored under key with the content of r
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open returns the object stored under key, custom_error.NonExistObjectError when there is none
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete removes the object, deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+}
@@ -1,24 +1,36 @@
 package middleware
 
 import (
+	"context"
 	"errors"
 	"flotify/internal/auth"
+	"flotify/internal/custom_error"
 	"flotify/internal/helper"
+	"flotify/internal/model"
+	"flotify/internal/repository"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gofrs/uuid/v5"
 )
 
+const (
+	// UserIDKey is the key under which the id of the authenticated user is stored in gin context
+	UserIDKey = "user_id"
+	// PlaylistRoleKey is the key under which the role of the user in the requested playlist is stored
+	PlaylistRoleKey = "playlist_role"
+)
+
 func AuthRequest(auth_manager auth.AuthManager) gin.HandlerFunc {
 
 	return func(c *gin.Context) {
-		token_string := c.Request.Header.Get("Authorization")
-		if token_string == "" {
-			err := errors.New("token nonexist")
+		token, err := bearerToken(c)
+		if err != nil {
 			helper.ErrorResponse(c, err, http.StatusUnauthorized)
+			return
 		}
-		token := token_string[len("Bearer "):]
 
 		id_string_form := c.Params.ByName("id")
 		id, err := uuid.FromString(id_string_form)
@@ -32,6 +44,226 @@ func AuthRequest(auth_manager auth.AuthManager) gin.HandlerFunc {
 			return
 		}
 
+		c.Set(UserIDKey, id)
+		c.Next()
+	}
+}
+
+// Authenticate only requires a valid access token, the id inside it is stored in gin context
+func Authenticate(auth_manager auth.AuthManager) gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		token, err := bearerToken(c)
+		if err != nil {
+			helper.ErrorResponse(c, err, http.StatusUnauthorized)
+			return
+		}
+
+		id, err := auth_manager.ParseJWT(token)
+		if err != nil {
+			helper.ErrorResponse(c, err, http.StatusUnauthorized)
+			return
+		}
+
+		c.Set(UserIDKey, id)
+		c.Next()
+	}
+}
+
+// AuthenticateMedia is Authenticate for urls handed to audio elements and players, which can't set headers.
+// Instead of the access token they may carry a stream token of track :id as the token query parameter,
+// it expires soon and only opens that track so it's harmless in access logs
+func AuthenticateMedia(auth_manager auth.AuthManager) gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		if stream_token := c.Query("token"); stream_token != "" {
+			track_id, err := uuid.FromString(c.Params.ByName("id"))
+			if err != nil {
+				helper.ErrorResponse(c, err, http.StatusBadRequest)
+				return
+			}
+
+			id, err := auth_manager.ParseStreamToken(stream_token, track_id)
+			if err != nil {
+				helper.ErrorResponse(c, err, http.StatusUnauthorized)
+				return
+			}
+
+			c.Set(UserIDKey, id)
+			c.Next()
+			return
+		}
+
+		token, err := bearerToken(c)
+		if err != nil {
+			helper.ErrorResponse(c, err, http.StatusUnauthorized)
+			return
+		}
+
+		id, err := auth_manager.ParseJWT(token)
+		if err != nil {
+			helper.ErrorResponse(c, err, http.StatusUnauthorized)
+			return
+		}
+
+		c.Set(UserIDKey, id)
+		c.Next()
+	}
+}
+
+// OptionalAuthenticate stores the id of the caller when an access token is sent, anonymous requests pass through
+func OptionalAuthenticate(auth_manager auth.AuthManager) gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		id, err := optionalUserID(c, auth_manager)
+		if err != nil {
+			helper.ErrorResponse(c, err, http.StatusUnauthorized)
+			return
+		}
+
+		if id != uuid.Nil {
+			c.Set(UserIDKey, id)
+		}
+		c.Next()
+	}
+}
+
+// AuthPlaylistRole requires the authenticated user to have one of the given roles in playlist :id
+func AuthPlaylistRole(auth_manager auth.AuthManager, playlist_repo repository.PlaylistRepository, roles ...model.PlaylistRole) gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		token, err := bearerToken(c)
+		if err != nil {
+			helper.ErrorResponse(c, err, http.StatusUnauthorized)
+			return
+		}
+
+		user_id, err := auth_manager.ParseJWT(token)
+		if err != nil {
+			helper.ErrorResponse(c, err, http.StatusUnauthorized)
+			return
+		}
+
+		playlist_id, err := uuid.FromString(c.Params.ByName("id"))
+		if err != nil {
+			helper.ErrorResponse(c, err, http.StatusBadRequest)
+			return
+		}
+
+		role, err := playlist_repo.GetRoleOfUser(context.Background(), playlist_id, user_id)
+		if err != nil {
+			switch err := err.(type) {
+			case custom_error.NonExistPlaylistError:
+				helper.ErrorResponse(c, err, http.StatusNotFound)
+				return
+			default:
+				helper.ErrorResponse(c, err, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if !slices.Contains(roles, role) {
+			helper.ErrorResponse(c, custom_error.PlaylistPermissionError{}, http.StatusForbidden)
+			return
+		}
+
+		c.Set(UserIDKey, user_id)
+		c.Set(PlaylistRoleKey, role)
+		c.Next()
+	}
+}
+
+// AuthPlaylistView lets a request through when playlist :id is visible to the caller.
+// The access token is optional, private playlists are reported as missing to anyone without a role
+func AuthPlaylistView(auth_manager auth.AuthManager, playlist_repo repository.PlaylistRepository) gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		user_id, err := optionalUserID(c, auth_manager)
+		if err != nil {
+			helper.ErrorResponse(c, err, http.StatusUnauthorized)
+			return
+		}
+
+		playlist_id, err := uuid.FromString(c.Params.ByName("id"))
+		if err != nil {
+			helper.ErrorResponse(c, err, http.StatusBadRequest)
+			return
+		}
+
+		visibility, err := playlist_repo.GetVisibilityOfPlaylist(context.Background(), playlist_id)
+		if err != nil {
+			switch err := err.(type) {
+			case custom_error.NonExistPlaylistError:
+				helper.ErrorResponse(c, err, http.StatusNotFound)
+				return
+			default:
+				helper.ErrorResponse(c, err, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		var role model.PlaylistRole
+		if user_id != uuid.Nil {
+			role, err = playlist_repo.GetRoleOfUser(context.Background(), playlist_id, user_id)
+			if err != nil {
+				helper.ErrorResponse(c, err, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if visibility == model.PlaylistPrivate && role == "" {
+			helper.ErrorResponse(c, custom_error.NonExistPlaylistError{}, http.StatusNotFound)
+			return
+		}
+
+		if user_id != uuid.Nil {
+			c.Set(UserIDKey, user_id)
+		}
+		c.Set(PlaylistRoleKey, role)
 		c.Next()
 	}
 }
+
+// GetUserID returns the id stored by one of the authentication middlewares
+func GetUserID(c *gin.Context) uuid.UUID {
+	value, ok := c.Get(UserIDKey)
+	if !ok {
+		return uuid.Nil
+	}
+	id, _ := value.(uuid.UUID)
+	return id
+}
+
+// GetPlaylistRole returns the role stored by AuthPlaylistRole
+func GetPlaylistRole(c *gin.Context) model.PlaylistRole {
+	value, ok := c.Get(PlaylistRoleKey)
+	if !ok {
+		return ""
+	}
+	role, _ := value.(model.PlaylistRole)
+	return role
+}
+
+// optionalUserID returns the id of the caller if an access token is sent, uuid.Nil otherwise
+func optionalUserID(c *gin.Context, auth_manager auth.AuthManager) (uuid.UUID, error) {
+	if id := GetUserID(c); id != uuid.Nil {
+		return id, nil
+	}
+	if c.Request.Header.Get("Authorization") == "" {
+		return uuid.Nil, nil
+	}
+
+	token, err := bearerToken(c)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return auth_manager.ParseJWT(token)
+}
+
+func bearerToken(c *gin.Context) (string, error) {
+	token_string := c.Request.Header.Get("Authorization")
+	if !strings.HasPrefix(token_string, "Bearer ") {
+		return "", errors.New("token nonexist")
+	}
+	return token_string[len("Bearer "):], nil
+}
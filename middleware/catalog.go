@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"flotify/internal/auth"
+	"flotify/internal/custom_error"
+	"flotify/internal/helper"
+	"flotify/internal/model"
+	"flotify/internal/repository"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid/v5"
+)
+
+// AuthCatalogEditor requires the authenticated user to be an admin or to manage an artist of the catalog item :id
+// of the target, see repository.UserRepository.CanEditCatalogItem
+func AuthCatalogEditor(auth_manager auth.AuthManager, user_repo repository.UserRepository, target model.TaxonomyTarget) gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		item_id, err := uuid.FromString(c.Params.ByName("id"))
+		if err != nil {
+			helper.ErrorResponse(c, err, http.StatusBadRequest)
+			return
+		}
+
+		authorizeCatalogEdit(c, auth_manager, user_repo, target, item_id)
+	}
+}
+
+// AuthAdmin requires the authenticated user to be an admin
+func AuthAdmin(auth_manager auth.AuthManager, user_repo repository.UserRepository) gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		authorizeCatalogEdit(c, auth_manager, user_repo, "", uuid.Nil)
+	}
+}
+
+func authorizeCatalogEdit(c *gin.Context, auth_manager auth.AuthManager, user_repo repository.UserRepository, target model.TaxonomyTarget, item_id uuid.UUID) {
+	token, err := bearerToken(c)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusUnauthorized)
+		return
+	}
+
+	user_id, err := auth_manager.ParseJWT(token)
+	if err != nil {
+		helper.ErrorResponse(c, err, http.StatusUnauthorized)
+		return
+	}
+
+	allowed, err := user_repo.CanEditCatalogItem(context.Background(), user_id, target, item_id)
+	if err != nil {
+		switch err := err.(type) {
+		case custom_error.NonExistUserError:
+			helper.ErrorResponse(c, err, http.StatusUnauthorized)
+			return
+		default:
+			helper.ErrorResponse(c, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if !allowed {
+		helper.ErrorResponse(c, custom_error.CatalogPermissionError{}, http.StatusForbidden)
+		return
+	}
+
+	c.Set(UserIDKey, user_id)
+	c.Next()
+}
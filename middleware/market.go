@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"flotify/internal/custom_error"
+	"flotify/internal/helper"
+	"flotify/internal/repository"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid/v5"
+)
+
+// MarketKey is the key under which the market of the caller is stored in gin context
+const MarketKey = "market"
+
+// Market stores the market of the caller: the country of the authenticated user, otherwise the market query parameter,
+// otherwise default_market. It runs after the authentication middlewares, callers whose market is still unknown
+// get repository.UnknownMarket and only see the items licensed everywhere
+func Market(user_repo repository.UserRepository, default_market string) gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		if user_id := GetUserID(c); user_id != uuid.Nil {
+			user, err := user_repo.GetUserByID(context.Background(), user_id)
+			if err != nil {
+				if _, ok := err.(custom_error.NonExistUserError); !ok {
+					helper.ErrorResponse(c, err, http.StatusInternalServerError)
+					return
+				}
+			} else if user.Country != "" {
+				// the country of the profile wins over the query parameter so a user gets the same catalog on every client
+				c.Set(MarketKey, user.Country)
+				c.Next()
+				return
+			}
+		}
+
+		market := default_market
+		if market_string_form := c.Query("market"); market_string_form != "" {
+			var err error
+			market, err = repository.NormalizeMarket(market_string_form)
+			if err != nil {
+				helper.ErrorResponse(c, err, http.StatusBadRequest)
+				return
+			}
+		}
+		if market == "" {
+			market = repository.UnknownMarket
+		}
+		c.Set(MarketKey, market)
+		c.Next()
+	}
+}
+
+// GetMarket returns the market stored by Market, empty on routes without it
+func GetMarket(c *gin.Context) string {
+	value, ok := c.Get(MarketKey)
+	if !ok {
+		return ""
+	}
+	market, _ := value.(string)
+	return market
+}
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS playlists (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name text NOT NULL,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS playlists_user_id_idx ON playlists(user_id);
+
+CREATE TABLE IF NOT EXISTS playlists_tracks (
+    playlist_id uuid NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+    track_id uuid NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    PRIMARY KEY (playlist_id, track_id)
+);
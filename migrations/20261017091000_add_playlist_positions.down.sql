@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS playlists_tracks_track_id_idx;
+
+ALTER TABLE playlists_tracks DROP CONSTRAINT playlists_tracks_pkey;
+
+DELETE FROM playlists_tracks pt
+USING playlists_tracks dup
+WHERE pt.playlist_id = dup.playlist_id AND pt.track_id = dup.track_id AND pt.position > dup.position;
+
+ALTER TABLE playlists_tracks ADD PRIMARY KEY (playlist_id, track_id);
+ALTER TABLE playlists_tracks DROP COLUMN position;
+
+ALTER TABLE playlists DROP COLUMN snapshot_id;
@@ -0,0 +1,19 @@
+ALTER TABLE playlists ADD COLUMN snapshot_id uuid NOT NULL DEFAULT gen_random_uuid();
+
+ALTER TABLE playlists_tracks ADD COLUMN position integer;
+
+UPDATE playlists_tracks pt SET position = ordered.position
+FROM (
+    SELECT playlist_id, track_id,
+        row_number() OVER (PARTITION BY playlist_id ORDER BY track_id) - 1 AS position
+    FROM playlists_tracks
+) ordered
+WHERE pt.playlist_id = ordered.playlist_id AND pt.track_id = ordered.track_id;
+
+ALTER TABLE playlists_tracks ALTER COLUMN position SET NOT NULL;
+
+-- the same track may now appear several times, a row is identified by its position
+ALTER TABLE playlists_tracks DROP CONSTRAINT playlists_tracks_pkey;
+ALTER TABLE playlists_tracks ADD PRIMARY KEY (playlist_id, position);
+
+CREATE INDEX playlists_tracks_track_id_idx ON playlists_tracks(track_id);
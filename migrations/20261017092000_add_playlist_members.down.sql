@@ -0,0 +1,5 @@
+ALTER TABLE playlists_tracks
+    DROP COLUMN added_at,
+    DROP COLUMN added_by;
+
+DROP TABLE IF EXISTS playlists_members;
@@ -0,0 +1,17 @@
+CREATE TABLE playlists_members (
+    playlist_id uuid NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role text NOT NULL CHECK (role IN ('editor', 'viewer')),
+    added_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (playlist_id, user_id)
+);
+
+CREATE INDEX playlists_members_user_id_idx ON playlists_members(user_id);
+
+ALTER TABLE playlists_tracks
+    ADD COLUMN added_by uuid REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN added_at timestamptz NOT NULL DEFAULT now();
+
+UPDATE playlists_tracks pt SET added_by = p.user_id
+FROM playlists p
+WHERE p.id = pt.playlist_id;
@@ -0,0 +1,27 @@
+CREATE TABLE playlists_versions (
+    snapshot_id uuid PRIMARY KEY,
+    playlist_id uuid NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+    action text NOT NULL,
+    user_id uuid REFERENCES users(id) ON DELETE SET NULL,
+    name text NOT NULL,
+    tracks jsonb NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX playlists_versions_playlist_id_idx ON playlists_versions(playlist_id, created_at DESC);
+
+-- the current state of existing playlists becomes their first version
+INSERT INTO playlists_versions(snapshot_id, playlist_id, action, user_id, name, tracks)
+SELECT p.snapshot_id, p.id, 'create', p.user_id, p.name,
+    COALESCE(
+        (
+            SELECT jsonb_agg(
+                jsonb_build_object('track_id', pt.track_id, 'added_by', pt.added_by, 'added_at', pt.added_at)
+                ORDER BY pt.position
+            )
+            FROM playlists_tracks pt
+            WHERE pt.playlist_id = p.id
+        ),
+        '[]'::jsonb
+    )
+FROM playlists p;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS playlists_followers;
+
+ALTER TABLE playlists DROP COLUMN visibility;
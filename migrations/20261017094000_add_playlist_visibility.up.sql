@@ -0,0 +1,11 @@
+ALTER TABLE playlists
+    ADD COLUMN visibility text NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'unlisted', 'private'));
+
+CREATE TABLE playlists_followers (
+    playlist_id uuid NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followed_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (playlist_id, user_id)
+);
+
+CREATE INDEX playlists_followers_user_id_idx ON playlists_followers(user_id);
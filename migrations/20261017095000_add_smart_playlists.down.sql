@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS tracks_created_at_idx;
+
+ALTER TABLE tracks DROP COLUMN created_at;
+
+ALTER TABLE playlists
+    DROP COLUMN refreshed_at,
+    DROP COLUMN rules;
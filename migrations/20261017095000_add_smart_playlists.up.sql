@@ -0,0 +1,8 @@
+ALTER TABLE playlists
+    ADD COLUMN rules jsonb,
+    ADD COLUMN refreshed_at timestamptz;
+
+ALTER TABLE tracks
+    ADD COLUMN created_at timestamptz NOT NULL DEFAULT now();
+
+CREATE INDEX tracks_created_at_idx ON tracks(created_at);
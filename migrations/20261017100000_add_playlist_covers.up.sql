@@ -0,0 +1 @@
+ALTER TABLE playlists ADD COLUMN cover_key text;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS library_playlists;
+DROP TABLE IF EXISTS folders;
@@ -0,0 +1,19 @@
+CREATE TABLE folders (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name text NOT NULL,
+    parent_id uuid REFERENCES folders(id) ON DELETE CASCADE,
+    position integer NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX folders_user_id_idx ON folders(user_id);
+
+-- place of a playlist in the library of a user, playlists without a row sit at the root after the placed items
+CREATE TABLE library_playlists (
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    playlist_id uuid NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+    folder_id uuid REFERENCES folders(id) ON DELETE SET NULL,
+    position integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, playlist_id)
+);
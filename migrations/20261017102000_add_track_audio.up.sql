@@ -0,0 +1,11 @@
+-- audio file uploaded for a track, the file itself lives in the storage under storage_key
+CREATE TABLE tracks_audio (
+    track_id uuid PRIMARY KEY REFERENCES tracks(id) ON DELETE CASCADE,
+    storage_key text NOT NULL,
+    format text NOT NULL,
+    codec text NOT NULL,
+    size bigint NOT NULL,
+    bitrate integer NOT NULL DEFAULT 0,
+    checksum text NOT NULL,
+    uploaded_at timestamptz NOT NULL DEFAULT now()
+);
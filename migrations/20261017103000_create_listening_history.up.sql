@@ -0,0 +1,9 @@
+-- one row each time a user starts streaming a track, seeking inside the stream doesn't add rows
+CREATE TABLE listening_history (
+    id bigserial PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    track_id uuid NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    started_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX listening_history_user_id_started_at_idx ON listening_history(user_id, started_at DESC);
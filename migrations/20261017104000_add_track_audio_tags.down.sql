@@ -0,0 +1,4 @@
+ALTER TABLE tracks_audio
+    DROP COLUMN duration_ms,
+    DROP COLUMN tags,
+    DROP COLUMN artwork_key;
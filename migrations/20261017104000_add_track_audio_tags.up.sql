@@ -0,0 +1,4 @@
+ALTER TABLE tracks_audio
+    ADD COLUMN duration_ms integer NOT NULL DEFAULT 0,
+    ADD COLUMN tags jsonb,
+    ADD COLUMN artwork_key text;
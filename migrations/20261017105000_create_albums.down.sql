@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS albums_tracks;
+DROP TABLE IF EXISTS artists_albums;
+DROP TABLE IF EXISTS albums;
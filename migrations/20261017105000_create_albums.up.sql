@@ -0,0 +1,30 @@
+CREATE TABLE albums (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    title text NOT NULL,
+    type text NOT NULL DEFAULT 'album',
+    release_date date,
+    label text NOT NULL DEFAULT '',
+    cover_key text,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE artists_albums (
+    artist_id uuid NOT NULL REFERENCES artists(id) ON DELETE CASCADE,
+    album_id uuid NOT NULL REFERENCES albums(id) ON DELETE CASCADE,
+    position integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (artist_id, album_id)
+);
+
+CREATE INDEX artists_albums_album_id_idx ON artists_albums(album_id);
+
+-- the same track can appear on several albums, a compilation and the original release for example
+CREATE TABLE albums_tracks (
+    album_id uuid NOT NULL REFERENCES albums(id) ON DELETE CASCADE,
+    track_id uuid NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    disc_number integer NOT NULL DEFAULT 1,
+    track_number integer NOT NULL,
+    PRIMARY KEY (album_id, track_id),
+    UNIQUE (album_id, disc_number, track_number)
+);
+
+CREATE INDEX albums_tracks_track_id_idx ON albums_tracks(track_id);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS artists_tags;
+DROP TABLE IF EXISTS albums_tags;
+DROP TABLE IF EXISTS tracks_tags;
+DROP TABLE IF EXISTS artists_genres;
+DROP TABLE IF EXISTS albums_genres;
+DROP TABLE IF EXISTS tracks_genres;
+DROP TABLE IF EXISTS genres;
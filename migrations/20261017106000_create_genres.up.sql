@@ -0,0 +1,54 @@
+CREATE TABLE genres (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name text NOT NULL,
+    slug text NOT NULL UNIQUE,
+    parent_id uuid REFERENCES genres(id) ON DELETE SET NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX genres_parent_id_idx ON genres(parent_id);
+
+CREATE TABLE tracks_genres (
+    track_id uuid NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    genre_id uuid NOT NULL REFERENCES genres(id) ON DELETE CASCADE,
+    PRIMARY KEY (track_id, genre_id)
+);
+
+CREATE TABLE albums_genres (
+    album_id uuid NOT NULL REFERENCES albums(id) ON DELETE CASCADE,
+    genre_id uuid NOT NULL REFERENCES genres(id) ON DELETE CASCADE,
+    PRIMARY KEY (album_id, genre_id)
+);
+
+CREATE TABLE artists_genres (
+    artist_id uuid NOT NULL REFERENCES artists(id) ON DELETE CASCADE,
+    genre_id uuid NOT NULL REFERENCES genres(id) ON DELETE CASCADE,
+    PRIMARY KEY (artist_id, genre_id)
+);
+
+CREATE INDEX tracks_genres_genre_id_idx ON tracks_genres(genre_id);
+CREATE INDEX albums_genres_genre_id_idx ON albums_genres(genre_id);
+CREATE INDEX artists_genres_genre_id_idx ON artists_genres(genre_id);
+
+-- free-form tags, stored lower case
+CREATE TABLE tracks_tags (
+    track_id uuid NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    tag text NOT NULL,
+    PRIMARY KEY (track_id, tag)
+);
+
+CREATE TABLE albums_tags (
+    album_id uuid NOT NULL REFERENCES albums(id) ON DELETE CASCADE,
+    tag text NOT NULL,
+    PRIMARY KEY (album_id, tag)
+);
+
+CREATE TABLE artists_tags (
+    artist_id uuid NOT NULL REFERENCES artists(id) ON DELETE CASCADE,
+    tag text NOT NULL,
+    PRIMARY KEY (artist_id, tag)
+);
+
+CREATE INDEX tracks_tags_tag_idx ON tracks_tags(tag);
+CREATE INDEX albums_tags_tag_idx ON albums_tags(tag);
+CREATE INDEX artists_tags_tag_idx ON artists_tags(tag);
@@ -0,0 +1,3 @@
+ALTER TABLE artists DROP COLUMN IF EXISTS mbid;
+ALTER TABLE albums DROP COLUMN IF EXISTS upc;
+ALTER TABLE tracks DROP COLUMN IF EXISTS isrc;
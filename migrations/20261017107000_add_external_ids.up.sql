@@ -0,0 +1,5 @@
+-- external identifiers shared with labels and MusicBrainz, each one names a single item of the catalog:
+-- ISRC for tracks, UPC for albums and MusicBrainz ids (MBID) for artists
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS isrc text UNIQUE;
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS upc text UNIQUE;
+ALTER TABLE artists ADD COLUMN IF NOT EXISTS mbid uuid UNIQUE;
@@ -0,0 +1,11 @@
+-- lyrics of a track, text joins the lines for searching and lines keeps their timing
+CREATE TABLE tracks_lyrics (
+    track_id uuid PRIMARY KEY REFERENCES tracks(id) ON DELETE CASCADE,
+    synced boolean NOT NULL DEFAULT false,
+    language text NOT NULL DEFAULT '',
+    text text NOT NULL,
+    lines jsonb NOT NULL,
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX tracks_lyrics_text_idx ON tracks_lyrics USING gin (to_tsvector('simple', text));
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS hide_explicit;
+ALTER TABLE tracks DROP COLUMN IF EXISTS explicit;
@@ -0,0 +1,3 @@
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS explicit boolean NOT NULL DEFAULT false;
+-- users who hide explicit content don't get explicit tracks in listings
+ALTER TABLE users ADD COLUMN IF NOT EXISTS hide_explicit boolean NOT NULL DEFAULT false;
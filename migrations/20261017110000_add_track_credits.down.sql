@@ -0,0 +1,9 @@
+DELETE FROM artists_tracks WHERE role NOT IN ('primary', 'featured');
+DELETE FROM artists_tracks f USING artists_tracks p
+WHERE f.track_id = p.track_id AND f.artist_id = p.artist_id AND f.role = 'featured' AND p.role = 'primary';
+
+DROP INDEX IF EXISTS artists_tracks_artist_role_idx;
+ALTER TABLE artists_tracks DROP CONSTRAINT IF EXISTS artists_tracks_pkey;
+ALTER TABLE artists_tracks ADD PRIMARY KEY (artist_id, track_id);
+ALTER TABLE artists_tracks DROP COLUMN IF EXISTS position;
+ALTER TABLE artists_tracks DROP COLUMN IF EXISTS role;
@@ -0,0 +1,17 @@
+-- artists are credited on tracks with a role, primary and featured artists are the artists of the track
+ALTER TABLE artists_tracks ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT 'primary'
+    CHECK (role IN ('primary', 'featured', 'composer', 'lyricist', 'producer', 'remixer'));
+-- position orders the artists sharing a role on a track
+ALTER TABLE artists_tracks ADD COLUMN IF NOT EXISTS position integer NOT NULL DEFAULT 0;
+
+UPDATE artists_tracks x SET position = numbered.position
+FROM (
+    SELECT track_id, artist_id, row_number() OVER (PARTITION BY track_id ORDER BY artist_id) - 1 AS position
+    FROM artists_tracks
+) numbered
+WHERE x.track_id = numbered.track_id AND x.artist_id = numbered.artist_id;
+
+-- an artist can hold several roles on the same track
+ALTER TABLE artists_tracks DROP CONSTRAINT IF EXISTS artists_tracks_pkey;
+ALTER TABLE artists_tracks ADD PRIMARY KEY (track_id, artist_id, role);
+CREATE INDEX IF NOT EXISTS artists_tracks_artist_role_idx ON artists_tracks (artist_id, role);
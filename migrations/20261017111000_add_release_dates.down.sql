@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS saved_albums;
+DROP TABLE IF EXISTS saved_tracks;
+
+DROP INDEX IF EXISTS artists_user_id_idx;
+ALTER TABLE artists DROP COLUMN IF EXISTS user_id;
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
+
+ALTER TABLE albums ALTER COLUMN release_date TYPE date USING (release_date AT TIME ZONE 'UTC')::date;
+ALTER TABLE tracks DROP COLUMN IF EXISTS release_date;
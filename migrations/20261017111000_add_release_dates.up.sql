@@ -0,0 +1,25 @@
+-- tracks and albums with a release date in the future are hidden until then,
+-- except from admins and the accounts managing their artists
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS release_date timestamptz;
+ALTER TABLE albums ALTER COLUMN release_date TYPE timestamptz USING release_date::timestamp AT TIME ZONE 'UTC';
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin boolean NOT NULL DEFAULT false;
+-- account of the artist, it sees the releases of the artist before they go live
+ALTER TABLE artists ADD COLUMN IF NOT EXISTS user_id uuid REFERENCES users(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS artists_user_id_idx ON artists(user_id);
+
+-- tracks and albums saved to the library of a user, saved before their release they are pre-saves
+-- and join the library when they go live
+CREATE TABLE saved_tracks (
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    track_id uuid NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    saved_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, track_id)
+);
+
+CREATE TABLE saved_albums (
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    album_id uuid NOT NULL REFERENCES albums(id) ON DELETE CASCADE,
+    saved_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, album_id)
+);
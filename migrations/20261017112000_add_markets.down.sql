@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS country;
+ALTER TABLE albums DROP COLUMN IF EXISTS markets;
+ALTER TABLE tracks DROP COLUMN IF EXISTS markets;
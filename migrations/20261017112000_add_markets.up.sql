@@ -0,0 +1,5 @@
+-- ISO 3166-1 alpha-2 countries the item is licensed in, available everywhere when NULL
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS markets text[];
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS markets text[];
+-- country of the user, the market of their requests without a market parameter
+ALTER TABLE users ADD COLUMN IF NOT EXISTS country text NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS tracks_work_id_idx;
+
+ALTER TABLE tracks DROP COLUMN IF EXISTS removed_at;
+ALTER TABLE tracks DROP COLUMN IF EXISTS version;
+ALTER TABLE tracks DROP COLUMN IF EXISTS work_id;
+
+DROP TABLE IF EXISTS works;
@@ -0,0 +1,14 @@
+-- a work groups the versions of a recording: the original, its remasters, live recordings, remixes and edits
+CREATE TABLE works (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS work_id uuid REFERENCES works(id) ON DELETE SET NULL;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS version text NOT NULL DEFAULT 'original'
+    CHECK (version IN ('original', 'remaster', 'live', 'remix', 'radio_edit'));
+-- a taken down track stays in the playlists and libraries holding it, which relink it to another version
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS removed_at timestamptz;
+
+CREATE INDEX tracks_work_id_idx ON tracks(work_id);
@@ -0,0 +1,2 @@
+ALTER TABLE tracks_audio DROP COLUMN IF EXISTS loudness_histogram;
+ALTER TABLE tracks_audio DROP COLUMN IF EXISTS loudness;
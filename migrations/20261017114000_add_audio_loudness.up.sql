@@ -0,0 +1,4 @@
+-- loudness of WAV and FLAC uploads, NULL for the other formats and for silent files.
+-- The histogram counts the 400 ms blocks by loudness in 0.1 LU steps from -70 LUFS, albums are gated from their sum
+ALTER TABLE tracks_audio ADD COLUMN IF NOT EXISTS loudness jsonb;
+ALTER TABLE tracks_audio ADD COLUMN IF NOT EXISTS loudness_histogram integer[];
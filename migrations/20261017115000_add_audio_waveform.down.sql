@@ -0,0 +1 @@
+ALTER TABLE tracks_audio DROP COLUMN IF EXISTS waveform;
@@ -0,0 +1,2 @@
+-- peak waveform of WAV and FLAC uploads as [min, max] pairs, NULL for the other formats
+ALTER TABLE tracks_audio ADD COLUMN IF NOT EXISTS waveform jsonb;
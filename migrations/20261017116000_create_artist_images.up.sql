@@ -0,0 +1,8 @@
+-- the avatar and banner of an artist are stored resized to a few widths, under artists/<id>/<kind>_<width>.jpg
+CREATE TABLE artists_images (
+    artist_id uuid NOT NULL REFERENCES artists(id) ON DELETE CASCADE,
+    kind text NOT NULL CHECK (kind IN ('avatar', 'banner')),
+    width integer NOT NULL,
+    height integer NOT NULL,
+    PRIMARY KEY (artist_id, kind, width)
+);